@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/config"
+	"github.com/blockopsnetwork/telescope/internal/static/doctor"
+	"github.com/blockopsnetwork/telescope/internal/static/integrations/ethereum"
+	"github.com/blockopsnetwork/telescope/internal/static/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Run preflight checks without starting collection",
+	Long: `Doctor loads the same flags or config file as the agent and checks that
+everything the agent depends on is usable: scrape targets serve metrics,
+chain client APIs respond on the same chain, the Docker socket is readable,
+the WAL and positions directories are writable, and the remote_write and Loki
+endpoints accept the configured credentials.
+
+Doctor exits with a non-zero status if any check fails.`,
+	Example: `  telescope doctor --config-file=telescope_config.yaml --enable-features integrations-next
+
+  telescope doctor --network=ethereum --project-id=my-project --project-name=my-project \
+            --telescope-username=user --telescope-password=pass \
+            --remote-write-url=https://prometheus.example.com/api/v1/write`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runDoctor,
+}
+
+func init() {
+	// The agent flags are shared with the root command in main.go's init.
+	doctorCmd.Flags().Duration("check-timeout", doctor.DefaultCheckTimeout, "Maximum time a single check may take")
+	cmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, _ []string) error {
+	defaultCfg := server.DefaultConfig()
+	defaultCfg.LogLevel.Set("warn")
+	logger := server.NewLogger(&defaultCfg)
+
+	var (
+		report          doctor.Report
+		checkTimeout    = doctor.DefaultCheckTimeout
+		configFile      = viper.GetString("config-file")
+		configTarget    = configFile
+		enabledFeatures = strings.Split(viper.GetString("enable-features"), ",")
+	)
+	if d, err := cmd.Flags().GetDuration("check-timeout"); err == nil && d > 0 {
+		checkTimeout = d
+	}
+
+	if configFile == "" {
+		// Generate the config from flags the same way the agent does, without
+		// overwriting the telescope_config.yaml of a running agent.
+		var tc TelescopeConfig
+		if err := tc.loadConfig(); err != nil {
+			report.Add(doctor.Result{
+				Check:  "flags",
+				Status: doctor.StatusFail,
+				Detail: err.Error(),
+				Hint:   "see telescope --help for the required flags",
+			})
+			return writeDoctorReport(&report)
+		}
+
+		f, err := os.CreateTemp("", "telescope-doctor-*.yaml")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+
+		scrapeConfigs := generateScrapeConfigs(tc, getNetworkConfig(tc.Network))
+		if err := writeConfigToFile(generateFullConfig(tc, scrapeConfigs), f.Name()); err != nil {
+			return err
+		}
+		configFile = f.Name()
+		configTarget = "generated from flags"
+	} else if err := validateConfigFile(configFile); err != nil {
+		report.Add(doctor.Result{
+			Check:  "config file",
+			Target: configFile,
+			Status: doctor.StatusFail,
+			Detail: err.Error(),
+			Hint:   "set --config-file to the path of an existing config file",
+		})
+		return writeDoctorReport(&report)
+	}
+
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	report.Add(doctor.CheckFeatures(raw, enabledFeatures)...)
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	cfg, err := loadAgentConfig(fs, configFile, logger)
+	if err != nil {
+		report.Add(doctor.Result{
+			Check:  "config file",
+			Target: configTarget,
+			Status: doctor.StatusFail,
+			Detail: err.Error(),
+			Hint:   "fix the reported error in the config file",
+		})
+		return writeDoctorReport(&report)
+	}
+	report.Add(doctor.Result{
+		Check:  "config file",
+		Target: configTarget,
+		Status: doctor.StatusPass,
+		Detail: "loaded",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	res := doctor.Run(ctx, doctor.Options{
+		Config:       cfg,
+		Nodes:        chainNodes(cfg),
+		CheckTimeout: checkTimeout,
+	})
+	report.Add(res.Results...)
+	return writeDoctorReport(&report)
+}
+
+func writeDoctorReport(report *doctor.Report) error {
+	if err := report.WriteTable(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("%d checks failed", report.Count(doctor.StatusFail))
+	}
+	return nil
+}
+
+// chainNodes returns the chain clients configured through integrations.
+func chainNodes(cfg *config.Config) []doctor.Node {
+	if cfg.Integrations.ConfigV2 == nil {
+		return nil
+	}
+
+	var nodes []doctor.Node
+	for _, c := range cfg.Integrations.ConfigV2.Configs {
+		ec, ok := c.(*ethereum.Config)
+		if !ok || !ec.Enabled {
+			continue
+		}
+
+		n := doctor.Node{Integration: ec.Name(), Chain: ec.Chain}
+		if ec.Common.InstanceKey != nil {
+			n.Instance = *ec.Common.InstanceKey
+		}
+		if ec.Execution.Enabled {
+			n.ExecutionURL = ec.Execution.URL
+		}
+		if ec.Consensus.Enabled {
+			n.ConsensusURL = ec.Consensus.URL
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
@@ -42,6 +42,10 @@ type Entrypoint struct {
 	log *server.Logger
 	cfg config.Config
 
+	// configFile is the path of the Telescope config file the Agent was
+	// started with. It is inspected to collect diagnostics.
+	configFile string
+
 	srv          *server.Server
 	promMetrics  *metrics.Agent
 	lokiLogs     *logs.Logs
@@ -57,14 +61,15 @@ type Entrypoint struct {
 type Reloader = func(log *server.Logger) (*config.Config, error)
 
 // NewEntrypoint creates a new Entrypoint.
-func NewEntrypoint(logger *server.Logger, cfg *config.Config, reloader Reloader) (*Entrypoint, error) {
+func NewEntrypoint(logger *server.Logger, cfg *config.Config, configFile string, reloader Reloader) (*Entrypoint, error) {
 	var (
 		reg      = prometheus.DefaultRegisterer
 		gatherer = prometheus.DefaultGatherer
 
 		ep = &Entrypoint{
-			log:      logger,
-			reloader: reloader,
+			log:        logger,
+			reloader:   reloader,
+			configFile: configFile,
 		}
 		err error
 	)
@@ -321,7 +326,12 @@ func (ep *Entrypoint) supportHandler(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	bundle, err := supportbundle.Export(ctx, enabledFeatures, configBytes, httpSrvAddress, ep.srv.DialContext)
+	diag, err := supportbundle.CollectDiagnostics(ctx, ep.configFile, nil)
+	if err != nil {
+		level.Warn(ep.log).Log("msg", "failed to collect telescope diagnostics for support bundle", "err", err)
+	}
+
+	bundle, err := supportbundle.Export(ctx, enabledFeatures, configBytes, httpSrvAddress, ep.srv.DialContext, diag)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Inspect the logs pipelines of a running agent",
+}
+
+var logsTailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Stream samples of the entries going through a logs pipeline",
+	Long: `Stream samples of the entries going through the processing stages of a
+running agent, with the values each stage extracts, the labels it adds or
+drops, and the reason entries are dropped.
+
+--component is the ID of a loki.process component, e.g. loki.process.default,
+or the name of a logs instance of static mode.`,
+	Example: `  telescope logs tail --component=default
+  telescope logs tail --component=loki.process.geth --sample=1 --output=json`,
+	Args: cobra.NoArgs,
+	RunE: runLogsTail,
+}
+
+func init() {
+	logsTailCmd.Flags().String("agent-address", "127.0.0.1:12345", "HTTP address of the running agent")
+	logsTailCmd.Flags().String("component", "", "loki.process component ID or static mode logs instance to tail")
+	logsTailCmd.Flags().Float64("sample", stages.DefaultTapSampleRate, "Fraction of the entries to stream, between 0 and 1")
+	logsTailCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	_ = logsTailCmd.MarkFlagRequired("component")
+
+	logsCmd.AddCommand(logsTailCmd)
+	cmd.AddCommand(logsCmd)
+}
+
+func runLogsTail(cmd *cobra.Command, _ []string) error {
+	var (
+		agentAddress, _ = cmd.Flags().GetString("agent-address")
+		component, _    = cmd.Flags().GetString("component")
+		sample, _       = cmd.Flags().GetFloat64("sample")
+		output, _       = cmd.Flags().GetString("output")
+	)
+	if sample <= 0 || sample > 1 {
+		return fmt.Errorf("--sample must be greater than 0 and at most 1")
+	}
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output %q, must be text or json", output)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	u := fmt.Sprintf("http://%s%s?sample=%s", agentAddress, tailPath(component), strconv.FormatFloat(sample, 'f', -1, 64))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response with status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	out := cmd.OutOrStdout()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("reading stream: %w", err)
+		}
+		if output == "json" {
+			fmt.Fprintln(out, string(raw))
+			continue
+		}
+
+		var ev stages.TapEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("decoding entry: %w", err)
+		}
+		fmt.Fprint(out, formatTapEvent(ev))
+	}
+}
+
+// tailPath returns the path of the stream of a loki.process component, or of
+// a static mode logs instance.
+func tailPath(component string) string {
+	if strings.HasPrefix(component, "loki.process.") {
+		return "/api/v0/component/" + url.PathEscape(component) + "/tail"
+	}
+	return "/agent/api/v1/logs/instances/" + url.PathEscape(component) + "/tail"
+}
+
+// formatTapEvent renders an entry and the changes made by each stage, one
+// stage per line.
+func formatTapEvent(ev stages.TapEvent) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s\n", ev.Timestamp.Format(time.RFC3339Nano), ev.Labels, ev.Line)
+
+	for _, s := range ev.Steps {
+		var changes []string
+		for _, k := range sortedKeys(s.Extracted) {
+			changes = append(changes, fmt.Sprintf("%s=%s", k, formatExtracted(s.Extracted[k])))
+		}
+		var added []string
+		for k, v := range s.LabelsAdded {
+			added = append(added, fmt.Sprintf("+%s=%q", k, v))
+		}
+		sort.Strings(added)
+		changes = append(changes, added...)
+		for _, k := range s.LabelsDropped {
+			changes = append(changes, "-"+k)
+		}
+		if s.Timestamp != nil {
+			changes = append(changes, "timestamp="+s.Timestamp.Format(time.RFC3339Nano))
+		}
+		if s.Line != nil {
+			changes = append(changes, "line="+strconv.Quote(*s.Line))
+		}
+		if len(changes) == 0 {
+			changes = append(changes, "(no changes)")
+		}
+		fmt.Fprintf(&sb, "  [%d] %-16s %s\n", s.Index, s.Stage, strings.Join(changes, " "))
+	}
+
+	if ev.Dropped {
+		fmt.Fprintf(&sb, "  dropped by %s: %s\n", ev.DropStage, ev.DropReason)
+	}
+	return sb.String()
+}
+
+func formatExtracted(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,18 +5,24 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
 	networksConfig "github.com/blockopsnetwork/telescope/internal/static/config/networks"
+	"github.com/blockopsnetwork/telescope/internal/static/integrations/ethereum"
 
 	"github.com/blockopsnetwork/telescope/internal/boringcrypto"
 	"github.com/blockopsnetwork/telescope/internal/build"
 	"github.com/blockopsnetwork/telescope/internal/static/config"
 	"github.com/blockopsnetwork/telescope/internal/static/server"
 	util_log "github.com/blockopsnetwork/telescope/internal/util/log"
+	lokiflagext "github.com/grafana/loki/pkg/util/flagext"
+	"github.com/alecthomas/units"
 	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -62,7 +68,7 @@ var cmd = &cobra.Command{
 		// Get network config and generate scrape configs
 		networkConfig := getNetworkConfig(config.Network)
 		level.Info(logger).Log("msg", "starting telescope agent", "network", config.Network)
-		scrapeConfigs := networkConfig.GenerateScrapeConfigs(config.ProjectName, config.Network)
+		scrapeConfigs := generateScrapeConfigs(config, networkConfig)
 
 		// Generate and write full config
 		fullConfig := generateFullConfig(config, scrapeConfigs)
@@ -122,12 +128,65 @@ type GlobalConfig struct {
 type MetricConfig struct {
 	Name          string         `yaml:"name"`
 	HostFilter    bool           `yaml:"host_filter"`
+	MaxWALSize    string         `yaml:"max_wal_size,omitempty"`
+	MinFreeDisk   string         `yaml:"min_free_disk,omitempty"`
 	ScrapeConfigs []ScrapeConfig `yaml:"scrape_configs"`
+
+	RemoteWriteOutbox *OutboxConfig       `yaml:"remote_write_outbox,omitempty"`
+	SeriesLimits      *SeriesLimitsConfig `yaml:"series_limits,omitempty"`
+
+	ScrapeNativeHistograms bool   `yaml:"scrape_native_histograms,omitempty"`
+	RemoteWriteProtocol    string `yaml:"remote_write_protocol,omitempty"`
+
+	Rules        *RulesConfig        `yaml:"rules,omitempty"`
+	LocalStorage *LocalStorageConfig `yaml:"local_storage,omitempty"`
+
+	OTLP []OTLPConfig `yaml:"otlp,omitempty"`
+}
+
+type OTLPConfig struct {
+	Endpoint           string            `yaml:"endpoint"`
+	Protocol           string            `yaml:"protocol,omitempty"`
+	Insecure           bool              `yaml:"insecure,omitempty"`
+	Headers            map[string]string `yaml:"headers,omitempty"`
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"`
+}
+
+type LocalStorageConfig struct {
+	Retention string `yaml:"retention,omitempty"`
+}
+
+type RulesConfig struct {
+	RuleFiles        []string `yaml:"rule_files,omitempty"`
+	AlertmanagerURLs []string `yaml:"alertmanager_urls,omitempty"`
+	WebhookURLs      []string `yaml:"webhook_urls,omitempty"`
+}
+
+type SeriesLimitsConfig struct {
+	PerTarget int `yaml:"per_target,omitempty"`
+	PerJob    int `yaml:"per_job,omitempty"`
+}
+
+type OutboxConfig struct {
+	MaxSize string `yaml:"max_size,omitempty"`
+	MaxAge  string `yaml:"max_age,omitempty"`
 }
 
 type ScrapeConfig struct {
-	JobName       string         `yaml:"job_name"`
-	StaticConfigs []StaticConfig `yaml:"static_configs"`
+	JobName             string               `yaml:"job_name"`
+	MetricsPath         string               `yaml:"metrics_path,omitempty"`
+	StaticConfigs       []StaticConfig       `yaml:"static_configs,omitempty"`
+	KubernetesSDConfigs []KubernetesSDConfig `yaml:"kubernetes_sd_configs,omitempty"`
+	RelabelConfigs      []RelabelConfig      `yaml:"relabel_configs,omitempty"`
+}
+
+type KubernetesSDConfig struct {
+	Role       string                `yaml:"role"`
+	Namespaces *KubernetesNamespaces `yaml:"namespaces,omitempty"`
+}
+
+type KubernetesNamespaces struct {
+	Names []string `yaml:"names"`
 }
 
 type BasicAuth struct {
@@ -152,12 +211,14 @@ type ToIntegrate struct {
 }
 
 type StaticConfig struct {
-	Targets []string `yaml:"targets"`
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty"`
 }
 
 type RemoteWrite struct {
-	URL       string    `yaml:"url"`
-	BasicAuth BasicAuth `yaml:"basic_auth"`
+	URL           string    `yaml:"url"`
+	BasicAuth     BasicAuth `yaml:"basic_auth"`
+	SendExemplars bool      `yaml:"send_exemplars,omitempty"`
 }
 
 type LogsConfig struct {
@@ -166,9 +227,43 @@ type LogsConfig struct {
 
 type LogConfig struct {
 	Name          string           `yaml:"name"`
-	Clients       []LogClient      `yaml:"clients"`
+	Clients       []LogClient      `yaml:"clients,omitempty"`
+	OTLP          []OTLPConfig     `yaml:"otlp,omitempty"`
 	Positions     Positions        `yaml:"positions"`
 	ScrapeConfigs []LogScrapeConfig `yaml:"scrape_configs,omitempty"`
+	WAL           *LogWAL           `yaml:"wal,omitempty"`
+	Redact        *LogRedact        `yaml:"redact,omitempty"`
+	ChainEvents   *LogChainEvents   `yaml:"chain_events,omitempty"`
+	SourceLimits  *LogSourceLimits  `yaml:"source_limits,omitempty"`
+}
+
+type LogWAL struct {
+	Enabled bool   `yaml:"enabled"`
+	MaxSize string `yaml:"max_size,omitempty"`
+}
+
+// LogRedact enables all the redaction detectors with their default
+// replacement.
+type LogRedact struct{}
+
+// LogChainEvents detects critical chain events in logs with the default
+// rules, and notifies the webhooks of them.
+type LogChainEvents struct {
+	DefaultRules bool                   `yaml:"default_rules"`
+	Webhooks     []LogChainEventWebhook `yaml:"webhooks,omitempty"`
+}
+
+// LogSourceLimits limits the rate of the logs sent per container.
+type LogSourceLimits struct {
+	GroupBy   []string `yaml:"group_by"`
+	GroupRate string   `yaml:"group_rate"`
+	Policy    string   `yaml:"policy"`
+}
+
+type LogChainEventWebhook struct {
+	URL        string `yaml:"url,omitempty"`
+	Format     string `yaml:"format"`
+	RoutingKey string `yaml:"routing_key,omitempty"`
 }
 
 type Positions struct {
@@ -182,9 +277,21 @@ type LogClient struct {
 }
 
 type LogScrapeConfig struct {
-	JobName         string            `yaml:"job_name"`
-	DockerSDConfigs []DockerSDConfig  `yaml:"docker_sd_configs,omitempty"`
-	RelabelConfigs  []RelabelConfig   `yaml:"relabel_configs,omitempty"`
+	JobName         string           `yaml:"job_name"`
+	DockerSDConfigs []DockerSDConfig `yaml:"docker_sd_configs,omitempty"`
+	StaticConfigs   []StaticConfig   `yaml:"static_configs,omitempty"`
+	Journal         *JournalConfig   `yaml:"journal,omitempty"`
+	PipelineStages  []PipelineStage  `yaml:"pipeline_stages,omitempty"`
+	RelabelConfigs  []RelabelConfig  `yaml:"relabel_configs,omitempty"`
+}
+
+// PipelineStage is a promtail pipeline stage, keyed by its type.
+type PipelineStage map[string]interface{}
+
+type JournalConfig struct {
+	MaxAge string            `yaml:"max_age,omitempty"`
+	Path   string            `yaml:"path,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
 }
 
 type DockerSDConfig struct {
@@ -195,8 +302,11 @@ type DockerSDConfig struct {
 
 type RelabelConfig struct {
 	SourceLabels []string `yaml:"source_labels,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
 	Regex        string   `yaml:"regex,omitempty"`
 	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
 }
 
 type TelescopeConfig struct {
@@ -214,11 +324,63 @@ type TelescopeConfig struct {
 	// Docker logs configuration
 	EnableDockerLogs  bool
 	DockerHost        string
+	// Podman logs configuration
+	EnablePodmanLogs bool
+	PodmanHost       string
+	// CRI logs configuration
+	EnableCRILogs bool
+	CRILogDir     string
+	// Systemd journal logs configuration
+	EnableJournalLogs bool
+	JournalPath       string
+	// Durable log delivery
+	LogsWAL        bool
+	LogsWALMaxSize string
+	LogsRedact     bool
+	// Chain event detection in logs
+	LogsChainEvents        bool
+	ChainEventWebhookURLs  []string
+	ChainEventSlackURLs    []string
+	ChainEventPagerDutyKey string
+	// Per-container log rate limits
+	LogsContainerRate   string
+	LogsRateLimitPolicy string
 	// Ethereum integration fields
 	EthereumEnabled            bool
 	EthereumExecutionURL       string
 	EthereumConsensusURL       string
 	EthereumExecutionModules   []string
+	EthereumChain              string
+	EthereumChainMismatch      string
+	EthereumExemplars          bool
+	// Kubernetes discovery configuration
+	Discovery            string
+	KubernetesNamespaces []string
+	// WAL disk limits
+	MaxWALSize  string
+	MinFreeDisk string
+	// Remote write outbox
+	RemoteWriteOutbox        bool
+	RemoteWriteOutboxMaxSize string
+	RemoteWriteOutboxMaxAge  string
+	// Series budgets
+	SeriesLimitPerTarget int
+	SeriesLimitPerJob    int
+	// Native histograms and remote write protocol
+	NativeHistograms    bool
+	RemoteWriteProtocol string
+	// Rule evaluation
+	RuleFiles        []string
+	AlertmanagerURLs []string
+	AlertWebhookURLs []string
+	// Local query API
+	LocalStorageRetention string
+	// OTLP export
+	OTLPEndpoint string
+	OTLPProtocol string
+	OTLPSignals  []string
+	OTLPInsecure bool
+	OTLPHeaders  map[string]string
 }
 
 func handleErr(err error, msg string) {
@@ -236,6 +398,15 @@ func toLowerAndEscape(input string) string {
 	return escaped
 }
 
+// generateScrapeConfigs returns the scrape configs of the network for the
+// configured discovery mode.
+func generateScrapeConfigs(config TelescopeConfig, networkConfig networksConfig.NetworkConfig) []networksConfig.ScrapeConfig {
+	if config.Discovery == networksConfig.DiscoveryKubernetes {
+		return networksConfig.KubernetesScrapeConfigs(config.ProjectName, config.Network, networkConfig.Roles(), config.KubernetesNamespaces)
+	}
+	return networkConfig.GenerateScrapeConfigs(config.ProjectName, config.Network)
+}
+
 func getNetworkConfig(network string) networksConfig.NetworkConfig {
 	config, exists := networkConfigs[network]
 	if !exists {
@@ -283,9 +454,109 @@ func (c *TelescopeConfig) validate() error {
 			strings.Join(supportedNetworks, ", "))
 	}
 
+	// Validate discovery mode
+	switch c.Discovery {
+	case networksConfig.DiscoveryStatic, networksConfig.DiscoveryKubernetes:
+	default:
+		return fmt.Errorf("unsupported discovery %q, must be one of: %s, %s",
+			c.Discovery, networksConfig.DiscoveryStatic, networksConfig.DiscoveryKubernetes)
+	}
+
+	// Validate WAL disk limits
+	for _, limit := range []struct{ flag, size string }{
+		{"max-wal-size", c.MaxWALSize},
+		{"min-free-disk", c.MinFreeDisk},
+		{"remote-write-outbox-max-size", c.RemoteWriteOutboxMaxSize},
+	} {
+		if limit.size == "" {
+			continue
+		}
+		if _, err := units.ParseBase2Bytes(limit.size); err != nil {
+			return fmt.Errorf("invalid --%s %q: %w", limit.flag, limit.size, err)
+		}
+	}
+	switch c.RemoteWriteProtocol {
+	case "", "1.0", "2.0":
+	default:
+		return fmt.Errorf("unsupported --remote-write-protocol %q, must be 1.0 or 2.0", c.RemoteWriteProtocol)
+	}
+	if c.SeriesLimitPerTarget < 0 || c.SeriesLimitPerJob < 0 {
+		return fmt.Errorf("series limits must not be negative")
+	}
+	if c.RemoteWriteOutboxMaxAge != "" {
+		if _, err := time.ParseDuration(c.RemoteWriteOutboxMaxAge); err != nil {
+			return fmt.Errorf("invalid --remote-write-outbox-max-age %q: %w", c.RemoteWriteOutboxMaxAge, err)
+		}
+	}
+
+	if c.OTLPEndpoint != "" {
+		switch c.OTLPProtocol {
+		case "grpc", "http":
+		default:
+			return fmt.Errorf("unsupported --otlp-protocol %q, must be grpc or http", c.OTLPProtocol)
+		}
+		for _, signal := range c.OTLPSignals {
+			if signal != "metrics" && signal != "logs" {
+				return fmt.Errorf("unsupported --otlp-signals %q, must be metrics or logs", signal)
+			}
+		}
+	}
+
+	for _, hook := range append(append([]string{}, c.ChainEventWebhookURLs...), c.ChainEventSlackURLs...) {
+		if err := validateURL(hook, "chain event webhook"); err != nil {
+			return err
+		}
+	}
+
+	if c.LogsContainerRate != "" {
+		var rate lokiflagext.ByteSize
+		if err := rate.Set(c.LogsContainerRate); err != nil {
+			return fmt.Errorf("invalid --logs-container-rate %q: %w", c.LogsContainerRate, err)
+		}
+		switch c.LogsRateLimitPolicy {
+		case "drop", "park":
+		default:
+			return fmt.Errorf("unsupported --logs-rate-limit-policy %q, must be drop or park", c.LogsRateLimitPolicy)
+		}
+	}
+
 	return nil
 }
 
+// otlpExports returns true if the given signal, metrics or logs, is sent to
+// the OTLP endpoint.
+func (c *TelescopeConfig) otlpExports(signal string) bool {
+	return c.OTLPEndpoint != "" && slices.Contains(c.OTLPSignals, signal)
+}
+
+// otlpConfig returns the OTLP endpoint of an instance sending the given
+// resource attributes.
+func (c *TelescopeConfig) otlpConfig(resourceAttributes map[string]string) []OTLPConfig {
+	return []OTLPConfig{{
+		Endpoint:           c.OTLPEndpoint,
+		Protocol:           c.OTLPProtocol,
+		Insecure:           c.OTLPInsecure,
+		Headers:            c.OTLPHeaders,
+		ResourceAttributes: resourceAttributes,
+	}}
+}
+
+// chainEventsConfig returns the chain event detection of the logs instance,
+// notifying the chain event webhooks.
+func (c *TelescopeConfig) chainEventsConfig() *LogChainEvents {
+	cfg := &LogChainEvents{DefaultRules: true}
+	for _, u := range c.ChainEventWebhookURLs {
+		cfg.Webhooks = append(cfg.Webhooks, LogChainEventWebhook{URL: u, Format: "json"})
+	}
+	for _, u := range c.ChainEventSlackURLs {
+		cfg.Webhooks = append(cfg.Webhooks, LogChainEventWebhook{URL: u, Format: "slack"})
+	}
+	if c.ChainEventPagerDutyKey != "" {
+		cfg.Webhooks = append(cfg.Webhooks, LogChainEventWebhook{Format: "pagerduty", RoutingKey: c.ChainEventPagerDutyKey})
+	}
+	return cfg
+}
+
 // checks if a URL string is valid and properly formatted.
 // It verifies that the URL has both a scheme (http/https) and a host.
 func validateURL(urlStr, name string) error {
@@ -330,6 +601,11 @@ func (c *TelescopeConfig) validateLogsConfig() error {
 		return nil // Logs not enabled, no validation needed
 	}
 
+	// Loki is optional when logs are sent to an OTLP endpoint.
+	if c.LogsSinkURL == "" && c.otlpExports("logs") {
+		return nil
+	}
+
 	if c.LogsSinkURL == "" {
 		return fmt.Errorf("logs-sink-url is required when logs are enabled")
 	}
@@ -352,6 +628,11 @@ func (c *TelescopeConfig) validateMetricsConfig() error {
 		return nil // Metrics not enabled, no validation needed
 	}
 
+	// Remote write is optional when metrics are sent to an OTLP endpoint.
+	if c.RemoteWriteUrl == "" && c.otlpExports("metrics") {
+		return nil
+	}
+
 	if c.TelescopeUsername == "" {
 		return fmt.Errorf("telescope-username is required when metrics are enabled")
 	}
@@ -373,12 +654,21 @@ func generateFullConfig(config TelescopeConfig, networkScrapeConfigs []networksC
 	scrapeConfigs := make([]ScrapeConfig, len(networkScrapeConfigs))
 	for i, nsc := range networkScrapeConfigs {
 		scrapeConfigs[i] = ScrapeConfig{
-			JobName: nsc.JobName,
-			StaticConfigs: []StaticConfig{
-				{
-					Targets: nsc.StaticConfigs[0].Targets,
-				},
-			},
+			JobName:     nsc.JobName,
+			MetricsPath: nsc.MetricsPath,
+		}
+		for _, sc := range nsc.StaticConfigs {
+			scrapeConfigs[i].StaticConfigs = append(scrapeConfigs[i].StaticConfigs, StaticConfig{Targets: sc.Targets})
+		}
+		for _, sd := range nsc.KubernetesSDConfigs {
+			kc := KubernetesSDConfig{Role: sd.Role}
+			if len(sd.Namespaces) > 0 {
+				kc.Namespaces = &KubernetesNamespaces{Names: sd.Namespaces}
+			}
+			scrapeConfigs[i].KubernetesSDConfigs = append(scrapeConfigs[i].KubernetesSDConfigs, kc)
+		}
+		for _, rc := range nsc.RelabelConfigs {
+			scrapeConfigs[i].RelabelConfigs = append(scrapeConfigs[i].RelabelConfigs, RelabelConfig(rc))
 		}
 	}
 
@@ -436,9 +726,29 @@ func generateFullConfig(config TelescopeConfig, networkScrapeConfigs []networksC
 		}
 
 
+		if config.EthereumChain != "" {
+			ethereumConfig["chain"] = config.EthereumChain
+		}
+		if config.EthereumChainMismatch != "" {
+			ethereumConfig["chain_mismatch"] = config.EthereumChainMismatch
+		}
+		if config.EthereumExemplars {
+			ethereumConfig["exemplars"] = true
+		}
+
 		integrations["ethereum_configs"] = []interface{}{ethereumConfig}
 	}
 
+	externalLabels := map[string]string{
+		"project_id":   config.ProjectId,
+		"project_name": config.ProjectName,
+	}
+	// Without a declared chain, only the metrics of the ethereum integration
+	// are labeled, with the chain its clients are resolved to.
+	if config.EthereumChain != "" {
+		externalLabels["chain"] = config.EthereumChain
+	}
+
 	cfg := Config{
 		Server: ServerConfig{
 			LogLevel: "info",
@@ -447,24 +757,14 @@ func generateFullConfig(config TelescopeConfig, networkScrapeConfigs []networksC
 			Wal_Directory: "/tmp/telescope",
 			Global: GlobalConfig{
 				ScrapeInterval: "15s",
-				ExternalLabels: map[string]string{
-					"project_id":   config.ProjectId,
-					"project_name": config.ProjectName,
-				},
-				RemoteWrite: []RemoteWrite{
-					{
-						URL: config.RemoteWriteUrl,
-						BasicAuth: BasicAuth{
-							Username: config.TelescopeUsername,
-							Password: config.TelescopePassword,
-						},
-					},
-				},
+				ExternalLabels: externalLabels,
 			},
 			Configs: []MetricConfig{
 				{
 					Name:          toLowerAndEscape(config.ProjectName + "_" + config.Network + "_metrics"),
 					HostFilter:    false,
+					MaxWALSize:    config.MaxWALSize,
+					MinFreeDisk:   config.MinFreeDisk,
 					ScrapeConfigs: scrapeConfigs,
 				},
 			},
@@ -472,88 +772,182 @@ func generateFullConfig(config TelescopeConfig, networkScrapeConfigs []networksC
 		Integrations: integrations,
 	}
 
+	if config.RemoteWriteUrl != "" {
+		cfg.Metrics.Global.RemoteWrite = []RemoteWrite{
+			{
+				URL: config.RemoteWriteUrl,
+				BasicAuth: BasicAuth{
+					Username: config.TelescopeUsername,
+					Password: config.TelescopePassword,
+				},
+				SendExemplars: config.EthereumExemplars,
+			},
+		}
+	}
+
+	// The external labels are added to the attributes of the data points
+	// sent to the OTLP endpoint.
+	if config.otlpExports("metrics") {
+		cfg.Metrics.Configs[0].OTLP = config.otlpConfig(nil)
+	}
+
+	if config.SeriesLimitPerTarget > 0 || config.SeriesLimitPerJob > 0 {
+		cfg.Metrics.Configs[0].SeriesLimits = &SeriesLimitsConfig{
+			PerTarget: config.SeriesLimitPerTarget,
+			PerJob:    config.SeriesLimitPerJob,
+		}
+	}
+
+	cfg.Metrics.Configs[0].ScrapeNativeHistograms = config.NativeHistograms
+	cfg.Metrics.Configs[0].RemoteWriteProtocol = config.RemoteWriteProtocol
+
+	if len(config.RuleFiles) > 0 {
+		cfg.Metrics.Configs[0].Rules = &RulesConfig{
+			RuleFiles:        config.RuleFiles,
+			AlertmanagerURLs: config.AlertmanagerURLs,
+			WebhookURLs:      config.AlertWebhookURLs,
+		}
+	}
+
+	if config.LocalStorageRetention != "" {
+		cfg.Metrics.Configs[0].LocalStorage = &LocalStorageConfig{
+			Retention: config.LocalStorageRetention,
+		}
+	}
+
+	if config.RemoteWriteOutbox {
+		cfg.Metrics.Configs[0].RemoteWriteOutbox = &OutboxConfig{
+			MaxSize: config.RemoteWriteOutboxMaxSize,
+			MaxAge:  config.RemoteWriteOutboxMaxAge,
+		}
+	}
+
 	if config.Logs {
+		projectLabels := map[string]string{
+			"project_id":   config.ProjectId,
+			"project_name": config.ProjectName,
+		}
 		logConfig := LogConfig{
 			Name: "telescope_logs",
-			Clients: []LogClient{
+			Positions: Positions{
+				Filename: "/tmp/telescope_logs",
+			},
+		}
+
+		if config.LogsSinkURL != "" {
+			logConfig.Clients = []LogClient{
 				{
 					URL: config.LogsSinkURL,
 					BasicAuth: BasicAuth{
 						Username: config.LokiUsername,
 						Password: config.LokiPassword,
 					},
-					ExternalLabels: map[string]string{
-						"project_id":   config.ProjectId,
-						"project_name": config.ProjectName,
-					},
+					ExternalLabels: projectLabels,
 				},
-			},
-			Positions: Positions{
-				Filename: "/tmp/telescope_logs",
-			},
+			}
+		}
+
+		// The project labels set on Loki streams are resource attributes of
+		// the logs sent to the OTLP endpoint.
+		if config.otlpExports("logs") {
+			logConfig.OTLP = config.otlpConfig(projectLabels)
+		}
+
+		if config.LogsRedact {
+			logConfig.Redact = &LogRedact{}
+		}
+
+		if config.LogsChainEvents {
+			logConfig.ChainEvents = config.chainEventsConfig()
+		}
+
+		if config.LogsContainerRate != "" {
+			logConfig.SourceLimits = &LogSourceLimits{
+				GroupBy:   []string{"container"},
+				GroupRate: config.LogsContainerRate,
+				Policy:    config.LogsRateLimitPolicy,
+			}
+		}
+
+		if config.LogsWAL {
+			logConfig.WAL = &LogWAL{
+				Enabled: true,
+				MaxSize: config.LogsWALMaxSize,
+			}
 		}
 
 		// Add Docker log scraping if enabled
 		if config.EnableDockerLogs {
-			logConfig.ScrapeConfigs = []LogScrapeConfig{
-				{
-					JobName: fmt.Sprintf("%s_docker_logs", toLowerAndEscape(config.ProjectName)),
-					DockerSDConfigs: []DockerSDConfig{
-						{
-							Host:            config.DockerHost,
-							RefreshInterval: "5s",
-							Filters:         []string{},
-						},
+			logConfig.ScrapeConfigs = append(logConfig.ScrapeConfigs, LogScrapeConfig{
+				JobName: fmt.Sprintf("%s_docker_logs", toLowerAndEscape(config.ProjectName)),
+				DockerSDConfigs: []DockerSDConfig{
+					{
+						Host:            config.DockerHost,
+						RefreshInterval: "5s",
+						Filters:         []string{},
 					},
-					RelabelConfigs: []RelabelConfig{
-						{
-							SourceLabels: []string{"__meta_docker_container_name"},
-							Regex:        "/(.*)",
-							TargetLabel:  "container",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_log_stream"},
-							TargetLabel:  "logstream",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_scrape_location"},
-							TargetLabel:  "job",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_scrape_location"},
-							TargetLabel:  "scrape_location",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_instance"},
-							TargetLabel:  "instance",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_network"},
-							TargetLabel:  "network",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_client_name"},
-							TargetLabel:  "client_name",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_group"},
-							TargetLabel:  "group",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_host_type"},
-							TargetLabel:  "host_type",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_project_name"},
-							TargetLabel:  "project_name",
-						},
-						{
-							SourceLabels: []string{"__meta_docker_container_label_project_id"},
-							TargetLabel:  "project_id",
+				},
+				RelabelConfigs: dockerRelabelConfigs(),
+			})
+		}
+
+		// Add Podman log scraping if enabled. Podman serves the Docker API, so
+		// its containers are discovered and labeled like Docker ones.
+		if config.EnablePodmanLogs {
+			logConfig.ScrapeConfigs = append(logConfig.ScrapeConfigs, LogScrapeConfig{
+				JobName: fmt.Sprintf("%s_podman_logs", toLowerAndEscape(config.ProjectName)),
+				DockerSDConfigs: []DockerSDConfig{
+					{
+						Host:            config.PodmanHost,
+						RefreshInterval: "5s",
+						Filters:         []string{},
+					},
+				},
+				RelabelConfigs: dockerRelabelConfigs(),
+			})
+		}
+
+		// Add CRI log scraping of the containers run by containerd through
+		// the kubelet if enabled. The pod metadata is in the path of the log
+		// files, the image, ID and annotations of the containers aren't, and
+		// are only available with discovery.cri in Flow mode.
+		if config.EnableCRILogs {
+			logConfig.ScrapeConfigs = append(logConfig.ScrapeConfigs, LogScrapeConfig{
+				JobName: fmt.Sprintf("%s_cri_logs", toLowerAndEscape(config.ProjectName)),
+				StaticConfigs: []StaticConfig{
+					{
+						Targets: []string{"localhost"},
+						Labels: map[string]string{
+							"job":          "cri",
+							"network":      config.Network,
+							"project_name": config.ProjectName,
+							"project_id":   config.ProjectId,
+							"__path__":     strings.TrimSuffix(config.CRILogDir, "/") + "/*/*/*.log",
 						},
 					},
 				},
+				PipelineStages: criPipelineStages(networkConfigs[config.Network].Roles()),
+			})
+		}
+
+		// Add systemd journal log scraping of the network's client units if
+		// enabled
+		if config.EnableJournalLogs {
+			var relabelConfigs []RelabelConfig
+			for _, rc := range networksConfig.JournalRelabelConfigs(config.Network, networkConfigs[config.Network].Roles()) {
+				relabelConfigs = append(relabelConfigs, RelabelConfig(rc))
 			}
+			logConfig.ScrapeConfigs = append(logConfig.ScrapeConfigs, LogScrapeConfig{
+				JobName: fmt.Sprintf("%s_journal_logs", toLowerAndEscape(config.ProjectName)),
+				Journal: &JournalConfig{
+					MaxAge: "12h",
+					Path:   config.JournalPath,
+					Labels: map[string]string{
+						"job": "systemd-journal",
+					},
+				},
+				RelabelConfigs: relabelConfigs,
+			})
 		}
 
 		cfg.Logs = LogsConfig{
@@ -564,7 +958,82 @@ func generateFullConfig(config TelescopeConfig, networkScrapeConfigs []networksC
 	return cfg
 }
 
-// writes the provided Config to a YAML file at the specified path.
+// dockerRelabelConfigs returns the relabel configs of the containers
+// discovered through the Docker API, which Podman serves as well.
+func dockerRelabelConfigs() []RelabelConfig {
+	return []RelabelConfig{
+		{
+			SourceLabels: []string{"__meta_docker_container_name"},
+			Regex:        "/(.*)",
+			TargetLabel:  "container",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_log_stream"},
+			TargetLabel:  "logstream",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_scrape_location"},
+			TargetLabel:  "job",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_scrape_location"},
+			TargetLabel:  "scrape_location",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_instance"},
+			TargetLabel:  "instance",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_network"},
+			TargetLabel:  "network",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_client_name"},
+			TargetLabel:  "client_name",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_group"},
+			TargetLabel:  "group",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_host_type"},
+			TargetLabel:  "host_type",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_project_name"},
+			TargetLabel:  "project_name",
+		},
+		{
+			SourceLabels: []string{"__meta_docker_container_label_project_id"},
+			TargetLabel:  "project_id",
+		},
+	}
+}
+
+// criPipelineStages returns the pipeline stages parsing the CRI log format
+// and labeling the lines with the pod metadata in the path of their file,
+// <namespace>_<pod>_<uid>/<container>/<restart count>.log, and with the
+// client_name of the roles' clients their container is named after.
+func criPipelineStages(roles []networksConfig.Role) []PipelineStage {
+	return []PipelineStage{
+		{"cri": map[string]interface{}{}},
+		{"regex": map[string]interface{}{
+			"source":     "filename",
+			"expression": `/(?P<namespace>[^/_]+)_(?P<pod>[^/_]+)_[^/]+/(?P<container>[^/]+)/[0-9]+\.log$`,
+		}},
+		{"regex": map[string]interface{}{
+			"source":     "container",
+			"expression": networksConfig.CRIClientExpression(roles),
+		}},
+		{"labels": map[string]interface{}{
+			"namespace":   nil,
+			"pod":         nil,
+			"container":   nil,
+			"client_name": nil,
+		}},
+	}
+}
+
 func writeConfigToFile(config Config, filePath string) error {
 	if filePath == "" {
 		return fmt.Errorf("empty file path provided")
@@ -606,12 +1075,50 @@ func (c *TelescopeConfig) loadConfig() error {
 	c.LogsSinkURL = viper.GetString("logs-sink-url")
 	c.EnableDockerLogs = viper.GetBool("enable-docker-logs")
 	c.DockerHost = viper.GetString("docker-host")
+	c.EnablePodmanLogs = viper.GetBool("enable-podman-logs")
+	c.PodmanHost = viper.GetString("podman-host")
+	c.EnableCRILogs = viper.GetBool("enable-cri-logs")
+	c.CRILogDir = viper.GetString("cri-log-dir")
+	c.EnableJournalLogs = viper.GetBool("enable-journal-logs")
+	c.JournalPath = viper.GetString("journal-path")
+	c.LogsWAL = viper.GetBool("logs-wal")
+	c.LogsWALMaxSize = viper.GetString("logs-wal-max-size")
+	c.LogsRedact = viper.GetBool("logs-redact")
+	c.LogsChainEvents = viper.GetBool("logs-chain-events")
+	c.ChainEventWebhookURLs = viper.GetStringSlice("chain-event-webhook-url")
+	c.ChainEventSlackURLs = viper.GetStringSlice("chain-event-slack-url")
+	c.ChainEventPagerDutyKey = viper.GetString("chain-event-pagerduty-routing-key")
+	c.LogsContainerRate = viper.GetString("logs-container-rate")
+	c.LogsRateLimitPolicy = viper.GetString("logs-rate-limit-policy")
+	c.Discovery = viper.GetString("discovery")
+	c.KubernetesNamespaces = viper.GetStringSlice("kubernetes-namespaces")
+	c.MaxWALSize = viper.GetString("max-wal-size")
+	c.MinFreeDisk = viper.GetString("min-free-disk")
+	c.RemoteWriteOutbox = viper.GetBool("remote-write-outbox")
+	c.RemoteWriteOutboxMaxSize = viper.GetString("remote-write-outbox-max-size")
+	c.RemoteWriteOutboxMaxAge = viper.GetString("remote-write-outbox-max-age")
+	c.SeriesLimitPerTarget = viper.GetInt("series-limit-per-target")
+	c.SeriesLimitPerJob = viper.GetInt("series-limit-per-job")
+	c.NativeHistograms = viper.GetBool("native-histograms")
+	c.RemoteWriteProtocol = viper.GetString("remote-write-protocol")
+	c.RuleFiles = viper.GetStringSlice("rule-files")
+	c.AlertmanagerURLs = viper.GetStringSlice("alertmanager-url")
+	c.AlertWebhookURLs = viper.GetStringSlice("alert-webhook-url")
+	c.LocalStorageRetention = viper.GetString("local-storage-retention")
+	c.OTLPEndpoint = viper.GetString("otlp-endpoint")
+	c.OTLPProtocol = viper.GetString("otlp-protocol")
+	c.OTLPSignals = viper.GetStringSlice("otlp-signals")
+	c.OTLPInsecure = viper.GetBool("otlp-insecure")
+	c.OTLPHeaders = viper.GetStringMapString("otlp-headers")
 
 	// Load Ethereum integration values
 	c.EthereumEnabled = viper.GetBool("ethereum-enabled")
 	c.EthereumExecutionURL = viper.GetString("ethereum-execution-url")
 	c.EthereumConsensusURL = viper.GetString("ethereum-consensus-url")
 	c.EthereumExecutionModules = viper.GetStringSlice("ethereum-execution-modules")
+	c.EthereumChain = viper.GetString("ethereum-chain")
+	c.EthereumChainMismatch = viper.GetString("ethereum-chain-mismatch")
+	c.EthereumExemplars = viper.GetBool("ethereum-exemplars")
 
 	// Run all validations
 	if err := c.validate(); err != nil {
@@ -639,6 +1146,17 @@ func (c *TelescopeConfig) validateEthereumConfig() error {
 	// Check if any ethereum flags are provided
 	ethereumEnabled := c.EthereumEnabled || c.EthereumExecutionURL != "" || c.EthereumConsensusURL != ""
 
+	if c.EthereumChain != "" {
+		if _, ok := chainclient.EthereumChainID(c.EthereumChain); !ok {
+			return fmt.Errorf("unknown ethereum chain %q: must be one of %s or a chain ID", c.EthereumChain, strings.Join(chainclient.EthereumChains(), ", "))
+		}
+	}
+	switch c.EthereumChainMismatch {
+	case "", ethereum.ChainMismatchFail, ethereum.ChainMismatchWarn:
+	default:
+		return fmt.Errorf("invalid --ethereum-chain-mismatch %q: must be %q or %q", c.EthereumChainMismatch, ethereum.ChainMismatchFail, ethereum.ChainMismatchWarn)
+	}
+
 	if ethereumEnabled {
 		enableFeatures := viper.GetString("enable-features")
 		if !strings.Contains(enableFeatures, "integrations-next") {
@@ -700,8 +1218,15 @@ func checkRequiredFlags() error {
 		}
 	}
 
+	// Remote write and Loki are optional for the signals sent to an OTLP
+	// endpoint, but their credentials are still required when they're set.
+	otlpExports := func(signal, urlFlag string) bool {
+		return viper.GetString("otlp-endpoint") != "" && viper.GetString(urlFlag) == "" &&
+			slices.Contains(viper.GetStringSlice("otlp-signals"), signal)
+	}
+
 	// Check metrics flags if metrics enabled
-	if viper.GetBool("metrics") {
+	if viper.GetBool("metrics") && !otlpExports("metrics", "remote-write-url") {
 		for _, flag := range metricsFlags {
 			if viper.GetString(flag) == "" {
 				missingFlags = append(missingFlags, flag)
@@ -710,7 +1235,7 @@ func checkRequiredFlags() error {
 	}
 
 	// Check logs flags if logs enabled
-	if viper.GetBool("enable-logs") {
+	if viper.GetBool("enable-logs") && !otlpExports("logs", "logs-sink-url") {
 		for _, flag := range logsFlags {
 			if viper.GetString(flag) == "" {
 				missingFlags = append(missingFlags, flag)
@@ -771,6 +1296,21 @@ IMPORTANT: Ethereum integration requires --enable-features integrations-next`
 	cmd.Flags().String("telescope-username", "", "Username for remote write authentication")
 	cmd.Flags().String("telescope-password", "", "Password for remote write authentication")
 	cmd.Flags().String("remote-write-url", "", "Prometheus remote write endpoint URL")
+	cmd.Flags().String("discovery", networksConfig.DiscoveryStatic, "How to find the network's nodes: static (localhost ports) or kubernetes (pods labeled telescope.blockops.network/client)")
+	cmd.Flags().StringSlice("kubernetes-namespaces", nil, "Namespaces to discover pods in with --discovery=kubernetes (default all namespaces)")
+	cmd.Flags().String("max-wal-size", "", "Maximum size of the metrics WAL, e.g., 512MiB; the oldest unsent samples are dropped beyond it (default unlimited)")
+	cmd.Flags().String("min-free-disk", "1GiB", "Free disk space to always leave on the WAL's disk; the oldest unsent samples are dropped to keep it (empty disables)")
+	cmd.Flags().Bool("remote-write-outbox", false, "Buffer metrics on disk while the remote write endpoint is unreachable and upload them once it's back")
+	cmd.Flags().String("remote-write-outbox-max-size", "1GiB", "Maximum size of the metrics buffered by --remote-write-outbox; the oldest are dropped beyond it")
+	cmd.Flags().String("remote-write-outbox-max-age", "168h", "Maximum age of the metrics buffered by --remote-write-outbox")
+	cmd.Flags().Int("series-limit-per-target", 0, "Maximum number of active series of each scrape target; new series beyond it are dropped (0 disables)")
+	cmd.Flags().Int("series-limit-per-job", 0, "Maximum number of active series of all targets of a scrape job combined (0 disables)")
+	cmd.Flags().Bool("native-histograms", false, "Scrape native histograms from targets which expose them and send them to the remote write endpoint")
+	cmd.Flags().String("remote-write-protocol", "1.0", "Remote write protocol version (1.0 or 2.0); with 2.0, endpoints which don't support it fall back to 1.0")
+	cmd.Flags().StringSlice("rule-files", nil, "Prometheus recording and alerting rule files to evaluate in the agent; globs are allowed")
+	cmd.Flags().StringSlice("alertmanager-url", nil, "Alertmanager to send alerts fired by --rule-files to")
+	cmd.Flags().StringSlice("alert-webhook-url", nil, "Webhook to post alerts fired by --rule-files to, in the format of the Alertmanager API")
+	cmd.Flags().String("local-storage-retention", "", "Keep the scraped samples of this duration in memory, e.g., 2h, to query them with the query command (empty disables)")
 
 	// Logs configuration flags
 	cmd.Flags().Bool("enable-logs", false, "Enable log collection")
@@ -779,6 +1319,28 @@ IMPORTANT: Ethereum integration requires --enable-features integrations-next`
 	cmd.Flags().String("telescope-loki-password", "", "Password for Loki authentication")
 	cmd.Flags().Bool("enable-docker-logs", false, "Enable Docker container log scraping")
 	cmd.Flags().String("docker-host", "unix:///var/run/docker.sock", "Docker daemon socket")
+	cmd.Flags().Bool("enable-podman-logs", false, "Enable Podman container log scraping")
+	cmd.Flags().String("podman-host", "unix:///run/podman/podman.sock", "Podman API socket")
+	cmd.Flags().Bool("enable-cri-logs", false, "Enable log scraping of the containers run through the CRI, e.g., by containerd")
+	cmd.Flags().String("cri-log-dir", "/var/log/pods", "Directory of the CRI container logs")
+	cmd.Flags().Bool("enable-journal-logs", false, "Enable systemd journal log scraping of the network's client units")
+	cmd.Flags().String("journal-path", "", "Path of the systemd journal, defaults to the system journal")
+	cmd.Flags().Bool("logs-wal", false, "Buffer logs in a WAL on disk and replay them after a restart")
+	cmd.Flags().String("logs-wal-max-size", "512MiB", "Maximum size of the logs WAL on disk")
+	cmd.Flags().Bool("logs-redact", true, "Redact private keys, mnemonics, credentials and tokens from logs")
+	cmd.Flags().Bool("logs-chain-events", true, "Detect critical chain events in logs, like missed attestations, slashing protection or database corruption")
+	cmd.Flags().StringSlice("chain-event-webhook-url", nil, "Webhook to post the chain events detected in logs to, as JSON")
+	cmd.Flags().StringSlice("chain-event-slack-url", nil, "Slack incoming webhook to post the chain events detected in logs to")
+	cmd.Flags().String("chain-event-pagerduty-routing-key", "", "PagerDuty Events API v2 routing key to trigger incidents for the chain events detected in logs")
+	cmd.Flags().String("logs-container-rate", "", "Maximum rate of the logs sent per container, in bytes per second, e.g., 256KB; unlimited if empty")
+	cmd.Flags().String("logs-rate-limit-policy", "drop", "What to do with the logs of a container over --logs-container-rate: drop, or park them in memory until the container is under its rate")
+
+	// OTLP export flags
+	cmd.Flags().String("otlp-endpoint", "", "OTLP endpoint to send metrics and logs to, host:port for gRPC or a URL for HTTP; remote write and Loki become optional for the signals it receives")
+	cmd.Flags().String("otlp-protocol", "grpc", "OTLP protocol: grpc or http")
+	cmd.Flags().StringSlice("otlp-signals", []string{"metrics", "logs"}, "Signals to send to --otlp-endpoint: metrics, logs")
+	cmd.Flags().Bool("otlp-insecure", false, "Connect to --otlp-endpoint without TLS")
+	cmd.Flags().StringToString("otlp-headers", nil, "Headers to send to --otlp-endpoint, e.g., authorization=Bearer <token>")
 
 	// Feature flags
 	cmd.Flags().String("enable-features", "", "Experimental features (comma-separated, e.g., integrations-next)")
@@ -788,6 +1350,9 @@ IMPORTANT: Ethereum integration requires --enable-features integrations-next`
 	cmd.Flags().String("ethereum-execution-url", "", "Ethereum execution node URL (e.g., http://localhost:8545)")
 	cmd.Flags().String("ethereum-consensus-url", "", "Ethereum consensus node URL (e.g., http://localhost:5052)")
 	cmd.Flags().StringSlice("ethereum-execution-modules", []string{"sync", "eth", "net", "web3", "txpool"}, "Execution modules to enable (comma-separated)")
+	cmd.Flags().String("ethereum-chain", "", "Ethereum chain the clients are expected to be on, by name or chain ID (if unset, only the ethereum integration's metrics are labeled, with the chain of the clients)")
+	cmd.Flags().String("ethereum-chain-mismatch", "warn", "Whether a chain mismatch only logs a warning (warn) or stops the ethereum integration (fail)")
+	cmd.Flags().Bool("ethereum-exemplars", false, "Track block arrival and RPC latency histograms with exemplars linking to block hashes, slots and trace IDs")
 
 	// Note: We don't mark flags as required here because when using --config-file,
 	// these values should come from the config file, not command line flags.
@@ -795,12 +1360,28 @@ IMPORTANT: Ethereum integration requires --enable-features integrations-next`
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
 		viper.BindPFlag(f.Name, f)
 	})
+
+	// doctor loads the same flags as the agent. The flags are shared rather
+	// than redefined so that the viper bindings above apply to both commands.
+	doctorCmd.Flags().AddFlagSet(cmd.Flags())
 }
 
 func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 }
 
+// loads the agent configuration from configPath using fs, passing through the
+// features enabled with --enable-features.
+func loadAgentConfig(fs *flag.FlagSet, configPath string, log *server.Logger) (*config.Config, error) {
+	args := []string{"-config.file", configPath}
+	// Add enable-features flag support for v2 integrations
+	enableFeatures := viper.GetString("enable-features")
+	if enableFeatures != "" {
+		args = append(args, "-enable-features", enableFeatures)
+	}
+	return config.Load(fs, args, log)
+}
+
 // initializes and runs the monitoring agent with the provided configuration file.
 func agent(configPath string) {
 	defaultCfg := server.DefaultConfig()
@@ -808,13 +1389,7 @@ func agent(configPath string) {
 
 	reloader := func(log *server.Logger) (*config.Config, error) {
 		fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-		// Add enable-features flag support for v2 integrations
-		args := []string{"-config.file", configPath}
-		enableFeatures := viper.GetString("enable-features")
-		if enableFeatures != "" {
-			args = append(args, "-enable-features", enableFeatures)
-		}
-		return config.Load(fs, args, log)
+		return loadAgentConfig(fs, configPath, log)
 	}
 
 	cfg, err := reloader(logger)
@@ -827,7 +1402,7 @@ func agent(configPath string) {
 	util_log.Logger = logger
 
 	level.Info(logger).Log("msg", "starting agent", "boringcrypto", boringcrypto.Enabled)
-	ep, err := NewEntrypoint(logger, cfg, reloader)
+	ep, err := NewEntrypoint(logger, cfg, configPath, reloader)
 	if err != nil {
 		level.Error(logger).Log("msg", "failed to create agent entrypoint", "err", err)
 		os.Exit(1)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query <promql>",
+	Short: "Query the recent metrics kept by a running agent",
+	Long: `Evaluate a PromQL query against the samples a running agent keeps in
+memory, without going through the remote write backend. Metrics instances
+need local_storage or rules enabled, e.g. with --local-storage-retention.
+
+An instant query is evaluated at --time, or now. A range query is evaluated
+when --start is set.`,
+	Example: `  telescope query 'up'
+  telescope query 'rate(p2p_peers[5m])' --start 1h --step 1m`,
+	Args: cobra.ExactArgs(1),
+	RunE: runQuery,
+}
+
+func init() {
+	queryCmd.Flags().String("agent-address", "127.0.0.1:12345", "HTTP address of the running agent")
+	queryCmd.Flags().String("time", "", "Evaluation time of an instant query, as a Unix or RFC 3339 timestamp (default now)")
+	queryCmd.Flags().String("start", "", "Start of a range query, as a Unix or RFC 3339 timestamp or a duration before now, e.g., 1h")
+	queryCmd.Flags().String("end", "", "End of a range query, as a Unix or RFC 3339 timestamp (default now)")
+	queryCmd.Flags().Duration("step", time.Minute, "Resolution of a range query")
+	queryCmd.Flags().Duration("timeout", 2*time.Minute, "Timeout of the query")
+
+	cmd.AddCommand(queryCmd)
+}
+
+func runQuery(cmd *cobra.Command, args []string) error {
+	var (
+		agentAddress, _ = cmd.Flags().GetString("agent-address")
+		evalTime, _     = cmd.Flags().GetString("time")
+		start, _        = cmd.Flags().GetString("start")
+		end, _          = cmd.Flags().GetString("end")
+		step, _         = cmd.Flags().GetDuration("step")
+		timeout, _      = cmd.Flags().GetDuration("timeout")
+	)
+
+	params := url.Values{"query": {args[0]}}
+	path := "/api/v1/query"
+	if start != "" {
+		path = "/api/v1/query_range"
+		params.Set("start", queryTimeParam(start))
+		params.Set("end", strconv.FormatInt(time.Now().Unix(), 10))
+		if end != "" {
+			params.Set("end", end)
+		}
+		params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	} else if evalTime != "" {
+		params.Set("time", evalTime)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := fetchQuery(ctx, agentAddress, path, params)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), result)
+	return nil
+}
+
+// queryTimeParam converts a duration to the timestamp of that long ago, and
+// returns other values as is.
+func queryTimeParam(s string) string {
+	if d, err := model.ParseDuration(s); err == nil {
+		return strconv.FormatInt(time.Now().Add(-time.Duration(d)).Unix(), 10)
+	}
+	return s
+}
+
+// fetchQuery runs a query against the local query API of a running agent.
+func fetchQuery(ctx context.Context, addr, path string, params url.Values) (model.Value, error) {
+	u := fmt.Sprintf("http://%s%s", addr, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResp struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+		Data      struct {
+			ResultType model.ValueType `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("unexpected response with status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	if apiResp.Status != "success" {
+		return nil, fmt.Errorf("query failed (%s): %s", apiResp.ErrorType, apiResp.Error)
+	}
+
+	var result model.Value
+	switch apiResp.Data.ResultType {
+	case model.ValVector:
+		result = &model.Vector{}
+	case model.ValMatrix:
+		result = &model.Matrix{}
+	case model.ValScalar:
+		result = &model.Scalar{}
+	case model.ValString:
+		result = &model.String{}
+	default:
+		return nil, fmt.Errorf("unsupported result type %q", apiResp.Data.ResultType)
+	}
+	if err := json.Unmarshal(apiResp.Data.Result, result); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+	return result, nil
+}
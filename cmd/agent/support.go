@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/server"
+	"github.com/blockopsnetwork/telescope/internal/static/supportbundle"
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+)
+
+var supportCmd = &cobra.Command{
+	Use:   "support",
+	Short: "Tools for troubleshooting a Telescope installation",
+}
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Generate a support bundle",
+	Long: `Generate a support bundle containing the state of the running agent along
+with a snapshot of each configured chain client, WAL statistics, the redacted
+config file and the reachability of every remote_write and Loki endpoint.
+
+If the agent is not running, a bundle containing only the Telescope
+diagnostics is generated from the config file.`,
+	Args: cobra.NoArgs,
+	RunE: runSupportBundle,
+}
+
+func init() {
+	supportBundleCmd.Flags().String("config-file", "telescope_config.yaml", "Config file the agent was started with")
+	supportBundleCmd.Flags().String("agent-address", "127.0.0.1:12345", "HTTP address of the running agent")
+	supportBundleCmd.Flags().Duration("duration", 10*time.Second, "Duration of the CPU profile collected by the running agent")
+	supportBundleCmd.Flags().StringP("output", "o", "telescope-support-bundle.zip", "Path to write the support bundle to")
+
+	supportCmd.AddCommand(supportBundleCmd)
+	cmd.AddCommand(supportCmd)
+}
+
+func runSupportBundle(cmd *cobra.Command, _ []string) error {
+	defaultCfg := server.DefaultConfig()
+	logger := server.NewLogger(&defaultCfg)
+
+	var (
+		configFile, _   = cmd.Flags().GetString("config-file")
+		agentAddress, _ = cmd.Flags().GetString("agent-address")
+		duration, _     = cmd.Flags().GetDuration("duration")
+		output, _       = cmd.Flags().GetString("output")
+	)
+
+	bundle, err := fetchAgentBundle(cmd.Context(), agentAddress, duration)
+	if err != nil {
+		level.Warn(logger).Log("msg", "could not get support bundle from running agent, collecting diagnostics only", "addr", agentAddress, "err", err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		diag, err := supportbundle.CollectDiagnostics(ctx, configFile, nil)
+		if err != nil {
+			return fmt.Errorf("failed to collect diagnostics: %w", err)
+		}
+		b, err := supportbundle.ExportDiagnostics(diag)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := supportbundle.Write(&buf, b, nil); err != nil {
+			return err
+		}
+		bundle = buf.Bytes()
+	}
+
+	if err := os.WriteFile(output, bundle, 0600); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+	level.Info(logger).Log("msg", "support bundle written", "path", output)
+	return nil
+}
+
+// fetchAgentBundle downloads a support bundle from the /-/support endpoint of
+// a running agent.
+func fetchAgentBundle(ctx context.Context, addr string, duration time.Duration) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration+30*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/-/support?duration=%d", addr, int(duration.Seconds()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -6,6 +6,7 @@ import (
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/azure"                          // Import discovery.azure
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/consul"                         // Import discovery.consul
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/consulagent"                    // Import discovery.consulagent
+	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/cri"                            // Import discovery.cri
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/digitalocean"                   // Import discovery.digitalocean
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/dns"                            // Import discovery.dns
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/docker"                         // Import discovery.docker
@@ -25,6 +26,7 @@ import (
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/nomad"                          // Import discovery.nomad
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/openstack"                      // Import discovery.openstack
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/ovhcloud"                       // Import discovery.ovhcloud
+	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/podman"                         // Import discovery.podman
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/process"                        // Import discovery.process
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/puppetdb"                       // Import discovery.puppetdb
 	_ "github.com/blockopsnetwork/telescope/internal/component/discovery/relabel"                        // Import discovery.relabel
@@ -43,7 +45,7 @@ import (
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/aws_firehose"                 // Import loki.source.awsfirehose
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/azure_event_hubs"             // Import loki.source.azure_event_hubs
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/cloudflare"                   // Import loki.source.cloudflare
-	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/docker"                       // Import loki.source.docker
+	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/docker"                       // Import loki.source.docker and loki.source.podman
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/file"                         // Import loki.source.file
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/gcplog"                       // Import loki.source.gcplog
 	_ "github.com/blockopsnetwork/telescope/internal/component/loki/source/gelf"                         // Import loki.source.gelf
@@ -96,6 +98,7 @@ import (
 	_ "github.com/blockopsnetwork/telescope/internal/component/otelcol/receiver/prometheus"              // Import otelcol.receiver.prometheus
 	_ "github.com/blockopsnetwork/telescope/internal/component/otelcol/receiver/vcenter"                 // Import otelcol.receiver.vcenter
 	_ "github.com/blockopsnetwork/telescope/internal/component/otelcol/receiver/zipkin"                  // Import otelcol.receiver.zipkin
+	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/aggregate"                     // Import prometheus.aggregate
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/exporter/apache"               // Import prometheus.exporter.apache
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/exporter/azure"                // Import prometheus.exporter.azure
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/exporter/blackbox"             // Import prometheus.exporter.blackbox
@@ -129,6 +132,7 @@ import (
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/receive_http"                  // Import prometheus.receive_http
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/relabel"                       // Import prometheus.relabel
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/remotewrite"                   // Import prometheus.remote_write
+	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/rules"                         // Import prometheus.rules
 	_ "github.com/blockopsnetwork/telescope/internal/component/prometheus/scrape"                        // Import prometheus.scrape
 	_ "github.com/blockopsnetwork/telescope/internal/component/pyroscope/ebpf"                           // Import pyroscope.ebpf
 	_ "github.com/blockopsnetwork/telescope/internal/component/pyroscope/java"                           // Import pyroscope.java
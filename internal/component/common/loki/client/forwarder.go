@@ -0,0 +1,171 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+)
+
+const (
+	// tenantQueueLength is the number of entries queued per tenant before
+	// the tenant is blocked.
+	tenantQueueLength = 16
+	// tenantIdleTimeout is the time after which the clients of a tenant
+	// without entries are stopped.
+	tenantIdleTimeout = sourceIdleTimeout
+)
+
+// tenantForwarder forwards the entries of each tenant to its own clients, so
+// that a tenant whose clients block, e.g. while they retry rate limited
+// batches, doesn't block the other tenants. It implements limiterOutput, and
+// must be used by a single SourceLimiter.
+//
+// The entries without a tenant go to the clients of the manager, the clients
+// of the other tenants are created with the first entry of the tenant, and
+// stopped once the tenant is idle.
+type tenantForwarder struct {
+	logger     log.Logger
+	newClients func() ([]Client, error)
+	readyCh    chan struct{}
+
+	mut     sync.Mutex
+	tenants map[string]*tenantClients
+	lastGC  time.Time
+
+	wg sync.WaitGroup
+}
+
+// tenantClients forwards the entries of a tenant to its clients.
+type tenantClients struct {
+	clients  []Client
+	owned    bool // The clients are stopped with the tenant.
+	entries  chan loki.Entry
+	lastSeen time.Time
+}
+
+func newTenantForwarder(clients []Client, newClients func() ([]Client, error), logger log.Logger) *tenantForwarder {
+	f := &tenantForwarder{
+		logger:     logger,
+		newClients: newClients,
+		readyCh:    make(chan struct{}, 1),
+		tenants:    make(map[string]*tenantClients),
+		lastGC:     time.Now(),
+	}
+	f.start("", &tenantClients{clients: clients})
+	return f
+}
+
+// start forwards the entries of tenant to t.
+func (f *tenantForwarder) start(tenant string, t *tenantClients) {
+	t.entries = make(chan loki.Entry, tenantQueueLength)
+	t.lastSeen = time.Now()
+	f.tenants[tenant] = t
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for e := range t.entries {
+			for _, c := range t.clients {
+				c.Chan() <- e
+			}
+			select {
+			case f.readyCh <- struct{}{}:
+			default:
+			}
+		}
+		if t.owned {
+			for _, c := range t.clients {
+				c.Stop()
+			}
+		}
+	}()
+}
+
+// tenant returns the clients of the tenant of e, starting them if needed.
+func (f *tenantForwarder) tenant(e loki.Entry) *tenantClients {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.lastGC) >= sourceGCInterval {
+		f.gc(now)
+	}
+
+	name := string(e.Labels[ReservedLabelTenantID])
+	t, ok := f.tenants[name]
+	if !ok {
+		clients, err := f.newClients()
+		if err != nil {
+			// The clients of the manager still send the entries to the
+			// tenant of their label.
+			level.Error(f.logger).Log("msg", "failed to start the clients of a tenant", "tenant", name, "err", err)
+			return f.tenants[""]
+		}
+		t = &tenantClients{clients: clients, owned: true}
+		f.start(name, t)
+	}
+	t.lastSeen = now
+	return t
+}
+
+// gc stops forwarding to the tenants idle for tenantIdleTimeout. Their
+// clients stop once they sent the queued entries.
+func (f *tenantForwarder) gc(now time.Time) {
+	f.lastGC = now
+	for name, t := range f.tenants {
+		if !t.owned || len(t.entries) > 0 || now.Sub(t.lastSeen) < tenantIdleTimeout {
+			continue
+		}
+		delete(f.tenants, name)
+		close(t.entries)
+		level.Debug(f.logger).Log("msg", "stopped the clients of an idle tenant", "tenant", name)
+	}
+}
+
+func (f *tenantForwarder) trySend(e loki.Entry) bool {
+	select {
+	case f.tenant(e).entries <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *tenantForwarder) send(e loki.Entry) {
+	f.tenant(e).entries <- e
+}
+
+func (f *tenantForwarder) ready() <-chan struct{} {
+	return f.readyCh
+}
+
+// stop waits for the queued entries to be sent, and stops the clients of
+// the tenants. The clients of the manager aren't stopped.
+func (f *tenantForwarder) stop() {
+	f.mut.Lock()
+	for name, t := range f.tenants {
+		delete(f.tenants, name)
+		close(t.entries)
+	}
+	f.mut.Unlock()
+	f.wg.Wait()
+}
+
+// stopNow stops the clients of the tenants without waiting for their
+// retries.
+func (f *tenantForwarder) stopNow() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	for _, t := range f.tenants {
+		if !t.owned {
+			continue
+		}
+		for _, c := range t.clients {
+			c.StopNow()
+		}
+	}
+}
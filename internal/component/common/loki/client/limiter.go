@@ -0,0 +1,499 @@
+package client
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"golang.org/x/time/rate"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+)
+
+const (
+	// sourceIdleTimeout is the time after which the buckets of a stream
+	// without entries are removed.
+	sourceIdleTimeout = 5 * time.Minute
+	sourceGCInterval  = time.Minute
+	// minReleaseWait bounds how often parked entries are released.
+	minReleaseWait = time.Millisecond
+
+	// dropReasonRateLimited, dropReasonParkFull and dropReasonTenantBlocked
+	// are the reasons of the bytes dropped by a SourceLimiter.
+	dropReasonRateLimited   = "rate_limited"
+	dropReasonParkFull      = "park_full"
+	dropReasonTenantBlocked = "tenant_blocked"
+)
+
+// sourceLabels are the labels identifying the source of a stream in the
+// metrics when the streams aren't grouped, so that the number of series is
+// bounded by the number of jobs rather than streams.
+var sourceLabels = []string{"job"}
+
+// SourceLimiter limits the bytes of the lines sent per stream and per group
+// of streams, so that a noisy source, e.g. a crash-looping container, doesn't
+// use up the capacity of the clients shared with the other sources.
+//
+// Entries over the limits are dropped, or parked until the buckets refill
+// with the park policy. Parked entries are released in turn across tenants,
+// and across the streams of a tenant, so that a tenant with many throttled
+// streams doesn't delay the entries of the other tenants. The entries of a
+// stream are always sent in order.
+//
+// When the downstream of a tenant is blocked, e.g. while its clients retry
+// rate limited batches, the entries of the tenant are parked until it takes
+// entries again, whatever the policy, and the other tenants keep flowing.
+type SourceLimiter struct {
+	cfg     limit.SourceConfig
+	logger  log.Logger
+	metrics *SourceLimiterMetrics
+
+	streams map[model.Fingerprint]*limitedStream
+	groups  map[string]*limitedGroup
+	sources map[string]int // Number of streams per source.
+	tenants map[string]*parkedTenant
+	parked  sourceRing[*parkedTenant]
+}
+
+// limitedStream holds the bucket and the parked entries of a stream.
+type limitedStream struct {
+	source   string
+	tenant   string
+	group    *limitedGroup
+	limiter  *rate.Limiter
+	lastSeen time.Time
+
+	entries []loki.Entry
+	bytes   int
+}
+
+// limitedGroup holds the bucket shared by the streams of a group.
+type limitedGroup struct {
+	key     string
+	limiter *rate.Limiter
+	streams int
+}
+
+// parkedTenant holds the streams of a tenant with parked entries.
+type parkedTenant struct {
+	streams sourceRing[*limitedStream]
+	// blocked is set while the downstream of the tenant doesn't take entries.
+	blocked bool
+}
+
+// limiterOutput receives the entries passed through a SourceLimiter.
+type limiterOutput interface {
+	// trySend sends e, unless the downstream of its tenant is blocked.
+	trySend(e loki.Entry) bool
+	// send sends e, waiting for the downstream of its tenant.
+	send(e loki.Entry)
+	// ready receives a value when a blocked downstream may take entries
+	// again.
+	ready() <-chan struct{}
+}
+
+// channelOutput sends the entries of all the tenants to a channel.
+type channelOutput chan<- loki.Entry
+
+func (c channelOutput) trySend(e loki.Entry) bool {
+	c <- e
+	return true
+}
+
+func (c channelOutput) send(e loki.Entry) { c <- e }
+
+func (c channelOutput) ready() <-chan struct{} { return nil }
+
+// NewSourceLimiter returns a limiter applying cfg, which must be valid.
+func NewSourceLimiter(cfg limit.SourceConfig, logger log.Logger, metrics *SourceLimiterMetrics) *SourceLimiter {
+	return &SourceLimiter{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metrics,
+		streams: make(map[model.Fingerprint]*limitedStream),
+		groups:  make(map[string]*limitedGroup),
+		sources: make(map[string]int),
+		tenants: make(map[string]*parkedTenant),
+	}
+}
+
+// Run passes the entries read from in through the limiter to the returned
+// channel, until in is closed. The entries still parked are then sent
+// regardless of the limits before the returned channel is closed.
+//
+// A limiter must be run only once.
+func (l *SourceLimiter) Run(in <-chan loki.Entry) <-chan loki.Entry {
+	out := make(chan loki.Entry)
+	go func() {
+		defer close(out)
+		l.run(in, channelOutput(out))
+	}()
+	return out
+}
+
+// run passes the entries read from in through the limiter to out, until in
+// is closed. The entries still parked are then sent regardless of the limits.
+func (l *SourceLimiter) run(in <-chan loki.Entry, out limiterOutput) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	gc := time.NewTicker(sourceGCInterval)
+	defer gc.Stop()
+
+	for {
+		var release <-chan time.Time
+		if wait, ok := l.nextRelease(time.Now()); ok {
+			timer.Reset(wait)
+			release = timer.C
+		}
+
+		select {
+		case e, ok := <-in:
+			if !ok {
+				l.flush(out.send)
+				return
+			}
+			l.handle(e, time.Now(), out.trySend)
+		case <-release:
+			l.release(time.Now(), out.trySend)
+		case <-out.ready():
+			l.unblock()
+			l.release(time.Now(), out.trySend)
+		case <-gc.C:
+			l.gc(time.Now())
+		}
+	}
+}
+
+// Wrap returns a handler passing the entries through the limiter to next.
+// Stopping the handler doesn't stop next.
+func (l *SourceLimiter) Wrap(next loki.EntryHandler) loki.EntryHandler {
+	in := make(chan loki.Entry)
+	out := l.Run(in)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range out {
+			next.Chan() <- e
+		}
+	}()
+
+	var once sync.Once
+	return loki.NewEntryHandler(in, func() {
+		once.Do(func() {
+			close(in)
+			<-done
+		})
+	})
+}
+
+// handle sends e if nothing is parked ahead of it, its tenant isn't blocked
+// and the buckets allow it. Entries over the limits are dropped or parked,
+// depending on the policy, and the other entries are parked.
+func (l *SourceLimiter) handle(e loki.Entry, now time.Time, send func(loki.Entry) bool) {
+	s := l.stream(e.Labels, now)
+	n := len(e.Line)
+	if !l.allowed(s, n, now) {
+		l.metrics.throttledBytes.WithLabelValues(s.source, l.cfg.Policy).Add(float64(n))
+		if l.cfg.Policy != limit.SourcePolicyPark {
+			l.metrics.droppedBytes.WithLabelValues(s.source, dropReasonRateLimited).Add(float64(n))
+			return
+		}
+		l.park(s, e, l.blocked(s.tenant))
+		return
+	}
+
+	blocked := l.blocked(s.tenant)
+	if len(s.entries) == 0 && !blocked {
+		if send(e) {
+			l.take(s, n, now)
+			return
+		}
+		blocked = true
+	}
+	l.park(s, e, blocked)
+}
+
+// park appends e to the entries parked for s, unless they would be over
+// MaxParkedBytes. blocked marks the tenant of s as blocked.
+func (l *SourceLimiter) park(s *limitedStream, e loki.Entry, blocked bool) {
+	n := len(e.Line)
+	if s.bytes+n > int(l.cfg.MaxParkedBytes) {
+		reason := dropReasonParkFull
+		if blocked {
+			reason = dropReasonTenantBlocked
+		}
+		l.metrics.droppedBytes.WithLabelValues(s.source, reason).Add(float64(n))
+		return
+	}
+
+	t, ok := l.tenants[s.tenant]
+	if !ok {
+		t = &parkedTenant{}
+		l.tenants[s.tenant] = t
+		l.parked.add(t)
+	}
+	t.blocked = t.blocked || blocked
+	if len(s.entries) == 0 {
+		t.streams.add(s)
+	}
+	s.entries = append(s.entries, e)
+	s.bytes += n
+	l.metrics.parkedBytes.WithLabelValues(s.tenant).Add(float64(n))
+}
+
+// blocked returns true if the downstream of tenant is blocked.
+func (l *SourceLimiter) blocked(tenant string) bool {
+	t, ok := l.tenants[tenant]
+	return ok && t.blocked
+}
+
+// unblock marks all the tenants as able to take entries again.
+func (l *SourceLimiter) unblock() {
+	for _, t := range l.parked.items {
+		t.blocked = false
+	}
+}
+
+// release sends the parked entries the buckets allow, an entry per tenant in
+// turn, and an entry per stream of a tenant in turn. Blocked tenants are
+// skipped.
+func (l *SourceLimiter) release(now time.Time, send func(loki.Entry) bool) {
+	for l.parked.next(func(t *parkedTenant) bool {
+		return t.streams.next(func(s *limitedStream) bool {
+			n := len(s.entries[0].Line)
+			if t.blocked || !l.allowed(s, n, now) {
+				return false
+			}
+			if !send(s.entries[0]) {
+				t.blocked = true
+				return false
+			}
+			l.take(s, n, now)
+			l.pop(s)
+			return true
+		})
+	}) {
+	}
+}
+
+// flush sends all the parked entries, regardless of the limits.
+func (l *SourceLimiter) flush(send func(loki.Entry)) {
+	for l.parked.next(func(t *parkedTenant) bool {
+		return t.streams.next(func(s *limitedStream) bool {
+			send(l.pop(s))
+			return true
+		})
+	}) {
+	}
+}
+
+// pop removes the first entry parked for s and returns it.
+func (l *SourceLimiter) pop(s *limitedStream) loki.Entry {
+	e := s.entries[0]
+	s.entries[0] = loki.Entry{}
+	s.entries = s.entries[1:]
+	s.bytes -= len(e.Line)
+	l.metrics.parkedBytes.WithLabelValues(s.tenant).Sub(float64(len(e.Line)))
+
+	if len(s.entries) == 0 {
+		s.entries = nil
+		t := l.tenants[s.tenant]
+		t.streams.remove(s)
+		if len(t.streams.items) == 0 {
+			delete(l.tenants, s.tenant)
+			l.parked.remove(t)
+		}
+	}
+	return e
+}
+
+// nextRelease returns the time until the next parked entry can be released,
+// or false if no entry of a tenant which isn't blocked is parked.
+func (l *SourceLimiter) nextRelease(now time.Time) (time.Duration, bool) {
+	var (
+		next  time.Duration
+		found bool
+	)
+	for _, t := range l.parked.items {
+		if t.blocked {
+			continue
+		}
+		for _, s := range t.streams.items {
+			n := len(s.entries[0].Line)
+			wait := max(tokensWait(s.limiter, n, now), tokensWait(s.group.limiter, n, now))
+			if !found || wait < next {
+				next, found = wait, true
+			}
+		}
+	}
+	return max(next, minReleaseWait), found
+}
+
+// gc removes the streams without parked entries which were idle for
+// sourceIdleTimeout, the groups without streams, and the metrics of the
+// sources without streams.
+func (l *SourceLimiter) gc(now time.Time) {
+	var removed int
+	for fp, s := range l.streams {
+		if len(s.entries) > 0 || now.Sub(s.lastSeen) < sourceIdleTimeout {
+			continue
+		}
+		delete(l.streams, fp)
+		if s.group.streams--; s.group.streams == 0 {
+			delete(l.groups, s.group.key)
+		}
+		if l.sources[s.source]--; l.sources[s.source] == 0 {
+			delete(l.sources, s.source)
+			l.deleteSourceMetrics(s.source)
+		}
+		removed++
+	}
+	if removed > 0 {
+		level.Debug(l.logger).Log("msg", "removed idle streams from the source limiter", "removed", removed, "streams", len(l.streams))
+	}
+}
+
+func (l *SourceLimiter) deleteSourceMetrics(source string) {
+	l.metrics.throttledBytes.Delete(prometheus.Labels{"source": source, "policy": l.cfg.Policy})
+	for _, reason := range []string{dropReasonRateLimited, dropReasonParkFull, dropReasonTenantBlocked} {
+		l.metrics.droppedBytes.Delete(prometheus.Labels{"source": source, "reason": reason})
+	}
+}
+
+// stream returns the limits of the stream with the labels ls.
+func (l *SourceLimiter) stream(ls model.LabelSet, now time.Time) *limitedStream {
+	fp := ls.Fingerprint()
+	s, ok := l.streams[fp]
+	if !ok {
+		key := labelsKey(ls, l.cfg.GroupBy)
+		g, ok := l.groups[key]
+		if !ok {
+			g = &limitedGroup{key: key, limiter: newBytesLimiter(l.cfg.GroupRate.Val(), l.cfg.GroupBurst.Val())}
+			l.groups[key] = g
+		}
+		g.streams++
+
+		source := key
+		if len(l.cfg.GroupBy) == 0 {
+			source = labelsKey(ls, sourceLabels)
+		}
+		l.sources[source]++
+		s = &limitedStream{
+			source:  source,
+			tenant:  string(ls[ReservedLabelTenantID]),
+			group:   g,
+			limiter: newBytesLimiter(l.cfg.StreamRate.Val(), l.cfg.StreamBurst.Val()),
+		}
+		l.streams[fp] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// labelsKey returns the values of the labels names in ls, formatted as a
+// label set.
+func labelsKey(ls model.LabelSet, names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+`"`+string(ls[model.LabelName(name)])+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// allowed returns true if both buckets of s have the tokens to send n bytes.
+func (l *SourceLimiter) allowed(s *limitedStream, n int, now time.Time) bool {
+	return tokensWait(s.limiter, n, now) == 0 && tokensWait(s.group.limiter, n, now) == 0
+}
+
+// take takes n bytes from the buckets of s.
+func (l *SourceLimiter) take(s *limitedStream, n int, now time.Time) {
+	takeTokens(s.limiter, n, now)
+	takeTokens(s.group.limiter, n, now)
+}
+
+// newBytesLimiter returns a bucket of bytes per second, or nil if rate is 0.
+// The burst defaults to the rate.
+func newBytesLimiter(bytesRate, burst int) *rate.Limiter {
+	if bytesRate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = bytesRate
+	}
+	return rate.NewLimiter(rate.Limit(bytesRate), burst)
+}
+
+// tokensWait returns the time until lim has the tokens to send n bytes. Lines
+// larger than the burst only wait for a full bucket.
+func tokensWait(lim *rate.Limiter, n int, now time.Time) time.Duration {
+	if lim == nil {
+		return 0
+	}
+	missing := float64(min(n, lim.Burst())) - lim.TokensAt(now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(lim.Limit()) * float64(time.Second))
+}
+
+func takeTokens(lim *rate.Limiter, n int, now time.Time) {
+	if lim != nil {
+		lim.AllowN(now, min(n, lim.Burst()))
+	}
+}
+
+// sourceRing takes items in turn.
+type sourceRing[T comparable] struct {
+	items []T
+	pos   int
+}
+
+func (r *sourceRing[T]) add(item T) {
+	r.items = append(r.items, item)
+}
+
+func (r *sourceRing[T]) remove(item T) {
+	for i, it := range r.items {
+		if it != item {
+			continue
+		}
+		r.items = append(r.items[:i], r.items[i+1:]...)
+		if i < r.pos {
+			r.pos--
+		}
+		if r.pos >= len(r.items) {
+			r.pos = 0
+		}
+		return
+	}
+}
+
+// next calls f on the items, starting after the item f last returned true
+// for, until f returns true again. f may remove the item it's called on.
+// next returns false if f returned false for all the items.
+func (r *sourceRing[T]) next(f func(T) bool) bool {
+	for i, n := 0, len(r.items); i < n; i++ {
+		idx := (r.pos + i) % n
+		prev := r.pos
+		r.pos = idx + 1
+		if f(r.items[idx]) {
+			if r.pos >= len(r.items) {
+				r.pos = 0
+			}
+			return true
+		}
+		r.pos = prev
+	}
+	return false
+}
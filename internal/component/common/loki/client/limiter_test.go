@@ -0,0 +1,245 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+)
+
+func newTestSourceLimiter(t *testing.T, cfg limit.SourceConfig) (*SourceLimiter, *SourceLimiterMetrics) {
+	t.Helper()
+	require.NoError(t, cfg.Validate())
+	metrics := NewSourceLimiterMetrics(prometheus.NewRegistry())
+	return NewSourceLimiter(cfg, log.NewNopLogger(), metrics), metrics
+}
+
+func limiterEntry(ls model.LabelSet, line string) loki.Entry {
+	return loki.Entry{Labels: ls, Entry: logproto.Entry{Timestamp: time.Now(), Line: line}}
+}
+
+// collect returns a send function appending the lines it's called with.
+func collect(lines *[]string) func(loki.Entry) bool {
+	return func(e loki.Entry) bool {
+		*lines = append(*lines, e.Line)
+		return true
+	}
+}
+
+func TestSourceLimiter_Drop(t *testing.T) {
+	l, metrics := newTestSourceLimiter(t, limit.SourceConfig{
+		StreamRate: 100,
+		Policy:     limit.SourcePolicyDrop,
+	})
+	noisy := model.LabelSet{"job": "geth", "container": "noisy"}
+	quiet := model.LabelSet{"job": "lighthouse", "container": "quiet"}
+
+	var sent []string
+	now := time.Now()
+	l.handle(limiterEntry(noisy, strings.Repeat("a", 60)), now, collect(&sent))
+	l.handle(limiterEntry(noisy, strings.Repeat("b", 60)), now, collect(&sent))
+	l.handle(limiterEntry(quiet, strings.Repeat("c", 60)), now, collect(&sent))
+	// The bucket of the noisy stream refills after 600ms.
+	l.handle(limiterEntry(noisy, strings.Repeat("d", 60)), now.Add(600*time.Millisecond), collect(&sent))
+
+	require.Equal(t, []string{strings.Repeat("a", 60), strings.Repeat("c", 60), strings.Repeat("d", 60)}, sent)
+	// Without group_by, the streams are reported by job.
+	require.Equal(t, 60.0, testutil.ToFloat64(metrics.throttledBytes.WithLabelValues(`{job="geth"}`, "drop")))
+	require.Equal(t, 60.0, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues(`{job="geth"}`, "rate_limited")))
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.throttledBytes.WithLabelValues(`{job="lighthouse"}`, "drop")))
+}
+
+func TestSourceLimiter_Park(t *testing.T) {
+	l, metrics := newTestSourceLimiter(t, limit.SourceConfig{
+		StreamRate:     100,
+		Policy:         limit.SourcePolicyPark,
+		MaxParkedBytes: 60,
+	})
+	noisy := model.LabelSet{"job": "geth", "container": "noisy"}
+	quiet := model.LabelSet{"job": "lighthouse", "container": "quiet"}
+
+	var sent []string
+	now := time.Now()
+	for _, line := range []string{"aaaaaaaaaa", strings.Repeat("b", 90), strings.Repeat("c", 50), strings.Repeat("d", 50), "e"} {
+		l.handle(limiterEntry(noisy, line), now, collect(&sent))
+	}
+	// The entries of other streams aren't held back.
+	l.handle(limiterEntry(quiet, "quiet"), now, collect(&sent))
+	require.Equal(t, []string{"aaaaaaaaaa", strings.Repeat("b", 90), "quiet"}, sent)
+
+	// d doesn't fit in the parked bytes, e is parked behind c.
+	require.Equal(t, 50.0, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues(`{job="geth"}`, "park_full")))
+	require.Equal(t, 51.0, testutil.ToFloat64(metrics.parkedBytes.WithLabelValues("")))
+
+	wait, ok := l.nextRelease(now)
+	require.True(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	sent = nil
+	l.release(now.Add(500*time.Millisecond), collect(&sent))
+	require.Equal(t, []string{strings.Repeat("c", 50)}, sent)
+	l.release(now.Add(510*time.Millisecond), collect(&sent))
+	require.Equal(t, []string{strings.Repeat("c", 50), "e"}, sent)
+
+	_, ok = l.nextRelease(now)
+	require.False(t, ok)
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.parkedBytes.WithLabelValues("")))
+}
+
+func TestSourceLimiter_FairRelease(t *testing.T) {
+	// A single group of all the streams limits the total rate.
+	l, _ := newTestSourceLimiter(t, limit.SourceConfig{
+		GroupRate:      10,
+		Policy:         limit.SourcePolicyPark,
+		MaxParkedBytes: 100,
+	})
+	var (
+		a1 = model.LabelSet{ReservedLabelTenantID: "a", "container": "1"}
+		a2 = model.LabelSet{ReservedLabelTenantID: "a", "container": "2"}
+		b1 = model.LabelSet{ReservedLabelTenantID: "b", "container": "1"}
+	)
+
+	var sent []string
+	now := time.Now()
+	l.handle(limiterEntry(a1, "a1-0000000"), now, collect(&sent))
+	for i := 1; i <= 3; i++ {
+		l.handle(limiterEntry(a1, "a1-"+strings.Repeat("x", i)), now, collect(&sent))
+		l.handle(limiterEntry(a2, "a2-"+strings.Repeat("x", i)), now, collect(&sent))
+		l.handle(limiterEntry(b1, "b1-"+strings.Repeat("x", i)), now, collect(&sent))
+	}
+	require.Equal(t, []string{"a1-0000000"}, sent)
+
+	// The bucket refills with 10 bytes per second, enough for a line of each
+	// tenant. A tenant whose next line doesn't fit yet is skipped until the
+	// next release.
+	for i := 1; i <= 5; i++ {
+		l.release(now.Add(time.Duration(i)*time.Second), collect(&sent))
+	}
+	require.Equal(t, []string{
+		"a1-0000000",
+		"a1-x", "b1-x",
+		"a2-x", "b1-xx",
+		"a1-xx", "a2-xx",
+		"b1-xxx",
+		"a1-xxx",
+	}, sent)
+
+	// The remaining entries are sent when the limiter stops.
+	l.flush(func(e loki.Entry) { collect(&sent)(e) })
+	require.Equal(t, "a2-xxx", sent[len(sent)-1])
+}
+
+func TestSourceLimiter_BlockedTenant(t *testing.T) {
+	l, metrics := newTestSourceLimiter(t, limit.SourceConfig{
+		StreamRate:     1000,
+		Policy:         limit.SourcePolicyDrop,
+		MaxParkedBytes: 10,
+	})
+	var (
+		a = model.LabelSet{ReservedLabelTenantID: "a", "job": "geth"}
+		b = model.LabelSet{ReservedLabelTenantID: "b", "job": "geth"}
+	)
+
+	var sent []string
+	blocked := true
+	send := func(e loki.Entry) bool {
+		if blocked && e.Labels[ReservedLabelTenantID] == "a" {
+			return false
+		}
+		return collect(&sent)(e)
+	}
+
+	now := time.Now()
+	l.handle(limiterEntry(a, "a-1"), now, send)
+	l.handle(limiterEntry(b, "b-1"), now, send)
+	l.handle(limiterEntry(a, "a-2"), now, send)
+	l.handle(limiterEntry(a, "a-toolong"), now, send)
+	l.handle(limiterEntry(b, "b-2"), now, send)
+
+	// The entries of the blocked tenant are parked, whatever the policy, and
+	// don't hold back the other tenant.
+	require.Equal(t, []string{"b-1", "b-2"}, sent)
+	require.Equal(t, 6.0, testutil.ToFloat64(metrics.parkedBytes.WithLabelValues("a")))
+	require.Equal(t, 9.0, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues(`{job="geth"}`, "tenant_blocked")))
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.throttledBytes.WithLabelValues(`{job="geth"}`, "drop")))
+
+	// Blocked tenants wait until their downstream is ready.
+	_, ok := l.nextRelease(now)
+	require.False(t, ok)
+	l.release(now, send)
+	require.Equal(t, []string{"b-1", "b-2"}, sent)
+
+	blocked = false
+	l.unblock()
+	l.release(now, send)
+	require.Equal(t, []string{"b-1", "b-2", "a-1", "a-2"}, sent)
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.parkedBytes.WithLabelValues("a")))
+}
+
+func TestSourceLimiter_GroupBy(t *testing.T) {
+	l, metrics := newTestSourceLimiter(t, limit.SourceConfig{
+		GroupBy:   []string{"container"},
+		GroupRate: 100,
+		Policy:    limit.SourcePolicyDrop,
+	})
+
+	var sent []string
+	now := time.Now()
+	// The streams of a container share its bucket.
+	l.handle(limiterEntry(model.LabelSet{"container": "app", "stream": "stdout"}, strings.Repeat("a", 60)), now, collect(&sent))
+	l.handle(limiterEntry(model.LabelSet{"container": "app", "stream": "stderr"}, strings.Repeat("b", 60)), now, collect(&sent))
+	l.handle(limiterEntry(model.LabelSet{"container": "db", "stream": "stderr"}, strings.Repeat("c", 60)), now, collect(&sent))
+
+	require.Equal(t, []string{strings.Repeat("a", 60), strings.Repeat("c", 60)}, sent)
+	require.Equal(t, 60.0, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues(`{container="app"}`, "rate_limited")))
+
+	// Idle streams are removed, with their groups and the series of their
+	// sources.
+	l.gc(now.Add(sourceIdleTimeout))
+	require.Empty(t, l.streams)
+	require.Empty(t, l.groups)
+	require.Empty(t, l.sources)
+	require.Equal(t, 0, testutil.CollectAndCount(metrics.throttledBytes))
+	require.Equal(t, 0, testutil.CollectAndCount(metrics.droppedBytes))
+}
+
+func TestSourceLimiter_Run(t *testing.T) {
+	l, _ := newTestSourceLimiter(t, limit.SourceConfig{
+		StreamRate:     1000,
+		StreamBurst:    10,
+		Policy:         limit.SourcePolicyPark,
+		MaxParkedBytes: 1000,
+	})
+	in := make(chan loki.Entry)
+	out := l.Run(in)
+
+	var received []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range out {
+			received = append(received, e.Line)
+		}
+	}()
+
+	var expected []string
+	ls := model.LabelSet{"container": "noisy"}
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat(string(rune('a'+i)), 10)
+		expected = append(expected, line)
+		in <- limiterEntry(ls, line)
+	}
+	close(in)
+	<-done
+
+	require.Equal(t, expected, received)
+}
@@ -77,10 +77,15 @@ type Manager struct {
 
 	clients []Client
 	pairs   []watcherClientPair
+	markers []internal.MarkerHandler
 
 	entries chan loki.Entry
 	once    sync.Once
 
+	// tenants forwards the entries per tenant when the source limits are
+	// enabled.
+	tenants *tenantForwarder
+
 	wg sync.WaitGroup
 }
 
@@ -99,6 +104,7 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 	clientsCheck := make(map[string]struct{})
 	clients := make([]Client, 0, len(clientCfgs))
 	pairs := make([]watcherClientPair, 0, len(clientCfgs))
+	var markers []internal.MarkerHandler
 	for _, cfg := range clientCfgs {
 		// Don't allow duplicate clients, we have client specific metrics that need at least one unique label value (name).
 		clientName := GetClientName(cfg)
@@ -117,6 +123,7 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 				return nil, err
 			}
 			markerHandler := internal.NewMarkerHandler(markerFileHandler, walCfg.MaxSegmentAge, logger, walMarkerMetrics.WithCurriedId(clientName))
+			markers = append(markers, markerHandler)
 
 			queue, err := NewQueue(metrics, queueClientMetrics.CurryWithId(clientName), cfg, limits.MaxStreams, limits.MaxLineSize.Val(), limits.MaxLineSizeTruncate, logger, markerHandler)
 			if err != nil {
@@ -154,6 +161,7 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 	manager := &Manager{
 		clients: clients,
 		pairs:   pairs,
+		markers: markers,
 		entries: make(chan loki.Entry),
 	}
 	if walCfg.Enabled {
@@ -161,7 +169,26 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 		manager.startWithConsume()
 	} else {
 		manager.name = buildManagerName("multi", clientCfgs...)
-		manager.startWithForward()
+		if limits.Sources.Enabled() {
+			limiter := NewSourceLimiter(limits.Sources, logger, NewSourceLimiterMetrics(reg))
+			manager.tenants = newTenantForwarder(clients, func() ([]Client, error) {
+				tenantClients := make([]Client, 0, len(clientCfgs))
+				for _, cfg := range clientCfgs {
+					c, err := New(metrics, cfg, limits.MaxStreams, limits.MaxLineSize.Val(), limits.MaxLineSizeTruncate, logger)
+					if err != nil {
+						for _, c := range tenantClients {
+							c.Stop()
+						}
+						return nil, err
+					}
+					tenantClients = append(tenantClients, c)
+				}
+				return tenantClients, nil
+			}, logger)
+			manager.startWithLimiter(limiter)
+		} else {
+			manager.startWithForward()
+		}
 	}
 	return manager, nil
 }
@@ -196,12 +223,42 @@ func (m *Manager) startWithForward() {
 	}()
 }
 
+// startWithLimiter starts the main manager routine, which passes the entries read from the exposed channel through
+// limiter, and forwards them to the clients of their tenant. The entries of a tenant whose clients block are parked by
+// limiter, so that the other tenants aren't blocked.
+func (m *Manager) startWithLimiter(limiter *SourceLimiter) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		limiter.run(m.entries, m.tenants)
+		m.tenants.stop()
+	}()
+}
+
 func (m *Manager) StopNow() {
+	if m.tenants != nil {
+		m.tenants.stopNow()
+	}
 	for _, pair := range m.pairs {
 		pair.client.StopNow()
 	}
 }
 
+// LastMarkedSegment implements wal.Marker, returning the last WAL segment read by all clients, or -1 if the WAL is
+// disabled or a client didn't mark a segment yet.
+func (m *Manager) LastMarkedSegment() int {
+	if len(m.markers) == 0 {
+		return -1
+	}
+	lowest := m.markers[0].LastMarkedSegment()
+	for _, marker := range m.markers[1:] {
+		if segment := marker.LastMarkedSegment(); segment < lowest {
+			lowest = segment
+		}
+	}
+	return lowest
+}
+
 func (m *Manager) Name() string {
 	return m.name
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -250,6 +251,119 @@ func TestManager_WALDisabled(t *testing.T) {
 	require.Len(t, seenEntries, totalLines)
 }
 
+func TestManager_WALDisabled_SourceLimits(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	logger := log.NewLogfmtLogger(os.Stdout)
+	testClientConfig, rwReceivedReqs, closeServer := newServerAndClientConfig(t)
+
+	limits := testLimitsConfig
+	limits.Sources = limit.SourceConfig{
+		StreamRate:  1,
+		StreamBurst: 10,
+		Policy:      limit.SourcePolicyDrop,
+	}
+	manager, err := NewManager(NewMetrics(reg), logger, limits, reg, wal.Config{}, NilNotifier, testClientConfig)
+	require.NoError(t, err)
+
+	receivedRequests := utils.NewSyncSlice[utils.RemoteWriteRequest]()
+	go func() {
+		for req := range rwReceivedReqs {
+			receivedRequests.Append(req)
+		}
+	}()
+
+	defer func() {
+		manager.Stop()
+		closeServer.Close()
+	}()
+
+	noisy := model.LabelSet{"container": "noisy"}
+	for i := 0; i < 10; i++ {
+		manager.Chan() <- loki.Entry{
+			Labels: noisy,
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: fmt.Sprintf("line%d", i)},
+		}
+	}
+	manager.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"container": "quiet"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "quiet"},
+	}
+
+	// the burst of the noisy stream only allows its first two lines
+	require.Eventually(t, func() bool {
+		return receivedRequests.Length() == 3
+	}, 5*time.Second, 100*time.Millisecond, "timed out waiting for requests to be received")
+
+	var seenEntries []string
+	defer receivedRequests.DoneIterate()
+	for _, req := range receivedRequests.StartIterate() {
+		for _, stream := range req.Request.Streams {
+			for _, entry := range stream.Entries {
+				seenEntries = append(seenEntries, entry.Line)
+			}
+		}
+	}
+	require.ElementsMatch(t, []string{"line0", "line1", "quiet"}, seenEntries)
+}
+
+func TestManager_WALDisabled_SourceLimits_BlockedTenant(t *testing.T) {
+	// The endpoint holds the requests of the slow tenant until the end of the
+	// test.
+	unblock := make(chan struct{})
+	received := make(chan string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get("X-Scope-OrgID")
+		if tenant == "slow" {
+			<-unblock
+		}
+		received <- tenant
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	limits := testLimitsConfig
+	limits.Sources = limit.SourceConfig{
+		StreamRate:     1 << 20,
+		Policy:         limit.SourcePolicyDrop,
+		MaxParkedBytes: 1 << 10,
+	}
+	reg := prometheus.NewRegistry()
+	manager, err := NewManager(NewMetrics(reg), log.NewNopLogger(), limits, reg, wal.Config{}, NilNotifier, Config{
+		Name:      "test-client",
+		URL:       flagext.URLValue{URL: serverURL},
+		Timeout:   10 * time.Second,
+		BatchSize: 1,
+		BatchWait: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer func() {
+		close(unblock)
+		manager.Stop()
+	}()
+
+	// Enough entries of the slow tenant to fill the queue of its clients.
+	slow := model.LabelSet{ReservedLabelTenantID: "slow", "job": "geth"}
+	for i := 0; i < 2*tenantQueueLength; i++ {
+		manager.Chan() <- loki.Entry{
+			Labels: slow,
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: fmt.Sprintf("line%d", i)},
+		}
+	}
+	manager.Chan() <- loki.Entry{
+		Labels: model.LabelSet{ReservedLabelTenantID: "fast", "job": "geth"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "fast"},
+	}
+
+	select {
+	case tenant := <-received:
+		require.Equal(t, "fast", tenant)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the entries of the fast tenant")
+	}
+}
+
 func TestManager_WALDisabled_MultipleConfigs(t *testing.T) {
 	walConfig := wal.Config{}
 	// start all necessary resources
@@ -35,3 +35,47 @@ func (m *QueueClientMetrics) CurryWithId(id string) *QueueClientMetrics {
 		}),
 	}
 }
+
+// SourceLimiterMetrics holds the metrics of a SourceLimiter.
+type SourceLimiterMetrics struct {
+	throttledBytes *prometheus.CounterVec
+	droppedBytes   *prometheus.CounterVec
+	parkedBytes    *prometheus.GaugeVec
+}
+
+func NewSourceLimiterMetrics(reg prometheus.Registerer) *SourceLimiterMetrics {
+	m := &SourceLimiterMetrics{
+		throttledBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "loki_write",
+				Name:      "source_throttled_bytes_total",
+				Help:      "Bytes of the lines over the limits of their source, by source and policy",
+			},
+			[]string{"source", "policy"},
+		),
+		droppedBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "loki_write",
+				Name:      "source_dropped_bytes_total",
+				Help:      "Bytes of the lines dropped by the source limits, by source and reason",
+			},
+			[]string{"source", "reason"},
+		),
+		parkedBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "loki_write",
+				Name:      "source_parked_bytes",
+				Help:      "Bytes of the lines parked until their source is under its limits, by tenant",
+			},
+			[]string{"tenant"},
+		),
+	}
+
+	if reg != nil {
+		m.throttledBytes = util.MustRegisterOrGet(reg, m.throttledBytes).(*prometheus.CounterVec)
+		m.droppedBytes = util.MustRegisterOrGet(reg, m.droppedBytes).(*prometheus.CounterVec)
+		m.parkedBytes = util.MustRegisterOrGet(reg, m.parkedBytes).(*prometheus.GaugeVec)
+	}
+
+	return m
+}
@@ -132,9 +132,13 @@ func (q *queue) closeAndDrain(ctx context.Context) {
 }
 
 // sendAndReport attempts to send the batch for the given tenant, and either way that operation succeeds or fails, reports
-// the data as sent.
+// the data as sent. Batches interrupted by the client being stopped aren't reported, so they're read again from the WAL
+// on restart.
 func (q *queue) sendAndReport(ctx context.Context, tenantId string, b *batch) {
 	q.client.sendBatch(ctx, tenantId, b)
+	if q.client.ctx.Err() != nil {
+		return
+	}
 	// mark segment data for that batch as sent, even if the send operation failed
 	b.reportAsSentData(q.client.markerHandler)
 }
@@ -579,6 +583,9 @@ func (c *queueClient) Stop() {
 	// fire timeout timer
 	ctx, cancel := context.WithTimeout(context.Background(), c.drainTimeout)
 	defer cancel()
+	// stop retrying the batch being sent when the timeout is exceeded, since it would otherwise block draining
+	stopCancelOnTimeout := context.AfterFunc(ctx, c.cancel)
+	defer stopCancelOnTimeout()
 
 	// enqueue batches that might be pending in the batches map
 	c.enqueuePendingBatches(ctx)
@@ -1,6 +1,8 @@
 package limit
 
 import (
+	"fmt"
+
 	"github.com/grafana/loki/pkg/util/flagext"
 )
 
@@ -12,4 +14,64 @@ type Config struct {
 	MaxStreams          int              `mapstructure:"max_streams" yaml:"max_streams" json:"max_streams"`
 	MaxLineSize         flagext.ByteSize `mapstructure:"max_line_size" yaml:"max_line_size" json:"max_line_size"`
 	MaxLineSizeTruncate bool             `mapstructure:"max_line_size_truncate" yaml:"max_line_size_truncate" json:"max_line_size_truncate"`
+
+	// Sources limits the bytes sent per stream and per group of streams.
+	Sources SourceConfig `mapstructure:"sources,omitempty" yaml:"sources,omitempty" json:"sources"`
+}
+
+// Policies applied to the entries of a source over its limits.
+const (
+	SourcePolicyDrop = "drop"
+	SourcePolicyPark = "park"
+)
+
+// DefaultSourceConfig holds the default settings of source limits.
+var DefaultSourceConfig = SourceConfig{
+	Policy:         SourcePolicyDrop,
+	MaxParkedBytes: 1 << 20,
+}
+
+// SourceConfig configures token buckets limiting the bytes of the lines sent
+// per stream, and per group of streams with the same values of the GroupBy
+// labels, e.g. per container. Without GroupBy labels, all the streams are in
+// a single group. A limit is disabled when its rate is 0.
+//
+// Entries over the limits are dropped, or parked with the park policy until
+// the buckets refill. At most MaxParkedBytes are parked per stream.
+type SourceConfig struct {
+	StreamRate     flagext.ByteSize `mapstructure:"stream_rate,omitempty" yaml:"stream_rate,omitempty" json:"stream_rate"`
+	StreamBurst    flagext.ByteSize `mapstructure:"stream_burst,omitempty" yaml:"stream_burst,omitempty" json:"stream_burst"`
+	GroupBy        []string         `mapstructure:"group_by,omitempty" yaml:"group_by,omitempty" json:"group_by"`
+	GroupRate      flagext.ByteSize `mapstructure:"group_rate,omitempty" yaml:"group_rate,omitempty" json:"group_rate"`
+	GroupBurst     flagext.ByteSize `mapstructure:"group_burst,omitempty" yaml:"group_burst,omitempty" json:"group_burst"`
+	Policy         string           `mapstructure:"policy,omitempty" yaml:"policy,omitempty" json:"policy"`
+	MaxParkedBytes flagext.ByteSize `mapstructure:"max_parked_bytes,omitempty" yaml:"max_parked_bytes,omitempty" json:"max_parked_bytes"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *SourceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSourceConfig
+	type sourceConfig SourceConfig
+	if err := unmarshal((*sourceConfig)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Enabled returns true if a limit is set.
+func (c *SourceConfig) Enabled() bool {
+	return c.StreamRate > 0 || c.GroupRate > 0
+}
+
+// Validate returns an error if c is invalid.
+func (c *SourceConfig) Validate() error {
+	switch c.Policy {
+	case SourcePolicyDrop, SourcePolicyPark:
+	default:
+		return fmt.Errorf("unsupported source limits policy %q, expected %q or %q", c.Policy, SourcePolicyDrop, SourcePolicyPark)
+	}
+	if c.Policy == SourcePolicyPark && c.MaxParkedBytes <= 0 {
+		return fmt.Errorf("source limits max_parked_bytes must be greater than 0")
+	}
+	return nil
 }
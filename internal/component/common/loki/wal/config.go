@@ -31,6 +31,10 @@ type Config struct {
 	// Note that this functionality will likely be deprecated in favour of a programmatic cleanup mechanism.
 	MaxSegmentAge time.Duration
 
+	// MaxSize is the maximum size in bytes of the segments on disk. When it's exceeded, the oldest segments are removed
+	// even if they weren't read yet, and their unread entries are counted as dropped. Zero disables the limit.
+	MaxSize uint64
+
 	// WatchConfig configures the backoff retry used by a WAL watcher when reading from segments not via
 	// the notification channel.
 	WatchConfig WatchConfig
@@ -54,6 +58,10 @@ type WatchConfig struct {
 	// DrainTimeout is the maximum amount of time that the Watcher can spend draining the remaining segments in the WAL.
 	// After that time, the Watcher is stopped immediately, dropping all the work in process.
 	DrainTimeout time.Duration
+
+	// ReplayUnmarked makes the Watcher start reading from the first segment when no segment was marked yet, instead of
+	// the last one. This replays the entries written before a restart even if none were sent before it.
+	ReplayUnmarked bool
 }
 
 // UnmarshalYAML implement YAML Unmarshaler
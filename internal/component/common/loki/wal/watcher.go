@@ -92,6 +92,9 @@ type Watcher struct {
 	drainTimeout time.Duration
 	marker       Marker
 	savedSegment int
+
+	// replayUnmarked is true if the watcher should start from the first segment when no segment was marked.
+	replayUnmarked bool
 }
 
 // NewWatcher creates a new Watcher.
@@ -111,6 +114,8 @@ func NewWatcher(walDir, id string, metrics *WatcherMetrics, writeTo WriteTo, log
 		minReadFreq:  config.MinReadFrequency,
 		maxReadFreq:  config.MaxReadFrequency,
 		drainTimeout: config.DrainTimeout,
+
+		replayUnmarked: config.ReplayUnmarked,
 	}
 }
 
@@ -160,8 +165,8 @@ func (w *Watcher) run() error {
 	currentSegment := lastSegment
 
 	// if the marker contains a valid segment number stored, and we correctly find the segment that follows that one,
-	// start tailing from there.
-	if nextToMarkedSegment, err := w.findNextSegmentFor(w.savedSegment); w.savedSegment != -1 && err == nil {
+	// start tailing from there. If configured to, start from the first segment if no segment was marked yet.
+	if nextToMarkedSegment, err := w.findNextSegmentFor(w.savedSegment); (w.savedSegment != -1 || w.replayUnmarked) && err == nil {
 		currentSegment = nextToMarkedSegment
 		// keep a separate metric that will help us track when the segment in the marker is used. This should be considered
 		// a replay event
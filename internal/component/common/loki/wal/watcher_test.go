@@ -569,6 +569,77 @@ func TestWatcher_Replay(t *testing.T) {
 		}, time.Second*10, time.Second, "timed out waiting for watcher to catch up")
 		writeTo.AssertContainsLines(t, segment2Lines...)
 	})
+
+	t.Run("replay all segments if invalid marker and replaying unmarked segments", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowDebug())
+		dir := t.TempDir()
+		metrics := NewWatcherMetrics(reg)
+		writeTo := &testWriteTo{
+			series:      map[uint64]model.LabelSet{},
+			logger:      logger,
+			ReadEntries: utils.NewSyncSlice[loki.Entry](),
+		}
+		cfg := DefaultWatchConfig
+		cfg.ReplayUnmarked = true
+		// create new watcher, and defer stop
+		watcher := NewWatcher(dir, "test", metrics, writeTo, logger, cfg, mockMarker{
+			LastMarkedSegmentFunc: func() int {
+				// no segment was marked
+				return -1
+			},
+		})
+		defer watcher.Stop()
+		wl, err := New(Config{
+			Enabled: true,
+			Dir:     dir,
+		}, logger, reg)
+		require.NoError(t, err)
+		defer wl.Close()
+
+		ew := newEntryWriter()
+
+		// Write to segment 0, which was never marked, hence replayed
+		for _, line := range segment1Lines {
+			err = ew.WriteEntry(loki.Entry{
+				Labels: labels,
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      line,
+				},
+			}, wl, logger)
+			require.NoError(t, err)
+		}
+
+		// cut segment and sync
+		_, err = wl.NextSegment()
+		require.NoError(t, err)
+		require.NoError(t, wl.Sync())
+
+		// start watcher
+		watcher.Start()
+
+		// Write something after watcher started
+		for _, line := range segment2Lines {
+			err = ew.WriteEntry(loki.Entry{
+				Labels: labels,
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      line,
+				},
+			}, wl, logger)
+			require.NoError(t, err)
+		}
+
+		// sync wal, and start watcher
+		require.NoError(t, wl.Sync())
+
+		require.Eventually(t, func() bool {
+			return writeTo.ReadEntries.Length() == 6 // wait for watcher to catch up with both segments
+		}, time.Second*10, time.Second, "timed out waiting for watcher to catch up")
+		writeTo.AssertContainsLines(t, segment1Lines...)
+		writeTo.AssertContainsLines(t, segment2Lines...)
+	})
 }
 
 // slowWriteTo mimics the combination of a WriteTo and a slow remote write client. This will allow us to have a writer
@@ -15,6 +15,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
 
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
 	"github.com/grafana/loki/pkg/ingester/wal"
@@ -26,6 +27,10 @@ const (
 	minimumCleanSegmentsEvery = time.Second
 )
 
+// checkSizeEvery is how often the size of the WAL is checked against the configured limit, and the pending bytes metric
+// updated.
+var checkSizeEvery = 5 * time.Second
+
 // CleanupEventSubscriber is an interface that objects that want to receive events from the wal Writer can implement. After
 // they can subscribe to events by adding themselves as subscribers on the Writer with writer.SubscribeCleanup.
 type CleanupEventSubscriber interface {
@@ -57,9 +62,14 @@ type Writer struct {
 	writeSubscribersLock sync.RWMutex
 	writeSubscribers     []WriteEventSubscriber
 
+	markerLock sync.RWMutex
+	marker     Marker
+
 	reclaimedOldSegmentsSpaceCounter *prometheus.CounterVec
 	lastReclaimedSegment             *prometheus.GaugeVec
 	lastWrittenTimestamp             *prometheus.GaugeVec
+	droppedEntries                   *prometheus.CounterVec
+	pendingBytes                     *prometheus.GaugeVec
 
 	closeCleaner chan struct{}
 }
@@ -103,18 +113,32 @@ func NewWriter(walCfg Config, logger log.Logger, reg prometheus.Registerer) (*Wr
 		Name:      "last_written_timestamp",
 		Help:      "Latest timestamp that was written to the WAL",
 	}, []string{})
+	wrt.droppedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "loki_write",
+		Subsystem: "wal_writer",
+		Name:      "dropped_entries_total",
+		Help:      "Number of entries dropped because they couldn't be written to the WAL, or were removed to stay under the size limit before being read.",
+	}, []string{"reason"})
+	wrt.pendingBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "loki_write",
+		Subsystem: "wal_writer",
+		Name:      "pending_bytes",
+		Help:      "Size in bytes of the WAL segments which weren't read yet by all clients.",
+	}, []string{})
 
 	if reg != nil {
 		_ = reg.Register(wrt.reclaimedOldSegmentsSpaceCounter)
 		_ = reg.Register(wrt.lastReclaimedSegment)
 		_ = reg.Register(wrt.lastWrittenTimestamp)
+		_ = reg.Register(wrt.droppedEntries)
+		_ = reg.Register(wrt.pendingBytes)
 	}
 
-	wrt.start(walCfg.MaxSegmentAge)
+	wrt.start(walCfg.MaxSegmentAge, walCfg.MaxSize)
 	return wrt, nil
 }
 
-func (wrt *Writer) start(maxSegmentAge time.Duration) {
+func (wrt *Writer) start(maxSegmentAge time.Duration, maxSize uint64) {
 	wrt.wg.Add(1)
 	// main WAL writer routine
 	go func() {
@@ -122,6 +146,7 @@ func (wrt *Writer) start(maxSegmentAge time.Duration) {
 		for e := range wrt.entries {
 			if err := wrt.entryWriter.WriteEntry(e, wrt.wal, wrt.log); err != nil {
 				level.Error(wrt.log).Log("msg", "failed to write entry", "err", err)
+				wrt.droppedEntries.WithLabelValues("write_error").Inc()
 				// if an error occurred while writing the wal, go to next entry and don't notify write subscribers
 				continue
 			}
@@ -147,6 +172,7 @@ func (wrt *Writer) start(maxSegmentAge time.Duration) {
 			triggerEvery = minimumCleanSegmentsEvery
 		}
 		trigger := time.NewTicker(triggerEvery)
+		sizeTrigger := time.NewTicker(checkSizeEvery)
 		for {
 			select {
 			case <-trigger.C:
@@ -154,8 +180,13 @@ func (wrt *Writer) start(maxSegmentAge time.Duration) {
 				if err := wrt.cleanSegments(maxSegmentAge); err != nil {
 					level.Error(wrt.log).Log("msg", "Error cleaning old segments", "err", err)
 				}
+			case <-sizeTrigger.C:
+				if err := wrt.checkSize(maxSize); err != nil {
+					level.Error(wrt.log).Log("msg", "Error checking wal size", "err", err)
+				}
 			case <-wrt.closeCleaner:
 				trigger.Stop()
+				sizeTrigger.Stop()
 				return
 			}
 		}
@@ -217,16 +248,92 @@ func (wrt *Writer) cleanSegments(maxAge time.Duration) error {
 	}
 	// if we reclaimed at least one segment, notify all subscribers
 	if maxReclaimed != -1 {
-		wrt.cleanupSubscribersLock.RLock()
-		defer wrt.cleanupSubscribersLock.RUnlock()
-		for _, subscriber := range wrt.cleanupSubscribers {
-			subscriber.SeriesReset(maxReclaimed)
+		wrt.notifyCleanup(maxReclaimed)
+	}
+	return nil
+}
+
+// checkSize removes the oldest segments while the WAL is bigger than maxSize, and updates the pending bytes metric. As
+// in cleanSegments, the head segment is never removed. Entries in removed segments which weren't read by all clients
+// yet are counted as dropped. A maxSize of zero disables the limit.
+func (wrt *Writer) checkSize(maxSize uint64) error {
+	walDir := wrt.wal.Dir()
+	segments, err := listSegments(walDir)
+	if err != nil {
+		return fmt.Errorf("error reading segments in wal directory: %w", err)
+	}
+	lastMarked := wrt.lastMarkedSegment()
+
+	var totalSize uint64
+	for _, segment := range segments {
+		totalSize += uint64(segment.size)
+	}
+
+	maxReclaimed := -1
+	for maxSize > 0 && totalSize > maxSize && len(segments) > 1 {
+		segment := segments[0]
+
+		var dropped int
+		if segment.number > lastMarked {
+			dropped, err = countSegmentEntries(filepath.Join(walDir, segment.name))
+			if err != nil {
+				level.Warn(wrt.log).Log("msg", "Failed to count entries of wal segment", "err", err, "segmentNum", segment.number)
+			}
+		}
+		if err := os.Remove(filepath.Join(walDir, segment.name)); err != nil {
+			level.Error(wrt.log).Log("msg", "Error removing wal segment over size limit", "err", err, "segmentNum", segment.number)
+			break
+		}
+		level.Warn(wrt.log).Log("msg", "Removed wal segment to stay under size limit", "segmentNum", segment.number, "droppedEntries", dropped)
+
+		wrt.reclaimedOldSegmentsSpaceCounter.WithLabelValues().Add(float64(segment.size))
+		wrt.droppedEntries.WithLabelValues("size_limit").Add(float64(dropped))
+		totalSize -= uint64(segment.size)
+		maxReclaimed = segment.number
+		segments = segments[1:]
+	}
+	if maxReclaimed != -1 {
+		wrt.notifyCleanup(maxReclaimed)
+	}
+
+	var pending int64
+	for _, segment := range segments {
+		if segment.number > lastMarked {
+			pending += segment.size
 		}
-		wrt.lastReclaimedSegment.WithLabelValues().Set(float64(maxReclaimed))
 	}
+	wrt.pendingBytes.WithLabelValues().Set(float64(pending))
 	return nil
 }
 
+// notifyCleanup notifies all subscribers that segments up to maxReclaimed were removed.
+func (wrt *Writer) notifyCleanup(maxReclaimed int) {
+	wrt.cleanupSubscribersLock.RLock()
+	defer wrt.cleanupSubscribersLock.RUnlock()
+	for _, subscriber := range wrt.cleanupSubscribers {
+		subscriber.SeriesReset(maxReclaimed)
+	}
+	wrt.lastReclaimedSegment.WithLabelValues().Set(float64(maxReclaimed))
+}
+
+// SetMarker sets the Marker telling up to which segment the WAL was read by all clients. Segments after the marked one
+// count as pending, and their entries as dropped when removed because of the size limit. Without a Marker, all
+// segments are considered pending.
+func (wrt *Writer) SetMarker(marker Marker) {
+	wrt.markerLock.Lock()
+	defer wrt.markerLock.Unlock()
+	wrt.marker = marker
+}
+
+func (wrt *Writer) lastMarkedSegment() int {
+	wrt.markerLock.RLock()
+	defer wrt.markerLock.RUnlock()
+	if wrt.marker == nil {
+		return -1
+	}
+	return wrt.marker.LastMarkedSegment()
+}
+
 // SubscribeCleanup adds a new CleanupEventSubscriber that will receive cleanup events.
 func (wrt *Writer) SubscribeCleanup(subscriber CleanupEventSubscriber) {
 	wrt.cleanupSubscribersLock.Lock()
@@ -291,6 +398,30 @@ type segmentRef struct {
 	lastModified time.Time
 }
 
+// countSegmentEntries returns the number of entries written to the segment at path.
+func countSegmentEntries(path string) (int, error) {
+	segment, err := wlog.OpenReadSegment(path)
+	if err != nil {
+		return 0, err
+	}
+	defer segment.Close()
+
+	var (
+		reader = wlog.NewReader(segment)
+		count  int
+	)
+	for reader.Next() {
+		var walRec wal.Record
+		if err := wal.DecodeRecord(reader.Record(), &walRec); err != nil {
+			return count, fmt.Errorf("error decoding wal record: %w", err)
+		}
+		for _, entries := range walRec.RefEntries {
+			count += len(entries.Entries)
+		}
+	}
+	return count, reader.Err()
+}
+
 // listSegments list wal segments under the given directory, alongside with some file system information for each.
 func listSegments(dir string) (refs []segmentRef, err error) {
 	files, err := os.ReadDir(dir)
@@ -10,6 +10,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 
@@ -222,6 +223,75 @@ func TestWriter_NoSegmentIsCleanedUpIfTheresOnlyOne(t *testing.T) {
 	require.Len(t, segmentsReclaimedNotificationsReceived, 0, "expected no notification")
 }
 
+type markerFunc func() int
+
+func (f markerFunc) LastMarkedSegment() int { return f() }
+
+func TestWriter_SegmentsOverSizeLimitAreRemoved(t *testing.T) {
+	logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowDebug())
+	dir := t.TempDir()
+	reg := prometheus.NewRegistry()
+
+	writer, err := NewWriter(Config{
+		Dir:           dir,
+		Enabled:       true,
+		MaxSegmentAge: time.Hour,
+	}, logger, reg)
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	reclaimed := []int{}
+	writer.SubscribeCleanup(notifySegmentsCleanedFunc(func(num int) {
+		reclaimed = append(reclaimed, num)
+	}))
+	// the first segment was read by all clients
+	writer.SetMarker(markerFunc(func() int { return 0 }))
+
+	// write two entries to the first segment, and three to the second one
+	written := 0
+	for _, lines := range [][]string{{"a", "b"}, {"c", "d", "e"}} {
+		for _, line := range lines {
+			writer.Chan() <- loki.Entry{
+				Labels: model.LabelSet{"testing": "log"},
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      line,
+				},
+			}
+		}
+		written += len(lines)
+		eventuallyReadWAL(t, written, dir)
+		_, err = writer.wal.NextSegment()
+		require.NoError(t, err)
+	}
+
+	segments := mustListSegments(t, dir)
+	require.Len(t, segments, 3)
+	headSize := segments[2].size
+
+	// Without a limit, only the segments after the marked one are pending.
+	require.NoError(t, writer.checkSize(0))
+	require.Len(t, mustListSegments(t, dir), 3)
+	require.Equal(t, float64(segments[1].size+headSize), testutil.ToFloat64(writer.pendingBytes))
+
+	// With a limit, all segments but the head one are removed, and the unread entries are dropped.
+	require.NoError(t, writer.checkSize(1))
+	remaining := mustListSegments(t, dir)
+	require.Len(t, remaining, 1)
+	require.Equal(t, 2, remaining[0].number)
+	require.Equal(t, []int{1}, reclaimed)
+	require.Equal(t, 3.0, testutil.ToFloat64(writer.droppedEntries.WithLabelValues("size_limit")))
+	require.Equal(t, float64(headSize), testutil.ToFloat64(writer.pendingBytes))
+}
+
+func mustListSegments(t *testing.T, dir string) []segmentRef {
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	return segments
+}
+
 func watchAndLogDirEntries(t *testing.T, path string) {
 	dirs, err := os.ReadDir(path)
 	if len(dirs) == 0 {
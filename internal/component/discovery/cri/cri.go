@@ -0,0 +1,240 @@
+// Package cri implements the discovery.cri component.
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/discovery"
+	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/refresh"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "discovery.cri",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+		Exports:   discovery.Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+const (
+	criLabel                    = model.MetaLabelPrefix + "cri_"
+	criLabelNamespace           = criLabel + "namespace"
+	criLabelPodName             = criLabel + "pod_name"
+	criLabelPodUID              = criLabel + "pod_uid"
+	criLabelContainerName       = criLabel + "container_name"
+	criLabelContainerID         = criLabel + "container_id"
+	criLabelContainerImage      = criLabel + "container_image"
+	criLabelContainerRestarts   = criLabel + "container_restart_count"
+	criLabelContainerAnnotation = criLabel + "container_annotation_"
+
+	// Annotations set by the CRI plugin of containerd on the OCI spec of the
+	// containers.
+	annotationContainerType = "io.kubernetes.cri.container-type"
+	annotationContainerName = "io.kubernetes.cri.container-name"
+	annotationImageName     = "io.kubernetes.cri.image-name"
+	annotationPodName       = "io.kubernetes.cri.sandbox-name"
+	annotationPodNamespace  = "io.kubernetes.cri.sandbox-namespace"
+	annotationPodUID        = "io.kubernetes.cri.sandbox-uid"
+
+	containerTypeContainer = "container"
+)
+
+// Arguments configures the discovery.cri component.
+type Arguments struct {
+	// Path is the directory holding the logs of the pods, in the layout of
+	// the kubelet: <namespace>_<pod>_<uid>/<container>/<restart count>.log.
+	Path string `river:"path,attr,optional"`
+	// StateDir is the directory holding the bundles of the containers run by
+	// containerd, used to add the image and annotations of the containers.
+	StateDir        string        `river:"state_dir,attr,optional"`
+	RefreshInterval time.Duration `river:"refresh_interval,attr,optional"`
+}
+
+// DefaultArguments holds default values for Arguments.
+var DefaultArguments = Arguments{
+	Path:            "/var/log/pods",
+	StateDir:        "/run/containerd/io.containerd.runtime.v2.task/k8s.io",
+	RefreshInterval: 10 * time.Second,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.Path == "" {
+		return fmt.Errorf("path attribute must not be empty")
+	}
+	if args.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval must be greater than 0")
+	}
+	return nil
+}
+
+// New returns a new instance of a discovery.cri component.
+func New(opts component.Options, args Arguments) (*discovery.Component, error) {
+	return discovery.New(opts, args, func(args component.Arguments) (discovery.Discoverer, error) {
+		a := args.(Arguments)
+		d := &criDiscovery{logger: opts.Logger, args: a}
+		return refresh.NewDiscovery(opts.Logger, "cri", a.RefreshInterval, d.refresh), nil
+	})
+}
+
+// criDiscovery discovers the log files of the containers run through the
+// CRI, labeled with the metadata of their pod and, if containerd runs them,
+// their image and annotations.
+type criDiscovery struct {
+	logger log.Logger
+	args   Arguments
+}
+
+// containerKey identifies a container of a pod.
+type containerKey struct {
+	namespace, pod, uid, container string
+}
+
+// bundle is the metadata of a container read from its containerd bundle.
+type bundle struct {
+	id          string
+	annotations map[string]string
+}
+
+func (d *criDiscovery) refresh(context.Context) ([]*targetgroup.Group, error) {
+	bundles := d.bundles()
+
+	podDirs, err := os.ReadDir(d.args.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pod log directory: %w", err)
+	}
+
+	tg := &targetgroup.Group{Source: "CRI"}
+	for _, podDir := range podDirs {
+		if !podDir.IsDir() {
+			continue
+		}
+		// Namespaces and pod names can't hold underscores.
+		parts := strings.SplitN(podDir.Name(), "_", 3)
+		if len(parts) != 3 {
+			level.Debug(d.logger).Log("msg", "skipping directory not named after a pod", "dir", podDir.Name())
+			continue
+		}
+
+		containerDirs, err := os.ReadDir(filepath.Join(d.args.Path, podDir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading pod log directory: %w", err)
+		}
+		for _, containerDir := range containerDirs {
+			if !containerDir.IsDir() {
+				continue
+			}
+			key := containerKey{namespace: parts[0], pod: parts[1], uid: parts[2], container: containerDir.Name()}
+
+			dir := filepath.Join(d.args.Path, podDir.Name(), containerDir.Name())
+			files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				tg.Targets = append(tg.Targets, d.target(key, f, bundles))
+			}
+		}
+	}
+	return []*targetgroup.Group{tg}, nil
+}
+
+// target returns the target of the log file f of the container key.
+func (d *criDiscovery) target(key containerKey, f string, bundles map[containerKey]bundle) model.LabelSet {
+	labels := model.LabelSet{
+		"__path__":            model.LabelValue(f),
+		criLabelNamespace:     model.LabelValue(key.namespace),
+		criLabelPodName:       model.LabelValue(key.pod),
+		criLabelPodUID:        model.LabelValue(key.uid),
+		criLabelContainerName: model.LabelValue(key.container),
+		// The kubelet names the log files after the restart count of the
+		// container.
+		criLabelContainerRestarts: model.LabelValue(strings.TrimSuffix(filepath.Base(f), ".log")),
+	}
+
+	b, ok := bundles[key]
+	if !ok {
+		// Bundles created before the sandbox UID annotation was added only
+		// match by name.
+		b, ok = bundles[containerKey{namespace: key.namespace, pod: key.pod, container: key.container}]
+	}
+	if ok {
+		labels[criLabelContainerID] = model.LabelValue(b.id)
+		labels[criLabelContainerImage] = model.LabelValue(b.annotations[annotationImageName])
+		for k, v := range b.annotations {
+			labels[model.LabelName(criLabelContainerAnnotation+strutil.SanitizeLabelName(k))] = model.LabelValue(v)
+		}
+	}
+	return labels
+}
+
+// bundles reads the annotations of the containers from their bundles in the
+// state directory of containerd. Bundles which can't be read are skipped, as
+// the logs can be read without them.
+func (d *criDiscovery) bundles() map[containerKey]bundle {
+	bundles := make(map[containerKey]bundle)
+	if d.args.StateDir == "" {
+		return bundles
+	}
+
+	dirs, err := os.ReadDir(d.args.StateDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			level.Warn(d.logger).Log("msg", "failed to read containerd state directory", "err", err)
+		}
+		return bundles
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(d.args.StateDir, dir.Name(), "config.json"))
+		if err != nil {
+			continue
+		}
+		var spec struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		if err := json.Unmarshal(buf, &spec); err != nil {
+			level.Debug(d.logger).Log("msg", "failed to parse container bundle", "container", dir.Name(), "err", err)
+			continue
+		}
+		a := spec.Annotations
+		if a[annotationContainerType] != containerTypeContainer {
+			continue
+		}
+		bundles[containerKey{
+			namespace: a[annotationPodNamespace],
+			pod:       a[annotationPodName],
+			uid:       a[annotationPodUID],
+			container: a[annotationContainerName],
+		}] = bundle{id: dir.Name(), annotations: a}
+	}
+	return bundles
+}
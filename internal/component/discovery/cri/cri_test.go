@@ -0,0 +1,104 @@
+package cri
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/river"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	gethPodDir    = "testdata/pods/ethereum_geth-0_5f1c2d3e-0000-4000-8000-000000000001"
+	corednsPodDir = "testdata/pods/kube-system_coredns-7db6d8ff4d-x2k9p_9a8b7c6d-0000-4000-8000-000000000002"
+)
+
+func TestRiverConfig(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		path             = "/var/log/pods"
+		refresh_interval = "30s"
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, DefaultArguments.StateDir, args.StateDir)
+
+	err = river.Unmarshal([]byte(`path = ""`), &args)
+	require.EqualError(t, err, "path attribute must not be empty")
+}
+
+func TestDiscovery(t *testing.T) {
+	d := &criDiscovery{logger: log.NewNopLogger(), args: Arguments{
+		Path:     "testdata/pods",
+		StateDir: "testdata/containerd",
+	}}
+
+	groups, err := d.refresh(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	gethLabels := model.LabelSet{
+		"__meta_cri_namespace":       "ethereum",
+		"__meta_cri_pod_name":        "geth-0",
+		"__meta_cri_pod_uid":         "5f1c2d3e-0000-4000-8000-000000000001",
+		"__meta_cri_container_name":  "geth",
+		"__meta_cri_container_id":    "8f3a2c",
+		"__meta_cri_container_image": "docker.io/ethereum/client-go:v1.14.0",
+		"__meta_cri_container_annotation_io_kubernetes_cri_container_name":    "geth",
+		"__meta_cri_container_annotation_io_kubernetes_cri_container_type":    "container",
+		"__meta_cri_container_annotation_io_kubernetes_cri_image_name":        "docker.io/ethereum/client-go:v1.14.0",
+		"__meta_cri_container_annotation_io_kubernetes_cri_sandbox_id":        "c0ffee",
+		"__meta_cri_container_annotation_io_kubernetes_cri_sandbox_name":      "geth-0",
+		"__meta_cri_container_annotation_io_kubernetes_cri_sandbox_namespace": "ethereum",
+		"__meta_cri_container_annotation_io_kubernetes_cri_sandbox_uid":       "5f1c2d3e-0000-4000-8000-000000000001",
+	}
+	require.Equal(t, []model.LabelSet{
+		gethLabels.Merge(model.LabelSet{
+			"__path__":                           model.LabelValue(filepath.Join(gethPodDir, "geth/0.log")),
+			"__meta_cri_container_restart_count": "0",
+		}),
+		gethLabels.Merge(model.LabelSet{
+			"__path__":                           model.LabelValue(filepath.Join(gethPodDir, "geth/1.log")),
+			"__meta_cri_container_restart_count": "1",
+		}),
+		{
+			"__path__":                           model.LabelValue(filepath.Join(gethPodDir, "init/0.log")),
+			"__meta_cri_namespace":               "ethereum",
+			"__meta_cri_pod_name":                "geth-0",
+			"__meta_cri_pod_uid":                 "5f1c2d3e-0000-4000-8000-000000000001",
+			"__meta_cri_container_name":          "init",
+			"__meta_cri_container_restart_count": "0",
+		},
+		{
+			"__path__":                           model.LabelValue(filepath.Join(corednsPodDir, "coredns/0.log")),
+			"__meta_cri_namespace":               "kube-system",
+			"__meta_cri_pod_name":                "coredns-7db6d8ff4d-x2k9p",
+			"__meta_cri_pod_uid":                 "9a8b7c6d-0000-4000-8000-000000000002",
+			"__meta_cri_container_name":          "coredns",
+			"__meta_cri_container_restart_count": "0",
+		},
+	}, groups[0].Targets)
+}
+
+func TestDiscovery_NoStateDir(t *testing.T) {
+	d := &criDiscovery{logger: log.NewNopLogger(), args: Arguments{
+		Path:     "testdata/pods",
+		StateDir: "testdata/missing",
+	}}
+
+	groups, err := d.refresh(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups[0].Targets, 4)
+	for _, tgt := range groups[0].Targets {
+		require.NotContains(t, tgt, model.LabelName("__meta_cri_container_image"))
+	}
+}
+
+func TestDiscovery_MissingPath(t *testing.T) {
+	d := &criDiscovery{logger: log.NewNopLogger(), args: Arguments{Path: "testdata/missing"}}
+
+	_, err := d.refresh(context.Background())
+	require.ErrorContains(t, err, "reading pod log directory")
+}
@@ -0,0 +1,284 @@
+// Package podman implements the discovery.podman component.
+package podman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/common/config"
+	"github.com/blockopsnetwork/telescope/internal/component/discovery"
+	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	"github.com/blockopsnetwork/telescope/internal/useragent"
+	"github.com/go-kit/log"
+	common_config "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/refresh"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "discovery.podman",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+		Exports:   discovery.Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+const (
+	podmanLabel                = model.MetaLabelPrefix + "podman_"
+	podmanLabelContainerPrefix = podmanLabel + "container_"
+	podmanLabelContainerID     = podmanLabelContainerPrefix + "id"
+	podmanLabelContainerName   = podmanLabelContainerPrefix + "name"
+	podmanLabelContainerImage  = podmanLabelContainerPrefix + "image"
+	podmanLabelContainerState  = podmanLabelContainerPrefix + "state"
+	podmanLabelContainerLabel  = podmanLabelContainerPrefix + "label_"
+	podmanLabelPodID           = podmanLabel + "pod_id"
+	podmanLabelPodName         = podmanLabel + "pod_name"
+	podmanLabelPortPrivate     = podmanLabel + "port_private"
+	podmanLabelPortPublic      = podmanLabel + "port_public"
+	podmanLabelPortPublicIP    = podmanLabel + "port_public_ip"
+	podmanLabelPortProtocol    = podmanLabel + "port_protocol"
+
+	// containersPath is the path of the libpod API listing the containers.
+	containersPath = "/v4.0.0/libpod/containers/json"
+)
+
+var userAgent = useragent.Get()
+
+// Arguments configures the discovery.podman component.
+type Arguments struct {
+	Host               string                  `river:"host,attr,optional"`
+	HostNetworkingHost string                  `river:"host_networking_host,attr,optional"`
+	RefreshInterval    time.Duration           `river:"refresh_interval,attr,optional"`
+	Filters            []Filter                `river:"filter,block,optional"`
+	HTTPClientConfig   config.HTTPClientConfig `river:",squash"`
+}
+
+// Filter is used to limit the discovery process to a subset of available
+// containers. See the filters of the libpod API for the supported names.
+type Filter struct {
+	Name   string   `river:"name,attr"`
+	Values []string `river:"values,attr"`
+}
+
+// DefaultArguments holds default values for Arguments.
+var DefaultArguments = Arguments{
+	Host:               "unix:///run/podman/podman.sock",
+	HostNetworkingHost: "localhost",
+	RefreshInterval:    time.Minute,
+	HTTPClientConfig:   config.DefaultHTTPClientConfig,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.Host == "" {
+		return fmt.Errorf("host attribute must not be empty")
+	}
+	u, err := url.Parse(args.Host)
+	if err != nil {
+		return fmt.Errorf("parsing host attribute: %w", err)
+	}
+	switch u.Scheme {
+	case "unix", "tcp", "http", "https":
+	default:
+		return fmt.Errorf("unsupported scheme %q of host attribute", u.Scheme)
+	}
+
+	if args.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval must be greater than 0")
+	}
+
+	return args.HTTPClientConfig.Validate()
+}
+
+// New returns a new instance of a discovery.podman component.
+func New(opts component.Options, args Arguments) (*discovery.Component, error) {
+	return discovery.New(opts, args, func(args component.Arguments) (discovery.Discoverer, error) {
+		return newDiscovery(args.(Arguments), opts.Logger)
+	})
+}
+
+// podmanDiscovery lists the containers of a Podman service through the
+// libpod API.
+type podmanDiscovery struct {
+	client             *http.Client
+	endpoint           string
+	filters            string
+	hostNetworkingHost string
+}
+
+func newDiscovery(args Arguments, l log.Logger) (*refresh.Discovery, error) {
+	d, err := newPodmanDiscovery(args)
+	if err != nil {
+		return nil, err
+	}
+	return refresh.NewDiscovery(l, "podman", args.RefreshInterval, d.refresh), nil
+}
+
+func newPodmanDiscovery(args Arguments) (*podmanDiscovery, error) {
+	u, err := url.Parse(args.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &podmanDiscovery{hostNetworkingHost: args.HostNetworkingHost}
+	switch u.Scheme {
+	case "unix":
+		// The host of the endpoint is ignored when dialing the socket.
+		d.endpoint = "http://podman"
+		d.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", u.Path)
+				},
+			},
+		}
+	default:
+		scheme := u.Scheme
+		if scheme == "tcp" {
+			scheme = "http"
+		}
+		d.endpoint = scheme + "://" + u.Host + u.Path
+		rt, err := common_config.NewRoundTripperFromConfig(*args.HTTPClientConfig.Convert(), "podman_sd")
+		if err != nil {
+			return nil, err
+		}
+		d.client = &http.Client{Transport: rt}
+	}
+	d.client.Timeout = args.RefreshInterval
+
+	if len(args.Filters) > 0 {
+		filters := make(map[string][]string, len(args.Filters))
+		for _, f := range args.Filters {
+			filters[f.Name] = append(filters[f.Name], f.Values...)
+		}
+		buf, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		d.filters = string(buf)
+	}
+	return d, nil
+}
+
+// container is a container listed by the libpod API.
+type container struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	State   string            `json:"State"`
+	Labels  map[string]string `json:"Labels"`
+	Pod     string            `json:"Pod"`
+	PodName string            `json:"PodName"`
+	Ports   []struct {
+		HostIP        string `json:"host_ip"`
+		ContainerPort uint16 `json:"container_port"`
+		HostPort      uint16 `json:"host_port"`
+		Range         uint16 `json:"range"`
+		Protocol      string `json:"protocol"`
+	} `json:"Ports"`
+}
+
+func (d *podmanDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, error) {
+	containers, err := d.containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tg := &targetgroup.Group{Source: "Podman"}
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+
+		commonLabels := model.LabelSet{
+			podmanLabelContainerID:    model.LabelValue(c.ID),
+			podmanLabelContainerName:  model.LabelValue(c.Names[0]),
+			podmanLabelContainerImage: model.LabelValue(c.Image),
+			podmanLabelContainerState: model.LabelValue(c.State),
+		}
+		if c.Pod != "" {
+			commonLabels[podmanLabelPodID] = model.LabelValue(c.Pod)
+			commonLabels[podmanLabelPodName] = model.LabelValue(c.PodName)
+		}
+		for k, v := range c.Labels {
+			commonLabels[model.LabelName(podmanLabelContainerLabel+strutil.SanitizeLabelName(k))] = model.LabelValue(v)
+		}
+
+		// Containers without published ports are addressed by their name,
+		// which is enough to read their logs.
+		if len(c.Ports) == 0 {
+			labels := commonLabels.Clone()
+			labels[model.AddressLabel] = model.LabelValue(c.Names[0])
+			tg.Targets = append(tg.Targets, labels)
+			continue
+		}
+
+		for _, p := range c.Ports {
+			hostIP := p.HostIP
+			if hostIP == "" || hostIP == "0.0.0.0" {
+				hostIP = d.hostNetworkingHost
+			}
+			labels := commonLabels.Clone()
+			labels[podmanLabelPortPrivate] = model.LabelValue(strconv.FormatUint(uint64(p.ContainerPort), 10))
+			labels[podmanLabelPortPublic] = model.LabelValue(strconv.FormatUint(uint64(p.HostPort), 10))
+			labels[podmanLabelPortPublicIP] = model.LabelValue(p.HostIP)
+			labels[podmanLabelPortProtocol] = model.LabelValue(p.Protocol)
+			labels[model.AddressLabel] = model.LabelValue(net.JoinHostPort(hostIP, strconv.FormatUint(uint64(p.HostPort), 10)))
+			tg.Targets = append(tg.Targets, labels)
+		}
+	}
+	return []*targetgroup.Group{tg}, nil
+}
+
+// containers lists the containers of the Podman service.
+func (d *podmanDiscovery) containers(ctx context.Context) ([]container, error) {
+	u, err := url.Parse(d.endpoint + containersPath)
+	if err != nil {
+		return nil, err
+	}
+	if d.filters != "" {
+		u.RawQuery = url.Values{"filters": []string{d.filters}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing containers: unexpected status %s", resp.Status)
+	}
+
+	var containers []container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("decoding containers: %w", err)
+	}
+	return containers, nil
+}
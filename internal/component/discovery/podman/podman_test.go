@@ -0,0 +1,148 @@
+package podman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/river"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// testContainers is a response of the libpod API listing a container of a
+// pod with a published port and a container without any.
+const testContainers = `[
+	{
+		"Id": "8f3a2c",
+		"Names": ["geth"],
+		"Image": "docker.io/ethereum/client-go:v1.14.0",
+		"State": "running",
+		"Labels": {"client_name": "geth", "io.podman.network": "mainnet"},
+		"Pod": "c0ffee",
+		"PodName": "ethereum",
+		"Ports": [{"host_ip": "", "container_port": 6060, "host_port": 16060, "range": 1, "protocol": "tcp"}]
+	},
+	{
+		"Id": "1b2c3d",
+		"Names": ["lighthouse"],
+		"Image": "docker.io/sigp/lighthouse:v5.1.0",
+		"State": "running",
+		"Labels": null,
+		"Ports": null
+	}
+]`
+
+func newFakeServer(t *testing.T, filters *string) http.Handler {
+	t.Helper()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != containersPath {
+			http.NotFound(w, r)
+			return
+		}
+		if filters != nil {
+			*filters = r.URL.Query().Get("filters")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(testContainers))
+	})
+}
+
+func TestRiverConfig(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		host             = "tcp://127.0.0.1:8080"
+		refresh_interval = "10s"
+		filter {
+			name   = "label"
+			values = ["network=mainnet"]
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, "tcp://127.0.0.1:8080", args.Host)
+	require.Equal(t, "localhost", args.HostNetworkingHost)
+	require.Len(t, args.Filters, 1)
+
+	err = river.Unmarshal([]byte(`host = "ssh://podman@example.com"`), &args)
+	require.EqualError(t, err, `unsupported scheme "ssh" of host attribute`)
+}
+
+func TestDiscovery(t *testing.T) {
+	var filters string
+	srv := httptest.NewServer(newFakeServer(t, &filters))
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Host = srv.URL
+	args.Filters = []Filter{{Name: "label", Values: []string{"network=mainnet"}}}
+
+	groups, err := mustPodmanDiscovery(t, args).refresh(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, `{"label":["network=mainnet"]}`, filters)
+
+	require.Len(t, groups, 1)
+	require.Equal(t, []model.LabelSet{
+		{
+			"__address__":                                     "localhost:16060",
+			"__meta_podman_container_id":                      "8f3a2c",
+			"__meta_podman_container_name":                    "geth",
+			"__meta_podman_container_image":                   "docker.io/ethereum/client-go:v1.14.0",
+			"__meta_podman_container_state":                   "running",
+			"__meta_podman_container_label_client_name":       "geth",
+			"__meta_podman_container_label_io_podman_network": "mainnet",
+			"__meta_podman_pod_id":                            "c0ffee",
+			"__meta_podman_pod_name":                          "ethereum",
+			"__meta_podman_port_private":                      "6060",
+			"__meta_podman_port_public":                       "16060",
+			"__meta_podman_port_public_ip":                    "",
+			"__meta_podman_port_protocol":                     "tcp",
+		},
+		{
+			"__address__":                   "lighthouse",
+			"__meta_podman_container_id":    "1b2c3d",
+			"__meta_podman_container_name":  "lighthouse",
+			"__meta_podman_container_image": "docker.io/sigp/lighthouse:v5.1.0",
+			"__meta_podman_container_state": "running",
+		},
+	}, groups[0].Targets)
+}
+
+func TestDiscovery_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(newFakeServer(t, nil))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Host = "unix://" + socket
+
+	groups, err := mustPodmanDiscovery(t, args).refresh(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Targets, 2)
+}
+
+func TestDiscovery_Error(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Host = srv.URL
+
+	_, err := mustPodmanDiscovery(t, args).refresh(context.Background())
+	require.EqualError(t, err, "listing containers: unexpected status 404 Not Found")
+}
+
+func mustPodmanDiscovery(t *testing.T, args Arguments) *podmanDiscovery {
+	t.Helper()
+	d, err := newPodmanDiscovery(args)
+	require.NoError(t, err)
+	return d
+}
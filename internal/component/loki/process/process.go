@@ -5,6 +5,7 @@ package process
 
 import (
 	"context"
+	"net/http"
 	"reflect"
 	"sync"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
 	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
 	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	http_service "github.com/blockopsnetwork/telescope/internal/service/http"
 )
 
 // TODO(thampiotr): We should reconsider which parts of this component should be exported and which should
@@ -45,7 +47,8 @@ type Exports struct {
 }
 
 var (
-	_ component.Component = (*Component)(nil)
+	_ component.Component    = (*Component)(nil)
+	_ http_service.Component = (*Component)(nil)
 )
 
 // Component implements the loki.process component.
@@ -59,6 +62,10 @@ type Component struct {
 	entryHandler loki.EntryHandler
 	stages       []stages.StageConfig
 
+	// tap streams the entries going through the pipeline for debugging. It
+	// outlives the pipeline so that streams aren't cut by updates.
+	tap *stages.Tap
+
 	fanoutMut sync.RWMutex
 	fanout    []loki.LogsReceiver
 }
@@ -67,6 +74,7 @@ type Component struct {
 func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
 		opts: o,
+		tap:  stages.NewTap(),
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -127,6 +135,7 @@ func (c *Component) Update(args component.Arguments) error {
 		if err != nil {
 			return err
 		}
+		pipeline.SetTap(c.tap)
 		c.entryHandler = loki.NewEntryHandler(c.processOut, func() {})
 		c.processIn = pipeline.Wrap(c.entryHandler).Chan()
 		c.stages = newArgs.Stages
@@ -135,6 +144,15 @@ func (c *Component) Update(args component.Arguments) error {
 	return nil
 }
 
+// Handler implements http_service.Component. The tail path streams samples
+// of the entries going through the pipeline, with the changes made by each
+// stage.
+func (c *Component) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/tail", c.tap)
+	return mux
+}
+
 func (c *Component) handleIn(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
@@ -4,6 +4,9 @@ package process
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -486,3 +489,56 @@ func TestDeadlockWithFrequentUpdates(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	require.WithinDuration(t, time.Now(), lastSend.Load().(time.Time), 300*time.Millisecond)
 }
+
+func TestTail(t *testing.T) {
+	stg := `
+stage.regex {
+	expression = "^level=(?P<level>\\w+)"
+}
+stage.labels {
+	values = { level = "" }
+}`
+	type cfg struct {
+		Stages []stages.StageConfig `river:"stage,enum"`
+	}
+	var stagesCfg cfg
+	require.NoError(t, river.Unmarshal([]byte(stg), &stagesCfg))
+
+	ch := loki.NewLogsReceiver()
+	opts := component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		OnStateChange: func(e component.Exports) {},
+	}
+	c, err := New(opts, Arguments{ForwardTo: []loki.LogsReceiver{ch}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/tail?sample=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The stream carries on through updates of the stages.
+	require.NoError(t, c.Update(Arguments{ForwardTo: []loki.LogsReceiver{ch}, Stages: stagesCfg.Stages}))
+
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"job": "geth"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "level=warn msg=stale peer"},
+	}
+	select {
+	case <-ch.Chan():
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for log line")
+	}
+
+	var ev stages.TapEvent
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ev))
+	require.Equal(t, "level=warn msg=stale peer", ev.Line)
+	require.Len(t, ev.Steps, 2)
+	require.Equal(t, model.LabelSet{"level": "warn"}, ev.Steps[1].LabelsAdded)
+}
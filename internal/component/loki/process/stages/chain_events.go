@@ -0,0 +1,598 @@
+package stages
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Severities of the rules of the chain_events stage, which are the
+// severities of PagerDuty events.
+const (
+	ChainEventSeverityCritical = "critical"
+	ChainEventSeverityError    = "error"
+	ChainEventSeverityWarning  = "warning"
+	ChainEventSeverityInfo     = "info"
+)
+
+// ChainEventSeverities lists the severities of the rules of the chain_events
+// stage.
+var ChainEventSeverities = []string{
+	ChainEventSeverityCritical,
+	ChainEventSeverityError,
+	ChainEventSeverityWarning,
+	ChainEventSeverityInfo,
+}
+
+// ChainEventField is the name of the value extracted by the chain_events
+// stage, set to the name of the first rule matching the line.
+const ChainEventField = "chain_event"
+
+// Defaults of the rules of the chain_events stage.
+const (
+	defaultChainEventThreshold = 1
+	defaultChainEventWindow    = time.Minute
+	defaultChainEventSeverity  = ChainEventSeverityWarning
+)
+
+// chainEventsPruneInterval is how often the chain_events stage forgets the
+// expired matches and the idle groups of events.
+const chainEventsPruneInterval = time.Minute
+
+// ChainEventsConfig configures a processing stage that detects critical chain
+// events in log lines, counts them, and notifies webhooks of them.
+type ChainEventsConfig struct {
+	// ClientLabel is the label holding the client of a stream, which rules
+	// are restricted to.
+	ClientLabel  string              `river:"client_label,attr,optional"`
+	DefaultRules bool                `river:"default_rules,attr,optional"`
+	Rules        []ChainEventRule    `river:"rule,block,optional"`
+	Webhooks     []ChainEventWebhook `river:"webhook,block,optional"`
+	Silences     []ChainEventSilence `river:"silence,block,optional"`
+
+	// Events of a rule with the same values of the GroupBy labels are sent
+	// in a single notification GroupWait after the first of them. Once
+	// notified, they aren't notified again before RepeatInterval.
+	GroupBy        []string      `river:"group_by,attr,optional"`
+	GroupWait      time.Duration `river:"group_wait,attr,optional"`
+	RepeatInterval time.Duration `river:"repeat_interval,attr,optional"`
+}
+
+// ChainEventRule fires when Threshold lines of a client match Expression
+// within Window.
+type ChainEventRule struct {
+	Name       string        `river:"name,attr"`
+	Expression string        `river:"expression,attr"`
+	Clients    []string      `river:"clients,attr,optional"`
+	Threshold  int           `river:"threshold,attr,optional"`
+	Window     time.Duration `river:"window,attr,optional"`
+	Severity   string        `river:"severity,attr,optional"`
+	Summary    string        `river:"summary,attr,optional"`
+}
+
+// ChainEventSilence mutes the notifications of the rules and clients matching
+// it between StartsAt and EndsAt, which are RFC 3339 timestamps. Empty Rules
+// or Clients match all of them.
+type ChainEventSilence struct {
+	Rules    []string `river:"rules,attr,optional"`
+	Clients  []string `river:"clients,attr,optional"`
+	StartsAt string   `river:"starts_at,attr"`
+	EndsAt   string   `river:"ends_at,attr"`
+}
+
+// DefaultChainEventsConfig holds the default values of a ChainEventsConfig.
+var DefaultChainEventsConfig = ChainEventsConfig{
+	ClientLabel:    "client_name",
+	DefaultRules:   true,
+	GroupBy:        []string{model.InstanceLabel},
+	GroupWait:      10 * time.Second,
+	RepeatInterval: time.Hour,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *ChainEventsConfig) SetToDefault() {
+	*args = DefaultChainEventsConfig
+}
+
+// Validate implements river.Validator.
+func (args *ChainEventsConfig) Validate() error {
+	_, err := args.compile()
+	return err
+}
+
+// Clients of the default rules of the chain_events stage.
+var (
+	chainEventConsensusClients = []string{"lighthouse", "prysm", "teku", "nimbus", "lodestar", "grandine"}
+	chainEventValidatorClients = append([]string{"vouch", "web3signer"}, chainEventConsensusClients...)
+	chainEventExecutionClients = []string{"geth", "nethermind", "besu", "erigon", "reth"}
+)
+
+// DefaultChainEventRules are the rules of the chain_events stage when
+// default_rules is set. Rules of the config with the same name replace them.
+var DefaultChainEventRules = []ChainEventRule{
+	{
+		Name:       "missed_attestation",
+		Expression: `(?i)missed attestation|attestations? (was |were )?missed|previous epoch attestations? missing|failed to (submit|publish|produce|sign) attestation`,
+		Clients:    chainEventValidatorClients,
+		Severity:   ChainEventSeverityWarning,
+		Summary:    "Validator missed an attestation",
+	},
+	{
+		Name:       "slashing_protection",
+		Expression: `(?i)slashing protection (triggered|prevented|violation|error)|not signing slashable|slashable (attestation|block|proposal|vote)|double (vote|proposal)|surround(ing|ed)? vote`,
+		Clients:    chainEventValidatorClients,
+		Severity:   ChainEventSeverityCritical,
+		Summary:    "Slashing protection refused to sign",
+	},
+	{
+		Name:       "block_proposal_failed",
+		Expression: `(?i)failed to (propose|produce|publish|submit|sign) (a )?(beacon )?block|block (proposal|production) (failed|error)|error (whilst|while) producing block|missed (block )?proposal`,
+		Clients:    chainEventValidatorClients,
+		Severity:   ChainEventSeverityCritical,
+		Summary:    "Block proposal failed",
+	},
+	{
+		Name:       "database_corruption",
+		Expression: `(?i)corrupt(ed|ion)?\b.*\b(database|db|chaindata|leveldb|pebble|mdbx|rocksdb|freezer|ancient)|\b(database|db|chaindata|leveldb|pebble|mdbx|rocksdb|freezer)\b.*\bcorrupt`,
+		Severity:   ChainEventSeverityCritical,
+		Summary:    "Client database is corrupted",
+	},
+	{
+		Name:       "out_of_sync",
+		Expression: `(?i)out of sync|not (fully )?synced|lost sync|fell behind|execution (client|engine|node) (is )?(offline|syncing|not synced)`,
+		Clients:    append(append([]string{}, chainEventExecutionClients...), chainEventValidatorClients...),
+		Threshold:  5,
+		Window:     5 * time.Minute,
+		Severity:   ChainEventSeverityWarning,
+		Summary:    "Node is out of sync",
+	},
+}
+
+// chainEventRule is a compiled ChainEventRule.
+type chainEventRule struct {
+	ChainEventRule
+	expr *regexp.Regexp
+}
+
+// matchesClient returns true if the rule applies to client. Clients match
+// their name, or their name followed by a suffix, e.g. lighthouse-bn.
+func (r *chainEventRule) matchesClient(client string) bool {
+	return len(r.Clients) == 0 || matchesChainEventClient(r.Clients, client)
+}
+
+func matchesChainEventClient(clients []string, client string) bool {
+	client = strings.ToLower(client)
+	for _, c := range clients {
+		if client == c {
+			return true
+		}
+		if strings.HasPrefix(client, c) && strings.ContainsRune("-_.@", rune(client[len(c)])) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainEventSilenceWindow is a parsed ChainEventSilence.
+type chainEventSilenceWindow struct {
+	ChainEventSilence
+	start, end time.Time
+}
+
+func (s *chainEventSilenceWindow) mutes(rule, client string, now time.Time) bool {
+	if now.Before(s.start) || !now.Before(s.end) {
+		return false
+	}
+	if len(s.Rules) > 0 && !containsString(s.Rules, rule) {
+		return false
+	}
+	return len(s.Clients) == 0 || matchesChainEventClient(s.Clients, client)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// compile validates the config and returns its rules, the default ones
+// first.
+func (args *ChainEventsConfig) compile() ([]*chainEventRule, error) {
+	if args.ClientLabel == "" {
+		return nil, fmt.Errorf("client_label must not be empty")
+	}
+	if args.GroupWait < 0 {
+		return nil, fmt.Errorf("group_wait must not be negative")
+	}
+	if args.RepeatInterval <= 0 {
+		return nil, fmt.Errorf("repeat_interval must be greater than 0")
+	}
+
+	var configured []ChainEventRule
+	if args.DefaultRules {
+		for _, def := range DefaultChainEventRules {
+			if !hasChainEventRule(args.Rules, def.Name) {
+				configured = append(configured, def)
+			}
+		}
+	}
+	configured = append(configured, args.Rules...)
+	if len(configured) == 0 {
+		return nil, fmt.Errorf("at least one rule must be set when default_rules is disabled")
+	}
+
+	var (
+		rules = make([]*chainEventRule, 0, len(configured))
+		names = make(map[string]struct{}, len(configured))
+	)
+	for _, r := range configured {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule name must not be empty")
+		}
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule %q", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		if r.Threshold == 0 {
+			r.Threshold = defaultChainEventThreshold
+		}
+		if r.Window == 0 {
+			r.Window = defaultChainEventWindow
+		}
+		if r.Severity == "" {
+			r.Severity = defaultChainEventSeverity
+		}
+		switch {
+		case r.Threshold < 0:
+			return nil, fmt.Errorf("threshold of rule %q must be greater than 0", r.Name)
+		case r.Window < 0:
+			return nil, fmt.Errorf("window of rule %q must be greater than 0", r.Name)
+		case !containsString(ChainEventSeverities, r.Severity):
+			return nil, fmt.Errorf("unknown severity %q of rule %q, must be one of %s", r.Severity, r.Name, strings.Join(ChainEventSeverities, ", "))
+		}
+		expr, err := regexp.Compile(r.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of rule %q: %w", r.Name, err)
+		}
+		r.Clients = lowerChainEventClients(r.Clients)
+		rules = append(rules, &chainEventRule{ChainEventRule: r, expr: expr})
+	}
+
+	for _, h := range args.Webhooks {
+		if err := h.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range args.Silences {
+		if _, err := s.parse(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func lowerChainEventClients(clients []string) []string {
+	res := make([]string, len(clients))
+	for i, c := range clients {
+		res[i] = strings.ToLower(c)
+	}
+	return res
+}
+
+func hasChainEventRule(rules []ChainEventRule, name string) bool {
+	for _, r := range rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s ChainEventSilence) parse() (chainEventSilenceWindow, error) {
+	start, err := time.Parse(time.RFC3339, s.StartsAt)
+	if err != nil {
+		return chainEventSilenceWindow{}, fmt.Errorf("invalid silence starts_at: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, s.EndsAt)
+	if err != nil {
+		return chainEventSilenceWindow{}, fmt.Errorf("invalid silence ends_at: %w", err)
+	}
+	if !end.After(start) {
+		return chainEventSilenceWindow{}, fmt.Errorf("silence ends_at must be after starts_at")
+	}
+	s.Clients = lowerChainEventClients(s.Clients)
+	return chainEventSilenceWindow{ChainEventSilence: s, start: start, end: end}, nil
+}
+
+// newChainEventsStage creates a chainEventsStage from config.
+func newChainEventsStage(logger log.Logger, cfg ChainEventsConfig, registerer prometheus.Registerer) (Stage, error) {
+	rules, err := cfg.compile()
+	if err != nil {
+		return nil, err
+	}
+	silences := make([]chainEventSilenceWindow, 0, len(cfg.Silences))
+	for _, s := range cfg.Silences {
+		parsed, _ := s.parse()
+		silences = append(silences, parsed)
+	}
+
+	logger = log.With(logger, "component", "stage", "type", "chain_events")
+	return &chainEventsStage{
+		logger:   logger,
+		cfg:      cfg,
+		rules:    rules,
+		silences: silences,
+		notifier: newChainEventNotifier(logger, cfg.Webhooks, registerer),
+		metrics:  getChainEventsMetrics(registerer),
+		now:      time.Now,
+	}, nil
+}
+
+type chainEventsMetrics struct {
+	events   *prometheus.CounterVec
+	fired    *prometheus.CounterVec
+	silenced *prometheus.CounterVec
+}
+
+func getChainEventsMetrics(registerer prometheus.Registerer) chainEventsMetrics {
+	return chainEventsMetrics{
+		events: registerChainEventsCounter(registerer, prometheus.CounterOpts{
+			Name: "loki_process_chain_events_total",
+			Help: "A count of all log lines matching a chain event rule, by rule, client and severity",
+		}, "rule", "client", "severity"),
+		fired: registerChainEventsCounter(registerer, prometheus.CounterOpts{
+			Name: "loki_process_chain_events_fired_total",
+			Help: "A count of all times a chain event rule reached its threshold, by rule and severity",
+		}, "rule", "severity"),
+		silenced: registerChainEventsCounter(registerer, prometheus.CounterOpts{
+			Name: "loki_process_chain_events_silenced_total",
+			Help: "A count of all fired chain event rules muted by a silence, by rule",
+		}, "rule"),
+	}
+}
+
+func registerChainEventsCounter(registerer prometheus.Registerer, opts prometheus.CounterOpts, labelNames ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labelNames)
+	err := registerer.Register(c)
+	if err != nil {
+		if existing, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			c = existing.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			// Same behavior as MustRegister if the error is not for AlreadyRegistered
+			panic(err)
+		}
+	}
+	return c
+}
+
+// chainEventsStage matches log lines against rules per client. Matching lines
+// are counted, and rules reaching their threshold fire. Fired rules are
+// grouped into notifications sent to webhooks, unless silenced.
+//
+// Lines are passed through unchanged, with the name of the first matching
+// rule extracted.
+type chainEventsStage struct {
+	logger   log.Logger
+	cfg      ChainEventsConfig
+	rules    []*chainEventRule
+	silences []chainEventSilenceWindow
+	notifier *chainEventNotifier
+	metrics  chainEventsMetrics
+	now      func() time.Time
+}
+
+// chainEventGroup holds the events of a rule with the same labels.
+type chainEventGroup struct {
+	rule   *chainEventRule
+	labels map[string]string
+
+	// hits are the times of the matches counted towards the threshold.
+	hits []time.Time
+
+	// Events fired and not notified yet, sent at deadline.
+	pending   bool
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+	line      string
+	deadline  time.Time
+
+	// notifiedAt is when the group was last notified.
+	notifiedAt time.Time
+}
+
+// Run implements Stage.
+func (s *chainEventsStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go s.notifier.run()
+	go func() {
+		// Notifications are sent after out is closed, so that they don't
+		// delay the shutdown of the pipeline.
+		defer s.notifier.close()
+		defer close(out)
+
+		var (
+			groups = make(map[string]*chainEventGroup)
+			timer  = time.NewTimer(time.Hour)
+			ticker = time.NewTicker(chainEventsPruneInterval)
+		)
+		defer timer.Stop()
+		defer ticker.Stop()
+
+		for {
+			var timerC <-chan time.Time
+			if deadline, ok := nextChainEventDeadline(groups); ok {
+				timer.Reset(time.Until(deadline))
+				timerC = timer.C
+			}
+
+			select {
+			case e, ok := <-in:
+				if !ok {
+					for _, g := range groups {
+						if g.pending {
+							s.notify(g)
+						}
+					}
+					return
+				}
+				s.process(groups, &e)
+				e.traceStep(s)
+				out <- e
+
+			case <-timerC:
+				now := s.now()
+				for _, g := range groups {
+					if g.pending && !g.deadline.After(now) {
+						s.notify(g)
+					}
+				}
+				s.prune(groups, now)
+
+			case <-ticker.C:
+				s.prune(groups, s.now())
+			}
+		}
+	}()
+	return out
+}
+
+// prune drops the matches which fell out of the window of their rule, and
+// deletes the groups with nothing left to track: no pending events, no
+// matches and no notification within the repeat interval.
+func (s *chainEventsStage) prune(groups map[string]*chainEventGroup, now time.Time) {
+	for key, g := range groups {
+		for len(g.hits) > 0 && now.Sub(g.hits[0]) > g.rule.Window {
+			g.hits = g.hits[1:]
+		}
+		if !g.pending && len(g.hits) == 0 && now.Sub(g.notifiedAt) >= s.cfg.RepeatInterval {
+			delete(groups, key)
+		}
+	}
+}
+
+func nextChainEventDeadline(groups map[string]*chainEventGroup) (time.Time, bool) {
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, g := range groups {
+		if g.pending && (!found || g.deadline.Before(next)) {
+			next, found = g.deadline, true
+		}
+	}
+	return next, found
+}
+
+// process matches e against the rules and fires the rules reaching their
+// threshold.
+func (s *chainEventsStage) process(groups map[string]*chainEventGroup, e *Entry) {
+	client := string(e.Labels[model.LabelName(s.cfg.ClientLabel)])
+	for _, r := range s.rules {
+		if !r.matchesClient(client) || !r.expr.MatchString(e.Line) {
+			continue
+		}
+		s.metrics.events.WithLabelValues(r.Name, client, r.Severity).Inc()
+		if _, ok := e.Extracted[ChainEventField]; !ok && e.Extracted != nil {
+			e.Extracted[ChainEventField] = r.Name
+		}
+
+		now := s.now()
+		g := s.group(groups, r, client, e.Labels)
+		g.hits = append(g.hits, now)
+		for len(g.hits) > 0 && now.Sub(g.hits[0]) > r.Window {
+			g.hits = g.hits[1:]
+		}
+		if len(g.hits) < r.Threshold {
+			continue
+		}
+		g.hits = nil
+		s.fire(g, client, e.Line, now)
+	}
+}
+
+// group returns the group of the events of r with labels lbls, creating it
+// if needed.
+func (s *chainEventsStage) group(groups map[string]*chainEventGroup, r *chainEventRule, client string, lbls model.LabelSet) *chainEventGroup {
+	groupLabels := model.LabelSet{}
+	if client != "" {
+		groupLabels[model.LabelName(s.cfg.ClientLabel)] = model.LabelValue(client)
+	}
+	for _, name := range s.cfg.GroupBy {
+		if v, ok := lbls[model.LabelName(name)]; ok {
+			groupLabels[model.LabelName(name)] = v
+		}
+	}
+	key := r.Name + "/" + groupLabels.Fingerprint().String()
+
+	g, ok := groups[key]
+	if !ok {
+		g = &chainEventGroup{rule: r, labels: make(map[string]string, len(groupLabels))}
+		for k, v := range groupLabels {
+			g.labels[string(k)] = string(v)
+		}
+		groups[key] = g
+	}
+	return g
+}
+
+// fire records that the rule of g reached its threshold. Notifications are
+// delayed by the group wait to group the events following it, and aren't
+// repeated within the repeat interval.
+func (s *chainEventsStage) fire(g *chainEventGroup, client, line string, now time.Time) {
+	r := g.rule
+	s.metrics.fired.WithLabelValues(r.Name, r.Severity).Inc()
+	for i := range s.silences {
+		if s.silences[i].mutes(r.Name, client, now) {
+			s.metrics.silenced.WithLabelValues(r.Name).Inc()
+			return
+		}
+	}
+
+	if g.pending {
+		g.count++
+		g.lastSeen = now
+		g.line = line
+		return
+	}
+	if !g.notifiedAt.IsZero() && now.Sub(g.notifiedAt) < s.cfg.RepeatInterval {
+		level.Debug(s.logger).Log("msg", "chain event already notified", "rule", r.Name, "labels", fmt.Sprint(g.labels))
+		return
+	}
+	g.pending = true
+	g.count = 1
+	g.firstSeen, g.lastSeen = now, now
+	g.line = line
+	g.deadline = now.Add(s.cfg.GroupWait)
+}
+
+// notify sends the pending events of g.
+func (s *chainEventsStage) notify(g *chainEventGroup) {
+	s.notifier.send(chainEventAlert{
+		Rule:      g.rule.Name,
+		Severity:  g.rule.Severity,
+		Summary:   g.rule.Summary,
+		Labels:    g.labels,
+		Count:     g.count,
+		FirstSeen: g.firstSeen,
+		LastSeen:  g.lastSeen,
+		Line:      g.line,
+	})
+	g.pending = false
+	g.notifiedAt = s.now()
+}
+
+// Name implements Stage.
+func (s *chainEventsStage) Name() string {
+	return StageTypeChainEvents
+}
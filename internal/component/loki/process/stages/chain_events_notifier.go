@@ -0,0 +1,284 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Formats of the notifications of the chain_events stage.
+const (
+	ChainEventFormatJSON      = "json"
+	ChainEventFormatSlack     = "slack"
+	ChainEventFormatPagerDuty = "pagerduty"
+)
+
+// ChainEventFormats lists the formats of the notifications of the
+// chain_events stage.
+var ChainEventFormats = []string{
+	ChainEventFormatJSON,
+	ChainEventFormatSlack,
+	ChainEventFormatPagerDuty,
+}
+
+const (
+	// DefaultPagerDutyURL is the endpoint of the PagerDuty Events API v2.
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+	defaultChainEventWebhookTimeout = 10 * time.Second
+	chainEventQueueCapacity         = 100
+	// maxChainEventLineLength bounds the length of the line sent with a
+	// notification.
+	maxChainEventLineLength = 1024
+)
+
+// ChainEventWebhook is a webhook notified of the events of the chain_events
+// stage. Format is one of json, slack or pagerduty. PagerDuty webhooks
+// default to the Events API v2 and require a RoutingKey.
+type ChainEventWebhook struct {
+	URL        string            `river:"url,attr,optional"`
+	Format     string            `river:"format,attr,optional"`
+	RoutingKey string            `river:"routing_key,attr,optional"`
+	Headers    map[string]string `river:"headers,attr,optional"`
+	Timeout    time.Duration     `river:"timeout,attr,optional"`
+}
+
+func (h *ChainEventWebhook) validate() error {
+	format := h.format()
+	switch {
+	case !containsString(ChainEventFormats, format):
+		return fmt.Errorf("unknown webhook format %q, must be one of %s", h.Format, strings.Join(ChainEventFormats, ", "))
+	case h.URL == "" && format != ChainEventFormatPagerDuty:
+		return fmt.Errorf("webhook url must be set")
+	case h.RoutingKey == "" && format == ChainEventFormatPagerDuty:
+		return fmt.Errorf("routing_key of pagerduty webhook must be set")
+	case h.Timeout < 0:
+		return fmt.Errorf("webhook timeout must not be negative")
+	}
+	return nil
+}
+
+func (h *ChainEventWebhook) format() string {
+	if h.Format == "" {
+		return ChainEventFormatJSON
+	}
+	return h.Format
+}
+
+func (h *ChainEventWebhook) url() string {
+	if h.URL == "" && h.format() == ChainEventFormatPagerDuty {
+		return DefaultPagerDutyURL
+	}
+	return h.URL
+}
+
+// chainEventAlert is a notification of the events of a rule with the same
+// labels.
+type chainEventAlert struct {
+	Rule      string            `json:"rule"`
+	Severity  string            `json:"severity"`
+	Summary   string            `json:"summary,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	Count     int               `json:"count"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Line      string            `json:"line"`
+}
+
+// description returns a one line description of the alert.
+func (a *chainEventAlert) description() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s", strings.ToUpper(a.Severity), a.Rule)
+	if a.Summary != "" {
+		fmt.Fprintf(&sb, ": %s", a.Summary)
+	}
+	if len(a.Labels) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(sortedChainEventLabels(a.Labels), ", "))
+	}
+	if a.Count > 1 {
+		fmt.Fprintf(&sb, ", %d times since %s", a.Count, a.FirstSeen.UTC().Format(time.RFC3339))
+	}
+	return sb.String()
+}
+
+// sortedChainEventLabels returns the labels formatted as name=value, sorted by
+// name.
+func sortedChainEventLabels(labels map[string]string) []string {
+	res := make([]string, 0, len(labels))
+	for k, v := range labels {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// dedupKey identifies the notifications of the same events, so that
+// PagerDuty groups them into a single incident.
+func (a *chainEventAlert) dedupKey() string {
+	ls := make(model.LabelSet, len(a.Labels))
+	for k, v := range a.Labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return a.Rule + "/" + ls.Fingerprint().String()
+}
+
+// chainEventNotifier posts the alerts of a chain_events stage to webhooks.
+//
+// Failed posts aren't retried, and alerts are dropped when the queue is full,
+// so that notifications never block the pipeline.
+type chainEventNotifier struct {
+	logger   log.Logger
+	webhooks []ChainEventWebhook
+	client   *http.Client
+
+	queue chan chainEventAlert
+	done  chan struct{}
+
+	notifications *prometheus.CounterVec
+}
+
+func newChainEventNotifier(logger log.Logger, webhooks []ChainEventWebhook, registerer prometheus.Registerer) *chainEventNotifier {
+	return &chainEventNotifier{
+		logger:   logger,
+		webhooks: webhooks,
+		client:   &http.Client{},
+		queue:    make(chan chainEventAlert, chainEventQueueCapacity),
+		done:     make(chan struct{}),
+		notifications: registerChainEventsCounter(registerer, prometheus.CounterOpts{
+			Name: "loki_process_chain_event_notifications_total",
+			Help: "A count of all chain event notifications, by webhook format and result",
+		}, "format", "result"),
+	}
+}
+
+// send queues the alert. It never blocks.
+func (n *chainEventNotifier) send(a chainEventAlert) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+	if len(a.Line) > maxChainEventLineLength {
+		a.Line = a.Line[:maxChainEventLineLength]
+	}
+	select {
+	case n.queue <- a:
+	default:
+		for _, h := range n.webhooks {
+			n.notifications.WithLabelValues(h.format(), "dropped").Inc()
+		}
+	}
+}
+
+// close stops the notifier once the queued alerts are sent.
+func (n *chainEventNotifier) close() {
+	close(n.queue)
+	<-n.done
+}
+
+// run sends the queued alerts until the notifier is closed.
+func (n *chainEventNotifier) run() {
+	defer close(n.done)
+	for a := range n.queue {
+		for _, h := range n.webhooks {
+			if err := n.post(h, a); err != nil {
+				level.Warn(n.logger).Log("msg", "failed to send chain event notification", "rule", a.Rule, "format", h.format(), "err", err)
+				n.notifications.WithLabelValues(h.format(), "failed").Inc()
+				continue
+			}
+			n.notifications.WithLabelValues(h.format(), "sent").Inc()
+		}
+	}
+}
+
+func (n *chainEventNotifier) post(h ChainEventWebhook, a chainEventAlert) error {
+	body, err := json.Marshal(chainEventPayload(h, a))
+	if err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultChainEventWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	return nil
+}
+
+// chainEventPayload returns the body of the notification of a in the format
+// of h.
+func chainEventPayload(h ChainEventWebhook, a chainEventAlert) interface{} {
+	switch h.format() {
+	case ChainEventFormatSlack:
+		text := a.description()
+		if a.Line != "" {
+			text += "\n```" + a.Line + "```"
+		}
+		return map[string]interface{}{"text": text}
+
+	case ChainEventFormatPagerDuty:
+		source := a.Labels[model.InstanceLabel]
+		if source == "" {
+			source = "telescope"
+		}
+		summary := a.description()
+		if len(summary) > 1024 {
+			summary = summary[:1024]
+		}
+		return map[string]interface{}{
+			"routing_key":  h.RoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    a.dedupKey(),
+			"payload": map[string]interface{}{
+				"summary":   summary,
+				"source":    source,
+				"severity":  a.Severity,
+				"timestamp": a.FirstSeen.UTC().Format(time.RFC3339Nano),
+				"group":     a.Rule,
+				"class":     "chain_event",
+				"custom_details": map[string]interface{}{
+					"labels":    a.Labels,
+					"count":     a.Count,
+					"last_seen": a.LastSeen.UTC().Format(time.RFC3339Nano),
+					"line":      a.Line,
+				},
+			},
+		}
+
+	default:
+		return struct {
+			Status string `json:"status"`
+			chainEventAlert
+		}{"firing", a}
+	}
+}
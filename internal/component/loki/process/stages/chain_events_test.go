@@ -0,0 +1,349 @@
+package stages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the notifications posted to it by path.
+type webhookReceiver struct {
+	*httptest.Server
+	requests chan webhookRequest
+}
+
+type webhookRequest struct {
+	path string
+	body map[string]interface{}
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	r := &webhookReceiver{requests: make(chan webhookRequest, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &body))
+		r.requests <- webhookRequest{path: req.URL.Path, body: body}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// receive returns the n next notifications by path.
+func (r *webhookReceiver) receive(t *testing.T, n int) map[string]map[string]interface{} {
+	res := make(map[string]map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		select {
+		case req := <-r.requests:
+			res[req.path] = req.body
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d notifications, expected %d", i, n)
+		}
+	}
+	return res
+}
+
+// expectNone fails if a notification is received within d.
+func (r *webhookReceiver) expectNone(t *testing.T, d time.Duration) {
+	select {
+	case req := <-r.requests:
+		t.Fatalf("unexpected notification to %s: %v", req.path, req.body)
+	case <-time.After(d):
+	}
+}
+
+func TestChainEventsStage_Webhooks(t *testing.T) {
+	recv := newWebhookReceiver(t)
+	reg := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(fmt.Sprintf(`
+stage.chain_events {
+	group_wait = "1m"
+
+	webhook {
+		url = "%[1]s/json"
+	}
+	webhook {
+		url    = "%[1]s/slack"
+		format = "slack"
+	}
+	webhook {
+		url         = "%[1]s/pagerduty"
+		format      = "pagerduty"
+		routing_key = "R0UT1NG"
+	}
+}
+`, recv.URL)), nil, reg)
+	require.NoError(t, err)
+
+	ts := time.Now()
+	bn := model.LabelSet{"client_name": "lighthouse-vc", "instance": "validator-1"}
+	out := processEntries(pl,
+		newEntry(nil, bn, "WARN Not signing slashable attestation", ts),
+		newEntry(nil, model.LabelSet{"client_name": "geth", "instance": "node-1"}, "Imported new chain segment", ts),
+		newEntry(nil, bn, "WARN Not signing slashable attestation slot=12", ts),
+		// Validator rules don't apply to execution clients.
+		newEntry(nil, model.LabelSet{"client_name": "geth", "instance": "node-1"}, "missed attestation", ts),
+	)
+	require.Len(t, out, 4)
+	assert.Equal(t, "WARN Not signing slashable attestation", out[0].Line)
+	assert.Equal(t, "slashing_protection", out[0].Extracted[ChainEventField])
+	assert.NotContains(t, out[1].Extracted, ChainEventField)
+	assert.NotContains(t, out[3].Extracted, ChainEventField)
+
+	// Pending notifications are sent when the pipeline stops.
+	notifications := recv.receive(t, 3)
+	recv.expectNone(t, 100*time.Millisecond)
+
+	generic := notifications["/json"]
+	assert.Equal(t, "firing", generic["status"])
+	assert.Equal(t, "slashing_protection", generic["rule"])
+	assert.Equal(t, ChainEventSeverityCritical, generic["severity"])
+	assert.Equal(t, float64(2), generic["count"])
+	assert.Equal(t, map[string]interface{}{"client_name": "lighthouse-vc", "instance": "validator-1"}, generic["labels"])
+	assert.Equal(t, "WARN Not signing slashable attestation slot=12", generic["line"])
+
+	slack := notifications["/slack"]
+	assert.True(t, strings.HasPrefix(slack["text"].(string), "[CRITICAL] slashing_protection: Slashing protection refused to sign (client_name=lighthouse-vc, instance=validator-1), 2 times since"))
+
+	pd := notifications["/pagerduty"]
+	assert.Equal(t, "R0UT1NG", pd["routing_key"])
+	assert.Equal(t, "trigger", pd["event_action"])
+	assert.True(t, strings.HasPrefix(pd["dedup_key"].(string), "slashing_protection/"))
+	payload := pd["payload"].(map[string]interface{})
+	assert.Equal(t, "validator-1", payload["source"])
+	assert.Equal(t, ChainEventSeverityCritical, payload["severity"])
+	assert.Equal(t, "slashing_protection", payload["group"])
+
+	assert.NoError(t, testutil.CollectAndCompare(reg, strings.NewReader(`
+# HELP loki_process_chain_events_total A count of all log lines matching a chain event rule, by rule, client and severity
+# TYPE loki_process_chain_events_total counter
+loki_process_chain_events_total{client="lighthouse-vc",rule="slashing_protection",severity="critical"} 2
+`), "loki_process_chain_events_total"))
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(reg, strings.NewReader(`
+# HELP loki_process_chain_event_notifications_total A count of all chain event notifications, by webhook format and result
+# TYPE loki_process_chain_event_notifications_total counter
+loki_process_chain_event_notifications_total{format="json",result="sent"} 1
+loki_process_chain_event_notifications_total{format="pagerduty",result="sent"} 1
+loki_process_chain_event_notifications_total{format="slack",result="sent"} 1
+`), "loki_process_chain_event_notifications_total") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestChainEventsStage_Threshold(t *testing.T) {
+	recv := newWebhookReceiver(t)
+	s, err := newChainEventsStage(util_log.Logger, ChainEventsConfig{
+		ClientLabel:    "client_name",
+		GroupWait:      20 * time.Millisecond,
+		RepeatInterval: time.Hour,
+		Rules: []ChainEventRule{{
+			Name:       "peer_drop",
+			Expression: "(?i)peer count dropped",
+			Clients:    []string{"Nethermind"},
+			Threshold:  3,
+			Window:     time.Minute,
+		}},
+		Webhooks: []ChainEventWebhook{{URL: recv.URL}},
+	}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	stage := s.(*chainEventsStage)
+
+	in := make(chan Entry)
+	out := stage.Run(in)
+	send := func(line string) {
+		in <- newEntry(nil, model.LabelSet{"client_name": "nethermind", "instance": "node-1"}, line, time.Now())
+		<-out
+	}
+
+	send("Peer count dropped to 3")
+	send("Peer count dropped to 2")
+	recv.expectNone(t, 100*time.Millisecond)
+	assert.Equal(t, 0.0, testutil.ToFloat64(stage.metrics.fired.WithLabelValues("peer_drop", ChainEventSeverityWarning)))
+
+	send("Peer count dropped to 1")
+	notification := recv.receive(t, 1)["/"]
+	assert.Equal(t, "peer_drop", notification["rule"])
+	assert.Equal(t, ChainEventSeverityWarning, notification["severity"])
+	assert.Equal(t, float64(1), notification["count"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(stage.metrics.fired.WithLabelValues("peer_drop", ChainEventSeverityWarning)))
+
+	// The rule fires again after three more matches, but isn't notified
+	// again within the repeat interval.
+	for i := 0; i < 3; i++ {
+		send("Peer count dropped to 0")
+	}
+	recv.expectNone(t, 100*time.Millisecond)
+	assert.Equal(t, 2.0, testutil.ToFloat64(stage.metrics.fired.WithLabelValues("peer_drop", ChainEventSeverityWarning)))
+
+	close(in)
+	for range out {
+	}
+	recv.expectNone(t, 100*time.Millisecond)
+}
+
+func TestChainEventsStage_Prune(t *testing.T) {
+	s, err := newChainEventsStage(util_log.Logger, ChainEventsConfig{
+		ClientLabel:    "client_name",
+		GroupBy:        []string{"instance"},
+		RepeatInterval: time.Hour,
+		Rules: []ChainEventRule{{
+			Name:       "peer_drop",
+			Expression: "(?i)peer count dropped",
+			Threshold:  3,
+			Window:     time.Minute,
+		}},
+	}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	stage := s.(*chainEventsStage)
+
+	now := time.Now()
+	stage.now = func() time.Time { return now }
+
+	// Every instance matching the rule below its threshold gets a group.
+	groups := make(map[string]*chainEventGroup)
+	for _, instance := range []string{"node-1", "node-2"} {
+		e := newEntry(nil, model.LabelSet{"client_name": "geth", "instance": model.LabelValue(instance)}, "Peer count dropped to 1", now)
+		stage.process(groups, &e)
+	}
+	require.Len(t, groups, 2)
+
+	now = now.Add(30 * time.Second)
+	e := newEntry(nil, model.LabelSet{"client_name": "geth", "instance": "node-2"}, "Peer count dropped to 0", now)
+	stage.process(groups, &e)
+
+	// Matches out of the window are dropped, and groups left without
+	// matches are deleted.
+	stage.prune(groups, now.Add(45*time.Second))
+	require.Len(t, groups, 1)
+	for _, g := range groups {
+		require.Equal(t, "node-2", g.labels["instance"])
+		require.Len(t, g.hits, 1)
+	}
+
+	stage.prune(groups, now.Add(2*time.Minute))
+	require.Empty(t, groups)
+}
+
+func TestChainEventsStage_Silences(t *testing.T) {
+	recv := newWebhookReceiver(t)
+	now := time.Now()
+	s, err := newChainEventsStage(util_log.Logger, ChainEventsConfig{
+		ClientLabel:    "client_name",
+		DefaultRules:   true,
+		GroupWait:      time.Minute,
+		RepeatInterval: time.Hour,
+		Webhooks:       []ChainEventWebhook{{URL: recv.URL}},
+		Silences: []ChainEventSilence{{
+			Rules:    []string{"database_corruption"},
+			Clients:  []string{"erigon"},
+			StartsAt: now.Add(-time.Hour).Format(time.RFC3339),
+			EndsAt:   now.Add(time.Hour).Format(time.RFC3339),
+		}},
+	}, prometheus.NewRegistry())
+	require.NoError(t, err)
+	stage := s.(*chainEventsStage)
+
+	out := processEntries(stage,
+		newEntry(nil, model.LabelSet{"client_name": "erigon"}, "mdbx: database corrupted, page checksum mismatch", now),
+		newEntry(nil, model.LabelSet{"client_name": "geth"}, "Chaindata is corrupted, resync required", now),
+	)
+	require.Len(t, out, 2)
+
+	notification := recv.receive(t, 1)["/"]
+	assert.Equal(t, "database_corruption", notification["rule"])
+	assert.Equal(t, map[string]interface{}{"client_name": "geth"}, notification["labels"])
+	recv.expectNone(t, 100*time.Millisecond)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(stage.metrics.silenced.WithLabelValues("database_corruption")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(stage.metrics.events.WithLabelValues("database_corruption", "erigon", ChainEventSeverityCritical)))
+}
+
+func TestChainEventsStage_DefaultRules(t *testing.T) {
+	tt := []struct {
+		client, line, rule string
+	}{
+		{"lighthouse", "WARN Previous epoch attestation missing epoch: 1234, validator: 42", "missed_attestation"},
+		{"prysm", "Failed to submit attestation", "missed_attestation"},
+		{"teku", "Slashing protection triggered for validator 0x8f3a", "slashing_protection"},
+		{"nimbus", "Failed to propose block", "block_proposal_failed"},
+		{"lodestar", "Block production error: execution payload timeout", "block_proposal_failed"},
+		{"nethermind", "Database corruption detected in state db", "database_corruption"},
+		{"besu", "Node is out of sync with the network", "out_of_sync"},
+		{"lighthouse-vc", "Beacon node is not synced", "out_of_sync"},
+		{"geth", "Failed to propose block", ""},
+		{"teku", "Slashing protection database loaded", ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.line, func(t *testing.T) {
+			s, err := newChainEventsStage(util_log.Logger, DefaultChainEventsConfig, prometheus.NewRegistry())
+			require.NoError(t, err)
+			out := processEntries(s, newEntry(nil, model.LabelSet{"client_name": model.LabelValue(tc.client)}, tc.line, time.Now()))
+			require.Len(t, out, 1)
+			if tc.rule == "" {
+				assert.NotContains(t, out[0].Extracted, ChainEventField)
+				return
+			}
+			assert.Equal(t, tc.rule, out[0].Extracted[ChainEventField])
+		})
+	}
+}
+
+func TestChainEventsConfig_Validate(t *testing.T) {
+	tt := []struct {
+		name   string
+		mutate func(*ChainEventsConfig)
+		err    string
+	}{
+		{"defaults", func(*ChainEventsConfig) {}, ""},
+		{"no rules", func(c *ChainEventsConfig) { c.DefaultRules = false }, "at least one rule must be set"},
+		{"duplicate rule", func(c *ChainEventsConfig) {
+			c.Rules = []ChainEventRule{{Name: "a", Expression: "a"}, {Name: "a", Expression: "b"}}
+		}, `duplicate rule "a"`},
+		{"override default rule", func(c *ChainEventsConfig) {
+			c.Rules = []ChainEventRule{{Name: "out_of_sync", Expression: "behind"}}
+		}, ""},
+		{"invalid expression", func(c *ChainEventsConfig) {
+			c.Rules = []ChainEventRule{{Name: "a", Expression: "("}}
+		}, `invalid expression of rule "a"`},
+		{"invalid severity", func(c *ChainEventsConfig) {
+			c.Rules = []ChainEventRule{{Name: "a", Expression: "a", Severity: "page"}}
+		}, `unknown severity "page" of rule "a"`},
+		{"invalid format", func(c *ChainEventsConfig) {
+			c.Webhooks = []ChainEventWebhook{{URL: "http://localhost", Format: "teams"}}
+		}, `unknown webhook format "teams"`},
+		{"pagerduty without routing key", func(c *ChainEventsConfig) {
+			c.Webhooks = []ChainEventWebhook{{Format: ChainEventFormatPagerDuty}}
+		}, "routing_key of pagerduty webhook must be set"},
+		{"pagerduty default url", func(c *ChainEventsConfig) {
+			c.Webhooks = []ChainEventWebhook{{Format: ChainEventFormatPagerDuty, RoutingKey: "key"}}
+		}, ""},
+		{"invalid silence", func(c *ChainEventsConfig) {
+			c.Silences = []ChainEventSilence{{StartsAt: "2024-01-02T00:00:00Z", EndsAt: "2024-01-01T00:00:00Z"}}
+		}, "silence ends_at must be after starts_at"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultChainEventsConfig
+			tc.mutate(&cfg)
+			err := cfg.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
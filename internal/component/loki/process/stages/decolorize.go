@@ -25,6 +25,7 @@ func (m *decolorizeStage) Run(in chan Entry) chan Entry {
 				nil,
 			)
 			e.Entry.Line = string(decolorizedLine)
+			e.traceStep(m)
 			out <- e
 		}
 	}()
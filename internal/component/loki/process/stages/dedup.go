@@ -0,0 +1,198 @@
+package stages
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the fields set by the dedup stage.
+const (
+	DedupRepeatCountField    = "repeat_count"
+	DedupFirstTimestampField = "first_timestamp"
+	DedupLastTimestampField  = "last_timestamp"
+)
+
+var defaultDedupReason = "dedup_stage"
+
+// Variable parts of lines ignored when comparing normalized lines: UUIDs, hex
+// strings and numbers, which covers IPs, ports, durations and peer IDs.
+var dedupNormalizeRegexp = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|0[xX][0-9a-fA-F]+|[0-9]+`)
+
+// DedupConfig contains the configuration for a dedupStage.
+type DedupConfig struct {
+	Window       time.Duration `river:"window,attr,optional"`
+	Normalize    bool          `river:"normalize,attr,optional"`
+	MaxEntries   int           `river:"max_entries,attr,optional"`
+	AppendFields bool          `river:"append_fields,attr,optional"`
+}
+
+// DefaultDedupConfig holds the default values of a DedupConfig.
+var DefaultDedupConfig = DedupConfig{
+	Window:       10 * time.Second,
+	MaxEntries:   1000,
+	AppendFields: true,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *DedupConfig) SetToDefault() {
+	*args = DefaultDedupConfig
+}
+
+// Validate implements river.Validator.
+func (args *DedupConfig) Validate() error {
+	if args.Window <= 0 {
+		return fmt.Errorf("window must be greater than 0")
+	}
+	if args.MaxEntries <= 0 {
+		return fmt.Errorf("max_entries must be greater than 0")
+	}
+	return nil
+}
+
+// newDedupStage creates a dedupStage from config.
+func newDedupStage(logger log.Logger, cfg DedupConfig, registerer prometheus.Registerer) (Stage, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &dedupStage{
+		logger:    log.With(logger, "component", "stage", "type", "dedup"),
+		cfg:       cfg,
+		dropCount: getDropCountMetric(registerer),
+	}, nil
+}
+
+// dedupStage collapses the identical lines of a stream read within a window
+// into the first of them, annotated with the number of repeats and the
+// timestamps of the first and last ones.
+//
+// Lines are held until their window ends, and are sent in the order they were
+// first read. At most MaxEntries distinct lines are held at once; the oldest
+// one is sent early when more are read.
+type dedupStage struct {
+	logger    log.Logger
+	cfg       DedupConfig
+	dropCount *prometheus.CounterVec
+}
+
+// dedupGroup is a line held by the dedup stage and its repeats.
+type dedupGroup struct {
+	key      string
+	entry    Entry
+	count    int
+	last     time.Time
+	deadline time.Time
+}
+
+// Run implements Stage.
+func (s *dedupStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+
+		var (
+			groups = make(map[string]*list.Element)
+			order  = list.New() // Groups in the order they were read.
+			timer  = time.NewTimer(s.cfg.Window)
+		)
+		defer timer.Stop()
+
+		flush := func(el *list.Element) {
+			g := order.Remove(el).(*dedupGroup)
+			delete(groups, g.key)
+			e := s.collapse(g)
+			e.traceStep(s)
+			out <- e
+		}
+
+		for {
+			var timerC <-chan time.Time
+			if front := order.Front(); front != nil {
+				timer.Reset(time.Until(front.Value.(*dedupGroup).deadline))
+				timerC = timer.C
+			}
+
+			select {
+			case e, ok := <-in:
+				if !ok {
+					for order.Len() > 0 {
+						flush(order.Front())
+					}
+					return
+				}
+
+				key := s.key(e)
+				if el, ok := groups[key]; ok {
+					g := el.Value.(*dedupGroup)
+					g.count++
+					g.last = e.Timestamp
+					s.dropCount.WithLabelValues(defaultDedupReason).Inc()
+					e.traceDrop(defaultDedupReason)
+					continue
+				}
+
+				if order.Len() >= s.cfg.MaxEntries {
+					flush(order.Front())
+				}
+				groups[key] = order.PushBack(&dedupGroup{
+					key:      key,
+					entry:    e,
+					count:    1,
+					last:     e.Timestamp,
+					deadline: time.Now().Add(s.cfg.Window),
+				})
+
+			case now := <-timerC:
+				for order.Len() > 0 && !order.Front().Value.(*dedupGroup).deadline.After(now) {
+					flush(order.Front())
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// key returns the key identifying the repeats of the line of e in its stream.
+func (s *dedupStage) key(e Entry) string {
+	line := e.Line
+	if s.cfg.Normalize {
+		line = dedupNormalizeRegexp.ReplaceAllString(line, "#")
+	}
+	return strconv.FormatUint(uint64(e.Labels.FastFingerprint()), 16) + "\xff" + line
+}
+
+// collapse returns the entry of g annotated with its repeats.
+func (s *dedupStage) collapse(g *dedupGroup) Entry {
+	var (
+		first = g.entry.Timestamp.UTC().Format(time.RFC3339Nano)
+		last  = g.last.UTC().Format(time.RFC3339Nano)
+	)
+
+	extracted := make(map[string]interface{}, len(g.entry.Extracted)+3)
+	for k, v := range g.entry.Extracted {
+		extracted[k] = v
+	}
+	extracted[DedupRepeatCountField] = g.count
+	extracted[DedupFirstTimestampField] = first
+	extracted[DedupLastTimestampField] = last
+
+	e := g.entry
+	e.Extracted = extracted
+	if s.cfg.AppendFields && g.count > 1 {
+		e.Line = fmt.Sprintf("%s %s=%d %s=%s %s=%s", e.Line,
+			DedupRepeatCountField, g.count,
+			DedupFirstTimestampField, first,
+			DedupLastTimestampField, last)
+	}
+	return e
+}
+
+// Name implements Stage.
+func (s *dedupStage) Name() string {
+	return StageTypeDedup
+}
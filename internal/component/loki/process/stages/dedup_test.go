@@ -0,0 +1,128 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDedupRiver = `
+stage.dedup {
+	window = "1m"
+}
+`
+
+var testDedupNormalizeRiver = `
+stage.dedup {
+	window        = "1m"
+	normalize     = true
+	append_fields = false
+}
+`
+
+func TestDedupStage(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testDedupRiver), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	out := processEntries(pl,
+		newEntry(nil, model.LabelSet{"job": "geth"}, "dial failed", ts),
+		newEntry(nil, model.LabelSet{"job": "geth"}, "peer connected", ts.Add(time.Second)),
+		newEntry(nil, model.LabelSet{"job": "geth"}, "dial failed", ts.Add(2*time.Second)),
+		newEntry(nil, model.LabelSet{"job": "lighthouse"}, "dial failed", ts.Add(2*time.Second)),
+		newEntry(nil, model.LabelSet{"job": "geth"}, "dial failed", ts.Add(3*time.Second)),
+	)
+	require.Len(t, out, 3)
+
+	assert.Equal(t, "dial failed repeat_count=3 first_timestamp=2024-01-02T03:04:05Z last_timestamp=2024-01-02T03:04:08Z", out[0].Line)
+	assert.Equal(t, ts, out[0].Timestamp)
+	assert.Equal(t, 3, out[0].Extracted[DedupRepeatCountField])
+	assert.Equal(t, "2024-01-02T03:04:05Z", out[0].Extracted[DedupFirstTimestampField])
+	assert.Equal(t, "2024-01-02T03:04:08Z", out[0].Extracted[DedupLastTimestampField])
+
+	assert.Equal(t, "peer connected", out[1].Line)
+	assert.Equal(t, 1, out[1].Extracted[DedupRepeatCountField])
+
+	assert.Equal(t, "dial failed", out[2].Line)
+	assert.Equal(t, model.LabelSet{"job": "lighthouse"}, out[2].Labels)
+}
+
+func TestDedupStage_Normalize(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testDedupNormalizeRiver), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ts := time.Now()
+	out := processEntries(pl,
+		newEntry(nil, nil, "Peer disconnected addr=10.0.0.1:30303 duration=1.5s", ts),
+		newEntry(nil, nil, "Peer disconnected addr=10.0.0.27:30304 duration=12.25s", ts),
+		newEntry(nil, nil, "Dial failed id=0x8f3a", ts),
+		newEntry(nil, nil, "Dial failed id=0x1b", ts),
+	)
+	require.Len(t, out, 2)
+	assert.Equal(t, "Peer disconnected addr=10.0.0.1:30303 duration=1.5s", out[0].Line)
+	assert.Equal(t, 2, out[0].Extracted[DedupRepeatCountField])
+	assert.Equal(t, "Dial failed id=0x8f3a", out[1].Line)
+	assert.Equal(t, 2, out[1].Extracted[DedupRepeatCountField])
+}
+
+func TestDedupStage_Window(t *testing.T) {
+	s, err := newDedupStage(util_log.Logger, DedupConfig{Window: 50 * time.Millisecond, MaxEntries: 10}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	in := make(chan Entry)
+	out := s.Run(in)
+	defer close(in)
+
+	in <- newEntry(nil, nil, "dial failed", time.Now())
+	in <- newEntry(nil, nil, "dial failed", time.Now())
+
+	select {
+	case e := <-out:
+		assert.Equal(t, 2, e.Extracted[DedupRepeatCountField])
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the window to end")
+	}
+
+	// Lines read after the window ended are held again.
+	in <- newEntry(nil, nil, "dial failed", time.Now())
+	select {
+	case e := <-out:
+		assert.Equal(t, 1, e.Extracted[DedupRepeatCountField])
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the window to end")
+	}
+}
+
+func TestDedupStage_MaxEntries(t *testing.T) {
+	s, err := newDedupStage(util_log.Logger, DedupConfig{Window: time.Hour, MaxEntries: 1}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	in := make(chan Entry)
+	out := s.Run(in)
+	defer close(in)
+
+	in <- newEntry(nil, nil, "first", time.Now())
+	go func() {
+		in <- newEntry(nil, nil, "second", time.Now())
+	}()
+
+	select {
+	case e := <-out:
+		assert.Equal(t, "first", e.Line)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the oldest line to be sent")
+	}
+}
+
+func TestDedupConfig_Validate(t *testing.T) {
+	_, err := newDedupStage(util_log.Logger, DedupConfig{MaxEntries: 1}, prometheus.NewRegistry())
+	require.EqualError(t, err, "window must be greater than 0")
+
+	_, err = newDedupStage(util_log.Logger, DedupConfig{Window: time.Second}, prometheus.NewRegistry())
+	require.EqualError(t, err, "max_entries must be greater than 0")
+}
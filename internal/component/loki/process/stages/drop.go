@@ -105,10 +105,12 @@ func (m *dropStage) Run(in chan Entry) chan Entry {
 		defer close(out)
 		for e := range in {
 			if !m.shouldDrop(e) {
+				e.traceStep(m)
 				out <- e
 				continue
 			}
 			m.dropCount.WithLabelValues(m.cfg.DropReason).Inc()
+			e.traceDrop(m.cfg.DropReason)
 		}
 	}()
 	return out
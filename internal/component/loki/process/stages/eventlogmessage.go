@@ -53,6 +53,7 @@ func (m *eventLogMessageStage) Run(in chan Entry) chan Entry {
 			if err != nil {
 				continue
 			}
+			e.traceStep(m)
 			out <- e
 		}
 	}()
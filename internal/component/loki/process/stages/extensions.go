@@ -150,6 +150,7 @@ func (c *cri) Run(entry chan Entry) chan Entry {
 			c.ensureTruncateIfRequired(&e)
 			delete(c.partialLines, fingerprint)
 		}
+		e.traceStep(c)
 		return []Entry{e}, false
 	})
 
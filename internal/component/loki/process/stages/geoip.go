@@ -136,6 +136,7 @@ func (g *geoIPStage) Run(in chan Entry) chan Entry {
 		defer g.close()
 		for e := range in {
 			g.process(e.Labels, e.Extracted)
+			e.traceStep(g)
 			out <- e
 		}
 	}()
@@ -7,6 +7,7 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 type inspector struct {
@@ -56,7 +57,7 @@ func (i inspector) inspect(stageName string, before *Entry, after Entry) {
 		formatter: i.formatter,
 	}
 
-	cmp.Equal(*before, after, cmp.Reporter(&r))
+	cmp.Equal(*before, after, cmp.Reporter(&r), cmpopts.IgnoreUnexported(Entry{}))
 
 	diff := r.String()
 	if strings.TrimSpace(diff) == "" {
@@ -87,6 +87,7 @@ func (j *jsonStage) Run(in chan Entry) chan Entry {
 			if err != nil && j.cfg.DropMalformed {
 				continue
 			}
+			e.traceStep(j)
 			out <- e
 		}
 	}()
@@ -0,0 +1,503 @@
+package stages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/flow/logging/level"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// Formats of the access logs parsed by the jsonrpc stage.
+const (
+	JSONRPCFormatNginx         = "nginx"
+	JSONRPCFormatNginxCombined = "nginx_combined"
+	JSONRPCFormatCaddy         = "caddy"
+	JSONRPCFormatHAProxy       = "haproxy"
+	JSONRPCFormatExtracted     = "extracted"
+)
+
+// JSONRPCFormats lists the formats of the access logs parsed by the jsonrpc
+// stage.
+var JSONRPCFormats = []string{
+	JSONRPCFormatNginx,
+	JSONRPCFormatNginxCombined,
+	JSONRPCFormatCaddy,
+	JSONRPCFormatHAProxy,
+	JSONRPCFormatExtracted,
+}
+
+// Names of the values extracted by the jsonrpc stage.
+const (
+	JSONRPCMethodField    = "jsonrpc_method"
+	JSONRPCBatchSizeField = "jsonrpc_batch_size"
+	JSONRPCClientField    = "jsonrpc_client"
+	JSONRPCStatusField    = "jsonrpc_status"
+	JSONRPCErrorCodeField = "jsonrpc_error_code"
+	JSONRPCErrorField     = "jsonrpc_error"
+	JSONRPCDurationField  = "jsonrpc_duration"
+)
+
+// JSONRPCBatchMethod is the method of batches of calls of different methods.
+const JSONRPCBatchMethod = "batch"
+
+// JSONRPCOtherMethod is the method of calls whose method isn't a valid method
+// name or isn't one of the allowed methods. Methods are set by the clients,
+// so they're bounded before they're used as labels.
+const JSONRPCOtherMethod = "other"
+
+// Fields of an access log record read by the jsonrpc stage, which are the
+// keys of the fields attribute for the extracted format.
+const (
+	jsonrpcFieldBody      = "body"
+	jsonrpcFieldMethod    = "method"
+	jsonrpcFieldStatus    = "status"
+	jsonrpcFieldClient    = "client"
+	jsonrpcFieldDuration  = "duration"
+	jsonrpcFieldResponse  = "response"
+	jsonrpcFieldErrorCode = "error_code"
+)
+
+var jsonrpcFields = []string{
+	jsonrpcFieldBody,
+	jsonrpcFieldMethod,
+	jsonrpcFieldStatus,
+	jsonrpcFieldClient,
+	jsonrpcFieldDuration,
+	jsonrpcFieldResponse,
+	jsonrpcFieldErrorCode,
+}
+
+var (
+	// The combined log format followed by $request_time and
+	// "$request_body".
+	nginxCombinedRegexp = regexp.MustCompile(`^(\S+) \S+ (\S+) \[[^\]]*\] "(?:[^"\\]|\\.)*" (\d{3}) \S+ "(?:[^"\\]|\\.)*" "(?:[^"\\]|\\.)*" ([0-9.]+) "((?:[^"\\]|\\.)*)"`)
+	// The escapes of variables in nginx logs, e.g. \x22 for a quote.
+	nginxEscapeRegexp = regexp.MustCompile(`\\x[0-9A-Fa-f]{2}`)
+	// The HTTP log format of HAProxy, up to the captured request headers.
+	haproxyRegexp = regexp.MustCompile(`(\S+):\d+ \[[^\]]+\] \S+ \S+ -?\d+/-?\d+/-?\d+/-?\d+/\+?(\d+) (-?\d+) .*?\{([^}]*)\}`)
+	// The methods extracted as is, other methods are JSONRPCOtherMethod.
+	jsonrpcMethodRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+)
+
+// JSONRPCConfig configures a processing stage extracting the JSON-RPC calls
+// of the access logs of RPC gateways.
+type JSONRPCConfig struct {
+	Format         string            `river:"format,attr"`
+	Source         string            `river:"source,attr,optional"`
+	Fields         map[string]string `river:"fields,attr,optional"`
+	AllowedMethods []string          `river:"allowed_methods,attr,optional"`
+}
+
+// validateJSONRPCConfig validates the JSONRPCConfig.
+func validateJSONRPCConfig(c *JSONRPCConfig) error {
+	switch c.Format {
+	case JSONRPCFormatNginx, JSONRPCFormatNginxCombined, JSONRPCFormatCaddy, JSONRPCFormatHAProxy:
+		if len(c.Fields) > 0 {
+			return fmt.Errorf("fields can only be set for the %s format", JSONRPCFormatExtracted)
+		}
+	case JSONRPCFormatExtracted:
+		if c.Source != "" {
+			return fmt.Errorf("source can't be set for the %s format", JSONRPCFormatExtracted)
+		}
+		if c.Fields[jsonrpcFieldBody] == "" && c.Fields[jsonrpcFieldMethod] == "" {
+			return fmt.Errorf("fields must map %s or %s for the %s format", jsonrpcFieldBody, jsonrpcFieldMethod, JSONRPCFormatExtracted)
+		}
+		for f := range c.Fields {
+			if !isJSONRPCField(f) {
+				return fmt.Errorf("unknown field %q, must be one of %s", f, strings.Join(jsonrpcFields, ", "))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format %q, must be one of %s", c.Format, strings.Join(JSONRPCFormats, ", "))
+	}
+	for _, m := range c.AllowedMethods {
+		if !jsonrpcMethodRegexp.MatchString(m) {
+			return fmt.Errorf("invalid allowed method %q, must match %s", m, jsonrpcMethodRegexp)
+		}
+	}
+	return nil
+}
+
+func isJSONRPCField(name string) bool {
+	for _, f := range jsonrpcFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newJSONRPCStage creates a jsonrpcStage from config.
+func newJSONRPCStage(logger log.Logger, config JSONRPCConfig) (Stage, error) {
+	if err := validateJSONRPCConfig(&config); err != nil {
+		return nil, err
+	}
+	var allowed map[string]struct{}
+	if len(config.AllowedMethods) > 0 {
+		allowed = make(map[string]struct{}, len(config.AllowedMethods))
+		for _, m := range config.AllowedMethods {
+			allowed[m] = struct{}{}
+		}
+	}
+	return toStage(&jsonrpcStage{
+		cfg:     config,
+		logger:  log.With(logger, "component", "stage", "type", "jsonrpc"),
+		allowed: allowed,
+	}), nil
+}
+
+// jsonrpcStage extracts the method, batch size, client, status and error of
+// the JSON-RPC calls of access log lines, to be used by the metrics stage.
+type jsonrpcStage struct {
+	cfg    JSONRPCConfig
+	logger log.Logger
+	// allowed is the set of allowed methods, or nil if all the valid method
+	// names are.
+	allowed map[string]struct{}
+}
+
+// accessRecord is the access log record of a JSON-RPC call.
+type accessRecord struct {
+	// body is the JSON-RPC request, and method the method of the call set in
+	// a header by the client, if the body isn't logged.
+	body, method string
+	status       string
+	client       string
+	// duration is the time taken to serve the call, in seconds.
+	duration  string
+	response  string
+	errorCode string
+}
+
+// Process implements Stage.
+func (s *jsonrpcStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	var (
+		rec accessRecord
+		err error
+	)
+	if s.cfg.Format == JSONRPCFormatExtracted {
+		rec = s.extractedRecord(extracted)
+	} else {
+		input := entry
+		if s.cfg.Source != "" {
+			value, ok := extracted[s.cfg.Source]
+			if !ok {
+				level.Debug(s.logger).Log("msg", "source does not exist in the set of extracted values", "source", s.cfg.Source)
+				return
+			}
+			str, err := getString(value)
+			if err != nil {
+				level.Debug(s.logger).Log("msg", "failed to convert source value to string", "source", s.cfg.Source, "err", err, "type", reflect.TypeOf(value))
+				return
+			}
+			input = &str
+		}
+		if input == nil {
+			level.Debug(s.logger).Log("msg", "cannot parse a nil entry")
+			return
+		}
+		rec, err = parseAccessRecord(s.cfg.Format, *input)
+		if err != nil {
+			level.Debug(s.logger).Log("msg", "failed to parse access log line", "format", s.cfg.Format, "err", err)
+			return
+		}
+	}
+
+	method, batchSize := jsonrpcMethod(rec.body)
+	if method == "" {
+		method, batchSize = rec.method, 1
+	}
+	if method == "" {
+		level.Debug(s.logger).Log("msg", "access log line holds no JSON-RPC call")
+		return
+	}
+	method = s.boundMethod(method)
+
+	errorCode := rec.errorCode
+	if errorCode == "" {
+		errorCode = jsonrpcErrorCode(rec.response)
+	}
+	status, _ := strconv.Atoi(rec.status)
+
+	extracted[JSONRPCMethodField] = method
+	extracted[JSONRPCBatchSizeField] = batchSize
+	extracted[JSONRPCStatusField] = rec.status
+	extracted[JSONRPCErrorField] = strconv.FormatBool(status >= 400 || errorCode != "")
+	if rec.client != "" {
+		extracted[JSONRPCClientField] = rec.client
+	}
+	if errorCode != "" {
+		extracted[JSONRPCErrorCodeField] = errorCode
+	}
+	if d, err := strconv.ParseFloat(rec.duration, 64); err == nil {
+		extracted[JSONRPCDurationField] = d
+	}
+}
+
+// boundMethod returns method if it's a valid and allowed method name, and
+// JSONRPCOtherMethod otherwise.
+func (s *jsonrpcStage) boundMethod(method string) string {
+	if method == JSONRPCBatchMethod {
+		return method
+	}
+	if !jsonrpcMethodRegexp.MatchString(method) {
+		return JSONRPCOtherMethod
+	}
+	if s.allowed != nil {
+		if _, ok := s.allowed[method]; !ok {
+			return JSONRPCOtherMethod
+		}
+	}
+	return method
+}
+
+// extractedRecord reads the record of the extracted format from the values
+// extracted by the previous stages.
+func (s *jsonrpcStage) extractedRecord(extracted map[string]interface{}) accessRecord {
+	get := func(field string) string {
+		value, ok := extracted[s.cfg.Fields[field]]
+		if !ok {
+			return ""
+		}
+		str, err := getString(value)
+		if err != nil {
+			level.Debug(s.logger).Log("msg", "failed to convert extracted value to string", "field", field, "err", err)
+			return ""
+		}
+		return str
+	}
+	return accessRecord{
+		body:      get(jsonrpcFieldBody),
+		method:    get(jsonrpcFieldMethod),
+		status:    get(jsonrpcFieldStatus),
+		client:    get(jsonrpcFieldClient),
+		duration:  get(jsonrpcFieldDuration),
+		response:  get(jsonrpcFieldResponse),
+		errorCode: get(jsonrpcFieldErrorCode),
+	}
+}
+
+// parseAccessRecord parses an access log line in the given format.
+func parseAccessRecord(format, line string) (accessRecord, error) {
+	switch format {
+	case JSONRPCFormatNginx:
+		return parseNginxRecord(line)
+	case JSONRPCFormatNginxCombined:
+		return parseNginxCombinedRecord(line)
+	case JSONRPCFormatCaddy:
+		return parseCaddyRecord(line)
+	case JSONRPCFormatHAProxy:
+		return parseHAProxyRecord(line)
+	}
+	return accessRecord{}, fmt.Errorf("unknown format %q", format)
+}
+
+// parseNginxRecord parses a line of a JSON log_format escaping its variables
+// as JSON, e.g.:
+//
+//	log_format jsonrpc escape=json '{"remote_addr":"$remote_addr",'
+//	  '"remote_user":"$remote_user","http_x_client_id":"$http_x_client_id",'
+//	  '"status":$status,"request_time":$request_time,'
+//	  '"http_x_jsonrpc_method":"$http_x_jsonrpc_method",'
+//	  '"request_body":"$request_body"}';
+//
+// The response_body of OpenResty is read as well, if logged.
+func parseNginxRecord(line string) (accessRecord, error) {
+	var r struct {
+		RemoteAddr   string      `json:"remote_addr"`
+		RemoteUser   string      `json:"remote_user"`
+		ClientID     string      `json:"http_x_client_id"`
+		Status       json.Number `json:"status"`
+		RequestTime  json.Number `json:"request_time"`
+		Method       string      `json:"http_x_jsonrpc_method"`
+		RequestBody  string      `json:"request_body"`
+		ResponseBody string      `json:"response_body"`
+	}
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		return accessRecord{}, err
+	}
+	return accessRecord{
+		body:     r.RequestBody,
+		method:   r.Method,
+		status:   r.Status.String(),
+		client:   firstNonEmpty(r.ClientID, r.RemoteUser, r.RemoteAddr),
+		duration: r.RequestTime.String(),
+		response: r.ResponseBody,
+	}, nil
+}
+
+// parseNginxCombinedRecord parses a line of the combined log format followed
+// by the request time and body:
+//
+//	log_format jsonrpc '$remote_addr - $remote_user [$time_local] '
+//	  '"$request" $status $body_bytes_sent "$http_referer" '
+//	  '"$http_user_agent" $request_time "$request_body"';
+func parseNginxCombinedRecord(line string) (accessRecord, error) {
+	m := nginxCombinedRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return accessRecord{}, fmt.Errorf("line doesn't match the combined log format with the request time and body")
+	}
+	user := m[2]
+	if user == "-" {
+		user = ""
+	}
+	return accessRecord{
+		body:     unescapeNginx(m[5]),
+		status:   m[3],
+		client:   firstNonEmpty(user, m[1]),
+		duration: m[4],
+	}, nil
+}
+
+// unescapeNginx unescapes the \xHH escapes of the variables of nginx logs.
+func unescapeNginx(s string) string {
+	return nginxEscapeRegexp.ReplaceAllStringFunc(s, func(esc string) string {
+		b, err := strconv.ParseUint(esc[2:], 16, 8)
+		if err != nil {
+			return esc
+		}
+		return string([]byte{byte(b)})
+	})
+}
+
+// parseCaddyRecord parses a line of the JSON access logs of Caddy, which
+// don't hold the request bodies: the method is read from the
+// X-Jsonrpc-Method request header.
+func parseCaddyRecord(line string) (accessRecord, error) {
+	var r struct {
+		Request struct {
+			RemoteIP string              `json:"remote_ip"`
+			ClientIP string              `json:"client_ip"`
+			Headers  map[string][]string `json:"headers"`
+		} `json:"request"`
+		UserID      string              `json:"user_id"`
+		Duration    json.Number         `json:"duration"`
+		Status      json.Number         `json:"status"`
+		RespHeaders map[string][]string `json:"resp_headers"`
+	}
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		return accessRecord{}, err
+	}
+	header := func(headers map[string][]string, name string) string {
+		for k, v := range headers {
+			if strings.EqualFold(k, name) && len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+	return accessRecord{
+		method:    header(r.Request.Headers, "X-Jsonrpc-Method"),
+		status:    r.Status.String(),
+		client:    firstNonEmpty(r.UserID, header(r.Request.Headers, "X-Client-Id"), r.Request.ClientIP, r.Request.RemoteIP),
+		duration:  r.Duration.String(),
+		errorCode: header(r.RespHeaders, "X-Jsonrpc-Error-Code"),
+	}, nil
+}
+
+// parseHAProxyRecord parses a line of the HTTP log format of HAProxy, with
+// the method and client ID captured from the request headers:
+//
+//	capture request header X-Jsonrpc-Method len 64
+//	capture request header X-Client-Id len 64
+func parseHAProxyRecord(line string) (accessRecord, error) {
+	m := haproxyRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return accessRecord{}, fmt.Errorf("line doesn't match the HTTP log format")
+	}
+	captures := strings.Split(m[4], "|")
+	rec := accessRecord{
+		method: captures[0],
+		status: m[3],
+		client: m[1],
+	}
+	if len(captures) > 1 && captures[1] != "" {
+		rec.client = captures[1]
+	}
+	// The total time, Tt, is in milliseconds.
+	if ms, err := strconv.ParseFloat(m[2], 64); err == nil {
+		rec.duration = strconv.FormatFloat(ms/1000, 'f', -1, 64)
+	}
+	return rec, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" && v != "-" {
+			return v
+		}
+	}
+	return ""
+}
+
+// jsonrpcCall is the part of a JSON-RPC request or response read by the
+// jsonrpc stage.
+type jsonrpcCall struct {
+	Method string `json:"method"`
+	Error  *struct {
+		Code json.Number `json:"code"`
+	} `json:"error"`
+}
+
+// jsonrpcMethod returns the method and number of calls of a JSON-RPC request,
+// or an empty method if body isn't one. The method of batches of calls of
+// different methods is JSONRPCBatchMethod.
+func jsonrpcMethod(body string) (string, int) {
+	calls := jsonrpcCalls(body)
+	if len(calls) == 0 {
+		return "", 0
+	}
+	method := calls[0].Method
+	for _, c := range calls[1:] {
+		if c.Method != method {
+			method = JSONRPCBatchMethod
+			break
+		}
+	}
+	return method, len(calls)
+}
+
+// jsonrpcErrorCode returns the code of the first error of a JSON-RPC
+// response, if any.
+func jsonrpcErrorCode(response string) string {
+	for _, c := range jsonrpcCalls(response) {
+		if c.Error != nil {
+			return c.Error.Code.String()
+		}
+	}
+	return ""
+}
+
+// jsonrpcCalls decodes a JSON-RPC request or response, or a batch of them.
+func jsonrpcCalls(s string) []jsonrpcCall {
+	b := bytes.TrimSpace([]byte(s))
+	if len(b) == 0 {
+		return nil
+	}
+	var calls []jsonrpcCall
+	if b[0] == '[' {
+		if err := json.Unmarshal(b, &calls); err != nil {
+			return nil
+		}
+	} else {
+		var c jsonrpcCall
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil
+		}
+		calls = []jsonrpcCall{c}
+	}
+	return calls
+}
+
+// Name implements Stage.
+func (s *jsonrpcStage) Name() string {
+	return StageTypeJSONRPC
+}
@@ -0,0 +1,291 @@
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testJSONRPCMetricsRiver = `
+stage.jsonrpc {
+	format = "nginx"
+}
+stage.labels {
+	values = { method = "jsonrpc_method" }
+}
+stage.metrics {
+	metric.counter {
+		name        = "jsonrpc_requests_total"
+		description = "JSON-RPC requests"
+		source      = "jsonrpc_method"
+		action      = "inc"
+	}
+	metric.counter {
+		name        = "jsonrpc_errors_total"
+		description = "JSON-RPC errors"
+		source      = "jsonrpc_error"
+		value       = "true"
+		action      = "inc"
+	}
+	metric.histogram {
+		name        = "jsonrpc_request_duration_seconds"
+		description = "JSON-RPC request duration"
+		source      = "jsonrpc_duration"
+		buckets     = [0.01, 0.1, 1]
+	}
+}
+stage.label_drop {
+	values = ["method"]
+}
+`
+
+// jsonrpcResult holds the values extracted by the jsonrpc stage from an
+// access log line.
+type jsonrpcResult struct {
+	method    string
+	batchSize int
+	client    string
+	status    string
+	isError   string
+	errorCode string
+	duration  float64
+}
+
+func TestJSONRPCStage_Formats(t *testing.T) {
+	tests := map[string][]jsonrpcResult{
+		JSONRPCFormatNginx: {
+			{"eth_blockNumber", 1, "wallet", "200", "false", "", 0.004},
+			{"eth_getBalance", 3, "alice", "200", "false", "", 0.021},
+			{JSONRPCBatchMethod, 2, "10.0.0.7", "200", "false", "", 0.013},
+			{"eth_call", 1, "wallet", "200", "true", "-32000", 0.05},
+			{"eth_sendRawTransaction", 1, "indexer", "502", "true", "", 1.5},
+			{},
+		},
+		JSONRPCFormatNginxCombined: {
+			{"eth_blockNumber", 1, "10.0.0.5", "200", "false", "", 0.004},
+			{"eth_getBalance", 3, "alice", "200", "false", "", 0.021},
+			{JSONRPCBatchMethod, 2, "10.0.0.7", "200", "false", "", 0.013},
+			{"eth_call", 1, "10.0.0.5", "200", "false", "", 0.05},
+			{"eth_sendRawTransaction", 1, "10.0.0.8", "502", "true", "", 1.5},
+			{},
+		},
+		JSONRPCFormatCaddy: {
+			{"eth_blockNumber", 1, "wallet", "200", "false", "", 0.004},
+			{"eth_getBalance", 1, "alice", "200", "false", "", 0.021},
+			{"eth_call", 1, "10.0.0.7", "200", "false", "", 0.013},
+			{"eth_call", 1, "wallet", "200", "true", "-32000", 0.05},
+			{"eth_sendRawTransaction", 1, "indexer", "502", "true", "", 1.5},
+			{},
+		},
+		JSONRPCFormatHAProxy: {
+			{"eth_blockNumber", 1, "wallet", "200", "false", "", 0.004},
+			{"eth_getBalance", 1, "alice", "200", "false", "", 0.021},
+			{"eth_call", 1, "10.0.0.7", "200", "false", "", 0.013},
+			{"eth_call", 1, "wallet", "200", "false", "", 0.05},
+			{"eth_sendRawTransaction", 1, "indexer", "502", "true", "", 1.5},
+			{},
+		},
+	}
+
+	for format, expected := range tests {
+		t.Run(format, func(t *testing.T) {
+			pl, err := NewPipeline(util_log.Logger, loadConfig(fmt.Sprintf(`stage.jsonrpc { format = %q }`, format)), nil, prometheus.NewRegistry())
+			require.NoError(t, err)
+
+			lines := readJSONRPCFixture(t, format)
+			require.Len(t, lines, len(expected))
+
+			entries := make([]Entry, 0, len(lines))
+			for _, line := range lines {
+				entries = append(entries, newEntry(nil, nil, line, time.Now()))
+			}
+			out := processEntries(pl, entries...)
+			require.Len(t, out, len(expected))
+
+			for i, e := range out {
+				assert.Equal(t, expected[i], toJSONRPCResult(e.Extracted), "line %d", i+1)
+				assert.Equal(t, lines[i], e.Line, "the line must be unchanged")
+			}
+		})
+	}
+}
+
+func TestJSONRPCStage_Extracted(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.logfmt {
+	mapping = { "body" = "", "code" = "", "took" = "", "key" = "" }
+}
+stage.jsonrpc {
+	format = "extracted"
+	fields = { body = "body", status = "code", duration = "took", client = "key" }
+}
+`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	out := processEntries(pl, newEntry(nil, nil, `code=429 took=0.25 key=team-a body="{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"eth_getLogs\",\"params\":[]}"`, time.Now()))
+	require.Len(t, out, 1)
+	assert.Equal(t, jsonrpcResult{"eth_getLogs", 1, "team-a", "429", "true", "", 0.25}, toJSONRPCResult(out[0].Extracted))
+}
+
+func TestJSONRPCStage_BoundedMethods(t *testing.T) {
+	tests := map[string]struct {
+		allowed []string
+		body    string
+		method  string
+	}{
+		"valid method": {
+			body:   `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`,
+			method: "eth_call",
+		},
+		"invalid characters": {
+			body:   `{"jsonrpc":"2.0","id":1,"method":"eth_call\"} 1\n# injected"}`,
+			method: JSONRPCOtherMethod,
+		},
+		"too long": {
+			body:   `{"jsonrpc":"2.0","id":1,"method":"` + strings.Repeat("a", 65) + `"}`,
+			method: JSONRPCOtherMethod,
+		},
+		"random batch": {
+			body:    `[{"method":"x_1d4f"},{"method":"x_1d4f"}]`,
+			allowed: []string{"eth_call"},
+			method:  JSONRPCOtherMethod,
+		},
+		"allowed method": {
+			body:    `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`,
+			allowed: []string{"eth_call", "eth_getLogs"},
+			method:  "eth_call",
+		},
+		"not allowed method": {
+			body:    `{"jsonrpc":"2.0","id":1,"method":"debug_traceTransaction"}`,
+			allowed: []string{"eth_call", "eth_getLogs"},
+			method:  JSONRPCOtherMethod,
+		},
+		"batch of allowed methods": {
+			body:    `[{"method":"eth_call"},{"method":"eth_getLogs"}]`,
+			allowed: []string{"eth_call"},
+			method:  JSONRPCBatchMethod,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := newJSONRPCStage(util_log.Logger, JSONRPCConfig{
+				Format:         JSONRPCFormatExtracted,
+				Fields:         map[string]string{"body": "body"},
+				AllowedMethods: tt.allowed,
+			})
+			require.NoError(t, err)
+
+			out := processEntries(s, newEntry(map[string]interface{}{"body": tt.body}, nil, "", time.Now()))
+			require.Len(t, out, 1)
+			assert.Equal(t, tt.method, out[0].Extracted[JSONRPCMethodField])
+		})
+	}
+}
+
+func TestJSONRPCStage_Metrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testJSONRPCMetricsRiver), nil, reg)
+	require.NoError(t, err)
+
+	var entries []Entry
+	for _, line := range readJSONRPCFixture(t, JSONRPCFormatNginx) {
+		entries = append(entries, newEntry(nil, nil, line, time.Now()))
+	}
+	out := processEntries(pl, entries...)
+	require.Len(t, out, len(entries))
+	for _, e := range out {
+		require.Empty(t, e.Labels, "the method label must only be set on the metrics")
+	}
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP loki_process_custom_jsonrpc_errors_total JSON-RPC errors
+# TYPE loki_process_custom_jsonrpc_errors_total counter
+loki_process_custom_jsonrpc_errors_total{method="eth_call"} 1
+loki_process_custom_jsonrpc_errors_total{method="eth_sendRawTransaction"} 1
+# HELP loki_process_custom_jsonrpc_requests_total JSON-RPC requests
+# TYPE loki_process_custom_jsonrpc_requests_total counter
+loki_process_custom_jsonrpc_requests_total{method="batch"} 1
+loki_process_custom_jsonrpc_requests_total{method="eth_blockNumber"} 1
+loki_process_custom_jsonrpc_requests_total{method="eth_call"} 1
+loki_process_custom_jsonrpc_requests_total{method="eth_getBalance"} 1
+loki_process_custom_jsonrpc_requests_total{method="eth_sendRawTransaction"} 1
+`), "loki_process_custom_jsonrpc_requests_total", "loki_process_custom_jsonrpc_errors_total")
+	require.NoError(t, err)
+
+	count, err := testutil.GatherAndCount(reg, "loki_process_custom_jsonrpc_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 5, count)
+}
+
+func TestJSONRPCConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		config JSONRPCConfig
+		err    string
+	}{
+		"preset": {
+			config: JSONRPCConfig{Format: JSONRPCFormatHAProxy, Source: "message"},
+		},
+		"unknown format": {
+			config: JSONRPCConfig{Format: "apache"},
+			err:    `unknown format "apache", must be one of nginx, nginx_combined, caddy, haproxy, extracted`,
+		},
+		"fields of preset": {
+			config: JSONRPCConfig{Format: JSONRPCFormatNginx, Fields: map[string]string{"body": "body"}},
+			err:    "fields can only be set for the extracted format",
+		},
+		"extracted without body or method": {
+			config: JSONRPCConfig{Format: JSONRPCFormatExtracted, Fields: map[string]string{"status": "status"}},
+			err:    "fields must map body or method for the extracted format",
+		},
+		"extracted with unknown field": {
+			config: JSONRPCConfig{Format: JSONRPCFormatExtracted, Fields: map[string]string{"method": "m", "latency": "l"}},
+			err:    `unknown field "latency", must be one of body, method, status, client, duration, response, error_code`,
+		},
+		"extracted with source": {
+			config: JSONRPCConfig{Format: JSONRPCFormatExtracted, Source: "message", Fields: map[string]string{"method": "m"}},
+			err:    "source can't be set for the extracted format",
+		},
+		"invalid allowed method": {
+			config: JSONRPCConfig{Format: JSONRPCFormatNginx, AllowedMethods: []string{"eth_call", "eth call"}},
+			err:    `invalid allowed method "eth call", must match ^[A-Za-z0-9_]{1,64}$`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newJSONRPCStage(util_log.Logger, tt.config)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func readJSONRPCFixture(t *testing.T, format string) []string {
+	t.Helper()
+	buf, err := os.ReadFile(filepath.Join("testdata", "jsonrpc", format+".log"))
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+}
+
+func toJSONRPCResult(extracted map[string]interface{}) jsonrpcResult {
+	var r jsonrpcResult
+	r.method, _ = extracted[JSONRPCMethodField].(string)
+	r.batchSize, _ = extracted[JSONRPCBatchSizeField].(int)
+	r.client, _ = extracted[JSONRPCClientField].(string)
+	r.status, _ = extracted[JSONRPCStatusField].(string)
+	r.isError, _ = extracted[JSONRPCErrorField].(string)
+	r.errorCode, _ = extracted[JSONRPCErrorCodeField].(string)
+	r.duration, _ = extracted[JSONRPCDurationField].(float64)
+	return r
+}
@@ -91,9 +91,11 @@ func (m *limitStage) Run(in chan Entry) chan Entry {
 		defer close(out)
 		for e := range in {
 			if !m.shouldThrottle(e.Labels) {
+				e.traceStep(m)
 				out <- e
 				continue
 			}
+			e.traceDrop(ratelimitDropReason)
 		}
 	}()
 	return out
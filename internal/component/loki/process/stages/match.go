@@ -147,6 +147,7 @@ func (m *matcherStage) runKeep(in chan Entry) chan Entry {
 	go func() {
 		defer close(out)
 		for e := range outNext {
+			e.traceStep(m)
 			out <- e
 		}
 	}()
@@ -155,6 +156,7 @@ func (m *matcherStage) runKeep(in chan Entry) chan Entry {
 		for e := range in {
 			e, ok := m.processLogQL(e)
 			if !ok {
+				e.traceStep(m)
 				out <- e
 				continue
 			}
@@ -170,10 +172,12 @@ func (m *matcherStage) runDrop(in chan Entry) chan Entry {
 		defer close(out)
 		for e := range in {
 			if e, ok := m.processLogQL(e); !ok {
+				e.traceStep(m)
 				out <- e
 				continue
 			}
 			m.dropCount.WithLabelValues(m.dropReason).Inc()
+			e.traceDrop(m.dropReason)
 		}
 	}()
 	return out
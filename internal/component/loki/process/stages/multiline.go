@@ -105,6 +105,7 @@ func (m *multilineStage) Run(in chan Entry) chan Entry {
 				// Pass through entries until we hit first start line.
 				if !m.cfg.regex.MatchString(e.Line) {
 					level.Debug(m.logger).Log("msg", "pass through entry", "stream", key)
+					e.traceStep(m)
 					out <- e
 					continue
 				}
@@ -194,10 +195,12 @@ func (m *multilineStage) flush(out chan Entry, s *multilineState) {
 				Line:      s.buffer.String(),
 			},
 		},
+		trace: s.startLineEntry.trace,
 	}
 	s.buffer.Reset()
 	s.currentLines = 0
 
+	collapsed.traceStep(m)
 	out <- collapsed
 }
 
@@ -136,7 +136,9 @@ func (m *packStage) Run(in chan Entry) chan Entry {
 	go func() {
 		defer close(out)
 		for e := range in {
-			out <- m.pack(e)
+			e = m.pack(e)
+			e.traceStep(m)
+			out <- e
 		}
 	}()
 	return out
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"sync"
 
-	"github.com/go-kit/log"
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
 )
@@ -16,13 +16,16 @@ import (
 // exactly one is set.
 type StageConfig struct {
 	//TODO(thampiotr): sync these with new stages
+	ChainEventsConfig     *ChainEventsConfig     `river:"chain_events,block,optional"`
 	CRIConfig             *CRIConfig             `river:"cri,block,optional"`
 	DecolorizeConfig      *DecolorizeConfig      `river:"decolorize,block,optional"`
+	DedupConfig           *DedupConfig           `river:"dedup,block,optional"`
 	DockerConfig          *DockerConfig          `river:"docker,block,optional"`
 	DropConfig            *DropConfig            `river:"drop,block,optional"`
 	EventLogMessageConfig *EventLogMessageConfig `river:"eventlogmessage,block,optional"`
 	GeoIPConfig           *GeoIPConfig           `river:"geoip,block,optional"`
 	JSONConfig            *JSONConfig            `river:"json,block,optional"`
+	JSONRPCConfig         *JSONRPCConfig         `river:"jsonrpc,block,optional"`
 	LabelAllowConfig      *LabelAllowConfig      `river:"label_keep,block,optional"`
 	LabelDropConfig       *LabelDropConfig       `river:"label_drop,block,optional"`
 	LabelsConfig          *LabelsConfig          `river:"labels,block,optional"`
@@ -34,6 +37,7 @@ type StageConfig struct {
 	MultilineConfig       *MultilineConfig       `river:"multiline,block,optional"`
 	OutputConfig          *OutputConfig          `river:"output,block,optional"`
 	PackConfig            *PackConfig            `river:"pack,block,optional"`
+	RedactConfig          *RedactConfig          `river:"redact,block,optional"`
 	RegexConfig           *RegexConfig           `river:"regex,block,optional"`
 	ReplaceConfig         *ReplaceConfig         `river:"replace,block,optional"`
 	StaticLabelsConfig    *StaticLabelsConfig    `river:"static_labels,block,optional"`
@@ -54,6 +58,9 @@ type Pipeline struct {
 	stages    []Stage
 	jobName   *string
 	dropCount *prometheus.CounterVec
+
+	tap          *Tap
+	tapRedactors []*Redactor
 }
 
 // NewPipeline creates a new log entry pipeline from a configuration
@@ -130,15 +137,35 @@ func (p *Pipeline) Run(in chan Entry) chan Entry {
 		for labelName, labelValue := range e.Labels {
 			e.Extracted[string(labelName)] = string(labelValue)
 		}
+		if p.tap != nil {
+			e.trace = p.tap.trace(e, p.stages, p.tapRedactors)
+		}
 		return e
 	})
-	// chain all stages together.
+	// chain all stages together. The stages record their changes to the
+	// entries sampled by the tap themselves.
 	for _, m := range p.stages {
 		in = m.Run(in)
 	}
+	if p.tap != nil {
+		in = RunWith(in, func(e Entry) Entry {
+			if e.trace != nil {
+				e.trace.finish()
+				e.trace = nil
+			}
+			return e
+		})
+	}
 	return in
 }
 
+// SetTap sets the tap recording the entries going through the pipeline. It
+// must be called before the pipeline is run.
+func (p *Pipeline) SetTap(t *Tap) {
+	p.tap = t
+	p.tapRedactors = traceRedactors(p.stages)
+}
+
 // Name implements Stage
 func (p *Pipeline) Name() string {
 	return StageTypePipeline
@@ -70,10 +70,12 @@ func (m *samplingStage) Run(in chan Entry) chan Entry {
 		defer close(out)
 		for e := range in {
 			if m.isSampled() {
+				e.traceStep(m)
 				out <- e
 				continue
 			}
 			m.dropCount.WithLabelValues(*m.cfg.DropReason).Inc()
+			e.traceDrop(*m.cfg.DropReason)
 		}
 	}()
 	return out
@@ -15,14 +15,17 @@ import (
 
 // TODO(@tpaschalis) Let's use this as the list of stages we need to port over.
 const (
-	StageTypeCRI        = "cri"
-	StageTypeDecolorize = "decolorize"
-	StageTypeDocker     = "docker"
-	StageTypeDrop       = "drop"
+	StageTypeChainEvents = "chain_events"
+	StageTypeCRI         = "cri"
+	StageTypeDecolorize  = "decolorize"
+	StageTypeDedup       = "dedup"
+	StageTypeDocker      = "docker"
+	StageTypeDrop        = "drop"
 	//TODO(thampiotr): Add support for eventlogmessage stage
 	StageTypeEventLogMessage    = "eventlogmessage"
 	StageTypeGeoIP              = "geoip"
 	StageTypeJSON               = "json"
+	StageTypeJSONRPC            = "jsonrpc"
 	StageTypeLabel              = "labels"
 	StageTypeLabelAllow         = "labelallow"
 	StageTypeLabelDrop          = "labeldrop"
@@ -35,6 +38,7 @@ const (
 	StageTypeOutput             = "output"
 	StageTypePack               = "pack"
 	StageTypePipeline           = "pipeline"
+	StageTypeRedact             = "redact"
 	StageTypeRegex              = "regex"
 	StageTypeReplace            = "replace"
 	StageTypeSampling           = "sampling"
@@ -55,6 +59,10 @@ type Processor interface {
 type Entry struct {
 	Extracted map[string]interface{}
 	loki.Entry
+
+	// trace records the entry through the pipeline when it is sampled by a
+	// Tap.
+	trace *entryTrace
 }
 
 // Stage can receive entries via an inbound channel and forward mutated entries to an outbound channel.
@@ -85,7 +93,7 @@ type stageProcessor struct {
 	inspector *inspector
 }
 
-func (s stageProcessor) Run(in chan Entry) chan Entry {
+func (s *stageProcessor) Run(in chan Entry) chan Entry {
 	return RunWith(in, func(e Entry) Entry {
 		var before *Entry
 
@@ -99,6 +107,7 @@ func (s stageProcessor) Run(in chan Entry) chan Entry {
 			s.inspector.inspect(s.Processor.Name(), before, e)
 		}
 
+		e.traceStep(s)
 		return e
 	})
 }
@@ -132,6 +141,11 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.JSONRPCConfig != nil:
+		s, err = newJSONRPCStage(logger, *cfg.JSONRPCConfig)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.LogfmtConfig != nil:
 		s, err = newLogfmtStage(logger, *cfg.LogfmtConfig)
 		if err != nil {
@@ -142,6 +156,11 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.RedactConfig != nil:
+		s, err = newRedactStage(*cfg.RedactConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.MetricsConfig != nil:
 		s, err = newMetricStage(logger, *cfg.MetricsConfig, registerer)
 		if err != nil {
@@ -234,6 +253,16 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.ChainEventsConfig != nil:
+		s, err = newChainEventsStage(logger, *cfg.ChainEventsConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.DedupConfig != nil:
+		s, err = newDedupStage(logger, *cfg.DedupConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.SamplingConfig != nil:
 		s = newSamplingStage(logger, *cfg.SamplingConfig, registerer)
 	case cfg.EventLogMessageConfig != nil:
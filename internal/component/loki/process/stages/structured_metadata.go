@@ -32,7 +32,9 @@ func (s *structuredMetadataStage) Run(in chan Entry) chan Entry {
 		processLabelsConfigs(s.logger, e.Extracted, s.cfgs, func(labelName model.LabelName, labelValue model.LabelValue) {
 			e.StructuredMetadata = append(e.StructuredMetadata, logproto.LabelAdapter{Name: string(labelName), Value: string(labelValue)})
 		})
-		return s.extractFromLabels(e)
+		e = s.extractFromLabels(e)
+		e.traceStep(s)
+		return e
 	})
 }
 
@@ -0,0 +1,449 @@
+package stages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// DefaultTapSampleRate is the fraction of the entries streamed to a
+	// subscriber of a Tap which doesn't set a sample rate.
+	DefaultTapSampleRate = 0.1
+
+	// tapBufferSize is the number of events buffered for a subscriber before
+	// new events are discarded.
+	tapBufferSize = 128
+)
+
+// TapEvent is an entry sampled by a Tap, with the changes made to it by each
+// stage of the pipeline it went through.
+type TapEvent struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Labels    model.LabelSet `json:"labels"`
+	Line      string         `json:"line"`
+	Steps     []TapStep      `json:"steps"`
+
+	Dropped    bool   `json:"dropped,omitempty"`
+	DropStage  string `json:"drop_stage,omitempty"`
+	DropReason string `json:"drop_reason,omitempty"`
+}
+
+// TapStep holds the changes made to an entry by a stage. A step without any
+// change is still recorded, so that a stage which stopped matching shows up.
+type TapStep struct {
+	Stage         string                 `json:"stage"`
+	Index         int                    `json:"index"`
+	LabelsAdded   model.LabelSet         `json:"labels_added,omitempty"`
+	LabelsDropped []string               `json:"labels_dropped,omitempty"`
+	Extracted     map[string]interface{} `json:"extracted,omitempty"`
+	Timestamp     *time.Time             `json:"timestamp,omitempty"`
+	Line          *string                `json:"line,omitempty"`
+}
+
+// Tap records samples of the entries going through a pipeline and streams
+// them to its subscribers. Entries are only recorded while the tap has
+// subscribers, and events are discarded for subscribers which fall behind,
+// so a tap never slows down the pipeline.
+//
+// If the pipeline has redact stages, the recorded lines, labels and extracted
+// values are redacted before they're streamed, so that the secrets scrubbed
+// from the entries don't leak through the tap.
+type Tap struct {
+	mut  sync.RWMutex
+	subs map[*TapSubscription]struct{}
+
+	// active is the number of subscribers. It's read without holding mut for
+	// every entry going through the pipeline.
+	active atomic.Int64
+}
+
+// NewTap returns a Tap without subscribers.
+func NewTap() *Tap {
+	return &Tap{subs: make(map[*TapSubscription]struct{})}
+}
+
+// TapSubscription receives the events of a Tap.
+type TapSubscription struct {
+	rate   float64
+	events chan TapEvent
+}
+
+// Events returns the channel receiving the events of the subscription. It is
+// closed once the subscription is removed from the tap.
+func (s *TapSubscription) Events() <-chan TapEvent {
+	return s.events
+}
+
+// Subscribe adds a subscriber receiving the given fraction of the entries
+// going through the pipeline.
+func (t *Tap) Subscribe(sampleRate float64) *TapSubscription {
+	s := &TapSubscription{rate: sampleRate, events: make(chan TapEvent, tapBufferSize)}
+	t.mut.Lock()
+	t.subs[s] = struct{}{}
+	t.active.Add(1)
+	t.mut.Unlock()
+	return s
+}
+
+// Unsubscribe removes the subscriber s from the tap.
+func (t *Tap) Unsubscribe(s *TapSubscription) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if _, ok := t.subs[s]; ok {
+		delete(t.subs, s)
+		t.active.Add(-1)
+		close(s.events)
+	}
+}
+
+// Record streams e to the subscribers sampling it, for entries which don't go
+// through a pipeline.
+func (t *Tap) Record(e loki.Entry) {
+	if tr := t.trace(Entry{Entry: e}, nil, nil); tr != nil {
+		tr.finish()
+	}
+}
+
+// trace returns the trace recording the entry e through the stages, or nil if
+// no subscriber samples the entry. The recorded values are redacted with the
+// given redactors before they're streamed.
+func (t *Tap) trace(e Entry, stages []Stage, redactors []*Redactor) *entryTrace {
+	if t.active.Load() == 0 {
+		return nil
+	}
+
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+
+	// A single roll is shared by the subscribers so that an entry sampled at
+	// a low rate is also sampled at any higher rate.
+	roll := rand.Float64()
+	sampled := false
+	for s := range t.subs {
+		if roll < s.rate {
+			sampled = true
+			break
+		}
+	}
+	if !sampled {
+		return nil
+	}
+
+	return &entryTrace{
+		tap:       t,
+		stages:    stages,
+		redactors: redactors,
+		roll:      roll,
+		event: TapEvent{
+			Timestamp: e.Timestamp,
+			Labels:    e.Labels.Clone(),
+			Line:      e.Line,
+			Steps:     make([]TapStep, 0, len(stages)),
+		},
+		labels:    e.Labels.Clone(),
+		extracted: copyExtracted(e.Extracted),
+		timestamp: e.Timestamp,
+		line:      e.Line,
+	}
+}
+
+func (t *Tap) publish(roll float64, ev TapEvent) {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	for s := range t.subs {
+		if roll >= s.rate {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams the events of the tap as newline-delimited JSON or, if
+// the client asks to upgrade the connection, as WebSocket messages. The
+// sample query parameter sets the fraction of the entries to stream.
+func (t *Tap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rate := DefaultTapSampleRate
+	if v := r.URL.Query().Get("sample"); v != "" {
+		var err error
+		rate, err = strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			http.Error(w, fmt.Sprintf("invalid sample %q, must be in (0, 1]", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replying, so that the entries sent once the client
+	// got the reply are streamed.
+	sub := t.Subscribe(rate)
+	defer t.Unsubscribe(sub)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		t.serveWebSocket(w, r, sub)
+		return
+	}
+
+	// The stream outlives the write timeout of the server.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-sub.events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			_ = rc.Flush()
+		}
+	}
+}
+
+var tapUpgrader = websocket.Upgrader{}
+
+func (t *Tap) serveWebSocket(w http.ResponseWriter, r *http.Request, sub *TapSubscription) {
+	conn, err := tapUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already replied to the client.
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Read the messages of the client to handle control messages and notice
+	// when it goes away.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-sub.events:
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// entryTrace records the changes made to a sampled entry by the stages of a
+// pipeline. It travels with the entry, so it is only used by one stage at a
+// time.
+type entryTrace struct {
+	tap       *Tap
+	stages    []Stage
+	redactors []*Redactor
+	roll      float64
+	event     TapEvent
+	done      bool
+
+	// next is the index of the stage processing the entry.
+	next int
+
+	// State of the entry after the last recorded step.
+	labels    model.LabelSet
+	extracted map[string]interface{}
+	timestamp time.Time
+	line      string
+}
+
+// step records the changes made to e by the stage st. Stages nested in
+// another stage of the pipeline aren't recorded, except for the last stage of
+// a nested pipeline, whose step is the step of the pipeline.
+func (t *entryTrace) step(st Stage, e Entry) {
+	index := -1
+	for i := t.next; i < len(t.stages); i++ {
+		if t.stages[i] == st {
+			index = i
+			break
+		}
+		if p, ok := t.stages[i].(*Pipeline); ok && len(p.stages) > 0 && p.stages[len(p.stages)-1] == st {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+
+	s := TapStep{Stage: t.stages[index].Name(), Index: index}
+
+	for k, v := range e.Labels {
+		if old, ok := t.labels[k]; !ok || old != v {
+			if s.LabelsAdded == nil {
+				s.LabelsAdded = model.LabelSet{}
+			}
+			s.LabelsAdded[k] = v
+		}
+	}
+	for k := range t.labels {
+		if _, ok := e.Labels[k]; !ok {
+			s.LabelsDropped = append(s.LabelsDropped, string(k))
+		}
+	}
+	sort.Strings(s.LabelsDropped)
+
+	for k, v := range e.Extracted {
+		if old, ok := t.extracted[k]; !ok || !reflect.DeepEqual(old, v) {
+			if s.Extracted == nil {
+				s.Extracted = map[string]interface{}{}
+			}
+			s.Extracted[k] = v
+		}
+	}
+	if !e.Timestamp.Equal(t.timestamp) {
+		ts := e.Timestamp
+		s.Timestamp = &ts
+	}
+	if e.Line != t.line {
+		line := e.Line
+		s.Line = &line
+	}
+	t.event.Steps = append(t.event.Steps, s)
+
+	t.labels = e.Labels.Clone()
+	t.extracted = copyExtracted(e.Extracted)
+	t.timestamp = e.Timestamp
+	t.line = e.Line
+	t.next = index + 1
+}
+
+// drop publishes the entry as dropped by the stage processing it.
+func (t *entryTrace) drop(reason string) {
+	if t.done {
+		return
+	}
+	t.event.Dropped = true
+	t.event.DropReason = reason
+	if t.next < len(t.stages) {
+		t.event.DropStage = t.stages[t.next].Name()
+	}
+	t.finish()
+}
+
+// finish publishes the entry once it went through the pipeline.
+func (t *entryTrace) finish() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.redact()
+	t.tap.publish(t.roll, t.event)
+}
+
+// redact runs the redactors over the recorded values which may hold secrets.
+func (t *entryTrace) redact() {
+	if len(t.redactors) == 0 {
+		return
+	}
+	redact := func(s string) string {
+		for _, r := range t.redactors {
+			s = r.redact(s, false)
+		}
+		return s
+	}
+	redactLabels := func(ls model.LabelSet) {
+		for k, v := range ls {
+			ls[k] = model.LabelValue(redact(string(v)))
+		}
+	}
+
+	t.event.Line = redact(t.event.Line)
+	redactLabels(t.event.Labels)
+	for i := range t.event.Steps {
+		s := &t.event.Steps[i]
+		if s.Line != nil {
+			line := redact(*s.Line)
+			s.Line = &line
+		}
+		redactLabels(s.LabelsAdded)
+		for k, v := range s.Extracted {
+			if str, ok := v.(string); ok {
+				s.Extracted[k] = redact(str)
+				continue
+			}
+			// Values parsed from JSON can hold secrets in nested fields.
+			// They're streamed as their redacted encoding if it differs.
+			if b, err := json.Marshal(v); err == nil {
+				if r := redact(string(b)); r != string(b) {
+					s.Extracted[k] = r
+				}
+			}
+		}
+	}
+}
+
+// traceRedactors returns the redactors of the redact stages in stages,
+// including the stages nested in other stages.
+func traceRedactors(stages []Stage) []*Redactor {
+	var redactors []*Redactor
+	for _, s := range stages {
+		switch s := s.(type) {
+		case *stageProcessor:
+			if rs, ok := s.Processor.(*redactStage); ok {
+				redactors = append(redactors, rs.redactor)
+			}
+		case *Pipeline:
+			redactors = append(redactors, traceRedactors(s.stages)...)
+		case *matcherStage:
+			if s.stage != nil {
+				redactors = append(redactors, traceRedactors([]Stage{s.stage})...)
+			}
+		}
+	}
+	return redactors
+}
+
+// traceStep records the changes made to the entry by the stage s, if it is
+// sampled by a Tap.
+func (entry Entry) traceStep(s Stage) {
+	if entry.trace != nil {
+		entry.trace.step(s, entry)
+	}
+}
+
+// traceDrop records that the entry is dropped for the given reason, if it is
+// sampled by a Tap.
+func (entry Entry) traceDrop(reason string) {
+	if entry.trace != nil {
+		entry.trace.drop(reason)
+	}
+}
+
+func copyExtracted(extracted map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(extracted))
+	for k, v := range extracted {
+		out[k] = v
+	}
+	return out
+}
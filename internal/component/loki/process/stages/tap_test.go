@@ -0,0 +1,259 @@
+package stages
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/gorilla/websocket"
+	"github.com/grafana/loki/pkg/logproto"
+	util_log "github.com/grafana/loki/pkg/util/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+var testTapRiver = `
+stage.regex {
+	expression = "^level=(?P<level>\\w+) msg=(?P<msg>.*)$"
+}
+stage.labels {
+	values = { level = "" }
+}
+stage.label_drop {
+	values = ["filename"]
+}
+stage.drop {
+	source      = "level"
+	value       = "debug"
+	drop_counter_reason = "debug_logs"
+}
+stage.output {
+	source = "msg"
+}
+`
+
+func newTestTapPipeline(t *testing.T, tap *Tap) *Pipeline {
+	t.Helper()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testTapRiver), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	pl.SetTap(tap)
+	return pl
+}
+
+func TestTap_Steps(t *testing.T) {
+	tap := NewTap()
+	sub := tap.Subscribe(1)
+	pl := newTestTapPipeline(t, tap)
+
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	out := processEntries(pl,
+		newEntry(nil, model.LabelSet{"filename": "/var/log/geth.log"}, "level=info msg=imported block", ts),
+		newEntry(nil, model.LabelSet{"filename": "/var/log/geth.log"}, "level=debug msg=peer connected", ts),
+		newEntry(nil, model.LabelSet{"filename": "/var/log/geth.log"}, "unstructured line", ts),
+	)
+	require.Len(t, out, 2)
+	for _, e := range out {
+		require.Nil(t, e.trace, "traces must not leave the pipeline")
+	}
+
+	// Entries dropped are published by the stage dropping them, so the order
+	// of the events isn't the order of the entries.
+	events := make(map[string]TapEvent)
+	for i := 0; i < 3; i++ {
+		ev := <-sub.Events()
+		events[ev.Line] = ev
+	}
+
+	dropped := events["level=debug msg=peer connected"]
+	require.True(t, dropped.Dropped)
+	require.Equal(t, StageTypeDrop, dropped.DropStage)
+	require.Equal(t, "debug_logs", dropped.DropReason)
+	require.Len(t, dropped.Steps, 3)
+
+	kept := events["level=info msg=imported block"]
+	require.False(t, kept.Dropped)
+	require.Equal(t, ts, kept.Timestamp)
+	require.Equal(t, model.LabelSet{"filename": "/var/log/geth.log"}, kept.Labels)
+	line := "imported block"
+	require.Equal(t, []TapStep{
+		{Stage: StageTypeRegex, Index: 0, Extracted: map[string]interface{}{"level": "info", "msg": "imported block"}},
+		{Stage: StageTypeLabel, Index: 1, LabelsAdded: model.LabelSet{"level": "info"}},
+		{Stage: StageTypeLabelDrop, Index: 2, LabelsDropped: []string{"filename"}},
+		{Stage: StageTypeDrop, Index: 3},
+		{Stage: StageTypeOutput, Index: 4, Line: &line},
+	}, kept.Steps)
+
+	// The regex stage doesn't extract anything from the unstructured line.
+	unmatched := events["unstructured line"]
+	require.Equal(t, TapStep{Stage: StageTypeRegex, Index: 0}, unmatched.Steps[0])
+}
+
+func TestTap_Sampling(t *testing.T) {
+	tap := NewTap()
+	pl := newTestTapPipeline(t, tap)
+
+	// Entries aren't traced without subscribers.
+	e := newEntry(nil, nil, "level=info msg=imported block", time.Now())
+	require.Nil(t, tap.trace(e, pl.stages, nil))
+
+	all, some := tap.Subscribe(1), tap.Subscribe(0.2)
+	entries := make([]Entry, 300)
+	for i := range entries {
+		entries[i] = newEntry(nil, nil, "level=info msg=imported block", time.Now())
+	}
+	// Send the entries in batches the subscribers can buffer.
+	for i := 0; i < len(entries); i += tapBufferSize {
+		processEntries(pl, entries[i:min(i+tapBufferSize, len(entries))]...)
+		for len(all.Events()) > 0 {
+			<-all.Events()
+		}
+	}
+
+	tap.Unsubscribe(all)
+	tap.Unsubscribe(some)
+	_, ok := <-all.Events()
+	require.False(t, ok, "unsubscribing must close the events")
+
+	var sampled int
+	for range some.Events() {
+		sampled++
+	}
+	require.Greater(t, sampled, 0)
+	require.Less(t, sampled, tapBufferSize)
+}
+
+func TestTap_Redact(t *testing.T) {
+	tap := NewTap()
+	sub := tap.Subscribe(1)
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.json {
+	expressions = { auth = "auth", user = "" }
+}
+stage.labels {
+	values = { auth = "" }
+}
+stage.redact {
+	detectors = ["bearer_token"]
+}
+`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	pl.SetTap(tap)
+
+	const secret = "abc123def456"
+	line := `{"auth":"Bearer ` + secret + `","user":{"auth":"Bearer ` + secret + `"}}`
+	out := processEntries(pl, newEntry(nil, nil, line, time.Now()))
+	require.Len(t, out, 1)
+
+	// The raw line, the extracted values and the labels made from them are
+	// all redacted, not only the line changed by the redact stage.
+	ev := <-sub.Events()
+	require.Len(t, ev.Steps, 3)
+	b, err := json.Marshal(ev)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), secret)
+	require.Contains(t, ev.Line, "Bearer **REDACTED**")
+}
+
+func TestTap_NestedPipeline(t *testing.T) {
+	tap := NewTap()
+	sub := tap.Subscribe(1)
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.docker {}
+stage.static_labels {
+	values = { env = "dev" }
+}
+`), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	pl.SetTap(tap)
+
+	processEntries(pl, newEntry(nil, nil, `{"log":"block imported\n","stream":"stderr","time":"2024-05-01T12:00:00Z"}`, time.Now()))
+
+	// The stages of the docker pipeline are recorded as a single step.
+	ev := <-sub.Events()
+	require.Len(t, ev.Steps, 2)
+	require.Equal(t, StageTypePipeline, ev.Steps[0].Stage)
+	require.Equal(t, model.LabelSet{"stream": "stderr"}, ev.Steps[0].LabelsAdded)
+	require.Equal(t, "block imported\n", *ev.Steps[0].Line)
+	require.Equal(t, model.LabelSet{"env": "dev"}, ev.Steps[1].LabelsAdded)
+}
+
+func TestTap_Record(t *testing.T) {
+	tap := NewTap()
+	tap.Record(loki.Entry{Entry: logproto.Entry{Line: "not sampled"}})
+
+	sub := tap.Subscribe(1)
+	tap.Record(loki.Entry{Labels: model.LabelSet{"job": "geth"}, Entry: logproto.Entry{Line: "imported block"}})
+	ev := <-sub.Events()
+	require.Equal(t, "imported block", ev.Line)
+	require.Equal(t, model.LabelSet{"job": "geth"}, ev.Labels)
+	require.Empty(t, ev.Steps)
+	require.Empty(t, sub.Events())
+}
+
+func TestTap_ServeHTTP(t *testing.T) {
+	tap := NewTap()
+	pl := newTestTapPipeline(t, tap)
+	srv := httptest.NewServer(tap)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?sample=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	waitForSubscribers(t, tap, 1)
+
+	processEntries(pl, newEntry(nil, nil, "level=debug msg=peer connected", time.Now()))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	var ev TapEvent
+	require.NoError(t, json.Unmarshal([]byte(line), &ev))
+	require.True(t, ev.Dropped)
+	require.Equal(t, "debug_logs", ev.DropReason)
+}
+
+func TestTap_ServeWebSocket(t *testing.T) {
+	tap := NewTap()
+	pl := newTestTapPipeline(t, tap)
+	srv := httptest.NewServer(tap)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?sample=1", nil)
+	require.NoError(t, err)
+	waitForSubscribers(t, tap, 1)
+
+	processEntries(pl, newEntry(nil, nil, "level=info msg=imported block", time.Now()))
+
+	var ev TapEvent
+	require.NoError(t, conn.ReadJSON(&ev))
+	require.Equal(t, "level=info msg=imported block", ev.Line)
+	require.Len(t, ev.Steps, 5)
+
+	// Closing the connection removes the subscriber.
+	require.NoError(t, conn.Close())
+	waitForSubscribers(t, tap, 0)
+}
+
+func TestTap_ServeHTTP_InvalidSample(t *testing.T) {
+	for _, sample := range []string{"0", "1.5", "all"} {
+		rec := httptest.NewRecorder()
+		NewTap().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?sample="+sample, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code, sample)
+	}
+}
+
+func waitForSubscribers(t *testing.T, tap *Tap, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		tap.mut.RLock()
+		defer tap.mut.RUnlock()
+		return len(tap.subs) == n
+	}, 5*time.Second, 10*time.Millisecond)
+}
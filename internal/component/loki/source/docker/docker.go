@@ -102,6 +102,10 @@ type Component struct {
 	opts    component.Options
 	metrics *dt.Metrics
 
+	// containerIDLabel is the label of the targets holding the ID of their
+	// container.
+	containerIDLabel string
+
 	mut           sync.RWMutex
 	args          Arguments
 	manager       *manager
@@ -115,8 +119,12 @@ type Component struct {
 	receivers    []loki.LogsReceiver
 }
 
-// New creates a new loki.source.file component.
+// New creates a new loki.source.docker component.
 func New(o component.Options, args Arguments) (*Component, error) {
+	return newComponent(o, args, dockerLabelContainerID)
+}
+
+func newComponent(o component.Options, args Arguments, containerIDLabel string) (*Component, error) {
 	err := os.MkdirAll(o.DataPath, 0750)
 	if err != nil && !os.IsExist(err) {
 		return nil, err
@@ -135,6 +143,8 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		opts:    o,
 		metrics: dt.NewMetrics(o.Registerer),
 
+		containerIDLabel: containerIDLabel,
+
 		handler:   loki.NewLogsReceiver(),
 		manager:   newManager(o.Logger, nil),
 		receivers: args.ForwardTo,
@@ -220,9 +230,9 @@ func (c *Component) Update(args component.Arguments) error {
 	seenTargets := make(map[string]struct{}, len(newArgs.Targets))
 
 	for _, target := range newArgs.Targets {
-		containerID, ok := target[dockerLabelContainerID]
+		containerID, ok := target[c.containerIDLabel]
 		if !ok {
-			level.Debug(c.opts.Logger).Log("msg", "docker target did not include container ID label:"+dockerLabelContainerID)
+			level.Debug(c.opts.Logger).Log("msg", "docker target did not include container ID label:"+c.containerIDLabel)
 			continue
 		}
 		if _, seen := seenTargets[containerID]; seen {
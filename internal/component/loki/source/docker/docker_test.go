@@ -73,3 +73,31 @@ func TestDuplicateTargets(t *testing.T) {
 
 	require.Len(t, cmp.manager.tasks, 1)
 }
+
+func TestPodmanTargets(t *testing.T) {
+	var cfg = `
+		host       = "tcp://127.0.0.1:9377"
+		targets    = [
+			{__meta_podman_container_id = "foo", __meta_podman_container_name = "geth"},
+			{__meta_docker_container_id = "bar"},
+		]
+		forward_to = []
+	`
+
+	var args Arguments
+	err := river.Unmarshal([]byte(cfg), &args)
+	require.NoError(t, err)
+
+	cmp, err := NewPodman(component.Options{
+		ID:         "loki.source.podman.test",
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		DataPath:   t.TempDir(),
+	}, args)
+	require.NoError(t, err)
+
+	require.Len(t, cmp.manager.tasks, 1)
+	for _, task := range cmp.manager.tasks {
+		require.Equal(t, "foo", task.target.Name())
+	}
+}
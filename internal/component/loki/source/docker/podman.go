@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	"github.com/prometheus/common/model"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "loki.source.podman",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return NewPodman(opts, args.(Arguments))
+		},
+	})
+}
+
+// podmanLabelContainerID is the label of the targets of discovery.podman
+// holding the ID of their container.
+const podmanLabelContainerID = model.MetaLabelPrefix + "podman_container_id"
+
+// NewPodman creates a new loki.source.podman component, reading the logs of
+// the containers discovered by discovery.podman through the Docker compatible
+// API of the Podman service at the host of args, e.g.,
+// unix:///run/podman/podman.sock.
+func NewPodman(o component.Options, args Arguments) (*Component, error) {
+	return newComponent(o, args, podmanLabelContainerID)
+}
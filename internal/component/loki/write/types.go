@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki/client"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki/utils"
 
 	"github.com/alecthomas/units"
@@ -86,6 +87,50 @@ func (q *QueueConfig) SetToDefault() {
 	}
 }
 
+// SourceLimitsArguments limits the bytes of the lines sent per stream, and
+// per group of streams with the same values of the group_by labels.
+type SourceLimitsArguments struct {
+	StreamRate     units.Base2Bytes `river:"stream_rate,attr,optional"`
+	StreamBurst    units.Base2Bytes `river:"stream_burst,attr,optional"`
+	GroupBy        []string         `river:"group_by,attr,optional"`
+	GroupRate      units.Base2Bytes `river:"group_rate,attr,optional"`
+	GroupBurst     units.Base2Bytes `river:"group_burst,attr,optional"`
+	Policy         string           `river:"policy,attr,optional"`
+	MaxParkedBytes units.Base2Bytes `river:"max_parked_bytes,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (s *SourceLimitsArguments) SetToDefault() {
+	*s = SourceLimitsArguments{
+		Policy:         limit.DefaultSourceConfig.Policy,
+		MaxParkedBytes: units.Base2Bytes(limit.DefaultSourceConfig.MaxParkedBytes),
+	}
+}
+
+// Validate implements river.Validator.
+func (s *SourceLimitsArguments) Validate() error {
+	if s.StreamRate < 0 || s.StreamBurst < 0 || s.GroupRate < 0 || s.GroupBurst < 0 || s.MaxParkedBytes < 0 {
+		return fmt.Errorf("source limits must not be negative")
+	}
+	cfg := s.convert()
+	return cfg.Validate()
+}
+
+func (s *SourceLimitsArguments) convert() limit.SourceConfig {
+	if s == nil {
+		return limit.SourceConfig{}
+	}
+	return limit.SourceConfig{
+		StreamRate:     lokiflagext.ByteSize(s.StreamRate),
+		StreamBurst:    lokiflagext.ByteSize(s.StreamBurst),
+		GroupBy:        s.GroupBy,
+		GroupRate:      lokiflagext.ByteSize(s.GroupRate),
+		GroupBurst:     lokiflagext.ByteSize(s.GroupBurst),
+		Policy:         s.Policy,
+		MaxParkedBytes: lokiflagext.ByteSize(s.MaxParkedBytes),
+	}
+}
+
 func (args Arguments) convertClientConfigs() []client.Config {
 	var res []client.Config
 	for _, cfg := range args.Endpoints {
@@ -31,10 +31,11 @@ func init() {
 
 // Arguments holds values which are used to configure the loki.write component.
 type Arguments struct {
-	Endpoints      []EndpointOptions `river:"endpoint,block,optional"`
-	ExternalLabels map[string]string `river:"external_labels,attr,optional"`
-	MaxStreams     int               `river:"max_streams,attr,optional"`
-	WAL            WalArguments      `river:"wal,block,optional"`
+	Endpoints      []EndpointOptions      `river:"endpoint,block,optional"`
+	ExternalLabels map[string]string      `river:"external_labels,attr,optional"`
+	MaxStreams     int                    `river:"max_streams,attr,optional"`
+	WAL            WalArguments           `river:"wal,block,optional"`
+	SourceLimits   *SourceLimitsArguments `river:"source_limits,block,optional"`
 }
 
 // WalArguments holds the settings for configuring the Write-Ahead Log (WAL) used
@@ -92,6 +93,9 @@ type Component struct {
 	// sink is the place where log entries received by this component should be written to. If WAL
 	// is enabled, this will be the WAL Writer, otherwise, the client manager
 	sink loki.EntryHandler
+	// limitedWriter passes entries through the source limits to the WAL Writer, if both are enabled.
+	// The client manager applies the source limits itself when the WAL is disabled.
+	limitedWriter loki.EntryHandler
 }
 
 // New creates a new loki.write component.
@@ -119,6 +123,9 @@ func (c *Component) Run(ctx context.Context) error {
 	defer func() {
 		// when exiting Run, proceed to shut down first the writer component, and then
 		// the client manager, with the WAL and remote-write client inside
+		if c.limitedWriter != nil {
+			c.limitedWriter.Stop()
+		}
 		if c.walWriter != nil {
 			c.walWriter.Stop()
 		}
@@ -153,6 +160,9 @@ func (c *Component) Update(args component.Arguments) error {
 	defer c.mut.Unlock()
 	c.args = newArgs
 
+	if c.limitedWriter != nil {
+		c.limitedWriter.Stop()
+	}
 	if c.walWriter != nil {
 		c.walWriter.Stop()
 	}
@@ -199,14 +209,23 @@ func (c *Component) Update(args component.Arguments) error {
 
 	c.clientManger, err = client.NewManager(c.metrics, c.opts.Logger, limit.Config{
 		MaxStreams: newArgs.MaxStreams,
+		Sources:    newArgs.SourceLimits.convert(),
 	}, c.opts.Registerer, walCfg, notifier, cfgs...)
 	if err != nil {
 		return fmt.Errorf("failed to create client manager: %w", err)
 	}
 
 	// if WAL is enabled, the WAL writer should be the destination sink. Otherwise, the client manager
+	// nil-out the limited writer in case WAL or source limits were disabled
+	c.limitedWriter = nil
 	if walCfg.Enabled {
+		c.walWriter.SetMarker(c.clientManger)
 		c.sink = c.walWriter
+		if sources := newArgs.SourceLimits.convert(); sources.Enabled() {
+			limiter := client.NewSourceLimiter(sources, c.opts.Logger, client.NewSourceLimiterMetrics(c.opts.Registerer))
+			c.limitedWriter = limiter.Wrap(c.walWriter)
+			c.sink = c.limitedWriter
+		}
 	} else {
 		c.sink = c.clientManger
 	}
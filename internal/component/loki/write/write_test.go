@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
 	"github.com/blockopsnetwork/telescope/internal/component/common/loki/wal"
 	"github.com/blockopsnetwork/telescope/internal/component/discovery"
 	lsf "github.com/blockopsnetwork/telescope/internal/component/loki/source/file"
@@ -123,6 +124,38 @@ func TestUnmarshallWalAttrributes(t *testing.T) {
 	}
 }
 
+func TestUnmarshallSourceLimits(t *testing.T) {
+	var exampleRiverConfig = `
+	endpoint {
+		url = "http://0.0.0.0:11111/loki/api/v1/push"
+	}
+	source_limits {
+		stream_rate = "64KiB"
+		group_by    = ["container"]
+		group_rate  = "1MiB"
+		policy      = "park"
+	}
+`
+
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(exampleRiverConfig), &args))
+	require.Equal(t, limit.SourceConfig{
+		StreamRate:     64 << 10,
+		GroupBy:        []string{"container"},
+		GroupRate:      1 << 20,
+		Policy:         limit.SourcePolicyPark,
+		MaxParkedBytes: limit.DefaultSourceConfig.MaxParkedBytes,
+	}, args.SourceLimits.convert())
+
+	err := river.Unmarshal([]byte(`
+	source_limits {
+		stream_rate = "64KiB"
+		policy      = "queue"
+	}
+`), &args)
+	require.ErrorContains(t, err, `unsupported source limits policy "queue"`)
+}
+
 func TestWriteToSingleEndpoint(t *testing.T) {
 	t.Run("wal disabled", func(t *testing.T) {
 		testSingleEndpoint(t, func(args *Arguments) {})
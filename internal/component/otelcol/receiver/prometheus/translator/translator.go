@@ -0,0 +1,63 @@
+// Package translator exposes the translation of scraped Prometheus samples
+// into OpenTelemetry metrics made by otelcol.receiver.prometheus, so that it
+// can be used outside of Flow components.
+package translator
+
+import (
+	"context"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component/otelcol/receiver/prometheus/internal"
+	flowprometheus "github.com/blockopsnetwork/telescope/internal/component/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/prometheus/prometheus/storage"
+	"go.opentelemetry.io/collector/consumer"
+	otelreceiver "go.opentelemetry.io/collector/receiver"
+)
+
+// gcInterval is how long series are kept to compute the start time of
+// cumulative metrics after they were last scraped. It should be longer than
+// the longest scrape interval.
+const gcInterval = 5 * time.Minute
+
+// NewAppendable returns a storage.Appendable converting the samples appended
+// by a scrape loop into OpenTelemetry metrics sent to sink, with the same
+// settings as otelcol.receiver.prometheus. externalLabels are added to every
+// data point.
+//
+// The types of the metrics are taken from the metadata of the scrape target
+// in the context passed to Appender, which Prometheus scrape loops set with
+// scrape.Options.PassMetadataInContext. Without it, metrics are untyped and
+// their resource is only built from the job and instance labels.
+func NewAppendable(sink consumer.Metrics, set otelreceiver.CreateSettings, externalLabels labels.Labels) (storage.Appendable, error) {
+	app, err := internal.NewAppendable(
+		sink,
+		set,
+		gcInterval,
+		false, // useStartTimeMetric
+		nil,   // startTimeMetricRegex
+		false, // useCreatedMetric
+		externalLabels,
+		false, // trimSuffixes
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &appendable{next: app}, nil
+}
+
+type appendable struct {
+	next storage.Appendable
+}
+
+// Appender implements storage.Appendable.
+func (a *appendable) Appender(ctx context.Context) storage.Appender {
+	if _, ok := scrape.TargetFromContext(ctx); !ok {
+		ctx = scrape.ContextWithTarget(ctx, &scrape.Target{})
+	}
+	if _, ok := scrape.MetricMetadataStoreFromContext(ctx); !ok {
+		ctx = scrape.ContextWithMetricMetadataStore(ctx, flowprometheus.NoopMetadataStore{})
+	}
+	return a.next.Appender(ctx)
+}
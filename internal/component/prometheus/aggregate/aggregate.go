@@ -0,0 +1,130 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/prometheus"
+	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	"github.com/blockopsnetwork/telescope/internal/service/labelstore"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/aggregate"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "prometheus.aggregate",
+		Stability: featuregate.StabilityExperimental,
+		Args:      Arguments{},
+		Exports:   Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// prometheus.aggregate component.
+type Arguments struct {
+	// Where the metrics and their aggregates should be forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	// The rollups to compute.
+	Rules []Rule `river:"rule,block,optional"`
+}
+
+// Rule configures the rollups of the series matching a selector.
+type Rule struct {
+	Match        string          `river:"match,attr"`
+	By           []string        `river:"by,attr,optional"`
+	Without      []string        `river:"without,attr,optional"`
+	Intervals    []time.Duration `river:"intervals,attr"`
+	Aggregations []string        `river:"aggregations,attr,optional"`
+	Quantiles    []float64       `river:"quantiles,attr,optional"`
+	DropRaw      bool            `river:"drop_raw,attr,optional"`
+}
+
+func (r Rule) convert() aggregate.Rule {
+	return aggregate.Rule{
+		Match:        r.Match,
+		By:           r.By,
+		Without:      r.Without,
+		Intervals:    r.Intervals,
+		Aggregations: r.Aggregations,
+		Quantiles:    r.Quantiles,
+		DropRaw:      r.DropRaw,
+	}
+}
+
+func (args Arguments) rules() []aggregate.Rule {
+	res := make([]aggregate.Rule, 0, len(args.Rules))
+	for _, r := range args.Rules {
+		res = append(res, r.convert())
+	}
+	return res
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	for i, r := range args.Rules {
+		rule := r.convert()
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the prometheus.aggregate
+// component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.aggregate component.
+type Component struct {
+	opts       component.Options
+	fanout     *prometheus.Fanout
+	aggregator *aggregate.Aggregator
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+)
+
+// New creates a new prometheus.aggregate component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{opts: o}
+	c.fanout = prometheus.NewFanout(args.ForwardTo, o.ID, o.Registerer, data.(labelstore.LabelStore))
+	c.aggregator = aggregate.New(o.Logger, o.Registerer, c.fanout)
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.aggregator})
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	c.aggregator.Run(ctx)
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+	return c.aggregator.ApplyRules(newArgs.rules())
+}
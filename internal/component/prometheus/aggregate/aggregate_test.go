@@ -0,0 +1,106 @@
+package aggregate
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/prometheus"
+	"github.com/blockopsnetwork/telescope/internal/service/labelstore"
+	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArguments_UnmarshalRiver(t *testing.T) {
+	cfg := `
+forward_to = []
+
+rule {
+	match        = "{__name__=~\"p2p_peer_.*\"}"
+	by           = ["job"]
+	intervals    = ["1m", "5m"]
+	aggregations = ["sum", "max"]
+	quantiles    = [0.99]
+	drop_raw     = true
+}
+`
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+	require.Len(t, args.Rules, 1)
+	require.Equal(t, []time.Duration{time.Minute, 5 * time.Minute}, args.Rules[0].Intervals)
+	require.True(t, args.Rules[0].DropRaw)
+
+	invalid := `
+forward_to = []
+
+rule {
+	match        = "{__name__=\"up\"}"
+	intervals    = ["1m"]
+	aggregations = ["stddev"]
+}
+`
+	require.ErrorContains(t, river.Unmarshal([]byte(invalid), &args), `invalid rule 0: unsupported aggregation "stddev"`)
+}
+
+func TestComponent(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		received = map[string]float64{}
+	)
+	ls := labelstore.New(nil, prom.NewRegistry())
+	sink := prometheus.NewInterceptor(nil, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		received[l.String()] = v
+		return ref, nil
+	}))
+
+	c, err := New(component.Options{
+		ID:            "prometheus.aggregate.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, Arguments{
+		ForwardTo: []storage.Appendable{sink},
+		Rules: []Rule{{
+			Match:        `{__name__="peers"}`,
+			Intervals:    []time.Duration{time.Second},
+			Aggregations: []string{"sum"},
+			DropRaw:      true,
+		}},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	app := c.aggregator.Appender(context.Background())
+	for i, peer := range []string{"a", "b"} {
+		_, err := app.Append(0, labels.FromStrings("__name__", "peers", "peer", peer), time.Now().UnixMilli(), float64(i+1))
+		require.NoError(t, err)
+	}
+	_, err = app.Append(0, labels.FromStrings("__name__", "up"), time.Now().UnixMilli(), 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	require.Eventually(t, func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return received[`{__name__="peers:sum_1s"}`] == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mut.Lock()
+	defer mut.Unlock()
+	require.Contains(t, received, `{__name__="up"}`)
+	require.NotContains(t, received, `{__name__="peers", peer="a"}`)
+}
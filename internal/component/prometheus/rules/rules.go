@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/prometheus"
+	"github.com/blockopsnetwork/telescope/internal/featuregate"
+	"github.com/blockopsnetwork/telescope/internal/service/labelstore"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/localstore"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/ruler"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "prometheus.rules",
+		Stability: featuregate.StabilityExperimental,
+		Args:      Arguments{},
+		Exports:   Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the prometheus.rules
+// component.
+type Arguments struct {
+	// Where received metrics and recorded series should be forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	RuleFiles          []string          `river:"rule_files,attr,optional"`
+	Rules              string            `river:"rules,attr,optional"`
+	EvaluationInterval time.Duration     `river:"evaluation_interval,attr,optional"`
+	AlertmanagerURLs   []string          `river:"alertmanager_urls,attr,optional"`
+	WebhookURLs        []string          `river:"webhook_urls,attr,optional"`
+	ExternalLabels     map[string]string `river:"external_labels,attr,optional"`
+
+	// How long received samples are kept to evaluate rules against.
+	Retention time.Duration `river:"retention,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = Arguments{
+		EvaluationInterval: ruler.DefaultConfig.EvaluationInterval,
+		Retention:          localstore.DefaultConfig.Retention,
+	}
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.Retention <= 0 {
+		return fmt.Errorf("retention must be greater than 0s")
+	}
+	cfg := args.rulerConfig()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if args.Rules != "" {
+		if _, errs := rulefmt.Parse([]byte(args.Rules)); len(errs) > 0 {
+			return fmt.Errorf("invalid rules: %w", errors.Join(errs...))
+		}
+	}
+	return nil
+}
+
+func (args Arguments) rulerConfig() ruler.Config {
+	return ruler.Config{
+		RuleFiles:          args.RuleFiles,
+		EvaluationInterval: args.EvaluationInterval,
+		AlertmanagerURLs:   args.AlertmanagerURLs,
+		WebhookURLs:        args.WebhookURLs,
+	}
+}
+
+// Exports holds values which are exported by the prometheus.rules component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.rules component.
+type Component struct {
+	opts   component.Options
+	fanout *prometheus.Fanout
+	store  *localstore.Store
+	ruler  *ruler.Ruler
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+)
+
+// New creates a new prometheus.rules component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := localstore.New(o.Logger, o.Registerer, filepath.Join(o.DataPath, "local-store"), localstore.Config{Retention: args.Retention})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:  o,
+		store: store,
+	}
+	c.fanout = prometheus.NewFanout(nil, o.ID, o.Registerer, data.(labelstore.LabelStore))
+	// Recorded series are forwarded and stored like received samples, so
+	// rules can use the output of other rules.
+	c.ruler = ruler.New(o.Logger, o.Registerer, store, c.fanout)
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.fanout})
+
+	if err := c.Update(args); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer c.store.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.store.Run(ctx)
+	}()
+	c.ruler.Run(ctx)
+	wg.Wait()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	children := make([]storage.Appendable, 0, len(newArgs.ForwardTo)+1)
+	children = append(children, newArgs.ForwardTo...)
+	c.fanout.UpdateChildren(append(children, c.store))
+	c.store.ApplyConfig(localstore.Config{Retention: newArgs.Retention})
+
+	return c.ruler.ApplyConfig(newArgs.rulerConfig(), newArgs.Rules, labels.FromMap(newArgs.ExternalLabels))
+}
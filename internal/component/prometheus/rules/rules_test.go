@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/component"
+	"github.com/blockopsnetwork/telescope/internal/component/prometheus"
+	"github.com/blockopsnetwork/telescope/internal/service/labelstore"
+	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArguments_UnmarshalRiver(t *testing.T) {
+	cfg := `
+forward_to        = []
+rule_files        = ["/etc/telescope/rules/*.yml"]
+alertmanager_urls = ["http://alertmanager:9093"]
+external_labels   = { network = "mainnet" }
+`
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+	require.Equal(t, time.Minute, args.EvaluationInterval)
+	require.Equal(t, 2*time.Hour, args.Retention)
+	require.Equal(t, map[string]string{"network": "mainnet"}, args.ExternalLabels)
+
+	invalid := `
+forward_to = []
+rules      = "groups: [{name: test, rules: [{record: 'bad name', expr: up}]}]"
+`
+	require.ErrorContains(t, river.Unmarshal([]byte(invalid), &args), "invalid rules")
+
+	invalid = `
+forward_to   = []
+webhook_urls = ["ftp://example.com"]
+`
+	require.ErrorContains(t, river.Unmarshal([]byte(invalid), &args), "scheme must be http or https")
+}
+
+func TestComponent(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		received = map[string]float64{}
+	)
+	ls := labelstore.New(nil, prom.NewRegistry())
+	sink := prometheus.NewInterceptor(nil, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		received[l.String()] = v
+		return ref, nil
+	}))
+
+	var args Arguments
+	args.SetToDefault()
+	args.ForwardTo = []storage.Appendable{sink}
+	args.EvaluationInterval = 100 * time.Millisecond
+	args.Rules = `
+groups:
+- name: peers
+  rules:
+  - record: job:peers:sum
+    expr: sum by (job) (peers)
+`
+
+	c, err := New(component.Options{
+		ID:            "prometheus.rules.test",
+		Logger:        util.TestFlowLogger(t),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	app := c.fanout.Appender(context.Background())
+	for i, peer := range []string{"a", "b"} {
+		_, err := app.Append(0, labels.FromStrings("__name__", "peers", "job", "geth", "peer", peer), time.Now().UnixMilli(), float64(i+1))
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	require.Eventually(t, func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return received[`{__name__="job:peers:sum", job="geth"}`] == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Received samples are forwarded too.
+	mut.Lock()
+	defer mut.Unlock()
+	require.Contains(t, received, `{__name__="peers", job="geth", peer="a"}`)
+}
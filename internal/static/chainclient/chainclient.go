@@ -0,0 +1,299 @@
+// Package chainclient implements lightweight probes against the APIs exposed
+// by blockchain clients. It is used for diagnostics and preflight checks and
+// deliberately avoids pulling in full client libraries.
+package chainclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Roles of the chain clients which can be probed.
+const (
+	RoleExecution = "execution"
+	RoleConsensus = "consensus"
+	RoleSubstrate = "substrate"
+)
+
+// Snapshot is a point-in-time view of a chain client.
+type Snapshot struct {
+	Role          string   `yaml:"role" json:"role"`
+	URL           string   `yaml:"url" json:"url"`
+	ClientVersion string   `yaml:"client_version,omitempty" json:"client_version,omitempty"`
+	ChainID       string   `yaml:"chain_id,omitempty" json:"chain_id,omitempty"`
+	Syncing       bool     `yaml:"syncing" json:"syncing"`
+	SyncDistance  uint64   `yaml:"sync_distance,omitempty" json:"sync_distance,omitempty"`
+	PeerCount     uint64   `yaml:"peer_count" json:"peer_count"`
+	HeadBlock     uint64   `yaml:"head_block" json:"head_block"`
+	Errors        []string `yaml:"errors,omitempty" json:"errors,omitempty"`
+}
+
+// TakeSnapshot queries the client at rawURL according to its role. Failing
+// queries are recorded in the Errors field of the returned Snapshot rather
+// than aborting the whole snapshot.
+func TakeSnapshot(ctx context.Context, cli *http.Client, role, rawURL string) Snapshot {
+	switch role {
+	case RoleExecution:
+		return ExecutionSnapshot(ctx, cli, rawURL)
+	case RoleConsensus:
+		return ConsensusSnapshot(ctx, cli, rawURL)
+	case RoleSubstrate:
+		return SubstrateSnapshot(ctx, cli, rawURL)
+	default:
+		return Snapshot{
+			Role:   role,
+			URL:    RedactURL(rawURL),
+			Errors: []string{fmt.Sprintf("unsupported role %q", role)},
+		}
+	}
+}
+
+// ExecutionSnapshot queries an execution client over JSON-RPC.
+func ExecutionSnapshot(ctx context.Context, cli *http.Client, rawURL string) Snapshot {
+	s := Snapshot{Role: RoleExecution, URL: RedactURL(rawURL)}
+	addErr := func(method string, err error) {
+		s.Errors = append(s.Errors, fmt.Sprintf("%s: %s", method, err))
+	}
+
+	var version string
+	if err := CallJSONRPC(ctx, cli, rawURL, "web3_clientVersion", &version); err != nil {
+		addErr("web3_clientVersion", err)
+	}
+	s.ClientVersion = version
+
+	if id, err := ExecutionChainID(ctx, cli, rawURL); err != nil {
+		addErr("eth_chainId", err)
+	} else {
+		s.ChainID = strconv.FormatUint(id, 10)
+	}
+
+	var syncing json.RawMessage
+	if err := CallJSONRPC(ctx, cli, rawURL, "eth_syncing", &syncing); err != nil {
+		addErr("eth_syncing", err)
+	} else if !bytes.Equal(bytes.TrimSpace(syncing), []byte("false")) {
+		var progress struct {
+			CurrentBlock hexUint64 `json:"currentBlock"`
+			HighestBlock hexUint64 `json:"highestBlock"`
+		}
+		if err := json.Unmarshal(syncing, &progress); err != nil {
+			addErr("eth_syncing", err)
+		} else {
+			s.Syncing = true
+			if progress.HighestBlock > progress.CurrentBlock {
+				s.SyncDistance = uint64(progress.HighestBlock - progress.CurrentBlock)
+			}
+		}
+	}
+
+	var peers hexUint64
+	if err := CallJSONRPC(ctx, cli, rawURL, "net_peerCount", &peers); err != nil {
+		addErr("net_peerCount", err)
+	}
+	s.PeerCount = uint64(peers)
+
+	var head hexUint64
+	if err := CallJSONRPC(ctx, cli, rawURL, "eth_blockNumber", &head); err != nil {
+		addErr("eth_blockNumber", err)
+	}
+	s.HeadBlock = uint64(head)
+
+	return s
+}
+
+// ConsensusSnapshot queries a consensus client over the standard beacon node
+// API. HeadBlock is reported as the head slot.
+func ConsensusSnapshot(ctx context.Context, cli *http.Client, rawURL string) Snapshot {
+	s := Snapshot{Role: RoleConsensus, URL: RedactURL(rawURL)}
+	addErr := func(path string, err error) {
+		s.Errors = append(s.Errors, fmt.Sprintf("%s: %s", path, err))
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := GetBeacon(ctx, cli, rawURL, "/eth/v1/node/version", &version); err != nil {
+		addErr("/eth/v1/node/version", err)
+	}
+	s.ClientVersion = version.Version
+
+	if id, err := ConsensusChainID(ctx, cli, rawURL); err != nil {
+		addErr("/eth/v1/config/deposit_contract", err)
+	} else {
+		s.ChainID = strconv.FormatUint(id, 10)
+	}
+
+	var syncing struct {
+		HeadSlot     decUint64 `json:"head_slot"`
+		SyncDistance decUint64 `json:"sync_distance"`
+		IsSyncing    bool      `json:"is_syncing"`
+	}
+	if err := GetBeacon(ctx, cli, rawURL, "/eth/v1/node/syncing", &syncing); err != nil {
+		addErr("/eth/v1/node/syncing", err)
+	}
+	s.Syncing = syncing.IsSyncing
+	s.SyncDistance = uint64(syncing.SyncDistance)
+	s.HeadBlock = uint64(syncing.HeadSlot)
+
+	var peers struct {
+		Connected decUint64 `json:"connected"`
+	}
+	if err := GetBeacon(ctx, cli, rawURL, "/eth/v1/node/peer_count", &peers); err != nil {
+		addErr("/eth/v1/node/peer_count", err)
+	}
+	s.PeerCount = uint64(peers.Connected)
+
+	return s
+}
+
+// ExecutionChainID returns the chain ID reported by an execution client.
+func ExecutionChainID(ctx context.Context, cli *http.Client, rawURL string) (uint64, error) {
+	var id hexUint64
+	if err := CallJSONRPC(ctx, cli, rawURL, "eth_chainId", &id); err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+// ConsensusChainID returns the execution chain ID that a consensus client's
+// deposit contract is deployed to.
+func ConsensusChainID(ctx context.Context, cli *http.Client, rawURL string) (uint64, error) {
+	var deposit struct {
+		ChainID decUint64 `json:"chain_id"`
+	}
+	if err := GetBeacon(ctx, cli, rawURL, "/eth/v1/config/deposit_contract", &deposit); err != nil {
+		return 0, err
+	}
+	return uint64(deposit.ChainID), nil
+}
+
+// CallJSONRPC performs a single JSON-RPC 2.0 call against rawURL and decodes
+// the result into out.
+func CallJSONRPC(ctx context.Context, cli *http.Client, rawURL, method string, out interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := do(cli, req, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", resp.Error.Code, resp.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, out)
+}
+
+// GetBeacon performs a GET request against a beacon node API path and decodes
+// the "data" field of the response into out.
+func GetBeacon(ctx context.Context, cli *http.Client, rawURL, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(rawURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := do(cli, req, &resp); err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+func do(cli *http.Client, req *http.Request, out interface{}) error {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// RedactURL removes credentials from a URL so that it can be safely included
+// in diagnostics output. User info and query values are masked.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q.Set(k, "redacted")
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// hexUint64 decodes a 0x-prefixed hex quantity as used by JSON-RPC.
+type hexUint64 uint64
+
+func (h *hexUint64) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hex quantity %q: %w", s, err)
+	}
+	*h = hexUint64(v)
+	return nil
+}
+
+// decUint64 decodes a decimal integer that the beacon API encodes as a string.
+type decUint64 uint64
+
+func (d *decUint64) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q: %w", s, err)
+	}
+	*d = decUint64(v)
+	return nil
+}
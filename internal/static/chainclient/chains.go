@@ -0,0 +1,78 @@
+package chainclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ethereumChains maps the names of well-known Ethereum chains to their chain
+// IDs.
+var ethereumChains = map[string]uint64{
+	"mainnet": 1,
+	"sepolia": 11155111,
+	"holesky": 17000,
+	"hoodi":   560048,
+	"gnosis":  100,
+	"chiado":  10200,
+}
+
+// EthereumChainID returns the chain ID of the named Ethereum chain. name may
+// also be a decimal chain ID. ok is false if name is not a known chain.
+func EthereumChainID(name string) (id uint64, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if id, ok := ethereumChains[name]; ok {
+		return id, true
+	}
+	if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return id, true
+	}
+	return 0, false
+}
+
+// EthereumChains returns the sorted names of the well-known Ethereum chains.
+func EthereumChains() []string {
+	names := make([]string, 0, len(ethereumChains))
+	for name := range ethereumChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EthereumChainName returns the name of the Ethereum chain with the given
+// chain ID. Unknown chains are named after their chain ID.
+func EthereumChainName(id uint64) string {
+	for name, chainID := range ethereumChains {
+		if chainID == id {
+			return name
+		}
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// ExecutionGenesisHash returns the hash of the genesis block known to an
+// execution client.
+func ExecutionGenesisHash(ctx context.Context, cli *http.Client, rawURL string) (string, error) {
+	var block struct {
+		Hash string `json:"hash"`
+	}
+	if err := CallJSONRPC(ctx, cli, rawURL, "eth_getBlockByNumber", &block, "0x0", false); err != nil {
+		return "", err
+	}
+	return block.Hash, nil
+}
+
+// ConsensusGenesisRoot returns the genesis validators root known to a
+// consensus client.
+func ConsensusGenesisRoot(ctx context.Context, cli *http.Client, rawURL string) (string, error) {
+	var genesis struct {
+		GenesisValidatorsRoot string `json:"genesis_validators_root"`
+	}
+	if err := GetBeacon(ctx, cli, rawURL, "/eth/v1/beacon/genesis", &genesis); err != nil {
+		return "", err
+	}
+	return genesis.GenesisValidatorsRoot, nil
+}
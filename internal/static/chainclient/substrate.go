@@ -0,0 +1,63 @@
+package chainclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// SubstrateSnapshot queries a Substrate-based node, such as a Polkadot relay
+// chain or parachain node, over JSON-RPC. ChainID is reported as the chain
+// name returned by system_chain.
+func SubstrateSnapshot(ctx context.Context, cli *http.Client, rawURL string) Snapshot {
+	s := Snapshot{Role: RoleSubstrate, URL: RedactURL(rawURL)}
+	addErr := func(method string, err error) {
+		s.Errors = append(s.Errors, fmt.Sprintf("%s: %s", method, err))
+	}
+
+	var version string
+	if err := CallJSONRPC(ctx, cli, rawURL, "system_version", &version); err != nil {
+		addErr("system_version", err)
+	}
+	s.ClientVersion = version
+
+	if chain, err := SubstrateChain(ctx, cli, rawURL); err != nil {
+		addErr("system_chain", err)
+	} else {
+		s.ChainID = chain
+	}
+
+	var health struct {
+		Peers     uint64 `json:"peers"`
+		IsSyncing bool   `json:"isSyncing"`
+	}
+	if err := CallJSONRPC(ctx, cli, rawURL, "system_health", &health); err != nil {
+		addErr("system_health", err)
+	}
+	s.Syncing = health.IsSyncing
+	s.PeerCount = health.Peers
+
+	var state struct {
+		CurrentBlock uint64 `json:"currentBlock"`
+		HighestBlock uint64 `json:"highestBlock"`
+	}
+	if err := CallJSONRPC(ctx, cli, rawURL, "system_syncState", &state); err != nil {
+		addErr("system_syncState", err)
+	}
+	s.HeadBlock = state.CurrentBlock
+	if state.HighestBlock > state.CurrentBlock {
+		s.SyncDistance = state.HighestBlock - state.CurrentBlock
+	}
+
+	return s
+}
+
+// SubstrateChain returns the name of the chain a Substrate-based node is
+// running, e.g., "Polkadot".
+func SubstrateChain(ctx context.Context, cli *http.Client, rawURL string) (string, error) {
+	var chain string
+	if err := CallJSONRPC(ctx, cli, rawURL, "system_chain", &chain); err != nil {
+		return "", err
+	}
+	return chain, nil
+}
@@ -0,0 +1,131 @@
+// Package chainmetrics collects latency histograms of blockchain clients with
+// exemplars linking observations to the blocks and RPC calls behind them.
+//
+// Exemplars carry the block hash and number, or the slot and block root, so
+// dashboards can jump from a latency spike to the block in an explorer. Each
+// RPC call is sent with a W3C traceparent header, and its trace ID is attached
+// to the observed request duration, so it can be linked to the trace recorded
+// by the client if it supports tracing.
+package chainmetrics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// arrivalBuckets cover delays from a fraction of a second up to two slots.
+	arrivalBuckets = []float64{0.25, 0.5, 1, 2, 3, 4, 6, 8, 12, 24}
+	// requestBuckets cover the durations of RPC calls.
+	requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+type traceIDKey struct{}
+
+// newTraceID returns a random W3C trace ID.
+func newTraceID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withTraceID returns a context whose requests are sent as part of the trace
+// with the given ID.
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// tracingTransport sets the traceparent header of requests whose context
+// carries a trace ID.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	traceID, ok := req.Context().Value(traceIDKey{}).(string)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	var spanID [8]byte
+	_, _ = rand.Read(spanID[:])
+
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", "00-"+traceID+"-"+hex.EncodeToString(spanID[:])+"-01")
+	return t.next.RoundTrip(req)
+}
+
+// newClient returns an HTTP client which propagates trace IDs.
+func newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &tracingTransport{next: http.DefaultTransport},
+	}
+}
+
+// requestMetrics tracks the duration of requests to a client.
+type requestMetrics struct {
+	duration *prometheus.HistogramVec
+	failures *prometheus.CounterVec
+}
+
+func newRequestMetrics(namespace, label string, constLabels prometheus.Labels) *requestMetrics {
+	return &requestMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "rpc_request_duration_seconds",
+			Help:        "Duration of the requests made to the client to track its head. Exemplars carry the trace ID of the request.",
+			ConstLabels: constLabels,
+			Buckets:     requestBuckets,
+		}, []string{label}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "rpc_request_failures_total",
+			Help:        "Total number of failed requests made to the client to track its head.",
+			ConstLabels: constLabels,
+		}, []string{label}),
+	}
+}
+
+// track runs fn as part of a new trace and observes its duration. Extra
+// labels are added to the exemplar once fn succeeds.
+func (m *requestMetrics) track(ctx context.Context, name string, fn func(ctx context.Context) (prometheus.Labels, error)) error {
+	traceID := newTraceID()
+	start := time.Now()
+	extra, err := fn(withTraceID(ctx, traceID))
+	if err != nil {
+		m.failures.WithLabelValues(name).Inc()
+		return err
+	}
+
+	exemplar := prometheus.Labels{"trace_id": traceID}
+	for k, v := range extra {
+		exemplar[k] = v
+	}
+	observeWithExemplar(m.duration.WithLabelValues(name), time.Since(start).Seconds(), exemplar)
+	return nil
+}
+
+func (m *requestMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.failures.Describe(ch)
+}
+
+func (m *requestMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.failures.Collect(ch)
+}
+
+// observeWithExemplar observes v with an exemplar if o supports them.
+func observeWithExemplar(o prometheus.Observer, v float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	o.Observe(v)
+}
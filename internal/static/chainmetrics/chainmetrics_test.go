@@ -0,0 +1,208 @@
+package chainmetrics
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+var traceparentRegexp = regexp.MustCompile(`^00-([0-9a-f]{32})-[0-9a-f]{16}-01$`)
+
+// exemplars returns the labels of the exemplars of the histogram with the
+// given name.
+func exemplars(t *testing.T, c prometheus.Collector, name string) []map[string]string {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var res []map[string]string
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, b := range m.GetHistogram().GetBucket() {
+				if b.GetExemplar() != nil {
+					res = append(res, labelMap(b.GetExemplar().GetLabel()))
+				}
+			}
+		}
+	}
+	return res
+}
+
+func labelMap(pairs []*dto.LabelPair) map[string]string {
+	res := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		res[p.GetName()] = p.GetValue()
+	}
+	return res
+}
+
+func TestExecutionTracker(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		head     = uint64(100)
+		traceIDs []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "eth_getBlockByNumber", req.Method)
+
+		m := traceparentRegexp.FindStringSubmatch(r.Header.Get("traceparent"))
+		require.NotNil(t, m, "missing traceparent header")
+
+		mut.Lock()
+		defer mut.Unlock()
+		traceIDs = append(traceIDs, m[1])
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":{"number":"0x%x","hash":"0x%064x","timestamp":"0x%x"}}`, req.ID, head, head, 1700000000+head*12)
+	}))
+	defer srv.Close()
+
+	tracker := NewExecutionTracker(log.NewNopLogger(), srv.URL, time.Second, time.Second, "eth_exe", nil)
+	ctx := context.Background()
+
+	// The first head is only recorded.
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return time.Unix(1700000000+100*12+5, 0) }))
+	require.Empty(t, exemplars(t, tracker, "eth_exe_block_arrival_delay_seconds"))
+
+	head = 101
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return time.Unix(1700000000+101*12+2, 0) }))
+	require.Equal(t, []map[string]string{{
+		"block_number": "101",
+		"block_hash":   fmt.Sprintf("0x%064x", 101),
+	}}, exemplars(t, tracker, "eth_exe_block_arrival_delay_seconds"))
+
+	// Request durations carry the trace ID sent to the client.
+	reqExemplars := exemplars(t, tracker, "eth_exe_rpc_request_duration_seconds")
+	require.Len(t, reqExemplars, 1)
+	require.Equal(t, traceIDs[1], reqExemplars[0]["trace_id"])
+	require.Equal(t, fmt.Sprintf("0x%064x", 101), reqExemplars[0]["block_hash"])
+}
+
+func TestConsensusTracker(t *testing.T) {
+	var slot = 5000
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			fmt.Fprint(w, `{"data":{"genesis_time":"1606824023"}}`)
+		case "/eth/v1/config/spec":
+			fmt.Fprint(w, `{"data":{"SECONDS_PER_SLOT":"12"}}`)
+		case "/eth/v1/beacon/headers/head":
+			require.Regexp(t, traceparentRegexp, r.Header.Get("traceparent"))
+			fmt.Fprintf(w, `{"data":{"root":"0x%064x","canonical":true,"header":{"message":{"slot":"%d"}}}}`, slot, slot)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tracker := NewConsensusTracker(log.NewNopLogger(), srv.URL, time.Second, time.Second, "eth_con", nil)
+	ctx := context.Background()
+	slotStart := func(slot int) time.Time { return time.Unix(1606824023+int64(slot)*12, 0) }
+
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return slotStart(5000).Add(time.Second) }))
+	slot = 5001
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return slotStart(5001).Add(3 * time.Second) }))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(tracker))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() == "eth_con_block_arrival_delay_seconds" {
+			h := mf.GetMetric()[0].GetHistogram()
+			require.Equal(t, uint64(1), h.GetSampleCount())
+			require.Equal(t, 3.0, h.GetSampleSum())
+		}
+	}
+
+	require.Equal(t, []map[string]string{{
+		"slot":       "5001",
+		"block_root": fmt.Sprintf("0x%064x", 5001),
+	}}, exemplars(t, tracker, "eth_con_block_arrival_delay_seconds"))
+}
+
+func TestSubstrateTracker(t *testing.T) {
+	var head = uint64(100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int           `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Regexp(t, traceparentRegexp, r.Header.Get("traceparent"))
+
+		var result string
+		switch req.Method {
+		case "chain_getBlockHash":
+			result = fmt.Sprintf(`"0x%064x"`, head)
+		case "chain_getHeader":
+			require.Equal(t, []interface{}{fmt.Sprintf("0x%064x", head)}, req.Params)
+			result = fmt.Sprintf(`{"number":"0x%x"}`, head)
+		case "state_getStorage":
+			require.Equal(t, []interface{}{timestampNowKey, fmt.Sprintf("0x%064x", head)}, req.Params)
+			// 1700000000000 + head*6000 milliseconds, little-endian.
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], 1700000000000+head*6000)
+			result = fmt.Sprintf(`"0x%x"`, b)
+		default:
+			t.Errorf("unexpected method %s", req.Method)
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, result)
+	}))
+	defer srv.Close()
+
+	tracker := NewSubstrateTracker(log.NewNopLogger(), srv.URL, time.Second, time.Second, "substrate", nil)
+	ctx := context.Background()
+	blockTime := func(n uint64) time.Time { return time.UnixMilli(int64(1700000000000 + n*6000)) }
+
+	// The first block is only recorded.
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return blockTime(100).Add(5 * time.Second) }))
+	require.Empty(t, exemplars(t, tracker, "substrate_block_arrival_delay_seconds"))
+
+	head = 101
+	require.NoError(t, tracker.poll(ctx, func() time.Time { return blockTime(101).Add(2 * time.Second) }))
+	require.Equal(t, []map[string]string{{
+		"block_number": "101",
+		"block_hash":   fmt.Sprintf("0x%064x", 101),
+	}}, exemplars(t, tracker, "substrate_block_arrival_delay_seconds"))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(tracker))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() == "substrate_block_arrival_delay_seconds" {
+			require.Equal(t, 2.0, mf.GetMetric()[0].GetHistogram().GetSampleSum())
+		}
+	}
+
+	// Request durations carry the trace ID and the hash of the block.
+	reqExemplars := exemplars(t, tracker, "substrate_rpc_request_duration_seconds")
+	require.NotEmpty(t, reqExemplars)
+	for _, e := range reqExemplars {
+		require.Regexp(t, "^[0-9a-f]{32}$", e["trace_id"])
+		require.Contains(t, []string{fmt.Sprintf("0x%064x", 100), fmt.Sprintf("0x%064x", 101)}, e["block_hash"])
+	}
+}
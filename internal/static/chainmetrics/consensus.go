@@ -0,0 +1,167 @@
+package chainmetrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConsensusTracker polls the head of a consensus client and observes how long
+// after the start of their slot new blocks arrive.
+type ConsensusTracker struct {
+	log      log.Logger
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	arrival  prometheus.Histogram
+	requests *requestMetrics
+
+	// Fetched from the client on the first poll.
+	genesis     time.Time
+	slotSeconds uint64
+
+	lastSlot uint64
+}
+
+var _ prometheus.Collector = (*ConsensusTracker)(nil)
+
+// NewConsensusTracker creates a new ConsensusTracker for the beacon node API
+// at rawURL, polled every interval. Metrics are prefixed with namespace.
+func NewConsensusTracker(l log.Logger, rawURL string, interval, timeout time.Duration, namespace string, constLabels prometheus.Labels) *ConsensusTracker {
+	return &ConsensusTracker{
+		log:      l,
+		url:      rawURL,
+		interval: interval,
+		client:   newClient(timeout),
+
+		arrival: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "block_arrival_delay_seconds",
+			Help:        "Delay between the start of the slot of new head blocks and when they were seen by the client. Exemplars carry the slot and block root.",
+			ConstLabels: constLabels,
+			Buckets:     arrivalBuckets,
+		}),
+		requests: newRequestMetrics(namespace, "path", constLabels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *ConsensusTracker) Describe(ch chan<- *prometheus.Desc) {
+	t.arrival.Describe(ch)
+	t.requests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *ConsensusTracker) Collect(ch chan<- prometheus.Metric) {
+	t.arrival.Collect(ch)
+	t.requests.Collect(ch)
+}
+
+// Run polls the head of the client until ctx is canceled.
+func (t *ConsensusTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.poll(ctx, time.Now); err != nil {
+			level.Debug(t.log).Log("msg", "failed to get head block of consensus client", "url", chainclient.RedactURL(t.url), "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Beacon API responses encode integers as strings.
+type beaconHeader struct {
+	Root   string `json:"root"`
+	Header struct {
+		Message struct {
+			Slot string `json:"slot"`
+		} `json:"message"`
+	} `json:"header"`
+}
+
+// poll gets the head block and observes its arrival delay if it's new. The
+// first head seen is only recorded, since it may have arrived long before.
+func (t *ConsensusTracker) poll(ctx context.Context, now func() time.Time) error {
+	if t.slotSeconds == 0 {
+		if err := t.loadTiming(ctx); err != nil {
+			return fmt.Errorf("failed to get slot timing: %w", err)
+		}
+	}
+
+	const path = "/eth/v1/beacon/headers/head"
+
+	var head beaconHeader
+	err := t.requests.track(ctx, path, func(ctx context.Context) (prometheus.Labels, error) {
+		if err := chainclient.GetBeacon(ctx, t.client, t.url, path, &head); err != nil {
+			return nil, err
+		}
+		return prometheus.Labels{"block_root": head.Root}, nil
+	})
+	if err != nil {
+		return err
+	}
+	seen := now()
+
+	slot, err := strconv.ParseUint(head.Header.Message.Slot, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid slot: %w", err)
+	}
+
+	first := t.lastSlot == 0
+	if slot <= t.lastSlot {
+		return nil
+	}
+	t.lastSlot = slot
+	if first {
+		return nil
+	}
+
+	slotStart := t.genesis.Add(time.Duration(slot*t.slotSeconds) * time.Second)
+	observeWithExemplar(t.arrival, seen.Sub(slotStart).Seconds(), prometheus.Labels{
+		"slot":       strconv.FormatUint(slot, 10),
+		"block_root": head.Root,
+	})
+	return nil
+}
+
+// loadTiming gets the genesis time and slot duration of the chain.
+func (t *ConsensusTracker) loadTiming(ctx context.Context) error {
+	var genesis struct {
+		GenesisTime string `json:"genesis_time"`
+	}
+	if err := chainclient.GetBeacon(ctx, t.client, t.url, "/eth/v1/beacon/genesis", &genesis); err != nil {
+		return err
+	}
+	genesisTime, err := strconv.ParseInt(genesis.GenesisTime, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid genesis time: %w", err)
+	}
+
+	var spec struct {
+		SecondsPerSlot string `json:"SECONDS_PER_SLOT"`
+	}
+	if err := chainclient.GetBeacon(ctx, t.client, t.url, "/eth/v1/config/spec", &spec); err != nil {
+		return err
+	}
+	slotSeconds, err := strconv.ParseUint(spec.SecondsPerSlot, 10, 64)
+	if err != nil || slotSeconds == 0 {
+		return fmt.Errorf("invalid seconds per slot %q", spec.SecondsPerSlot)
+	}
+
+	t.genesis = time.Unix(genesisTime, 0)
+	t.slotSeconds = slotSeconds
+	return nil
+}
@@ -0,0 +1,134 @@
+package chainmetrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExecutionTracker polls the head of an execution client and observes how
+// long after their timestamp new blocks arrive.
+type ExecutionTracker struct {
+	log      log.Logger
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	arrival  prometheus.Histogram
+	requests *requestMetrics
+
+	lastHead uint64
+}
+
+var _ prometheus.Collector = (*ExecutionTracker)(nil)
+
+// NewExecutionTracker creates a new ExecutionTracker for the JSON-RPC
+// endpoint at rawURL, polled every interval. Metrics are prefixed with
+// namespace.
+func NewExecutionTracker(l log.Logger, rawURL string, interval, timeout time.Duration, namespace string, constLabels prometheus.Labels) *ExecutionTracker {
+	return &ExecutionTracker{
+		log:      l,
+		url:      rawURL,
+		interval: interval,
+		client:   newClient(timeout),
+
+		arrival: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "block_arrival_delay_seconds",
+			Help:        "Delay between the timestamp of new head blocks and when they were seen by the client. Exemplars carry the block number and hash.",
+			ConstLabels: constLabels,
+			Buckets:     arrivalBuckets,
+		}),
+		requests: newRequestMetrics(namespace, "method", constLabels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *ExecutionTracker) Describe(ch chan<- *prometheus.Desc) {
+	t.arrival.Describe(ch)
+	t.requests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *ExecutionTracker) Collect(ch chan<- prometheus.Metric) {
+	t.arrival.Collect(ch)
+	t.requests.Collect(ch)
+}
+
+// Run polls the head of the client until ctx is canceled.
+func (t *ExecutionTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.poll(ctx, time.Now); err != nil {
+			level.Debug(t.log).Log("msg", "failed to get head block of execution client", "url", chainclient.RedactURL(t.url), "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type executionBlock struct {
+	Number    string `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+}
+
+// poll gets the head block and observes its arrival delay if it's new. The
+// first head seen is only recorded, since it may have arrived long before.
+func (t *ExecutionTracker) poll(ctx context.Context, now func() time.Time) error {
+	const method = "eth_getBlockByNumber"
+
+	var block executionBlock
+	err := t.requests.track(ctx, method, func(ctx context.Context) (prometheus.Labels, error) {
+		if err := chainclient.CallJSONRPC(ctx, t.client, t.url, method, &block, "latest", false); err != nil {
+			return nil, err
+		}
+		return prometheus.Labels{"block_hash": block.Hash}, nil
+	})
+	if err != nil {
+		return err
+	}
+	seen := now()
+
+	number, err := parseHex(block.Number)
+	if err != nil {
+		return fmt.Errorf("invalid block number: %w", err)
+	}
+	timestamp, err := parseHex(block.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid block timestamp: %w", err)
+	}
+
+	first := t.lastHead == 0
+	if number <= t.lastHead {
+		return nil
+	}
+	t.lastHead = number
+	if first {
+		return nil
+	}
+
+	delay := seen.Sub(time.Unix(int64(timestamp), 0)).Seconds()
+	observeWithExemplar(t.arrival, delay, prometheus.Labels{
+		"block_number": strconv.FormatUint(number, 10),
+		"block_hash":   block.Hash,
+	})
+	return nil
+}
+
+func parseHex(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
@@ -0,0 +1,164 @@
+package chainmetrics
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timestampNowKey is the storage key of Timestamp.Now, the timestamp of a
+// block in milliseconds, i.e., twox128("Timestamp") ++ twox128("Now").
+const timestampNowKey = "0xf0c365c3cf59d671eb72da0e7a4113c49f1f0515f462cdcf84e0f1d6045dfcbb"
+
+// SubstrateTracker polls the best block of a Substrate-based node and
+// observes how long after their timestamp new blocks arrive.
+type SubstrateTracker struct {
+	log      log.Logger
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	arrival  prometheus.Histogram
+	requests *requestMetrics
+
+	lastHead uint64
+}
+
+var _ prometheus.Collector = (*SubstrateTracker)(nil)
+
+// NewSubstrateTracker creates a new SubstrateTracker for the JSON-RPC
+// endpoint at rawURL, polled every interval. Metrics are prefixed with
+// namespace.
+func NewSubstrateTracker(l log.Logger, rawURL string, interval, timeout time.Duration, namespace string, constLabels prometheus.Labels) *SubstrateTracker {
+	return &SubstrateTracker{
+		log:      l,
+		url:      rawURL,
+		interval: interval,
+		client:   newClient(timeout),
+
+		arrival: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "block_arrival_delay_seconds",
+			Help:        "Delay between the timestamp of new best blocks and when they were seen by the node. Exemplars carry the block number and hash.",
+			ConstLabels: constLabels,
+			Buckets:     arrivalBuckets,
+		}),
+		requests: newRequestMetrics(namespace, "method", constLabels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *SubstrateTracker) Describe(ch chan<- *prometheus.Desc) {
+	t.arrival.Describe(ch)
+	t.requests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *SubstrateTracker) Collect(ch chan<- prometheus.Metric) {
+	t.arrival.Collect(ch)
+	t.requests.Collect(ch)
+}
+
+// Run polls the best block of the node until ctx is canceled.
+func (t *SubstrateTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.poll(ctx, time.Now); err != nil {
+			level.Debug(t.log).Log("msg", "failed to get best block of substrate node", "url", chainclient.RedactURL(t.url), "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll gets the best block and observes its arrival delay if it's new. The
+// first block seen is only recorded, since it may have arrived long before.
+func (t *SubstrateTracker) poll(ctx context.Context, now func() time.Time) error {
+	var hash string
+	err := t.requests.track(ctx, "chain_getBlockHash", func(ctx context.Context) (prometheus.Labels, error) {
+		if err := chainclient.CallJSONRPC(ctx, t.client, t.url, "chain_getBlockHash", &hash); err != nil {
+			return nil, err
+		}
+		return prometheus.Labels{"block_hash": hash}, nil
+	})
+	if err != nil {
+		return err
+	}
+	seen := now()
+
+	var header struct {
+		Number string `json:"number"`
+	}
+	err = t.requests.track(ctx, "chain_getHeader", func(ctx context.Context) (prometheus.Labels, error) {
+		if err := chainclient.CallJSONRPC(ctx, t.client, t.url, "chain_getHeader", &header, hash); err != nil {
+			return nil, err
+		}
+		return prometheus.Labels{"block_hash": hash}, nil
+	})
+	if err != nil {
+		return err
+	}
+	number, err := parseHex(header.Number)
+	if err != nil {
+		return fmt.Errorf("invalid block number: %w", err)
+	}
+
+	first := t.lastHead == 0
+	if number <= t.lastHead {
+		return nil
+	}
+	t.lastHead = number
+	if first {
+		return nil
+	}
+
+	var storage string
+	err = t.requests.track(ctx, "state_getStorage", func(ctx context.Context) (prometheus.Labels, error) {
+		if err := chainclient.CallJSONRPC(ctx, t.client, t.url, "state_getStorage", &storage, timestampNowKey, hash); err != nil {
+			return nil, err
+		}
+		return prometheus.Labels{"block_hash": hash}, nil
+	})
+	if err != nil {
+		return err
+	}
+	timestamp, err := parseTimestamp(storage)
+	if err != nil {
+		return fmt.Errorf("invalid block timestamp: %w", err)
+	}
+
+	delay := seen.Sub(timestamp).Seconds()
+	observeWithExemplar(t.arrival, delay, prometheus.Labels{
+		"block_number": strconv.FormatUint(number, 10),
+		"block_hash":   hash,
+	})
+	return nil
+}
+
+// parseTimestamp decodes the SCALE encoded Timestamp.Now storage value, a
+// little-endian number of milliseconds.
+func parseTimestamp(s string) (time.Time, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(b) != 8 {
+		return time.Time{}, fmt.Errorf("expected 8 bytes, got %d", len(b))
+	}
+	return time.UnixMilli(int64(binary.LittleEndian.Uint64(b))), nil
+}
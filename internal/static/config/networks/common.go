@@ -6,8 +6,11 @@ import (
 )
 
 type ScrapeConfig struct {
-	JobName       string
-	StaticConfigs []StaticConfig
+	JobName             string
+	MetricsPath         string
+	StaticConfigs       []StaticConfig
+	KubernetesSDConfigs []KubernetesSDConfig
+	RelabelConfigs      []RelabelConfig
 }
 
 type StaticConfig struct {
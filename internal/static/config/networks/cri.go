@@ -0,0 +1,11 @@
+package networks
+
+import "fmt"
+
+// CRIClientExpression returns the expression of a regex pipeline stage which
+// extracts the client_name of the roles' clients from the name of a CRI
+// container, e.g., geth or lighthouse-beacon, like the client_name label of
+// Docker containers.
+func CRIClientExpression(roles []Role) string {
+	return fmt.Sprintf(`^(?P<client_name>%s)(?:-.*)?$`, clientsRegex(journalClients(roles)))
+}
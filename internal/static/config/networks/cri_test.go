@@ -0,0 +1,28 @@
+package networks
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRIClientExpression(t *testing.T) {
+	re := regexp.MustCompile(CRIClientExpression(NewPolkadotConfig().Roles()))
+
+	for container, client := range map[string]string{
+		"polkadot":           "polkadot",
+		"polkadot-validator": "polkadot",
+		"polkadot-parachain": "polkadot-parachain",
+		"nginx":              "",
+		"polkadotx":          "",
+	} {
+		m := re.FindStringSubmatch(container)
+		if client == "" {
+			require.Nil(t, m, "container %q", container)
+			continue
+		}
+		require.NotNil(t, m, "container %q", container)
+		require.Equal(t, client, m[re.SubexpIndex("client_name")], "container %q", container)
+	}
+}
@@ -5,16 +5,18 @@ import (
 )
 
 type EthereumConfig struct {
-	Chain    string
 	NodeType map[string]int
-	Port     int
+	// MetricsPath maps node types to their metrics path, DefaultMetricsPath
+	// if unset.
+	MetricsPath map[string]string
+	Port        int
 }
 
 func NewEthereumConfig() *EthereumConfig {
 	return &EthereumConfig{
-		Chain:    "sepolia",
-		NodeType: map[string]int{"execution": 6060, "consensus": 8008},
-		Port:     6060,
+		NodeType:    map[string]int{"execution": 6060, "consensus": 8008},
+		MetricsPath: map[string]string{"execution": gethMetricsPath},
+		Port:        6060,
 	}
 }
 
@@ -33,7 +35,8 @@ func (e *EthereumConfig) GenerateScrapeConfigs(projectName, network string) []Sc
 		jobName := fmt.Sprintf("%s_%s_%s_job_%d", toLowerAndEscape(projectName), network, nodeType, idx)
 		target := fmt.Sprintf("localhost:%d", port)
 		scrapeConfigs = append(scrapeConfigs, ScrapeConfig{
-			JobName: jobName,
+			JobName:     jobName,
+			MetricsPath: e.MetricsPath[nodeType],
 			StaticConfigs: []StaticConfig{
 				{
 					Targets: []string{target},
@@ -48,4 +51,11 @@ func (e *EthereumConfig) GenerateScrapeConfigs(projectName, network string) []Sc
 func (e *EthereumConfig) AutoconfigureScrapeConfigs(projectName, network string) ([]ScrapeConfig, error) {
 	// Implement the logic for auto-configuring scrape configs
 	return e.GenerateScrapeConfigs(projectName, network), nil
-}
\ No newline at end of file
+}
+
+func (e *EthereumConfig) Roles() []Role {
+	return nodeTypeRoles(e.NodeType, e.MetricsPath, map[string][]string{
+		"execution": ethereumExecutionClients,
+		"consensus": ethereumConsensusClients,
+	})
+}
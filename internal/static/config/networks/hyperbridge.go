@@ -48,4 +48,10 @@ func (h *HyperbridgeConfig) GenerateScrapeConfigs(projectName, network string) [
 func (h *HyperbridgeConfig) AutoconfigureScrapeConfigs(projectName, network string) ([]ScrapeConfig, error) {
 	// Implement the logic for auto-configuring scrape configs
 	return h.GenerateScrapeConfigs(projectName, network), nil
-}
\ No newline at end of file
+}
+
+func (h *HyperbridgeConfig) Roles() []Role {
+	return nodeTypeRoles(h.NodeType, nil, map[string][]string{
+		"node": {"hyperbridge"},
+	})
+}
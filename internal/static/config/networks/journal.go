@@ -0,0 +1,51 @@
+package networks
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JournalRelabelConfigs returns the relabel configs of a systemd journal
+// scrape config which keep the entries of the units of the roles' clients,
+// e.g., geth.service or lighthouse-bn.service, and label them like the
+// entries of Docker containers.
+func JournalRelabelConfigs(network string, roles []Role) []RelabelConfig {
+	unitRegex := fmt.Sprintf(`(%s)(?:[-_@.][^.]*)?\.service`, clientsRegex(journalClients(roles)))
+
+	return []RelabelConfig{
+		{SourceLabels: []string{"__journal__systemd_unit"}, Regex: unitRegex, Action: "keep"},
+		{SourceLabels: []string{"__journal__systemd_unit"}, Regex: unitRegex, TargetLabel: "client_name", Replacement: "$1"},
+		{SourceLabels: []string{"__journal__systemd_unit"}, TargetLabel: "unit"},
+		{SourceLabels: []string{"__journal_priority_keyword"}, TargetLabel: "priority"},
+		{SourceLabels: []string{"__journal__hostname"}, TargetLabel: "hostname"},
+		{TargetLabel: "network", Replacement: network},
+	}
+}
+
+// journalClients returns the clients of the roles, longest first so that
+// units of clients whose name starts with the name of another one, like
+// polkadot-parachain, match the longest one.
+func journalClients(roles []Role) []string {
+	seen := map[string]struct{}{}
+	var clients []string
+	for _, role := range roles {
+		roleClients := role.Clients
+		if len(roleClients) == 0 {
+			roleClients = []string{role.Name}
+		}
+		for _, c := range roleClients {
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			clients = append(clients, c)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if len(clients[i]) != len(clients[j]) {
+			return len(clients[i]) > len(clients[j])
+		}
+		return clients[i] < clients[j]
+	})
+	return clients
+}
@@ -0,0 +1,55 @@
+package networks
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalRelabelConfigs(t *testing.T) {
+	relabelConfigs := toPromRelabelConfigs(t, JournalRelabelConfigs("ethereum", NewEthereumConfig().Roles()))
+
+	for unit, client := range map[string]string{
+		"geth.service":            "geth",
+		"lighthouse-bn.service":   "lighthouse",
+		"lighthouse-vc.service":   "lighthouse",
+		"nethermind@main.service": "nethermind",
+		"sshd.service":            "",
+		"gethx.service":           "",
+		"geth.socket":             "",
+	} {
+		lbls, kept := relabel.Process(labels.FromStrings(
+			"__journal__systemd_unit", unit,
+			"__journal_priority_keyword", "info",
+			"__journal__hostname", "validator-1",
+		), relabelConfigs...)
+		require.Equal(t, client != "", kept, "unit %q", unit)
+		if !kept {
+			continue
+		}
+		require.Equal(t, labels.FromStrings(
+			"__journal__hostname", "validator-1",
+			"__journal__systemd_unit", unit,
+			"__journal_priority_keyword", "info",
+			"client_name", client,
+			"hostname", "validator-1",
+			"network", "ethereum",
+			"priority", "info",
+			"unit", unit,
+		), lbls, "unit %q", unit)
+	}
+}
+
+func TestJournalRelabelConfigs_LongestClient(t *testing.T) {
+	relabelConfigs := toPromRelabelConfigs(t, JournalRelabelConfigs("polkadot", NewPolkadotConfig().Roles()))
+
+	lbls, kept := relabel.Process(labels.FromStrings("__journal__systemd_unit", "polkadot-parachain.service"), relabelConfigs...)
+	require.True(t, kept)
+	require.Equal(t, "polkadot-parachain", lbls.Get("client_name"))
+
+	lbls, kept = relabel.Process(labels.FromStrings("__journal__systemd_unit", "polkadot-validator.service"), relabelConfigs...)
+	require.True(t, kept)
+	require.Equal(t, "polkadot", lbls.Get("client_name"))
+}
@@ -0,0 +1,159 @@
+package networks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pod labels and annotations used to discover blockchain clients on
+// Kubernetes. The client may be set either as a label or as an annotation;
+// the port and path annotations override the defaults of the role.
+const (
+	KubernetesClientKey = "telescope.blockops.network/client"
+	KubernetesPortKey   = "telescope.blockops.network/port"
+	KubernetesPathKey   = "telescope.blockops.network/path"
+)
+
+// Supported discovery modes of the generator.
+const (
+	DiscoveryStatic     = "static"
+	DiscoveryKubernetes = "kubernetes"
+)
+
+// DefaultMetricsPath is the metrics path of roles which do not set one.
+const DefaultMetricsPath = "/metrics"
+
+// gethMetricsPath is the path of the Prometheus metrics of geth, and of the
+// clients sharing its metrics server, e.g. erigon.
+const gethMetricsPath = "/debug/metrics/prometheus"
+
+// Well-known clients of Ethereum nodes, shared by the networks which run
+// them.
+var (
+	ethereumExecutionClients = []string{"geth", "nethermind", "besu", "erigon", "reth"}
+	ethereumConsensusClients = []string{"lighthouse", "prysm", "teku", "nimbus", "lodestar", "grandine"}
+)
+
+// Role is a component of a network whose metrics are scraped, e.g., the
+// execution client of an Ethereum node.
+type Role struct {
+	Name        string
+	Port        int
+	MetricsPath string
+	// Clients are the well-known implementations of the role. Pods are
+	// selected when their client label or annotation is one of them.
+	Clients []string
+}
+
+type KubernetesSDConfig struct {
+	Role       string
+	Namespaces []string
+}
+
+type RelabelConfig struct {
+	SourceLabels []string
+	Separator    string
+	Regex        string
+	TargetLabel  string
+	Replacement  string
+	Action       string
+}
+
+// KubernetesScrapeConfigs returns one scrape config per role which discovers
+// the pods of the role's clients through the Kubernetes API. An empty list of
+// namespaces discovers pods in all namespaces.
+func KubernetesScrapeConfigs(projectName, network string, roles []Role, namespaces []string) []ScrapeConfig {
+	var scrapeConfigs []ScrapeConfig
+	for _, role := range roles {
+		if len(role.Clients) == 0 {
+			role.Clients = []string{role.Name}
+		}
+
+		scrapeConfigs = append(scrapeConfigs, ScrapeConfig{
+			JobName:     fmt.Sprintf("%s_%s_%s_kubernetes", toLowerAndEscape(projectName), network, role.Name),
+			MetricsPath: metricsPath(role.MetricsPath),
+			KubernetesSDConfigs: []KubernetesSDConfig{
+				{Role: "pod", Namespaces: namespaces},
+			},
+			RelabelConfigs: kubernetesRelabelConfigs(network, role),
+		})
+	}
+	return scrapeConfigs
+}
+
+func kubernetesRelabelConfigs(network string, role Role) []RelabelConfig {
+	clientAnnotation := "__meta_kubernetes_pod_annotation_" + sanitizeLabelName(KubernetesClientKey)
+	clientLabel := "__meta_kubernetes_pod_label_" + sanitizeLabelName(KubernetesClientKey)
+	portAnnotation := "__meta_kubernetes_pod_annotation_" + sanitizeLabelName(KubernetesPortKey)
+	pathAnnotation := "__meta_kubernetes_pod_annotation_" + sanitizeLabelName(KubernetesPathKey)
+
+	return []RelabelConfig{
+		// Only scrape the running containers of pods. Pod discovery returns
+		// a target per declared container port; the rules below give them
+		// all the same address and labels, so the scrape pool merges them
+		// into a single target per pod.
+		{SourceLabels: []string{"__meta_kubernetes_pod_phase"}, Regex: "Running", Action: "keep"},
+		{SourceLabels: []string{"__meta_kubernetes_pod_container_init"}, Regex: "true", Action: "drop"},
+
+		// Select the pods of the role's clients. The label takes precedence
+		// over the annotation.
+		{SourceLabels: []string{clientAnnotation}, Regex: "(.+)", TargetLabel: "__tmp_telescope_client"},
+		{SourceLabels: []string{clientLabel}, Regex: "(.+)", TargetLabel: "__tmp_telescope_client"},
+		{SourceLabels: []string{"__tmp_telescope_client"}, Regex: clientsRegex(role.Clients), Action: "keep"},
+
+		// Scrape the pod IP on the role's port unless overridden. IPv6
+		// addresses, which contain colons, are enclosed in brackets.
+		{SourceLabels: []string{"__meta_kubernetes_pod_ip"}, Regex: "(.+)", TargetLabel: "__address__", Replacement: fmt.Sprintf("$1:%d", role.Port)},
+		{SourceLabels: []string{"__meta_kubernetes_pod_ip"}, Regex: "(.*:.*)", TargetLabel: "__address__", Replacement: fmt.Sprintf("[$1]:%d", role.Port)},
+		{SourceLabels: []string{"__meta_kubernetes_pod_ip", portAnnotation}, Separator: ";", Regex: `([^:]+);(\d+)`, TargetLabel: "__address__", Replacement: "$1:$2"},
+		{SourceLabels: []string{"__meta_kubernetes_pod_ip", portAnnotation}, Separator: ";", Regex: `(.*:.*);(\d+)`, TargetLabel: "__address__", Replacement: "[$1]:$2"},
+		{SourceLabels: []string{pathAnnotation}, Regex: "(.+)", TargetLabel: "__metrics_path__"},
+
+		{SourceLabels: []string{"__tmp_telescope_client"}, TargetLabel: "client"},
+		{SourceLabels: []string{"__meta_kubernetes_namespace"}, TargetLabel: "namespace"},
+		{SourceLabels: []string{"__meta_kubernetes_pod_name"}, TargetLabel: "pod"},
+		{SourceLabels: []string{"__meta_kubernetes_pod_node_name"}, TargetLabel: "node"},
+		{TargetLabel: "role", Replacement: role.Name},
+		{TargetLabel: "network", Replacement: network},
+	}
+}
+
+func clientsRegex(clients []string) string {
+	quoted := make([]string, len(clients))
+	for i, c := range clients {
+		quoted[i] = regexp.QuoteMeta(c)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// sanitizeLabelName converts a Kubernetes label or annotation name to the
+// form used in the meta labels of Kubernetes service discovery.
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// nodeTypeRoles returns the roles of presets which map node types to ports,
+// sorted by name. Node types without a metrics path use DefaultMetricsPath.
+func nodeTypeRoles(nodeTypes map[string]int, metricsPaths map[string]string, clients map[string][]string) []Role {
+	roles := make([]Role, 0, len(nodeTypes))
+	for name, port := range nodeTypes {
+		roles = append(roles, Role{Name: name, Port: port, MetricsPath: metricsPath(metricsPaths[name]), Clients: clients[name]})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+// metricsPath returns path, or DefaultMetricsPath if it's empty.
+func metricsPath(path string) string {
+	if path == "" {
+		return DefaultMetricsPath
+	}
+	return path
+}
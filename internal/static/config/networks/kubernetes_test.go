@@ -0,0 +1,230 @@
+package networks
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPod(name string, labels, annotations map[string]string, ip string, ports ...int32) *corev1.Pod {
+	var containerPorts []corev1.ContainerPort
+	for _, p := range ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: p, Protocol: corev1.ProtocolTCP})
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "eth",
+			UID:         types.UID("uid-" + name),
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "main", Ports: containerPorts}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+	}
+}
+
+// discoverPods runs the Prometheus pod discovery against a fake Kubernetes
+// client and returns the discovered targets.
+func discoverPods(t *testing.T, pods ...*corev1.Pod) []labels.Labels {
+	t.Helper()
+
+	client := fake.NewSimpleClientset()
+	for _, p := range pods {
+		_, err := client.CoreV1().Pods(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	podInformer := factory.Core().V1().Pods().Informer()
+	d := kubernetes.NewPod(nil, podInformer, nil)
+	factory.Start(ctx.Done())
+
+	ch := make(chan []*targetgroup.Group)
+	go d.Run(ctx, ch)
+
+	var targets []labels.Labels
+	for seen := 0; seen < len(pods); {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for pod discovery")
+		case groups := <-ch:
+			for _, g := range groups {
+				seen++
+				for _, tgt := range g.Targets {
+					lb := labels.NewBuilder(labels.EmptyLabels())
+					for n, v := range g.Labels {
+						lb.Set(string(n), string(v))
+					}
+					for n, v := range tgt {
+						lb.Set(string(n), string(v))
+					}
+					targets = append(targets, lb.Labels())
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// toPromRelabelConfigs converts the generated relabel rules the same way the
+// Agent loads them from the generated config file.
+func toPromRelabelConfigs(t *testing.T, rcs []RelabelConfig) []*relabel.Config {
+	t.Helper()
+
+	var raw []map[string]interface{}
+	for _, rc := range rcs {
+		m := map[string]interface{}{}
+		if len(rc.SourceLabels) > 0 {
+			m["source_labels"] = rc.SourceLabels
+		}
+		for k, v := range map[string]string{
+			"separator":    rc.Separator,
+			"regex":        rc.Regex,
+			"target_label": rc.TargetLabel,
+			"replacement":  rc.Replacement,
+			"action":       rc.Action,
+		} {
+			if v != "" {
+				m[k] = v
+			}
+		}
+		raw = append(raw, m)
+	}
+	bb, err := yaml.Marshal(raw)
+	require.NoError(t, err)
+
+	var cfgs []*relabel.Config
+	require.NoError(t, yaml.Unmarshal(bb, &cfgs))
+	return cfgs
+}
+
+func TestKubernetesScrapeConfigs(t *testing.T) {
+	scrapeConfigs := KubernetesScrapeConfigs("My Project", "ethereum", NewEthereumConfig().Roles(), []string{"eth"})
+	require.Len(t, scrapeConfigs, 2)
+
+	var execution ScrapeConfig
+	for _, sc := range scrapeConfigs {
+		require.Equal(t, []KubernetesSDConfig{{Role: "pod", Namespaces: []string{"eth"}}}, sc.KubernetesSDConfigs)
+		if sc.JobName == "my+project_ethereum_execution_kubernetes" {
+			execution = sc
+		}
+	}
+	require.Equal(t, "/debug/metrics/prometheus", execution.MetricsPath)
+
+	targets := discoverPods(t,
+		newPod("geth-0", map[string]string{KubernetesClientKey: "geth"}, nil, "10.0.0.1", 8545, 30303),
+		newPod("reth-0", nil, map[string]string{KubernetesClientKey: "reth", KubernetesPortKey: "9001", KubernetesPathKey: "/metrics"}, "10.0.0.2"),
+		newPod("geth-1", map[string]string{KubernetesClientKey: "geth"}, nil, "fd00::1"),
+		newPod("reth-1", nil, map[string]string{KubernetesClientKey: "reth", KubernetesPortKey: "9001"}, "fd00::2"),
+		newPod("lighthouse-0", map[string]string{KubernetesClientKey: "lighthouse"}, nil, "10.0.0.3", 5054),
+		newPod("nginx-0", map[string]string{"app": "nginx"}, nil, "10.0.0.4", 80),
+	)
+
+	relabelConfigs := toPromRelabelConfigs(t, execution.RelabelConfigs)
+	var (
+		keptTargets int
+		kept        = map[string]labels.Labels{}
+		unique      = map[uint64]struct{}{}
+	)
+	for _, tgt := range targets {
+		if lbls, keep := relabel.Process(tgt, relabelConfigs...); keep {
+			keptTargets++
+			kept[lbls.Get(model.AddressLabel)] = lbls
+			unique[targetLabels(lbls).Hash()] = struct{}{}
+		}
+	}
+
+	// The two container ports of geth-0 are discovered as two targets,
+	// which become identical once meta labels are dropped and are scraped
+	// once.
+	require.Equal(t, 5, keptTargets)
+	require.Len(t, unique, 4)
+
+	var addrs []string
+	for addr := range kept {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	// IPv6 pod IPs are enclosed in brackets.
+	require.Equal(t, []string{"10.0.0.1:6060", "10.0.0.2:9001", "[fd00::1]:6060", "[fd00::2]:9001"}, addrs)
+
+	geth := kept["10.0.0.1:6060"]
+	require.Equal(t, "geth", geth.Get("client"))
+	require.Equal(t, "execution", geth.Get("role"))
+	require.Equal(t, "ethereum", geth.Get("network"))
+	require.Equal(t, "eth", geth.Get("namespace"))
+	require.Equal(t, "geth-0", geth.Get("pod"))
+	require.Equal(t, "node-1", geth.Get("node"))
+	require.Equal(t, "", geth.Get(model.MetricsPathLabel))
+
+	reth := kept["10.0.0.2:9001"]
+	require.Equal(t, "reth", reth.Get("client"))
+	require.Equal(t, "/metrics", reth.Get(model.MetricsPathLabel))
+}
+
+// targetLabels drops the meta labels of a relabeled target, like the scrape
+// pool does before deduplicating targets.
+func targetLabels(lbls labels.Labels) labels.Labels {
+	lb := labels.NewBuilder(lbls)
+	lbls.Range(func(l labels.Label) {
+		if strings.HasPrefix(l.Name, model.MetaLabelPrefix) {
+			lb.Del(l.Name)
+		}
+	})
+	return lb.Labels()
+}
+
+func TestRoles_MetricsPath(t *testing.T) {
+	paths := map[string]string{}
+	for _, role := range NewEthereumConfig().Roles() {
+		paths[role.Name] = role.MetricsPath
+	}
+	require.Equal(t, map[string]string{"execution": "/debug/metrics/prometheus", "consensus": DefaultMetricsPath}, paths)
+
+	for _, sc := range NewEthereumConfig().GenerateScrapeConfigs("p", "ethereum") {
+		if strings.Contains(sc.JobName, "execution") {
+			require.Equal(t, "/debug/metrics/prometheus", sc.MetricsPath)
+		} else {
+			require.Empty(t, sc.MetricsPath)
+		}
+	}
+}
+
+func TestKubernetesScrapeConfigs_DefaultClients(t *testing.T) {
+	scrapeConfigs := KubernetesScrapeConfigs("p", "hyperbridge", []Role{{Name: "node", Port: 8080}}, nil)
+	require.Len(t, scrapeConfigs, 1)
+	require.Equal(t, DefaultMetricsPath, scrapeConfigs[0].MetricsPath)
+
+	relabelConfigs := toPromRelabelConfigs(t, scrapeConfigs[0].RelabelConfigs)
+	for client, keep := range map[string]bool{"node": true, "": false, "geth": false} {
+		lbls := labels.FromStrings(
+			"__meta_kubernetes_pod_phase", "Running",
+			"__meta_kubernetes_pod_ip", "10.0.0.1",
+			"__meta_kubernetes_pod_label_telescope_blockops_network_client", client,
+		)
+		_, kept := relabel.Process(lbls, relabelConfigs...)
+		require.Equal(t, keep, kept, "client %q", client)
+	}
+}
@@ -3,4 +3,7 @@ package networks
 type NetworkConfig interface {
     NetworkDiscovery() ([]string, error)
     GenerateScrapeConfigs(projectName, network string) []ScrapeConfig
+    // Roles returns the components of the network whose metrics are scraped,
+    // used to discover them on Kubernetes.
+    Roles() []Role
 }
\ No newline at end of file
@@ -48,4 +48,11 @@ func (p *PolkadotConfig) GenerateScrapeConfigs(projectName, network string) []Sc
 func (p *PolkadotConfig) AutoconfigureScrapeConfigs(projectName, network string) ([]ScrapeConfig, error) {
 	// Implement the logic for auto-configuring scrape configs
 	return p.GenerateScrapeConfigs(projectName, network), nil
-}
\ No newline at end of file
+}
+
+func (p *PolkadotConfig) Roles() []Role {
+	return nodeTypeRoles(p.NodeType, nil, map[string][]string{
+		"relaychain": {"polkadot"},
+		"parachains": {"polkadot-parachain"},
+	})
+}
@@ -12,6 +12,8 @@ import (
 type NodeConfig struct {
 	Type string
 	Port int
+	// MetricsPath is DefaultMetricsPath if empty.
+	MetricsPath string
 }
 
 type SSVConfig struct {
@@ -23,7 +25,7 @@ func NewSSVConfig() *SSVConfig {
 	return &SSVConfig{
 		Protocol: "ssv",
 		NodeTypes: []NodeConfig{
-			{Type: "execution", Port: 6060},
+			{Type: "execution", Port: 6060, MetricsPath: gethMetricsPath},
 			{Type: "consensus", Port: 8008},
 			{Type: "mevboost", Port: 18550},
 			{Type: "ssvdkg", Port: 3030},
@@ -38,7 +40,8 @@ func (s *SSVConfig) GenerateScrapeConfigs(projectName, protocol string) []Scrape
 
 	for _, node := range s.NodeTypes {
 		scrapeConfigs = append(scrapeConfigs, ScrapeConfig{
-			JobName: fmt.Sprintf("%s_client_%s", protocol, node.Type ),
+			JobName:     fmt.Sprintf("%s_client_%s", protocol, node.Type),
+			MetricsPath: node.MetricsPath,
 			StaticConfigs: []StaticConfig{
 				{
 					Targets: []string{fmt.Sprintf("localhost:%d", node.Port)},
@@ -60,4 +63,17 @@ func (s *SSVConfig) NetworkDiscovery() ([]string, error) {
 	return ports, nil
 }
 
-
+func (s *SSVConfig) Roles() []Role {
+	clients := map[string][]string{
+		"execution": ethereumExecutionClients,
+		"consensus": ethereumConsensusClients,
+		"mevboost":  {"mev-boost"},
+		"ssvdkg":    {"ssv-dkg"},
+		"ssv":       {"ssv-node"},
+	}
+	roles := make([]Role, 0, len(s.NodeTypes))
+	for _, node := range s.NodeTypes {
+		roles = append(roles, Role{Name: node.Type, Port: node.Port, MetricsPath: metricsPath(node.MetricsPath), Clients: clients[node.Type]})
+	}
+	return roles
+}
@@ -7,6 +7,8 @@ import (
 type StarknetNodeConfig struct {
 	Type string
 	Port int
+	// MetricsPath is DefaultMetricsPath if empty.
+	MetricsPath string
 }
 
 type StarknetConfig struct {
@@ -18,7 +20,7 @@ func NewStarknetConfig() *StarknetConfig {
 	return &StarknetConfig{
 		Protocol: "starknet",
 		NodeTypes: []StarknetNodeConfig{
-			{Type: "execution", Port: 6060},
+			{Type: "execution", Port: 6060, MetricsPath: gethMetricsPath},
 			{Type: "consensus", Port: 8008},
 			{Type: "juno", Port: 9090},
 			{Type: "pathfinder", Port: 9090},
@@ -33,7 +35,8 @@ func (s *StarknetConfig) GenerateScrapeConfigs(projectName, protocol string) []S
 
 	for _, node := range s.NodeTypes {
 		scrapeConfigs = append(scrapeConfigs, ScrapeConfig{
-			JobName: fmt.Sprintf("%s_client_%s", protocol, node.Type ),
+			JobName:     fmt.Sprintf("%s_client_%s", protocol, node.Type),
+			MetricsPath: node.MetricsPath,
 			StaticConfigs: []StaticConfig{
 				{
 					Targets: []string{fmt.Sprintf("localhost:%d", node.Port)},
@@ -55,4 +58,14 @@ func (s *StarknetConfig) NetworkDiscovery() ([]string, error) {
 	return ports, nil
 }
 
-
+func (s *StarknetConfig) Roles() []Role {
+	clients := map[string][]string{
+		"execution": ethereumExecutionClients,
+		"consensus": ethereumConsensusClients,
+	}
+	roles := make([]Role, 0, len(s.NodeTypes))
+	for _, node := range s.NodeTypes {
+		roles = append(roles, Role{Name: node.Type, Port: node.Port, MetricsPath: metricsPath(node.MetricsPath), Clients: clients[node.Type]})
+	}
+	return roles
+}
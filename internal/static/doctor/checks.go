@@ -0,0 +1,524 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/blockopsnetwork/telescope/internal/static/config"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	promtail_client "github.com/grafana/loki/clients/pkg/promtail/client"
+	commonconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/prompb"
+	"gopkg.in/yaml.v2"
+)
+
+const userAgent = "telescope-doctor"
+
+// CheckFeatures verifies that the features required by the raw config file
+// are enabled. Integrations configured with a "_configs" suffix are only
+// understood by integrations-next.
+func CheckFeatures(raw []byte, enabledFeatures []string) []Result {
+	var cfg struct {
+		Integrations map[string]interface{} `yaml:"integrations"`
+	}
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return []Result{{
+			Check:  "config file",
+			Status: StatusFail,
+			Detail: err.Error(),
+			Hint:   "fix the YAML syntax of the config file",
+		}}
+	}
+
+	var v2Integrations []string
+	for name := range cfg.Integrations {
+		if strings.HasSuffix(name, "_configs") {
+			v2Integrations = append(v2Integrations, name)
+		}
+	}
+	if len(v2Integrations) == 0 {
+		return nil
+	}
+
+	for _, f := range enabledFeatures {
+		if strings.TrimSpace(f) == "integrations-next" {
+			return []Result{{
+				Check:  "feature flags",
+				Target: "integrations-next",
+				Status: StatusPass,
+				Detail: "enabled",
+			}}
+		}
+	}
+	return []Result{{
+		Check:  "feature flags",
+		Target: "integrations-next",
+		Status: StatusFail,
+		Detail: fmt.Sprintf("%s require integrations-next", strings.Join(v2Integrations, ", ")),
+		Hint:   "add --enable-features integrations-next",
+	}}
+}
+
+// CheckWritableDir verifies that dir exists, or can be created, and that
+// files can be written to it.
+func CheckWritableDir(check, dir string) Result {
+	res := Result{Check: check, Target: dir}
+	if dir == "" {
+		res.Status = StatusWarn
+		res.Detail = "directory not configured"
+		return res
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "create the directory or point the config to a writable location"
+		return res
+	}
+	f, err := os.CreateTemp(dir, ".telescope-doctor-*")
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "make the directory writable by the user running telescope"
+		return res
+	}
+	f.Close()
+	_ = os.Remove(f.Name())
+
+	res.Status = StatusPass
+	res.Detail = "writable"
+	return res
+}
+
+func checkDirectories(cfg *config.Config) []Result {
+	res := []Result{CheckWritableDir("WAL directory", cfg.Metrics.WALDir)}
+	if cfg.Logs == nil {
+		return res
+	}
+
+	seen := map[string]struct{}{}
+	for _, ic := range cfg.Logs.Configs {
+		dir := filepath.Dir(ic.PositionsConfig.PositionsFile)
+		if ic.PositionsConfig.PositionsFile == "" {
+			dir = cfg.Logs.PositionsDirectory
+		}
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		res = append(res, CheckWritableDir("positions directory", dir))
+	}
+	return res
+}
+
+// CheckScrapeTarget verifies that target serves metrics.
+func CheckScrapeTarget(ctx context.Context, client *http.Client, job, target string) Result {
+	res := Result{Check: "scrape target", Target: fmt.Sprintf("%s (%s)", chainclient.RedactURL(target), job)}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "check that the client is running and its metrics server is enabled on this port"
+		return res
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	switch {
+	case resp.StatusCode/100 != 2:
+		res.Status = StatusFail
+		res.Detail = resp.Status
+		res.Hint = "check the metrics path and port of the scrape config"
+	case len(bytes.TrimSpace(body)) == 0:
+		res.Status = StatusWarn
+		res.Detail = "endpoint returned no metrics"
+		res.Hint = "check that the client has metrics enabled"
+	default:
+		res.Status = StatusPass
+		res.Detail = resp.Status
+	}
+	return res
+}
+
+func checkScrapeTargets(ctx context.Context, cfg *config.Config, timeout time.Duration) []Result {
+	var res []Result
+	for _, ic := range cfg.Metrics.Configs {
+		for _, sc := range ic.ScrapeConfigs {
+			client, err := commonconfig.NewClientFromConfig(sc.HTTPClientConfig, userAgent)
+			if err != nil {
+				res = append(res, Result{
+					Check:  "scrape target",
+					Target: sc.JobName,
+					Status: StatusFail,
+					Detail: err.Error(),
+					Hint:   "fix the HTTP client settings of the scrape config",
+				})
+				continue
+			}
+			client.Timeout = timeout
+
+			for _, target := range staticTargets(sc) {
+				res = append(res, CheckScrapeTarget(ctx, client, sc.JobName, target))
+			}
+		}
+	}
+	return res
+}
+
+// staticTargets returns the URLs of all statically configured targets of sc.
+// Targets from other service discovery mechanisms are not known until the
+// Agent runs and are not returned.
+func staticTargets(sc *promconfig.ScrapeConfig) []string {
+	var targets []string
+	for _, sd := range sc.ServiceDiscoveryConfigs {
+		static, ok := sd.(discovery.StaticConfig)
+		if !ok {
+			continue
+		}
+		for _, group := range static {
+			for _, t := range group.Targets {
+				u := url.URL{
+					Scheme: sc.Scheme,
+					Host:   string(t[model.AddressLabel]),
+					Path:   sc.MetricsPath,
+				}
+				if len(sc.Params) > 0 {
+					u.RawQuery = sc.Params.Encode()
+				}
+				targets = append(targets, u.String())
+			}
+		}
+	}
+	return targets
+}
+
+// CheckRemoteWrite sends an empty remote write request to rw to verify that
+// the endpoint is reachable and accepts the configured credentials.
+func CheckRemoteWrite(ctx context.Context, rw *promconfig.RemoteWriteConfig, timeout time.Duration) Result {
+	res := Result{Check: "remote_write push", Target: chainclient.RedactURL(rw.URL.String())}
+
+	client, err := commonconfig.NewClientFromConfig(rw.HTTPClientConfig, userAgent)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "fix the HTTP client settings of the remote_write config"
+		return res
+	}
+	client.Timeout = timeout
+
+	data, err := proto.Marshal(&prompb.WriteRequest{})
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return res
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.URL.String(), bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return res
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range rw.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return classifyPush(client, req, res, "--remote-write-url")
+}
+
+func checkRemoteWrites(ctx context.Context, cfg *config.Config, timeout time.Duration) []Result {
+	var (
+		res  []Result
+		seen = map[string]struct{}{}
+	)
+	check := func(rw *promconfig.RemoteWriteConfig) {
+		if rw == nil || rw.URL == nil {
+			return
+		}
+		key := rw.URL.String()
+		if ba := rw.HTTPClientConfig.BasicAuth; ba != nil {
+			key += "|" + ba.Username
+		}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		res = append(res, CheckRemoteWrite(ctx, rw, timeout))
+	}
+
+	for _, rw := range cfg.Metrics.Global.RemoteWrite {
+		check(rw)
+	}
+	for _, ic := range cfg.Metrics.Configs {
+		for _, rw := range ic.RemoteWrite {
+			check(rw)
+		}
+	}
+	return res
+}
+
+// CheckLokiPush sends an empty push request to the Loki client endpoint to
+// verify that it is reachable and accepts the configured credentials.
+func CheckLokiPush(ctx context.Context, cc promtail_client.Config, timeout time.Duration) Result {
+	res := Result{Check: "loki push", Target: chainclient.RedactURL(cc.URL.String())}
+
+	client, err := commonconfig.NewClientFromConfig(cc.Client, userAgent)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "fix the HTTP client settings of the logs client"
+		return res
+	}
+	client.Timeout = timeout
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cc.URL.String(), strings.NewReader(`{"streams":[]}`))
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if cc.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", cc.TenantID)
+	}
+	for k, v := range cc.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return classifyPush(client, req, res, "--logs-sink-url")
+}
+
+// classifyPush performs a test push request and sets the status of res
+// depending on the response.
+func classifyPush(client *http.Client, req *http.Request, res Result, urlFlag string) Result {
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = fmt.Sprintf("check %s and outbound network access", urlFlag)
+		return res
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	res.Detail = strings.TrimSpace(fmt.Sprintf("%s %s", resp.Status, msg))
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		res.Status = StatusPass
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		res.Status = StatusFail
+		res.Hint = "credentials were rejected; check the configured username and password"
+	case resp.StatusCode == http.StatusNotFound:
+		res.Status = StatusFail
+		res.Hint = fmt.Sprintf("the endpoint does not exist; check the path of %s", urlFlag)
+	default:
+		res.Status = StatusWarn
+		res.Hint = "the endpoint is reachable but did not accept the test push"
+	}
+	return res
+}
+
+// CheckDocker verifies that the Docker daemon at host can be reached.
+func CheckDocker(ctx context.Context, host string, timeout time.Duration) Result {
+	res := Result{Check: "docker socket", Target: host}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		res.Hint = "set --docker-host to a valid address, e.g. unix:///var/run/docker.sock"
+		return res
+	}
+
+	transport := &http.Transport{}
+	base := "http://" + u.Host
+	switch u.Scheme {
+	case "unix":
+		if _, err := os.Stat(u.Path); err != nil {
+			res.Status = StatusFail
+			res.Detail = err.Error()
+			res.Hint = "check --docker-host and that the socket is mounted into the container"
+			return res
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", u.Path)
+		}
+		base = "http://docker"
+	case "tcp":
+	case "http", "https":
+		base = u.Scheme + "://" + u.Host
+	default:
+		res.Status = StatusFail
+		res.Detail = fmt.Sprintf("unsupported scheme %q", u.Scheme)
+		res.Hint = "set --docker-host to a unix:// or tcp:// address"
+		return res
+	}
+
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/_ping", nil)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return res
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		if strings.Contains(strings.ToLower(err.Error()), "permission denied") {
+			res.Hint = "add the user running telescope to the docker group"
+		} else {
+			res.Hint = "check that the Docker daemon is running"
+		}
+		return res
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		res.Status = StatusFail
+		res.Detail = resp.Status
+		res.Hint = "check that --docker-host points to a Docker daemon"
+		return res
+	}
+	res.Status = StatusPass
+	res.Detail = "daemon responded to ping"
+	return res
+}
+
+func checkLogs(ctx context.Context, cfg *config.Config, timeout time.Duration) []Result {
+	if cfg.Logs == nil {
+		return nil
+	}
+
+	var (
+		res        []Result
+		seenHosts  = map[string]struct{}{}
+		seenClient = map[string]struct{}{}
+	)
+	for _, ic := range cfg.Logs.Configs {
+		for _, cc := range ic.ClientConfigs {
+			if cc.URL.URL == nil {
+				continue
+			}
+			if _, ok := seenClient[cc.URL.String()]; ok {
+				continue
+			}
+			seenClient[cc.URL.String()] = struct{}{}
+			res = append(res, CheckLokiPush(ctx, cc, timeout))
+		}
+
+		for _, sc := range ic.ScrapeConfig {
+			for _, sd := range sc.DockerSDConfigs {
+				if _, ok := seenHosts[sd.Host]; ok {
+					continue
+				}
+				seenHosts[sd.Host] = struct{}{}
+				res = append(res, CheckDocker(ctx, sd.Host, timeout))
+			}
+		}
+	}
+	return res
+}
+
+// CheckNode verifies that the APIs of the chain clients in n respond and
+// report the same chain ID.
+func CheckNode(ctx context.Context, n Node, timeout time.Duration) []Result {
+	var (
+		res          []Result
+		client       = &http.Client{Timeout: timeout}
+		elID, clID   uint64
+		elErr, clErr error
+	)
+	name := n.Integration
+	if n.Instance != "" {
+		name = n.Instance
+	}
+
+	if n.ExecutionURL != "" {
+		elID, elErr = chainclient.ExecutionChainID(ctx, client, n.ExecutionURL)
+		r := Result{Check: "execution JSON-RPC", Target: fmt.Sprintf("%s (%s)", chainclient.RedactURL(n.ExecutionURL), name)}
+		if elErr != nil {
+			r.Status = StatusFail
+			r.Detail = elErr.Error()
+			r.Hint = "check --ethereum-execution-url and that the client's HTTP JSON-RPC API is enabled"
+		} else {
+			r.Status = StatusPass
+			r.Detail = fmt.Sprintf("chain ID %d", elID)
+		}
+		res = append(res, r)
+	}
+
+	if n.ConsensusURL != "" {
+		clID, clErr = chainclient.ConsensusChainID(ctx, client, n.ConsensusURL)
+		r := Result{Check: "consensus beacon API", Target: fmt.Sprintf("%s (%s)", chainclient.RedactURL(n.ConsensusURL), name)}
+		if clErr != nil {
+			r.Status = StatusFail
+			r.Detail = clErr.Error()
+			r.Hint = "check --ethereum-consensus-url and that the client's HTTP API is enabled"
+		} else {
+			r.Status = StatusPass
+			r.Detail = fmt.Sprintf("chain ID %d", clID)
+		}
+		res = append(res, r)
+	}
+
+	if expectedID, ok := chainclient.EthereumChainID(n.Chain); n.Chain != "" && ok {
+		for _, c := range []struct {
+			role string
+			id   uint64
+			ok   bool
+		}{
+			{chainclient.RoleExecution, elID, n.ExecutionURL != "" && elErr == nil},
+			{chainclient.RoleConsensus, clID, n.ConsensusURL != "" && clErr == nil},
+		} {
+			if c.ok && c.id != expectedID {
+				res = append(res, Result{
+					Check:  "chain ID",
+					Target: name,
+					Status: StatusFail,
+					Detail: fmt.Sprintf("%s client is on chain %s (%d), expected %s (%d)", c.role, chainclient.EthereumChainName(c.id), c.id, n.Chain, expectedID),
+					Hint:   "point the client at the expected network or change --ethereum-chain",
+				})
+			}
+		}
+	}
+
+	if n.ExecutionURL != "" && n.ConsensusURL != "" && elErr == nil && clErr == nil && elID != clID {
+		res = append(res, Result{
+			Check:  "chain ID",
+			Target: name,
+			Status: StatusFail,
+			Detail: fmt.Sprintf("execution client is on chain %d, consensus client is on chain %d", elID, clID),
+			Hint:   "point the execution and consensus URLs at clients of the same network",
+		})
+	}
+	return res
+}
@@ -0,0 +1,162 @@
+// Package doctor implements preflight checks of an Agent config. The checks
+// verify that the endpoints, sockets and directories the config refers to are
+// usable without starting any collection.
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/config"
+)
+
+// DefaultCheckTimeout is the default time a single check may take.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Status is the outcome of a check.
+type Status int
+
+// Supported statuses, ordered by severity.
+const (
+	StatusPass Status = iota
+	StatusWarn
+	StatusFail
+)
+
+// String implements fmt.Stringer.
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusWarn:
+		return "WARN"
+	case StatusFail:
+		return "FAIL"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Result is the result of a single check.
+type Result struct {
+	// Check is the name of the check, e.g., "scrape target".
+	Check string
+	// Target is the endpoint, socket or path which was checked.
+	Target string
+	Status Status
+	// Detail describes what was observed.
+	Detail string
+	// Hint describes how to remediate a warning or failure.
+	Hint string
+}
+
+// Report is a collection of check results.
+type Report struct {
+	Results []Result
+}
+
+// Add appends results to the report.
+func (r *Report) Add(results ...Result) {
+	r.Results = append(r.Results, results...)
+}
+
+// Failed returns true if any check in the report failed.
+func (r *Report) Failed() bool {
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of results with the given status.
+func (r *Report) Count(s Status) int {
+	var n int
+	for _, res := range r.Results {
+		if res.Status == s {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTable writes the report as a table to w, followed by a summary line.
+func (r *Report) WriteTable(w io.Writer) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tTARGET\tDETAIL\tHINT")
+	for _, res := range r.Results {
+		hint := res.Hint
+		if res.Status == StatusPass {
+			hint = ""
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Status, res.Check, res.Target, oneLine(res.Detail), hint)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Padding leaves trailing whitespace on rows without a hint.
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n",
+		r.Count(StatusPass), r.Count(StatusWarn), r.Count(StatusFail))
+	return err
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Node is a chain client whose APIs are checked.
+type Node struct {
+	// Integration and Instance identify where the node was configured.
+	Integration string
+	Instance    string
+
+	// Chain is the name or ID of the chain the node is expected to be on. If
+	// empty, only the execution and consensus clients are compared.
+	Chain string
+
+	ExecutionURL string
+	ConsensusURL string
+}
+
+// Options configures which checks are run.
+type Options struct {
+	// Config is the loaded Agent config.
+	Config *config.Config
+	// Nodes are the chain clients configured through integrations.
+	Nodes []Node
+	// CheckTimeout is the maximum time a single check may take. Defaults to
+	// DefaultCheckTimeout.
+	CheckTimeout time.Duration
+}
+
+// Run runs all checks for the given options.
+func Run(ctx context.Context, o Options) *Report {
+	if o.CheckTimeout == 0 {
+		o.CheckTimeout = DefaultCheckTimeout
+	}
+
+	var r Report
+	if o.Config != nil {
+		r.Add(checkDirectories(o.Config)...)
+		r.Add(checkScrapeTargets(ctx, o.Config, o.CheckTimeout)...)
+		r.Add(checkRemoteWrites(ctx, o.Config, o.CheckTimeout)...)
+		r.Add(checkLogs(ctx, o.Config, o.CheckTimeout)...)
+	}
+	for _, n := range o.Nodes {
+		r.Add(CheckNode(ctx, n, o.CheckTimeout)...)
+	}
+	return &r
+}
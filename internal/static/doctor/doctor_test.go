@@ -0,0 +1,194 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/flagext"
+	promtail_client "github.com/grafana/loki/clients/pkg/promtail/client"
+	commonconfig "github.com/prometheus/common/config"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFeatures(t *testing.T) {
+	raw := []byte(`
+integrations:
+  node_exporter:
+    enabled: true
+  ethereum_configs:
+    - instance: node_1
+`)
+
+	res := CheckFeatures(raw, nil)
+	require.Len(t, res, 1)
+	require.Equal(t, StatusFail, res[0].Status)
+	require.Contains(t, res[0].Hint, "integrations-next")
+
+	res = CheckFeatures(raw, []string{"integrations-next"})
+	require.Len(t, res, 1)
+	require.Equal(t, StatusPass, res[0].Status)
+
+	require.Empty(t, CheckFeatures([]byte("integrations: {node_exporter: {}}"), nil))
+}
+
+func TestCheckWritableDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wal")
+	require.Equal(t, StatusPass, CheckWritableDir("WAL directory", dir).Status)
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	require.Equal(t, StatusFail, CheckWritableDir("WAL directory", filepath.Join(file, "wal")).Status)
+
+	require.Equal(t, StatusWarn, CheckWritableDir("WAL directory", "").Status)
+}
+
+func TestCheckScrapeTarget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "up 1")
+	}))
+	defer srv.Close()
+
+	require.Equal(t, StatusPass, CheckScrapeTarget(context.Background(), srv.Client(), "job", srv.URL+"/metrics").Status)
+	require.Equal(t, StatusFail, CheckScrapeTarget(context.Background(), srv.Client(), "job", srv.URL+"/debug/metrics").Status)
+}
+
+func newPushServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestCheckRemoteWrite(t *testing.T) {
+	srv := newPushServer(t)
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/api/v1/write")
+	require.NoError(t, err)
+
+	rw := &promconfig.RemoteWriteConfig{
+		URL: &commonconfig.URL{URL: u},
+		HTTPClientConfig: commonconfig.HTTPClientConfig{
+			BasicAuth: &commonconfig.BasicAuth{Username: "user", Password: "pass"},
+		},
+	}
+	require.Equal(t, StatusPass, CheckRemoteWrite(context.Background(), rw, time.Second).Status)
+
+	rw.HTTPClientConfig.BasicAuth.Password = "wrong"
+	res := CheckRemoteWrite(context.Background(), rw, time.Second)
+	require.Equal(t, StatusFail, res.Status)
+	require.Contains(t, res.Hint, "credentials")
+}
+
+func TestCheckLokiPush(t *testing.T) {
+	srv := newPushServer(t)
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/loki/api/v1/push")
+	require.NoError(t, err)
+
+	cc := promtail_client.Config{
+		URL: flagext.URLValue{URL: u},
+		Client: commonconfig.HTTPClientConfig{
+			BasicAuth: &commonconfig.BasicAuth{Username: "user", Password: "pass"},
+		},
+	}
+	require.Equal(t, StatusPass, CheckLokiPush(context.Background(), cc, time.Second).Status)
+
+	cc.Client.BasicAuth = nil
+	require.Equal(t, StatusFail, CheckLokiPush(context.Background(), cc, time.Second).Status)
+}
+
+func TestCheckDocker(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			fmt.Fprint(w, "OK")
+			return
+		}
+		http.NotFound(w, r)
+	})}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	require.Equal(t, StatusPass, CheckDocker(context.Background(), "unix://"+sock, time.Second).Status)
+
+	res := CheckDocker(context.Background(), "unix://"+filepath.Join(t.TempDir(), "missing.sock"), time.Second)
+	require.Equal(t, StatusFail, res.Status)
+	require.Contains(t, res.Hint, "--docker-host")
+}
+
+func TestCheckNode(t *testing.T) {
+	el := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`)
+	}))
+	defer el.Close()
+	cl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"chain_id":"11155111"}}`)
+	}))
+	defer cl.Close()
+
+	res := CheckNode(context.Background(), Node{
+		Integration:  "ethereum",
+		Instance:     "node_1",
+		ExecutionURL: el.URL,
+		ConsensusURL: cl.URL,
+	}, time.Second)
+
+	require.Len(t, res, 3)
+	require.Equal(t, StatusPass, res[0].Status)
+	require.Equal(t, "chain ID 1", res[0].Detail)
+	require.Equal(t, StatusPass, res[1].Status)
+	require.Equal(t, StatusFail, res[2].Status)
+	require.Contains(t, res[2].Detail, "chain 11155111")
+
+	res = CheckNode(context.Background(), Node{
+		Integration:  "ethereum",
+		Chain:        "sepolia",
+		ExecutionURL: el.URL,
+	}, time.Second)
+
+	require.Len(t, res, 2)
+	require.Equal(t, StatusPass, res[0].Status)
+	require.Equal(t, StatusFail, res[1].Status)
+	require.Contains(t, res[1].Detail, "expected sepolia (11155111)")
+}
+
+func TestReport_WriteTable(t *testing.T) {
+	var r Report
+	r.Add(
+		Result{Check: "WAL directory", Target: "/tmp/wal", Status: StatusPass, Detail: "writable"},
+		Result{Check: "docker socket", Target: "unix:///var/run/docker.sock", Status: StatusFail, Detail: "no such file", Hint: "mount it"},
+	)
+	require.True(t, r.Failed())
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteTable(&buf))
+	require.Equal(t, `STATUS  CHECK          TARGET                       DETAIL        HINT
+PASS    WAL directory  /tmp/wal                     writable
+FAIL    docker socket  unix:///var/run/docker.sock  no such file  mount it
+
+1 passed, 0 warnings, 1 failed
+`, buf.String())
+}
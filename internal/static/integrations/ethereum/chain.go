@@ -0,0 +1,204 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// chainResolveTimeout is the maximum time spent querying each client for its
+// chain at startup.
+const chainResolveTimeout = 10 * time.Second
+
+// chainInfo is the chain a client reported at startup.
+type chainInfo struct {
+	role    string
+	id      uint64
+	genesis string
+}
+
+// resolveChain queries the chain ID and genesis of the configured clients and
+// checks them against the expected chain and each other. The name of the
+// resolved chain is stored in i.chain so it can be attached as a label to
+// the collected metrics.
+//
+// Clients which cannot be reached are skipped with a warning, since they may
+// still be starting up. A mismatch returns an error only if ChainMismatch is
+// set to "fail".
+func (i *Integration) resolveChain(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, chainResolveTimeout)
+	defer cancel()
+	client := &http.Client{Timeout: chainResolveTimeout}
+
+	var infos []chainInfo
+	if i.cfg.Execution.Enabled {
+		id, err := chainclient.ExecutionChainID(ctx, client, i.cfg.Execution.URL)
+		if err != nil {
+			level.Warn(i.log).Log("msg", "failed to resolve chain of execution client", "url", chainclient.RedactURL(i.cfg.Execution.URL), "err", err)
+		} else {
+			genesis, _ := chainclient.ExecutionGenesisHash(ctx, client, i.cfg.Execution.URL)
+			infos = append(infos, chainInfo{role: chainclient.RoleExecution, id: id, genesis: genesis})
+		}
+	}
+	if i.cfg.Consensus.Enabled {
+		id, err := chainclient.ConsensusChainID(ctx, client, i.cfg.Consensus.URL)
+		if err != nil {
+			level.Warn(i.log).Log("msg", "failed to resolve chain of consensus client", "url", chainclient.RedactURL(i.cfg.Consensus.URL), "err", err)
+		} else {
+			genesis, _ := chainclient.ConsensusGenesisRoot(ctx, client, i.cfg.Consensus.URL)
+			infos = append(infos, chainInfo{role: chainclient.RoleConsensus, id: id, genesis: genesis})
+		}
+	}
+
+	problems := chainProblems(i.cfg.Chain, infos)
+
+	i.chainMut.Lock()
+	switch {
+	case len(infos) > 0:
+		i.chain = chainclient.EthereumChainName(infos[0].id)
+	case i.cfg.Chain != "":
+		id, _ := chainclient.EthereumChainID(i.cfg.Chain)
+		i.chain = chainclient.EthereumChainName(id)
+	}
+	i.chainMut.Unlock()
+	if err := i.registerChainMetrics(infos, len(problems) > 0); err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		if i.chain != "" {
+			level.Info(i.log).Log("msg", "resolved chain of ethereum clients", "chain", i.chain)
+		}
+		return nil
+	}
+
+	msg := strings.Join(problems, "; ")
+	if i.cfg.ChainMismatch != ChainMismatchFail {
+		level.Warn(i.log).Log("msg", "ethereum clients are not on the expected chain", "err", msg)
+		return nil
+	}
+	return fmt.Errorf("chain mismatch: %s (set chain_mismatch: warn to collect metrics anyway)", msg)
+}
+
+// chainProblems returns a description of every mismatch between the
+// expected chain and the chains reported by the clients.
+func chainProblems(expected string, infos []chainInfo) []string {
+	var problems []string
+	if expected != "" {
+		expectedID, _ := chainclient.EthereumChainID(expected)
+		for _, info := range infos {
+			if info.id != expectedID {
+				problems = append(problems, fmt.Sprintf("%s client is on chain %s (%d), expected %s (%d)",
+					info.role, chainclient.EthereumChainName(info.id), info.id, chainclient.EthereumChainName(expectedID), expectedID))
+			}
+		}
+	}
+	if len(infos) == 2 && infos[0].id != infos[1].id {
+		problems = append(problems, fmt.Sprintf("%s client is on chain %d but %s client is on chain %d",
+			infos[0].role, infos[0].id, infos[1].role, infos[1].id))
+	}
+	return problems
+}
+
+// registerChainMetrics exports the chains reported by the clients. The
+// metrics registered by a previous run of the integration are reused.
+func (i *Integration) registerChainMetrics(infos []chainInfo, mismatch bool) error {
+	var chainInfoVec prometheus.Collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "eth_chain_info",
+		Help:        "Chain reported by the ethereum clients at startup.",
+		ConstLabels: prometheus.Labels{"node_name": "ethereum"},
+	}, []string{"ethereum_role", "chain", "chain_id", "genesis"})
+	if err := registerOrGet(i.reg, &chainInfoVec); err != nil {
+		return fmt.Errorf("failed to register chain metrics: %w", err)
+	}
+	infoVec := chainInfoVec.(*prometheus.GaugeVec)
+	infoVec.Reset()
+	for _, info := range infos {
+		infoVec.WithLabelValues(info.role, chainclient.EthereumChainName(info.id), strconv.FormatUint(info.id, 10), info.genesis).Set(1)
+	}
+
+	var chainMismatch prometheus.Collector = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "eth_chain_mismatch",
+		Help:        "Set to 1 if the ethereum clients are not on the expected chain or disagree with each other.",
+		ConstLabels: prometheus.Labels{"node_name": "ethereum"},
+	})
+	if err := registerOrGet(i.reg, &chainMismatch); err != nil {
+		return fmt.Errorf("failed to register chain metrics: %w", err)
+	}
+	if mismatch {
+		chainMismatch.(prometheus.Gauge).Set(1)
+	} else {
+		chainMismatch.(prometheus.Gauge).Set(0)
+	}
+	return nil
+}
+
+// registerOrGet registers *c, or replaces it with the collector already
+// registered in its place.
+func registerOrGet(reg prometheus.Registerer, c *prometheus.Collector) error {
+	err := reg.Register(*c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		*c = are.ExistingCollector
+		return nil
+	}
+	return err
+}
+
+// currentChain returns the chain the clients were resolved to, if any.
+func (i *Integration) currentChain() string {
+	i.chainMut.RLock()
+	defer i.chainMut.RUnlock()
+	return i.chain
+}
+
+// chainLabelGatherer adds the chain the clients were resolved to as a label
+// to the metrics whose name starts with prefix. The beacon library registers
+// the consensus client metrics itself, without a way to set const labels.
+type chainLabelGatherer struct {
+	prometheus.Gatherer
+	prefix string
+	chain  func() string
+}
+
+// Gather implements prometheus.Gatherer.
+func (g chainLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	chain := g.chain()
+	if chain == "" {
+		return mfs, err
+	}
+	for _, mf := range mfs {
+		if !strings.HasPrefix(mf.GetName(), g.prefix) {
+			continue
+		}
+		for _, m := range mf.Metric {
+			if hasLabel(m, "chain") {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String("chain"), Value: proto.String(chain)})
+			sort.Slice(m.Label, func(a, b int) bool { return m.Label[a].GetName() < m.Label[b].GetName() })
+		}
+	}
+	return mfs, err
+}
+
+func hasLabel(m *dto.Metric, name string) bool {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package ethereum
 
 import (
+	"fmt"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
 	"github.com/go-kit/log"
 	v2 "github.com/blockopsnetwork/telescope/internal/static/integrations/v2"
 	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/common"
@@ -8,7 +11,8 @@ import (
 
 // DefaultConfig is the default configuration for the ethereum integration
 var DefaultConfig = Config{
-	Enabled: false,
+	Enabled:       false,
+	ChainMismatch: ChainMismatchWarn,
 	Execution: ExecutionConfig{
 		Enabled:  false,
 		URL:      "http://localhost:8545",
@@ -38,8 +42,32 @@ type Config struct {
 
 	// Consensus client configuration
 	Consensus ConsensusConfig `yaml:"consensus"`
+
+	// Chain is the chain the clients are expected to run on, e.g. "mainnet"
+	// or "sepolia". A decimal chain ID is also accepted. When set, the chain
+	// IDs reported by the clients are checked against it at startup.
+	Chain string `yaml:"chain,omitempty"`
+
+	// ChainMismatch controls what happens when the clients report a
+	// different chain than Chain, or when the execution and consensus clients
+	// are on different chains. Defaults to warn.
+	ChainMismatch string `yaml:"chain_mismatch,omitempty"`
+
+	// Exemplars enables histograms of block arrival delays and RPC latencies
+	// for the enabled clients. Their exemplars carry the block hash, number
+	// or slot of the observed head and the trace ID sent with the RPC call.
+	Exemplars bool `yaml:"exemplars,omitempty"`
 }
 
+// Supported values of Config.ChainMismatch.
+const (
+	// ChainMismatchFail stops the integration on a chain mismatch.
+	ChainMismatchFail = "fail"
+	// ChainMismatchWarn logs a warning on a chain mismatch and keeps
+	// collecting metrics.
+	ChainMismatchWarn = "warn"
+)
+
 // ExecutionConfig holds the configuration for the execution client
 type ExecutionConfig struct {
 	Enabled  bool     `yaml:"enabled"`
@@ -95,6 +123,20 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultConfig
 
 	type config Config
-	return unmarshal((*config)(c))
+	if err := unmarshal((*config)(c)); err != nil {
+		return err
+	}
+
+	if c.Chain != "" {
+		if _, ok := chainclient.EthereumChainID(c.Chain); !ok {
+			return fmt.Errorf("unknown chain %q: must be a known chain name or a chain ID", c.Chain)
+		}
+	}
+	switch c.ChainMismatch {
+	case ChainMismatchFail, ChainMismatchWarn:
+	default:
+		return fmt.Errorf("invalid chain_mismatch %q: must be %q or %q", c.ChainMismatch, ChainMismatchFail, ChainMismatchWarn)
+	}
+	return nil
 }
 
@@ -0,0 +1,75 @@
+package ethereum
+
+import (
+	"context"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainmetrics"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Fallbacks used when the interval or timeout of a client can't be parsed.
+const (
+	defaultHeadInterval = 15 * time.Second
+	defaultHeadTimeout  = 5 * time.Second
+)
+
+// startHeadTrackers starts polling the head of the enabled clients, observing
+// block arrival delays and RPC latencies with exemplars linking them to the
+// observed blocks and the trace IDs of the calls.
+func (i *Integration) startHeadTrackers(ctx context.Context) {
+	if i.cfg.Execution.Enabled {
+		constLabels := i.headTrackerLabels("execution")
+		tracker := chainmetrics.NewExecutionTracker(
+			log.With(i.log, "ethereum_role", "execution"),
+			i.cfg.Execution.URL,
+			parseDurationOr(i.cfg.Execution.Interval, defaultHeadInterval),
+			parseDurationOr(i.cfg.Execution.Timeout, defaultHeadTimeout),
+			"eth_exe",
+			constLabels,
+		)
+		i.runHeadTracker(ctx, tracker, tracker.Run)
+	}
+
+	if i.cfg.Consensus.Enabled {
+		constLabels := i.headTrackerLabels("consensus")
+		tracker := chainmetrics.NewConsensusTracker(
+			log.With(i.log, "ethereum_role", "consensus"),
+			i.cfg.Consensus.URL,
+			parseDurationOr(i.cfg.Consensus.Interval, defaultHeadInterval),
+			parseDurationOr(i.cfg.Consensus.Timeout, defaultHeadTimeout),
+			"eth_con",
+			constLabels,
+		)
+		i.runHeadTracker(ctx, tracker, tracker.Run)
+	}
+}
+
+func (i *Integration) runHeadTracker(ctx context.Context, c prometheus.Collector, run func(context.Context)) {
+	if err := i.reg.Register(c); err != nil {
+		level.Warn(i.log).Log("msg", "failed to register head tracking metrics", "err", err)
+		return
+	}
+	go run(ctx)
+}
+
+func (i *Integration) headTrackerLabels(role string) prometheus.Labels {
+	constLabels := prometheus.Labels{
+		"ethereum_role": role,
+		"node_name":     "ethereum",
+	}
+	if i.chain != "" {
+		constLabels["chain"] = i.chain
+	}
+	return constLabels
+}
+
+func parseDurationOr(s string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
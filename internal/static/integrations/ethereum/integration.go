@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethpandaops/beacon/pkg/beacon"
@@ -52,6 +53,10 @@ type Integration struct {
 
 	// Track if metrics are already registered
 	metricsRegistered bool
+
+	// chain is the name of the chain the clients were resolved to at startup.
+	chainMut sync.RWMutex
+	chain    string
 }
 
 // New creates a new ethereum integration
@@ -82,6 +87,10 @@ func (i *Integration) RunIntegration(ctx context.Context) error {
 
 	level.Info(i.log).Log("msg", "starting ethereum integration")
 
+	if err := i.resolveChain(ctx); err != nil {
+		return err
+	}
+
 	if i.cfg.Execution.Enabled {
 		if err := i.setupExecutionClient(ctx); err != nil {
 			return fmt.Errorf("failed to setup execution client: %w", err)
@@ -101,6 +110,9 @@ func (i *Integration) RunIntegration(ctx context.Context) error {
 		}
 	}
 
+	if i.cfg.Exemplars {
+		i.startHeadTrackers(ctx)
+	}
 
 	// Mark as registered to prevent duplicate setup
 	i.metricsRegistered = true
@@ -133,6 +145,9 @@ func (i *Integration) setupExecutionClient(ctx context.Context) error {
 	constLabels := make(prometheus.Labels)
 	constLabels["ethereum_role"] = "execution"
 	constLabels["node_name"] = "ethereum"
+	if i.chain != "" {
+		constLabels["chain"] = i.chain
+	}
 
 	// Initialize all metrics collectors exactly like the original exporter
 	i.syncMetrics = jobs.NewSyncStatus(i.ethClient, internalAPI, i.ethRPCClient, logrusLogger, "eth_exe", constLabels)
@@ -255,7 +270,13 @@ func (i *Integration) Stop() {
 func (i *Integration) Handler(prefix string) (http.Handler, error) {
 	mux := http.NewServeMux()
 	// Use the global registry since autoscrape is disabled
-    mux.Handle(prefix+"/metrics", promhttp.Handler())
+	gatherer, ok := i.reg.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+	gatherer = chainLabelGatherer{Gatherer: gatherer, prefix: "eth_con_", chain: i.currentChain}
+	// OpenMetrics is negotiated so the exemplars of the head trackers are exposed.
+	mux.Handle(prefix+"/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
 	return mux, nil
 }
 
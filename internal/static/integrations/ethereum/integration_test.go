@@ -2,6 +2,12 @@ package ethereum
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,7 +16,10 @@ import (
 	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/autoscrape"
 	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func createTestGlobals() v2integrations.Globals {
@@ -249,4 +258,192 @@ func TestConfig_NewIntegration(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, integration)
 	assert.IsType(t, (*Integration)(nil), integration)
-}
\ No newline at end of file
+}
+func newChainServers(t *testing.T, elChainID, clChainID string) (el, cl *httptest.Server) {
+	t.Helper()
+	el = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "eth_chainId":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, elChainID)
+		case "eth_getBlockByNumber":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"hash":"0xd4e5"}}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+		}
+	}))
+	t.Cleanup(el.Close)
+	cl = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eth/v1/config/deposit_contract":
+			fmt.Fprintf(w, `{"data":{"chain_id":"%s"}}`, clChainID)
+		case "/eth/v1/beacon/genesis":
+			fmt.Fprint(w, `{"data":{"genesis_validators_root":"0x4b36"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(cl.Close)
+	return el, cl
+}
+
+func TestIntegration_ResolveChain(t *testing.T) {
+	el, cl := newChainServers(t, "0xaa36a7", "11155111")
+
+	integration := New(log.NewNopLogger(), &Config{
+		Enabled:   true,
+		Chain:     "sepolia",
+		Execution: ExecutionConfig{Enabled: true, URL: el.URL},
+		Consensus: ConsensusConfig{Enabled: true, URL: cl.URL},
+	}, createTestGlobals())
+	reg := prometheus.NewRegistry()
+	integration.reg = reg
+
+	require.NoError(t, integration.resolveChain(context.Background()))
+	assert.Equal(t, "sepolia", integration.chain)
+
+	expect := `
+# HELP eth_chain_mismatch Set to 1 if the ethereum clients are not on the expected chain or disagree with each other.
+# TYPE eth_chain_mismatch gauge
+eth_chain_mismatch{node_name="ethereum"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expect), "eth_chain_mismatch"))
+	assert.Equal(t, 2, testutil.CollectAndCount(reg, "eth_chain_info"))
+}
+
+func TestIntegration_ResolveChain_Mismatch(t *testing.T) {
+	el, cl := newChainServers(t, "0x1", "11155111")
+
+	cfg := &Config{
+		Enabled:       true,
+		Chain:         "mainnet",
+		ChainMismatch: ChainMismatchFail,
+		Execution:     ExecutionConfig{Enabled: true, URL: el.URL},
+		Consensus:     ConsensusConfig{Enabled: true, URL: cl.URL},
+	}
+	integration := New(log.NewNopLogger(), cfg, createTestGlobals())
+	integration.reg = prometheus.NewRegistry()
+
+	err := integration.RunIntegration(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "consensus client is on chain sepolia (11155111), expected mainnet (1)")
+
+	// With the warn policy collection continues and the mismatch is exported.
+	cfg.ChainMismatch = ChainMismatchWarn
+	integration = New(log.NewNopLogger(), cfg, createTestGlobals())
+	reg := prometheus.NewRegistry()
+	integration.reg = reg
+
+	require.NoError(t, integration.resolveChain(context.Background()))
+	expect := `
+# HELP eth_chain_mismatch Set to 1 if the ethereum clients are not on the expected chain or disagree with each other.
+# TYPE eth_chain_mismatch gauge
+eth_chain_mismatch{node_name="ethereum"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expect), "eth_chain_mismatch"))
+}
+
+func TestIntegration_ResolveChain_Reload(t *testing.T) {
+	el, cl := newChainServers(t, "0xaa36a7", "11155111")
+	cfg := &Config{
+		Enabled:   true,
+		Chain:     "sepolia",
+		Execution: ExecutionConfig{Enabled: true, URL: el.URL},
+		Consensus: ConsensusConfig{Enabled: true, URL: cl.URL},
+	}
+	reg := prometheus.NewRegistry()
+
+	// The chain metrics registered by a previous integration are reused.
+	for n := 0; n < 2; n++ {
+		integration := New(log.NewNopLogger(), cfg, createTestGlobals())
+		integration.reg = reg
+		require.NoError(t, integration.resolveChain(context.Background()))
+	}
+	assert.Equal(t, 2, testutil.CollectAndCount(reg, "eth_chain_info"))
+
+	// Other registration errors are returned.
+	reg = prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "eth_chain_mismatch", Help: "Conflicting help."}))
+	integration := New(log.NewNopLogger(), cfg, createTestGlobals())
+	integration.reg = reg
+	require.ErrorContains(t, integration.resolveChain(context.Background()), "failed to register chain metrics")
+}
+
+func TestIntegration_Handler_ConsensusChainLabel(t *testing.T) {
+	el, cl := newChainServers(t, "0xaa36a7", "11155111")
+
+	integration := New(log.NewNopLogger(), &Config{
+		Enabled:   true,
+		Chain:     "sepolia",
+		Execution: ExecutionConfig{Enabled: true, URL: el.URL},
+		Consensus: ConsensusConfig{Enabled: true, URL: cl.URL},
+	}, createTestGlobals())
+	reg := prometheus.NewRegistry()
+	integration.reg = reg
+	require.NoError(t, integration.resolveChain(context.Background()))
+
+	// Stands in for the metrics the beacon library registers itself.
+	headSlot := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "eth_con_beacon_slot",
+		Help: "The slot number in the block.",
+	}, []string{"block_id"})
+	headSlot.WithLabelValues("head").Set(42)
+	other := prometheus.NewGauge(prometheus.GaugeOpts{Name: "other_metric", Help: "Not from the consensus client."})
+	reg.MustRegister(headSlot, other)
+
+	handler, err := integration.Handler("/integrations/ethereum")
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/integrations/ethereum/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `eth_con_beacon_slot{block_id="head",chain="sepolia"} 42`)
+	assert.Contains(t, body, "other_metric 0")
+}
+
+func TestIntegration_Handler_Exemplars(t *testing.T) {
+	el, _ := newChainServers(t, "0xaa36a7", "11155111")
+
+	integration := New(log.NewNopLogger(), &Config{
+		Enabled:   true,
+		Exemplars: true,
+		Execution: ExecutionConfig{Enabled: true, URL: el.URL, Interval: "1h", Timeout: "5s"},
+	}, createTestGlobals())
+	integration.reg = prometheus.NewRegistry()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	integration.startHeadTrackers(ctx)
+
+	handler, err := integration.Handler("/integrations/ethereum")
+	require.NoError(t, err)
+	scrape := func(accept string) string {
+		req := httptest.NewRequest(http.MethodGet, "/integrations/ethereum/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// The first poll of the head runs when the tracker starts. Exemplars are
+	// only written in the OpenMetrics format.
+	exemplarRegexp := regexp.MustCompile(`eth_exe_rpc_request_duration_seconds_bucket\{.*\} 1 # \{(trace_id="[0-9a-f]{32}",block_hash="0xd4e5"|block_hash="0xd4e5",trace_id="[0-9a-f]{32}")\}`)
+	require.Eventually(t, func() bool {
+		return exemplarRegexp.MatchString(scrape("application/openmetrics-text"))
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotRegexp(t, exemplarRegexp, scrape("text/plain"))
+}
+
+func TestConfig_UnmarshalYAML_Chain(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("chain: holesky\nchain_mismatch: warn\n"), &cfg))
+	assert.Equal(t, "holesky", cfg.Chain)
+	assert.Equal(t, ChainMismatchWarn, cfg.ChainMismatch)
+
+	require.Error(t, yaml.Unmarshal([]byte("chain: ropsten\n"), &cfg))
+	require.Error(t, yaml.Unmarshal([]byte("chain_mismatch: ignore\n"), &cfg))
+}
@@ -39,6 +39,7 @@ import (
 	//
 
 	_ "github.com/blockopsnetwork/telescope/internal/static/integrations/ethereum"              // register ethereum
+	_ "github.com/blockopsnetwork/telescope/internal/static/integrations/substrate"             // register substrate
 	_ "github.com/blockopsnetwork/telescope/internal/static/integrations/v2/agent"              // register agent
 	_ "github.com/blockopsnetwork/telescope/internal/static/integrations/v2/apache_http"        // register apache_exporter
 	_ "github.com/blockopsnetwork/telescope/internal/static/integrations/v2/app_agent_receiver" // register app_agent_receiver
@@ -0,0 +1,250 @@
+// Package substrate implements an integration which collects the metrics of
+// Substrate-based nodes, such as Polkadot relay chain and parachain nodes.
+//
+// Substrate nodes expose Prometheus metrics themselves; the integration
+// serves them through the Agent so they are collected with the integration's
+// labels and autoscrape settings. With exemplars enabled, the integration
+// also tracks the best block of the node with latency histograms carrying
+// exemplars.
+package substrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/blockopsnetwork/telescope/internal/static/chainmetrics"
+	integrations_v2 "github.com/blockopsnetwork/telescope/internal/static/integrations/v2"
+	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/common"
+	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/metricsutils"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// headInterval is how often the best block of the node is polled when
+// exemplars are enabled, the block time of Polkadot.
+const headInterval = 6 * time.Second
+
+// DefaultConfig holds the default settings for the substrate integration.
+var DefaultConfig = Config{
+	MetricsURL: "http://localhost:9615/metrics",
+	Timeout:    10 * time.Second,
+}
+
+// Config controls the substrate integration.
+type Config struct {
+	// MetricsURL is the Prometheus endpoint of the node.
+	MetricsURL string `yaml:"metrics_url,omitempty"`
+	// RPCURL is the JSON-RPC endpoint of the node. When set, the chain the
+	// node runs is checked against Chain.
+	RPCURL string `yaml:"rpc_url,omitempty"`
+	// Chain is the name of the chain the node is expected to run, as
+	// returned by system_chain, e.g., "Polkadot". When set, it is attached to
+	// the collected metrics as the chain label.
+	Chain string `yaml:"chain,omitempty"`
+	// Timeout is the maximum time a request to the node may take.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Exemplars tracks the best block of the node at RPCURL, observing
+	// block arrival delays and RPC latencies with exemplars linking them to
+	// the blocks and the trace IDs of the calls.
+	Exemplars bool `yaml:"exemplars,omitempty"`
+
+	Common common.MetricsConfig `yaml:",inline"`
+}
+
+// ApplyDefaults applies the integration's default configuration.
+func (c *Config) ApplyDefaults(globals integrations_v2.Globals) error {
+	c.Common.ApplyDefaults(globals.SubsystemOpts.Metrics.Autoscrape)
+	if c.Chain != "" && !c.Common.ExtraLabels.Has("chain") {
+		c.Common.ExtraLabels = append(c.Common.ExtraLabels, labels.Label{Name: "chain", Value: c.Chain})
+	}
+	return nil
+}
+
+// Identifier returns a string that identifies the integration.
+func (c *Config) Identifier(globals integrations_v2.Globals) (string, error) {
+	if c.Common.InstanceKey != nil {
+		return *c.Common.InstanceKey, nil
+	}
+	u, err := url.Parse(c.MetricsURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler for Config.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Exemplars && c.RPCURL == "" {
+		return fmt.Errorf("exemplars require rpc_url")
+	}
+	return validateURL(c.MetricsURL)
+}
+
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid metrics_url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid metrics_url %q: must be an http or https URL", rawURL)
+	}
+	return nil
+}
+
+// Name returns the name of the integration this config is for.
+func (c *Config) Name() string {
+	return "substrate"
+}
+
+// NewIntegration instantiates a new integrations.MetricsIntegration which
+// serves the metrics of the node.
+func (c *Config) NewIntegration(logger log.Logger, globals integrations_v2.Globals) (integrations_v2.Integration, error) {
+	if err := validateURL(c.MetricsURL); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	handler := newHandler(client, c.MetricsURL)
+	var tracker *chainmetrics.SubstrateTracker
+	if c.Exemplars {
+		if c.RPCURL == "" {
+			return nil, fmt.Errorf("exemplars require rpc_url")
+		}
+		tracker = chainmetrics.NewSubstrateTracker(logger, c.RPCURL, headInterval, c.Timeout, "substrate", nil)
+		handler = newTrackerHandler(client, c.MetricsURL, tracker)
+	}
+
+	mi, err := metricsutils.NewMetricsHandlerIntegration(logger, c, c.Common, globals, handler)
+	if err != nil {
+		return nil, err
+	}
+	return &integration{MetricsIntegration: mi, logger: logger, client: client, cfg: c, tracker: tracker}, nil
+}
+
+// integration checks the chain of the node when it starts running, and
+// tracks its best block if exemplars are enabled.
+type integration struct {
+	integrations_v2.MetricsIntegration
+	logger  log.Logger
+	client  *http.Client
+	cfg     *Config
+	tracker *chainmetrics.SubstrateTracker
+}
+
+// RunIntegration implements Integration.
+func (i *integration) RunIntegration(ctx context.Context) error {
+	if i.tracker != nil {
+		go i.tracker.Run(ctx)
+	}
+	if i.cfg.RPCURL != "" && i.cfg.Chain != "" {
+		checkChain(ctx, i.logger, i.client, i.cfg.RPCURL, i.cfg.Chain)
+	}
+	return i.MetricsIntegration.RunIntegration(ctx)
+}
+
+// checkChain logs a warning if the node is not running the expected chain.
+// Failing to reach the node is not an error, since it may still be starting.
+func checkChain(ctx context.Context, logger log.Logger, client *http.Client, rpcURL, expected string) {
+	ctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	defer cancel()
+
+	chain, err := chainclient.SubstrateChain(ctx, client, rpcURL)
+	switch {
+	case err != nil:
+		level.Warn(logger).Log("msg", "failed to query chain of substrate node", "url", chainclient.RedactURL(rpcURL), "err", err)
+	case chain != expected:
+		level.Warn(logger).Log("msg", "substrate node is not on the expected chain", "chain", chain, "expected", expected)
+	}
+}
+
+// newHandler returns a handler which serves the metrics of the node at
+// metricsURL.
+func newHandler(client *http.Client, metricsURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, metricsURL, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if accept := r.Header.Get("Accept"); accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to scrape substrate node: %s", err), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			http.Error(w, fmt.Sprintf("substrate node returned %s", resp.Status), http.StatusBadGateway)
+			return
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		_, _ = io.Copy(w, resp.Body)
+	})
+}
+
+// newTrackerHandler returns a handler which serves the metrics of the node at
+// metricsURL along with the metrics of tracker. Exemplars are exposed when the
+// OpenMetrics format is requested.
+func newTrackerHandler(client *http.Client, metricsURL string, tracker prometheus.Collector) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tracker)
+	node := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return gatherNode(client, metricsURL)
+	})
+	return promhttp.HandlerFor(prometheus.Gatherers{node, reg}, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// gatherNode scrapes the metrics of the node at metricsURL.
+func gatherNode(client *http.Client, metricsURL string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape substrate node: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("substrate node returned %s", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse substrate node metrics: %w", err)
+	}
+	res := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		res = append(res, mf)
+	}
+	return res, nil
+}
+
+func init() {
+	integrations_v2.Register(&Config{}, integrations_v2.TypeMultiplex)
+}
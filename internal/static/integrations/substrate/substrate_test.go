@@ -0,0 +1,176 @@
+package substrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	integrations_v2 "github.com/blockopsnetwork/telescope/internal/static/integrations/v2"
+	"github.com/blockopsnetwork/telescope/internal/static/integrations/v2/autoscrape"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig_UnmarshalYAML(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("rpc_url: http://node:9933\nchain: Polkadot\n"), &cfg))
+	require.Equal(t, DefaultConfig.MetricsURL, cfg.MetricsURL)
+	require.Equal(t, "Polkadot", cfg.Chain)
+
+	id, err := cfg.Identifier(integrations_v2.Globals{})
+	require.NoError(t, err)
+	require.Equal(t, "localhost:9615", id)
+
+	require.Error(t, yaml.Unmarshal([]byte("metrics_url: node:9615\n"), &cfg))
+	require.EqualError(t, yaml.Unmarshal([]byte("exemplars: true\n"), &cfg), "exemplars require rpc_url")
+}
+
+func TestIntegration(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics":
+			fmt.Fprintln(w, `substrate_block_height{status="best"} 100`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"Polkadot"}`)
+		}
+	}))
+	defer node.Close()
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf("metrics_url: %s/metrics\nrpc_url: %s\nchain: Polkadot\n", node.URL, node.URL)), &cfg))
+
+	globals := integrations_v2.Globals{
+		SubsystemOpts: integrations_v2.SubsystemOptions{
+			Metrics: integrations_v2.MetricsSubsystemOptions{Autoscrape: autoscrape.DefaultGlobal},
+		},
+	}
+	require.NoError(t, cfg.ApplyDefaults(globals))
+	require.Equal(t, "Polkadot", cfg.Common.ExtraLabels.Get("chain"))
+
+	i, err := cfg.NewIntegration(log.NewNopLogger(), globals)
+	require.NoError(t, err)
+
+	mi := i.(integrations_v2.MetricsIntegration)
+	groups := mi.Targets(integrations_v2.Endpoint{Host: "agent:12345", Prefix: "/integrations/substrate/"})
+	require.Len(t, groups, 1)
+	require.Equal(t, "Polkadot", string(groups[0].Labels["chain"]))
+
+	h, err := mi.Handler("/integrations/substrate/")
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/integrations/substrate/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, _ := io.ReadAll(rec.Body)
+	require.Contains(t, string(body), "substrate_block_height")
+
+	// The handler reports an unreachable node as a failed scrape.
+	node.Close()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/integrations/substrate/metrics", nil))
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestIntegration_CheckChain(t *testing.T) {
+	var rpcCalls atomic.Int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rpcCalls.Inc()
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"Kusama"}`)
+	}))
+	defer node.Close()
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf("rpc_url: %s\nchain: Polkadot\n", node.URL)), &cfg))
+
+	var buf syncBuffer
+	i, err := cfg.NewIntegration(log.NewLogfmtLogger(&buf), integrations_v2.Globals{})
+	require.NoError(t, err)
+	// Creating the integration doesn't wait for the node.
+	require.Zero(t, rpcCalls.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- i.RunIntegration(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), "substrate node is not on the expected chain")
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestIntegration_Exemplars(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			fmt.Fprintln(w, `substrate_block_height{status="best"} 100`)
+			return
+		}
+		var req struct {
+			Method string `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.Method {
+		case "chain_getBlockHash":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%064x"}`, 100)
+		case "chain_getHeader":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"0x64"}}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"Polkadot"}`)
+		}
+	}))
+	defer node.Close()
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf("metrics_url: %s/metrics\nrpc_url: %s\nexemplars: true\n", node.URL, node.URL)), &cfg))
+
+	i, err := cfg.NewIntegration(log.NewNopLogger(), integrations_v2.Globals{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = i.RunIntegration(ctx) }()
+
+	h, err := i.(integrations_v2.MetricsIntegration).Handler("/integrations/substrate/")
+	require.NoError(t, err)
+
+	// The metrics of the node are served along with the ones of the
+	// tracker, whose request durations carry exemplars in OpenMetrics.
+	require.Eventually(t, func() bool {
+		req := httptest.NewRequest(http.MethodGet, "/integrations/substrate/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		body := rec.Body.String()
+		return rec.Code == http.StatusOK &&
+			strings.Contains(body, `substrate_block_height{status="best"} 100`) &&
+			strings.Contains(body, `block_hash="0x`+strings.Repeat("0", 62)+`64"}`) &&
+			strings.Contains(body, `# {trace_id="`)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mut sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.String()
+}
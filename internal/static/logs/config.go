@@ -4,7 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"path/filepath"
+	"time"
 
+	sourcelimit "github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/wal"
+	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
+	"github.com/blockopsnetwork/telescope/internal/static/otlp"
+	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/loki/clients/pkg/promtail/client"
 	"github.com/grafana/loki/clients/pkg/promtail/limit"
 	"github.com/grafana/loki/clients/pkg/promtail/positions"
@@ -39,17 +45,22 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 //  3. No InstanceConfig may have an empty name.
 //  4. If InstanceConfig positions path is empty, shared PositionsDirectory
 //     must not be empty.
+//  5. No two InstanceConfigs may have the same WAL directory.
 //
 // Defaults:
 //
 //  1. If a positions config is empty, it will be generated based on
 //     the InstanceConfig name and Config.PositionsDirectory.
-//  2. If an InstanceConfigs's ClientConfigs is empty, it will be generated based on
-//     the Config.GlobalConfig.ClientConfigs.
+//  2. If an InstanceConfigs's ClientConfigs and OTLP are empty, its
+//     ClientConfigs will be generated based on the
+//     Config.GlobalConfig.ClientConfigs.
+//  3. If the WAL of an InstanceConfig is enabled without a directory, it will
+//     be stored in a wal directory next to the positions file.
 func (c *Config) ApplyDefaults() error {
 	var (
 		names     = map[string]struct{}{}
 		positions = map[string]string{} // positions file name -> config using it
+		walDirs   = map[string]string{} // WAL directory -> config using it
 	)
 
 	for idx, ic := range c.Configs {
@@ -72,9 +83,23 @@ func (c *Config) ApplyDefaults() error {
 		}
 		positions[ic.PositionsConfig.PositionsFile] = ic.Name
 
-		if len(ic.ClientConfigs) == 0 {
+		if len(ic.ClientConfigs) == 0 && len(ic.OTLP) == 0 {
 			ic.ClientConfigs = c.Global.ClientConfigs
 		}
+
+		if ic.WAL.Enabled {
+			if ic.WAL.Dir == "" {
+				ic.WAL.Dir = filepath.Join(filepath.Dir(ic.PositionsConfig.PositionsFile), "wal", ic.Name)
+			}
+			if orig, ok := walDirs[ic.WAL.Dir]; ok {
+				return fmt.Errorf("Loki configs %s and %s must have different WAL directories", orig, ic.Name)
+			}
+			walDirs[ic.WAL.Dir] = ic.Name
+
+			if ic.WAL.MinReadFrequency >= ic.WAL.MaxReadFrequency {
+				return fmt.Errorf("WAL min_read_frequency of Loki config %s must be lower than max_read_frequency", ic.Name)
+			}
+		}
 	}
 
 	return nil
@@ -89,6 +114,187 @@ type InstanceConfig struct {
 	ScrapeConfig    []scrapeconfig.Config `yaml:"scrape_configs,omitempty"`
 	TargetConfig    file.Config           `yaml:"target_config,omitempty"`
 	LimitsConfig    limit.Config          `yaml:"limits_config,omitempty"`
+	WAL             WALConfig             `yaml:"wal,omitempty"`
+	Redact          *RedactConfig         `yaml:"redact,omitempty"`
+	ChainEvents     *ChainEventsConfig    `yaml:"chain_events,omitempty"`
+	Dedup           *DedupConfig          `yaml:"dedup,omitempty"`
+
+	// SourceLimits limits the bytes sent per stream and per group of streams
+	// to the clients and OTLP endpoints.
+	SourceLimits *sourcelimit.SourceConfig `yaml:"source_limits,omitempty"`
+
+	// OTLP endpoints receiving the entries alongside the clients.
+	OTLP []otlp.Config `yaml:"otlp,omitempty"`
+}
+
+// stageConfigs returns the configs of the stages processing the entries of
+// the instance before they're sent. Chain events are detected in redacted
+// lines, before repeated lines are collapsed.
+func (c *InstanceConfig) stageConfigs() []stages.StageConfig {
+	var res []stages.StageConfig
+	if c.Redact != nil {
+		cfg := c.Redact.stageConfig()
+		res = append(res, stages.StageConfig{RedactConfig: &cfg})
+	}
+	if c.ChainEvents != nil {
+		cfg := c.ChainEvents.stageConfig()
+		res = append(res, stages.StageConfig{ChainEventsConfig: &cfg})
+	}
+	if c.Dedup != nil {
+		cfg := stages.DedupConfig(*c.Dedup)
+		res = append(res, stages.StageConfig{DedupConfig: &cfg})
+	}
+	return res
+}
+
+// RedactConfig configures the redaction of secrets and key material from the
+// entries of an instance before they're sent.
+type RedactConfig struct {
+	// Detectors to run, all of them if empty.
+	Detectors []string `yaml:"detectors,omitempty"`
+	// Replacement of the redacted secrets, and its overrides per detector.
+	Replacement  string            `yaml:"replacement,omitempty"`
+	Replacements map[string]string `yaml:"replacements,omitempty"`
+}
+
+func (c *RedactConfig) stageConfig() stages.RedactConfig {
+	return stages.RedactConfig{
+		Detectors:    c.Detectors,
+		Replacement:  c.Replacement,
+		Replacements: c.Replacements,
+	}
+}
+
+// ChainEventsConfig configures the detection of critical chain events, like
+// missed attestations or database corruption, in the entries of an instance,
+// and the webhooks notified of them.
+type ChainEventsConfig struct {
+	// ClientLabel is the label holding the client of a stream, which rules
+	// are restricted to.
+	ClientLabel  string              `yaml:"client_label,omitempty"`
+	DefaultRules bool                `yaml:"default_rules"`
+	Rules        []ChainEventRule    `yaml:"rules,omitempty"`
+	Webhooks     []ChainEventWebhook `yaml:"webhooks,omitempty"`
+	Silences     []ChainEventSilence `yaml:"silences,omitempty"`
+
+	GroupBy        []string      `yaml:"group_by,omitempty"`
+	GroupWait      time.Duration `yaml:"group_wait,omitempty"`
+	RepeatInterval time.Duration `yaml:"repeat_interval,omitempty"`
+}
+
+// ChainEventRule fires when threshold lines of a client match expression
+// within window.
+type ChainEventRule struct {
+	Name       string        `yaml:"name"`
+	Expression string        `yaml:"expression"`
+	Clients    []string      `yaml:"clients,omitempty"`
+	Threshold  int           `yaml:"threshold,omitempty"`
+	Window     time.Duration `yaml:"window,omitempty"`
+	Severity   string        `yaml:"severity,omitempty"`
+	Summary    string        `yaml:"summary,omitempty"`
+}
+
+// ChainEventWebhook is notified of chain events in the json, slack or
+// pagerduty format.
+type ChainEventWebhook struct {
+	URL        string            `yaml:"url,omitempty"`
+	Format     string            `yaml:"format,omitempty"`
+	RoutingKey string            `yaml:"routing_key,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	Timeout    time.Duration     `yaml:"timeout,omitempty"`
+}
+
+// ChainEventSilence mutes the notifications of chain events between two RFC
+// 3339 timestamps.
+type ChainEventSilence struct {
+	Rules    []string `yaml:"rules,omitempty"`
+	Clients  []string `yaml:"clients,omitempty"`
+	StartsAt string   `yaml:"starts_at"`
+	EndsAt   string   `yaml:"ends_at"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *ChainEventsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	def := stages.DefaultChainEventsConfig
+	*c = ChainEventsConfig{
+		ClientLabel:    def.ClientLabel,
+		DefaultRules:   def.DefaultRules,
+		GroupBy:        def.GroupBy,
+		GroupWait:      def.GroupWait,
+		RepeatInterval: def.RepeatInterval,
+	}
+	type chainEventsConfig ChainEventsConfig
+	if err := unmarshal((*chainEventsConfig)(c)); err != nil {
+		return err
+	}
+	cfg := c.stageConfig()
+	return cfg.Validate()
+}
+
+func (c *ChainEventsConfig) stageConfig() stages.ChainEventsConfig {
+	cfg := stages.ChainEventsConfig{
+		ClientLabel:    c.ClientLabel,
+		DefaultRules:   c.DefaultRules,
+		GroupBy:        c.GroupBy,
+		GroupWait:      c.GroupWait,
+		RepeatInterval: c.RepeatInterval,
+	}
+	for _, r := range c.Rules {
+		cfg.Rules = append(cfg.Rules, stages.ChainEventRule(r))
+	}
+	for _, h := range c.Webhooks {
+		cfg.Webhooks = append(cfg.Webhooks, stages.ChainEventWebhook(h))
+	}
+	for _, s := range c.Silences {
+		cfg.Silences = append(cfg.Silences, stages.ChainEventSilence(s))
+	}
+	return cfg
+}
+
+// DedupConfig configures the collapsing of the identical lines of a stream
+// read within a window into the first of them.
+type DedupConfig struct {
+	Window time.Duration `yaml:"window,omitempty"`
+	// Normalize ignores numbers and hex strings when comparing lines.
+	Normalize  bool `yaml:"normalize,omitempty"`
+	MaxEntries int  `yaml:"max_entries,omitempty"`
+	// AppendFields appends the repeat count and the first and last timestamps
+	// to the collapsed lines.
+	AppendFields bool `yaml:"append_fields"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *DedupConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DedupConfig(stages.DefaultDedupConfig)
+	type dedupConfig DedupConfig
+	return unmarshal((*dedupConfig)(c))
+}
+
+// DefaultWALConfig holds the default settings of the WAL of an instance.
+var DefaultWALConfig = WALConfig{
+	MaxSegmentAge:    wal.DefaultMaxSegmentAge,
+	MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
+	MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
+	DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+}
+
+// WALConfig configures a write-ahead log on disk for the entries read by an
+// instance. Entries are written to the WAL before being sent, so they aren't
+// lost while Loki is unreachable, and the entries which weren't sent yet are
+// replayed on restart.
+type WALConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty"`
+	Dir     string `yaml:"dir,omitempty"`
+
+	// MaxSize limits the size of the WAL on disk. When exceeded, the oldest
+	// segments are removed even if they weren't sent yet.
+	MaxSize flagext.Bytes `yaml:"max_size,omitempty"`
+	// MaxSegmentAge is how long segments are kept after being written.
+	MaxSegmentAge time.Duration `yaml:"max_segment_age,omitempty"`
+
+	MinReadFrequency time.Duration `yaml:"min_read_frequency,omitempty"`
+	MaxReadFrequency time.Duration `yaml:"max_read_frequency,omitempty"`
+	DrainTimeout     time.Duration `yaml:"drain_timeout,omitempty"`
 }
 
 func (c *InstanceConfig) Initialize() {
@@ -100,6 +306,8 @@ func (c *InstanceConfig) Initialize() {
 
 	// Blank out the positions file since we set our own default for that.
 	c.PositionsConfig.PositionsFile = ""
+
+	c.WAL = DefaultWALConfig
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
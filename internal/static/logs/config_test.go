@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	sourcelimit "github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
 	pc "github.com/prometheus/common/config"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
@@ -191,3 +193,79 @@ name: config-c
 	require.Equal(t, false, cfg.PositionsConfig.IgnoreInvalidYaml)
 	require.Equal(t, false, cfg.TargetConfig.Stdin)
 }
+
+func TestInstanceConfig_ChainEvents(t *testing.T) {
+	cfgText := untab(`
+name: default
+redact: {}
+dedup: {}
+chain_events:
+	rules:
+	- name: peer_drop
+		expression: "peer count dropped"
+		clients: [nethermind]
+		threshold: 3
+	webhooks:
+	- url: https://hooks.slack.com/services/T000/B000/XXXX
+		format: slack
+	- format: pagerduty
+		routing_key: R0UT1NG
+`)
+	var cfg InstanceConfig
+	require.NoError(t, yaml.UnmarshalStrict([]byte(cfgText), &cfg))
+
+	stageConfigs := cfg.stageConfigs()
+	require.Len(t, stageConfigs, 3)
+	require.NotNil(t, stageConfigs[0].RedactConfig)
+	require.NotNil(t, stageConfigs[2].DedupConfig)
+
+	chainEvents := stageConfigs[1].ChainEventsConfig
+	require.NotNil(t, chainEvents)
+	require.True(t, chainEvents.DefaultRules)
+	require.Equal(t, "client_name", chainEvents.ClientLabel)
+	require.Equal(t, time.Hour, chainEvents.RepeatInterval)
+	require.Equal(t, []stages.ChainEventRule{{
+		Name:       "peer_drop",
+		Expression: "peer count dropped",
+		Clients:    []string{"nethermind"},
+		Threshold:  3,
+	}}, chainEvents.Rules)
+	require.Len(t, chainEvents.Webhooks, 2)
+	require.Equal(t, stages.ChainEventFormatPagerDuty, chainEvents.Webhooks[1].Format)
+
+	invalid := untab(`
+name: default
+chain_events:
+	webhooks:
+	- format: pagerduty
+`)
+	require.ErrorContains(t, yaml.UnmarshalStrict([]byte(invalid), &cfg), "routing_key of pagerduty webhook must be set")
+}
+
+func TestInstanceConfig_SourceLimits(t *testing.T) {
+	cfgText := untab(`
+name: default
+source_limits:
+	stream_rate: 64KB
+	group_by: [container]
+	group_rate: 1MB
+	policy: park
+`)
+	var cfg InstanceConfig
+	require.NoError(t, yaml.UnmarshalStrict([]byte(cfgText), &cfg))
+	require.Equal(t, &sourcelimit.SourceConfig{
+		StreamRate:     64 << 10,
+		GroupBy:        []string{"container"},
+		GroupRate:      1 << 20,
+		Policy:         sourcelimit.SourcePolicyPark,
+		MaxParkedBytes: sourcelimit.DefaultSourceConfig.MaxParkedBytes,
+	}, cfg.SourceLimits)
+
+	invalid := untab(`
+name: default
+source_limits:
+	stream_rate: 64KB
+	policy: queue
+`)
+	require.ErrorContains(t, yaml.UnmarshalStrict([]byte(invalid), &cfg), `unsupported source limits policy "queue"`)
+}
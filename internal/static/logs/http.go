@@ -1,7 +1,9 @@
 package logs
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"sort"
 
 	"github.com/go-kit/log/level"
@@ -15,6 +17,7 @@ import (
 func (l *Logs) WireAPI(r *mux.Router) {
 	r.HandleFunc("/agent/api/v1/logs/instances", l.ListInstancesHandler).Methods("GET")
 	r.HandleFunc("/agent/api/v1/logs/targets", l.ListTargetsHandler).Methods("GET")
+	r.HandleFunc("/agent/api/v1/logs/instances/{instance}/tail", l.TailHandler).Methods("GET")
 }
 
 // ListInstancesHandler writes the set of currently running instances to the http.ResponseWriter.
@@ -38,7 +41,7 @@ func (l *Logs) ListTargetsHandler(w http.ResponseWriter, r *http.Request) {
 	instances := l.instances
 	allTargets := make(map[string]TargetSet, len(instances))
 	for instName, inst := range instances {
-		allTargets[instName] = inst.promtail.ActiveTargets()
+		allTargets[instName] = inst.pipeline.ActiveTargets()
 	}
 	listTargetsHandler(allTargets).ServeHTTP(w, r)
 }
@@ -65,6 +68,24 @@ func listTargetsHandler(targets map[string]TargetSet) http.Handler {
 	})
 }
 
+// TailHandler streams samples of the entries going through the processing
+// stages of an instance, with the changes made by each stage. See
+// stages.Tap for the format of the stream.
+func (l *Logs) TailHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(mux.Vars(r)["instance"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not decode instance name: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	inst := l.Instance(name)
+	if inst == nil {
+		http.Error(w, fmt.Sprintf("logs instance %q not found", name), http.StatusNotFound)
+		return
+	}
+	inst.Tap().ServeHTTP(w, r)
+}
+
 // TargetSet is a set of targets for an individual scraper.
 type TargetSet map[string][]target.Target
 
@@ -1,13 +1,22 @@
 package logs
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
 	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/gorilla/mux"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
 	"github.com/grafana/loki/clients/pkg/promtail/targets/target"
+	"github.com/grafana/loki/pkg/logproto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
@@ -175,3 +184,81 @@ func (mt *mockTarget) Details() interface{} {
 		"/var/log/syslog":           788450,
 	}
 }
+
+func TestAgent_TailHandler(t *testing.T) {
+	cfgText := util.Untab(fmt.Sprintf(`
+configs:
+- name: instance-a
+  positions:
+    filename: %s
+  clients:
+	- url: http://127.0.0.1:80/loki/api/v1/push
+  redact:
+    detectors: [bearer_token]
+- name: instance-b
+  positions:
+    filename: %s
+  clients:
+	- url: http://127.0.0.1:80/loki/api/v1/push
+	`, filepath.Join(t.TempDir(), "positions-a.yaml"), filepath.Join(t.TempDir(), "positions-b.yaml")))
+
+	var cfg Config
+	dec := yaml.NewDecoder(strings.NewReader(cfgText))
+	dec.SetStrict(true)
+	require.NoError(t, dec.Decode(&cfg))
+
+	// The entries are only logged in dry run mode, so stopping doesn't wait
+	// for them to be pushed.
+	logger := util.TestLogger(t)
+	l, err := New(prometheus.NewRegistry(), &cfg, logger, true)
+	require.NoError(t, err)
+	defer l.Stop()
+
+	router := mux.NewRouter()
+	l.WireAPI(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	t.Run("unknown instance", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/agent/api/v1/logs/instances/instance-c/tail")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	// tail reads the first event streamed for an entry sent to the instance.
+	tail := func(t *testing.T, instance, line string) (stages.TapEvent, string) {
+		resp, err := http.Get(srv.URL + "/agent/api/v1/logs/instances/" + instance + "/tail?sample=1")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		sent := l.Instance(instance).SendEntry(api.Entry{
+			Labels: model.LabelSet{"job": "geth"},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: line},
+		}, time.Second)
+		require.True(t, sent)
+
+		raw, err := bufio.NewReader(resp.Body).ReadString('\n')
+		require.NoError(t, err)
+		var ev stages.TapEvent
+		require.NoError(t, json.Unmarshal([]byte(raw), &ev))
+		return ev, raw
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ev, raw := tail(t, "instance-a", "auth=Bearer abc123")
+		require.NotContains(t, raw, "abc123", "secrets scrubbed by the redact stage must not be streamed")
+		require.Equal(t, "auth=Bearer **REDACTED**", ev.Line)
+		require.Len(t, ev.Steps, 1)
+		require.Equal(t, stages.StageTypeRedact, ev.Steps[0].Stage)
+		require.Equal(t, "auth=Bearer **REDACTED**", *ev.Steps[0].Line)
+	})
+
+	t.Run("without stages", func(t *testing.T) {
+		ev, _ := tail(t, "instance-b", "imported block")
+		require.Equal(t, "imported block", ev.Line)
+		require.Equal(t, model.LabelSet{"job": "geth"}, ev.Labels)
+		require.Empty(t, ev.Steps)
+	})
+}
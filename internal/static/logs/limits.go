@@ -0,0 +1,48 @@
+package logs
+
+import (
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/client"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+	"github.com/go-kit/log"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// limitedSink passes entries through the source limits of an instance to
+// another sink.
+type limitedSink struct {
+	next    entrySink
+	entries chan loki.Entry
+	done    chan struct{}
+}
+
+func newLimitedSink(next entrySink, cfg limit.SourceConfig, l log.Logger, reg prometheus.Registerer) *limitedSink {
+	s := &limitedSink{
+		next:    next,
+		entries: make(chan loki.Entry),
+		done:    make(chan struct{}),
+	}
+	limiter := client.NewSourceLimiter(cfg, l, client.NewSourceLimiterMetrics(reg))
+	out := limiter.Run(s.entries)
+	go func() {
+		defer close(s.done)
+		for e := range out {
+			next.Send(api.Entry(e))
+		}
+	}()
+	return s
+}
+
+// Send implements entrySink.
+func (s *limitedSink) Send(e api.Entry) {
+	s.entries <- loki.Entry(e)
+}
+
+// Stop implements entrySink. The parked entries are sent before the next
+// sink stops.
+func (s *limitedSink) Stop() {
+	close(s.entries)
+	<-s.done
+	s.next.Stop()
+}
@@ -12,9 +12,10 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/blockopsnetwork/telescope/internal/agentseed"
+	processstages "github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
 	"github.com/blockopsnetwork/telescope/internal/useragent"
 	"github.com/blockopsnetwork/telescope/internal/util"
-	"github.com/grafana/loki/clients/pkg/promtail"
+	"github.com/grafana/loki/clients/pkg/logentry/stages"
 	"github.com/grafana/loki/clients/pkg/promtail/api"
 	"github.com/grafana/loki/clients/pkg/promtail/client"
 	"github.com/grafana/loki/clients/pkg/promtail/config"
@@ -121,7 +122,12 @@ type Instance struct {
 	log log.Logger
 	reg *util.Unregisterer
 
-	promtail *promtail.Promtail
+	pipeline pipeline
+
+	// tap streams the entries going through the processing stages for
+	// debugging. It outlives the pipeline so that streams aren't cut when the
+	// config is applied.
+	tap *processstages.Tap
 }
 
 // NewInstance creates and starts a Logs instance.
@@ -131,6 +137,7 @@ func NewInstance(reg prometheus.Registerer, c *InstanceConfig, g GlobalConfig, l
 	inst := Instance{
 		reg: util.WrapWithUnregisterer(instReg),
 		log: log.With(l, "logs_config", c.Name),
+		tap: processstages.NewTap(),
 	}
 	if err := inst.ApplyConfig(c, g, dryRun); err != nil {
 		return nil, err
@@ -167,9 +174,9 @@ func (i *Instance) ApplyConfig(c *InstanceConfig, g GlobalConfig, dryRun bool) e
 		level.Warn(i.log).Log("msg", "failed to create the positions directory. logs may be unable to save their position", "path", positionsDir, "err", err)
 	}
 
-	if i.promtail != nil {
-		i.promtail.Shutdown()
-		i.promtail = nil
+	if i.pipeline != nil {
+		i.pipeline.Shutdown()
+		i.pipeline = nil
 	}
 
 	// Unregister all existing metrics before trying to create a new instance.
@@ -179,8 +186,8 @@ func (i *Instance) ApplyConfig(c *InstanceConfig, g GlobalConfig, dryRun bool) e
 		return fmt.Errorf("failed to unregister all metrics from previous promtail. THIS IS A BUG")
 	}
 
-	if len(c.ClientConfigs) == 0 {
-		level.Debug(i.log).Log("msg", "skipping creation of a promtail because no client_configs are present")
+	if len(c.ClientConfigs) == 0 && len(c.OTLP) == 0 {
+		level.Debug(i.log).Log("msg", "skipping creation of a promtail because no client_configs or otlp endpoints are present")
 		return nil
 	}
 
@@ -193,7 +200,6 @@ func (i *Instance) ApplyConfig(c *InstanceConfig, g GlobalConfig, dryRun bool) e
 		c.ClientConfigs[i].Headers[agentseed.HeaderName] = uid
 	}
 
-	clientMetrics := client.NewMetrics(i.reg)
 	cfg := DefaultConfig()
 	cfg.Global = config.GlobalConfig{
 		FileWatch: file.WatchConfig{
@@ -207,26 +213,90 @@ func (i *Instance) ApplyConfig(c *InstanceConfig, g GlobalConfig, dryRun bool) e
 	cfg.TargetConfig = c.TargetConfig
 	cfg.LimitsConfig = c.LimitsConfig
 
-	p, err := promtail.New(cfg, nil, clientMetrics, dryRun, promtail.WithLogger(i.log), promtail.WithRegisterer(i.reg))
+	cfg.Setup(i.log)
+	if cfg.LimitsConfig.ReadlineRateEnabled {
+		stages.SetReadLineRateLimiter(cfg.LimitsConfig.ReadlineRate, cfg.LimitsConfig.ReadlineBurst, cfg.LimitsConfig.ReadlineRateDrop)
+	}
+	if dryRun {
+		cfg.PositionsConfig.ReadOnly = true
+	}
+
+	var processing *processstages.Pipeline
+	if stageCfgs := c.stageConfigs(); len(stageCfgs) > 0 {
+		processing, err = processstages.NewPipeline(i.log, stageCfgs, nil, i.reg)
+		if err != nil {
+			return fmt.Errorf("invalid processing config: %w", err)
+		}
+		processing.SetTap(i.tap)
+	}
+
+	sink, err := i.newSink(cfg, c, dryRun)
 	if err != nil {
 		return fmt.Errorf("unable to create logs instance: %w", err)
 	}
 
-	i.promtail = p
+	p, err := newTargetsPipeline(cfg, sink, processing, i.tap, i.log, i.reg)
+	if err != nil {
+		return fmt.Errorf("unable to create logs instance: %w", err)
+	}
+	i.pipeline = p
 	return nil
 }
 
-// SendEntry passes an entry to the internal promtail client and returns true if successfully sent. It is
-// best effort and not guaranteed to succeed.
+// newSink returns the sink sending the entries of the instance to its
+// clients and OTLP endpoints, within the source limits of the instance.
+// Nothing is sent to the OTLP endpoints in dry run mode.
+func (i *Instance) newSink(cfg config.Config, c *InstanceConfig, dryRun bool) (entrySink, error) {
+	var sinks multiSink
+	if len(c.ClientConfigs) > 0 {
+		var (
+			sink entrySink
+			err  error
+		)
+		if c.WAL.Enabled && !dryRun {
+			sink, err = newWALSink(cfg, c.WAL, i.log, i.reg)
+		} else {
+			sink, err = newClientSink(cfg, dryRun, i.log, i.reg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if !dryRun {
+		for idx, otlpCfg := range c.OTLP {
+			sink, err := newOTLPSink(fmt.Sprintf("%s/%d", c.Name, idx), otlpCfg, i.log)
+			if err != nil {
+				sinks.Stop()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+	}
+
+	var sink entrySink = sinks
+	if len(sinks) == 1 {
+		sink = sinks[0]
+	}
+	if c.SourceLimits != nil && c.SourceLimits.Enabled() {
+		sink = newLimitedSink(sink, *c.SourceLimits, i.log, i.reg)
+	}
+	return sink, nil
+}
+
+// SendEntry passes an entry through the processing stages of the instance and
+// then to its clients, and returns true if successfully sent. It is best
+// effort and not guaranteed to succeed.
 func (i *Instance) SendEntry(entry api.Entry, dur time.Duration) bool {
 	i.mut.Lock()
 	defer i.mut.Unlock()
 
-	// promtail is nil it has been stopped
-	if i.promtail != nil {
+	// pipeline is nil it has been stopped
+	if i.pipeline != nil {
 		// send non blocking so we don't block the mutex. this is best effort
 		select {
-		case i.promtail.Client().Chan() <- entry:
+		case i.pipeline.Chan() <- entry:
 			return true
 		case <-time.After(dur):
 		}
@@ -235,14 +305,20 @@ func (i *Instance) SendEntry(entry api.Entry, dur time.Duration) bool {
 	return false
 }
 
+// Tap returns the tap streaming the entries going through the processing
+// stages of the instance.
+func (i *Instance) Tap() *processstages.Tap {
+	return i.tap
+}
+
 // Stop stops the Promtail instance.
 func (i *Instance) Stop() {
 	i.mut.Lock()
 	defer i.mut.Unlock()
 
-	if i.promtail != nil {
-		i.promtail.Shutdown()
-		i.promtail = nil
+	if i.pipeline != nil {
+		i.pipeline.Shutdown()
+		i.pipeline = nil
 	}
 	i.reg.UnregisterAll()
 }
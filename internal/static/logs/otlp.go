@@ -0,0 +1,173 @@
+package logs
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/otlp"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	loki_translator "github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/loki"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Attributes set on the logs sent to OTLP endpoints, following the
+// conventions of the OpenTelemetry Collector.
+const (
+	// hintAttributes lists the attributes which were Loki labels, so that
+	// they can be promoted back to labels by a Loki exporter.
+	hintAttributes = "loki.attribute.labels"
+
+	serviceNameAttribute       = "service.name"
+	serviceInstanceIDAttribute = "service.instance.id"
+	logFilePathAttribute       = "log.file.path"
+	logFileNameAttribute       = "log.file.name"
+)
+
+// otlpSink batches entries and sends them to an OTLP endpoint.
+//
+// Entries aren't kept in the WAL of the instance, so the entries which
+// weren't sent yet are lost when the sink stops.
+type otlpSink struct {
+	log log.Logger
+	cfg otlp.Config
+	exp *otlp.LogsExporter
+
+	entries chan api.Entry
+	wg      sync.WaitGroup
+}
+
+func newOTLPSink(name string, cfg otlp.Config, l log.Logger) (*otlpSink, error) {
+	exp, err := otlp.NewLogsExporter(l, name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &otlpSink{
+		log:     log.With(l, "otlp_endpoint", cfg.Endpoint),
+		cfg:     cfg,
+		exp:     exp,
+		entries: make(chan api.Entry),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+func (s *otlpSink) run() {
+	defer s.wg.Done()
+
+	batch := make([]api.Entry, 0, s.cfg.BatchSize)
+	ticker := time.NewTicker(s.cfg.BatchWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-s.entries:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= s.cfg.BatchSize {
+				s.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *otlpSink) send(batch []api.Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.exp.ConsumeLogs(context.Background(), entriesToLogs(batch)); err != nil {
+		level.Error(s.log).Log("msg", "failed to send entries to otlp endpoint", "entries", len(batch), "err", err)
+	}
+}
+
+// Send implements entrySink.
+func (s *otlpSink) Send(e api.Entry) {
+	s.entries <- e
+}
+
+// Stop implements entrySink. The entries buffered are sent before the
+// exporter stops.
+func (s *otlpSink) Stop() {
+	close(s.entries)
+	s.wg.Wait()
+	if err := s.exp.Shutdown(context.Background()); err != nil {
+		level.Error(s.log).Log("msg", "failed to stop otlp exporter", "err", err)
+	}
+}
+
+// multiSink sends entries to several sinks.
+type multiSink []entrySink
+
+// Send implements entrySink.
+func (s multiSink) Send(e api.Entry) {
+	for _, sink := range s {
+		sink.Send(e)
+	}
+}
+
+// Stop implements entrySink.
+func (s multiSink) Stop() {
+	for _, sink := range s {
+		sink.Stop()
+	}
+}
+
+// entriesToLogs converts entries to OpenTelemetry logs. The job and instance
+// labels of an entry set the service.name and service.instance.id attributes
+// of its resource. All the labels, including job and instance, become
+// attributes of the log record, listed by the loki.attribute.labels
+// attribute, as done by otelcol.receiver.loki.
+func entriesToLogs(entries []api.Entry) plog.Logs {
+	type resourceKey struct{ job, instance model.LabelValue }
+
+	logs := plog.NewLogs()
+	scopes := make(map[resourceKey]plog.ScopeLogs)
+	for _, e := range entries {
+		key := resourceKey{job: e.Labels[model.JobLabel], instance: e.Labels[model.InstanceLabel]}
+		sl, ok := scopes[key]
+		if !ok {
+			rl := logs.ResourceLogs().AppendEmpty()
+			if key.job != "" {
+				rl.Resource().Attributes().PutStr(serviceNameAttribute, string(key.job))
+			}
+			if key.instance != "" {
+				rl.Resource().Attributes().PutStr(serviceInstanceIDAttribute, string(key.instance))
+			}
+			sl = rl.ScopeLogs().AppendEmpty()
+			scopes[key] = sl
+		}
+
+		lr := sl.LogRecords().AppendEmpty()
+		if filename, ok := e.Labels["filename"]; ok {
+			lr.Attributes().PutStr(logFilePathAttribute, string(filename))
+			lr.Attributes().PutStr(logFileNameAttribute, path.Base(string(filename)))
+		}
+		if len(e.Labels) > 0 {
+			names := make([]string, 0, len(e.Labels))
+			for name := range e.Labels {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			lr.Attributes().PutStr(hintAttributes, strings.Join(names, ","))
+		}
+		for _, md := range e.StructuredMetadata {
+			lr.Attributes().PutStr(md.Name, md.Value)
+		}
+		loki_translator.ConvertEntryToLogRecord(&e.Entry, &lr, e.Labels, true)
+	}
+	return logs
+}
@@ -0,0 +1,142 @@
+package logs
+
+import (
+	"sync"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/loki/process/stages"
+	"github.com/go-kit/log"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	"github.com/grafana/loki/clients/pkg/promtail/client"
+	"github.com/grafana/loki/clients/pkg/promtail/config"
+	"github.com/grafana/loki/clients/pkg/promtail/targets"
+	"github.com/grafana/loki/clients/pkg/promtail/targets/target"
+	promtailwal "github.com/grafana/loki/clients/pkg/promtail/wal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipeline reads the entries of the targets of an instance and sends them to
+// its clients.
+type pipeline interface {
+	// Chan returns a channel to send entries without reading them from a
+	// target.
+	Chan() chan<- api.Entry
+	ActiveTargets() map[string][]target.Target
+	Shutdown()
+}
+
+// entrySink sends the entries read by a targetsPipeline to the clients.
+type entrySink interface {
+	Send(api.Entry)
+	Stop()
+}
+
+// targetsPipeline is a pipeline running the targets of an instance, and
+// passing their entries through the processing stages of the instance, if
+// any, to a sink.
+type targetsPipeline struct {
+	sink           entrySink
+	stages         *stages.Pipeline
+	tap            *stages.Tap
+	targetManagers *targets.TargetManagers
+
+	entries  chan api.Entry
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// newTargetsPipeline starts the targets of cfg. The sink is stopped when the
+// pipeline is shut down. processing may be nil, in which case the entries are
+// recorded to tap as they're sent to the sink.
+func newTargetsPipeline(cfg config.Config, sink entrySink, processing *stages.Pipeline, tap *stages.Tap, l log.Logger, reg prometheus.Registerer) (*targetsPipeline, error) {
+	p := &targetsPipeline{
+		sink:    sink,
+		stages:  processing,
+		tap:     tap,
+		entries: make(chan api.Entry),
+	}
+	p.wg.Add(1)
+	go p.run()
+
+	var err error
+	p.targetManagers, err = targets.NewTargetManagers(p, reg, l, cfg.PositionsConfig, api.NewEntryHandler(p.entries, func() {}), cfg.ScrapeConfig, &cfg.TargetConfig, cfg.Global.FileWatch)
+	if err != nil {
+		p.Shutdown()
+		return nil, err
+	}
+	return p, nil
+}
+
+// run passes the entries read from the targets to the sink.
+func (p *targetsPipeline) run() {
+	defer p.wg.Done()
+	if p.stages == nil {
+		for e := range p.entries {
+			p.tap.Record(loki.Entry(e))
+			p.sink.Send(e)
+		}
+		return
+	}
+
+	in := make(chan stages.Entry)
+	go func() {
+		defer close(in)
+		for e := range p.entries {
+			in <- stages.Entry{Extracted: map[string]interface{}{}, Entry: loki.Entry(e)}
+		}
+	}()
+	// Stages holding entries, like dedup, send them when in is closed.
+	for e := range p.stages.Run(in) {
+		p.sink.Send(api.Entry(e.Entry))
+	}
+}
+
+// Chan returns a channel to send entries through the pipeline.
+func (p *targetsPipeline) Chan() chan<- api.Entry {
+	return p.entries
+}
+
+// ActiveTargets returns the active targets per job.
+func (p *targetsPipeline) ActiveTargets() map[string][]target.Target {
+	if p.targetManagers == nil {
+		return nil
+	}
+	return p.targetManagers.ActiveTargets()
+}
+
+// Shutdown stops reading from the targets, then stops the sink.
+func (p *targetsPipeline) Shutdown() {
+	p.stopOnce.Do(func() {
+		if p.targetManagers != nil {
+			p.targetManagers.Stop()
+		}
+		close(p.entries)
+		p.wg.Wait()
+
+		p.sink.Stop()
+	})
+}
+
+// clientSink keeps the entries in memory until they're sent by the clients.
+type clientSink struct {
+	client.Client
+}
+
+func newClientSink(cfg config.Config, dryRun bool, l log.Logger, reg prometheus.Registerer) (clientSink, error) {
+	var (
+		metrics = client.NewMetrics(reg)
+		c       client.Client
+		err     error
+	)
+	if dryRun {
+		c, err = client.NewLogger(metrics, l, cfg.ClientConfigs...)
+	} else {
+		c, err = client.NewManager(metrics, l, cfg.LimitsConfig, reg, promtailwal.Config{}, client.NilNotifier, cfg.ClientConfigs...)
+	}
+	return clientSink{c}, err
+}
+
+// Send implements entrySink.
+func (s clientSink) Send(e api.Entry) {
+	s.Chan() <- e
+}
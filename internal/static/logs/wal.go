@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"fmt"
+
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/client"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/limit"
+	"github.com/blockopsnetwork/telescope/internal/component/common/loki/wal"
+	"github.com/go-kit/log"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	promtailclient "github.com/grafana/loki/clients/pkg/promtail/client"
+	"github.com/grafana/loki/clients/pkg/promtail/config"
+	promtaillimit "github.com/grafana/loki/clients/pkg/promtail/limit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// walQueueCapacity is the size in bytes of the batches buffered by each client
+// while reading from the WAL.
+const walQueueCapacity = 10 << 20
+
+// walSink writes entries to a WAL on disk, from which they are read and sent
+// by the clients.
+//
+// Each client marks the segments it sent, so the entries which weren't sent
+// before a restart are replayed from the WAL when the sink starts again.
+type walSink struct {
+	writer  *wal.Writer
+	manager *client.Manager
+}
+
+func newWALSink(cfg config.Config, walCfg WALConfig, l log.Logger, reg prometheus.Registerer) (*walSink, error) {
+	writerCfg := wal.Config{
+		Enabled:       true,
+		Dir:           walCfg.Dir,
+		MaxSegmentAge: walCfg.MaxSegmentAge,
+		MaxSize:       uint64(walCfg.MaxSize),
+		WatchConfig: wal.WatchConfig{
+			MinReadFrequency: walCfg.MinReadFrequency,
+			MaxReadFrequency: walCfg.MaxReadFrequency,
+			DrainTimeout:     walCfg.DrainTimeout,
+			// Send what was written before a restart even if Loki was never
+			// reachable.
+			ReplayUnmarked: true,
+		},
+	}
+
+	writer, err := wal.NewWriter(writerCfg, l, reg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wal writer: %w", err)
+	}
+
+	manager, err := client.NewManager(client.NewMetrics(reg), l, convertLimitsConfig(cfg.LimitsConfig), reg, writerCfg, writer, convertClientConfigs(cfg.ClientConfigs, walCfg)...)
+	if err != nil {
+		writer.Stop()
+		return nil, fmt.Errorf("failed to create client manager: %w", err)
+	}
+	writer.SetMarker(manager)
+
+	return &walSink{writer: writer, manager: manager}, nil
+}
+
+// Send implements entrySink.
+func (s *walSink) Send(e api.Entry) {
+	s.writer.Chan() <- loki.Entry(e)
+}
+
+// Stop implements entrySink. Entries which weren't sent yet are kept in the
+// WAL.
+func (s *walSink) Stop() {
+	s.writer.Stop()
+	s.manager.Stop()
+}
+
+// convertLimitsConfig converts the Promtail limits config of an instance to
+// the limits of the clients reading from the WAL.
+func convertLimitsConfig(cfg promtaillimit.Config) limit.Config {
+	return limit.Config{
+		ReadlineRate:        cfg.ReadlineRate,
+		ReadlineBurst:       cfg.ReadlineBurst,
+		ReadlineRateEnabled: cfg.ReadlineRateEnabled,
+		ReadlineRateDrop:    cfg.ReadlineRateDrop,
+		MaxStreams:          cfg.MaxStreams,
+		MaxLineSize:         cfg.MaxLineSize,
+		MaxLineSizeTruncate: cfg.MaxLineSizeTruncate,
+	}
+}
+
+// convertClientConfigs converts the Promtail client configs of an instance to
+// configs of the clients reading from the WAL.
+func convertClientConfigs(cfgs []promtailclient.Config, walCfg WALConfig) []client.Config {
+	res := make([]client.Config, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		res = append(res, client.Config{
+			Name:                   cfg.Name,
+			URL:                    cfg.URL,
+			BatchWait:              cfg.BatchWait,
+			BatchSize:              cfg.BatchSize,
+			Client:                 cfg.Client,
+			Headers:                cfg.Headers,
+			BackoffConfig:          cfg.BackoffConfig,
+			ExternalLabels:         cfg.ExternalLabels,
+			Timeout:                cfg.Timeout,
+			TenantID:               cfg.TenantID,
+			DropRateLimitedBatches: cfg.DropRateLimitedBatches,
+			Queue: client.QueueConfig{
+				Capacity:     walQueueCapacity,
+				DrainTimeout: walCfg.DrainTimeout,
+			},
+		})
+	}
+	return res
+}
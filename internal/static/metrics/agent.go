@@ -21,6 +21,7 @@ import (
 	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance"
 	"github.com/blockopsnetwork/telescope/internal/util"
 	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/promql"
 )
 
 // DefaultConfig is the default settings for the Prometheus-lite client.
@@ -145,6 +146,9 @@ type Agent struct {
 
 	cluster *cluster.Cluster
 
+	// Evaluates queries of the local query API.
+	queryEngine *promql.Engine
+
 	stopped  bool
 	stopOnce sync.Once
 	actor    chan func()
@@ -166,6 +170,11 @@ func newAgent(reg prometheus.Registerer, cfg Config, logger log.Logger, fact ins
 		reg:             reg,
 		actor:           make(chan func(), 1),
 	}
+	a.queryEngine = promql.NewEngine(promql.EngineOpts{
+		Logger:     log.With(a.logger, "component", "query engine"),
+		MaxSamples: queryMaxSamples,
+		Timeout:    queryTimeout,
+	})
 
 	a.bm = instance.NewBasicManager(instance.BasicManagerConfig{
 		InstanceRestartBackoff: cfg.InstanceRestartBackoff,
@@ -204,7 +213,23 @@ func (a *Agent) newInstance(c instance.Config) (instance.ManagedInstance, error)
 		instanceLabel: c.Name,
 	}, a.reg)
 
-	return a.instanceFactory(reg, c, a.cfg.WALDir, a.logger)
+	inst, err := a.instanceFactory(reg, c, a.cfg.WALDir, a.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// In the scraping service, targets may be sharded across the cluster
+	// instead of whole configs.
+	if s, ok := inst.(targetSharded); ok && a.cfg.ServiceConfig.Enabled {
+		s.SetTargetOwner(a.cluster, a.cluster.TargetHandover())
+	}
+	return inst, nil
+}
+
+// targetSharded is implemented by instances whose targets can be sharded
+// across a cluster.
+type targetSharded interface {
+	SetTargetOwner(owner instance.TargetOwner, handover time.Duration)
 }
 
 // Validate will validate the incoming Config and mutate it to apply defaults.
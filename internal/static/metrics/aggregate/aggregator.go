@@ -0,0 +1,385 @@
+package aggregate
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// idleInterval is how long Run waits between checks when no rules are set.
+const idleInterval = time.Minute
+
+// Aggregator is a storage.Appendable which aggregates the samples appended to
+// it according to its rules and forwards everything else to the next
+// Appendable. Samples are aggregated in the window holding their timestamp,
+// and aggregates are written to the next Appendable when their window ends,
+// with the end of the window as their timestamp.
+//
+// Series named <metric>:<aggregation>_<interval> are written for each group,
+// e.g. p2p_peers:sum_1m; quantiles are written as
+// <metric>:quantile_<interval> with a quantile label.
+type Aggregator struct {
+	log     log.Logger
+	next    storage.Appendable
+	metrics *metrics
+
+	mut    sync.RWMutex
+	config []Rule
+	rules  []*rule
+	wake   chan struct{}
+}
+
+var _ storage.Appendable = (*Aggregator)(nil)
+
+// New creates a new Aggregator without rules, which forwards everything to
+// next.
+func New(l log.Logger, reg prometheus.Registerer, next storage.Appendable) *Aggregator {
+	return &Aggregator{
+		log:     l,
+		next:    next,
+		metrics: newMetrics(reg),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// ApplyRules replaces the rules of the Aggregator. Unless the rules are
+// unchanged, the samples of the open windows of the previous rules are
+// discarded.
+func (a *Aggregator) ApplyRules(rules []Rule) error {
+	a.mut.RLock()
+	unchanged := reflect.DeepEqual(a.config, rules)
+	a.mut.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	now := time.Now()
+
+	compiled := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		c, err := newRule(r, now)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+
+	a.mut.Lock()
+	a.config = append([]Rule(nil), rules...)
+	a.rules = compiled
+	a.mut.Unlock()
+	a.metrics.groups.Set(0)
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run writes the aggregates of each window as it ends until ctx is canceled.
+func (a *Aggregator) Run(ctx context.Context) {
+	for {
+		wait := a.flush(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// flush writes the aggregates of the windows which ended by now and returns
+// how long to wait until the next window ends.
+func (a *Aggregator) flush(now time.Time) time.Duration {
+	a.mut.Lock()
+	outputs := a.closeWindows(now)
+	next := now.Add(idleInterval)
+	var groups int
+	for _, r := range a.rules {
+		for _, w := range r.windows {
+			if w.end.Before(next) {
+				next = w.end
+			}
+			groups += len(w.groups)
+		}
+	}
+	a.mut.Unlock()
+	a.metrics.groups.Set(float64(groups))
+
+	a.write(outputs)
+	return next.Sub(now)
+}
+
+// output is an aggregate waiting to be written.
+type output struct {
+	labels labels.Labels
+	ts     int64
+	value  float64
+}
+
+// closeWindows returns the aggregates of the windows which ended by now, and
+// opens the windows holding now in their place. a.mut must be held.
+func (a *Aggregator) closeWindows(now time.Time) []output {
+	var outputs []output
+	for _, r := range a.rules {
+		for _, w := range r.windows {
+			if w.end.After(now) {
+				continue
+			}
+			ts := w.end.UnixMilli()
+			for _, g := range w.groups {
+				for _, agg := range r.Aggregations {
+					outputs = append(outputs, output{
+						labels: outputLabels(g.labels, agg+w.suffix, ""),
+						ts:     ts,
+						value:  g.value(agg),
+					})
+				}
+				if len(r.Quantiles) > 0 {
+					sort.Float64s(g.samples)
+					for _, q := range r.Quantiles {
+						outputs = append(outputs, output{
+							labels: outputLabels(g.labels, quantileName+w.suffix, strconv.FormatFloat(q, 'f', -1, 64)),
+							ts:     ts,
+							value:  quantile(q, g.samples),
+						})
+					}
+				}
+			}
+			w.groups = make(map[uint64]*group)
+			w.end = now.Truncate(w.interval).Add(w.interval)
+		}
+	}
+	return outputs
+}
+
+// write writes outputs to the next Appendable.
+func (a *Aggregator) write(outputs []output) {
+	if len(outputs) == 0 {
+		return
+	}
+	app := a.next.Appender(context.Background())
+	for _, o := range outputs {
+		if _, err := app.Append(0, o.labels, o.ts, o.value); err != nil {
+			level.Warn(a.log).Log("msg", "failed to write aggregate", "series", o.labels.String(), "err", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		level.Error(a.log).Log("msg", "failed to commit aggregates", "err", err)
+	} else {
+		a.metrics.outputSamples.Add(float64(len(outputs)))
+	}
+}
+
+// outputLabels returns the labels of an aggregate of the group with the given
+// labels. If q is set, it's added as the quantile label.
+func outputLabels(group labels.Labels, suffix, q string) labels.Labels {
+	b := labels.NewBuilder(group)
+	b.Set(labels.MetricName, group.Get(labels.MetricName)+":"+suffix)
+	if q != "" {
+		b.Set(quantileName, q)
+	}
+	return b.Labels()
+}
+
+// match returns the rules matching the series l and whether its raw samples
+// should be dropped.
+func (a *Aggregator) match(l labels.Labels) (matched []*rule, drop bool) {
+	a.mut.RLock()
+	defer a.mut.RUnlock()
+
+	for _, r := range a.rules {
+		if r.matches(l) {
+			matched = append(matched, r)
+			drop = drop || r.DropRaw
+		}
+	}
+	return matched, drop
+}
+
+// observation is a sample waiting for its appender to commit.
+type observation struct {
+	rules  []*rule
+	labels labels.Labels
+	ts     int64
+	value  float64
+}
+
+// observe adds committed samples to the windows of their rules holding their
+// timestamp. Windows which ended by the newest sample are written first,
+// while samples older than the open window of a rule, whose window was
+// already written, or newer than it, i.e. with a timestamp in the future, are
+// left out of it.
+func (a *Aggregator) observe(obs []observation) {
+	var newest int64
+	for _, o := range obs {
+		if o.ts > newest {
+			newest = o.ts
+		}
+	}
+	now := time.Now()
+	if t := time.UnixMilli(newest); t.Before(now) {
+		now = t
+	}
+
+	a.mut.Lock()
+	outputs := a.closeWindows(now)
+
+	var (
+		b                  labels.Builder
+		input, outOfWindow int
+	)
+	for _, o := range obs {
+		t := time.UnixMilli(o.ts)
+		series := o.labels.Hash()
+		var added, skipped bool
+		for _, r := range o.rules {
+			gl := r.groupLabels(&b, o.labels)
+			key := gl.Hash()
+			for _, w := range r.windows {
+				if t.Before(w.end.Add(-w.interval)) || !t.Before(w.end) {
+					skipped = true
+					continue
+				}
+				g, ok := w.groups[key]
+				if !ok {
+					g = &group{labels: gl, last: make(map[uint64]float64)}
+					w.groups[key] = g
+				}
+				g.observe(series, o.value, len(r.Quantiles) > 0)
+				added = true
+			}
+		}
+		if added {
+			input++
+		}
+		if skipped {
+			outOfWindow++
+		}
+	}
+	a.mut.Unlock()
+	a.metrics.inputSamples.Add(float64(input))
+	a.metrics.outOfWindowSamples.Add(float64(outOfWindow))
+
+	a.write(outputs)
+}
+
+// Appender implements storage.Appendable.
+func (a *Aggregator) Appender(ctx context.Context) storage.Appender {
+	return &appender{agg: a, next: a.next.Appender(ctx)}
+}
+
+type appender struct {
+	agg     *Aggregator
+	next    storage.Appender
+	pending []observation
+}
+
+var _ storage.Appender = (*appender)(nil)
+
+func (app *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	rules, drop := app.agg.match(l)
+	if len(rules) > 0 && !value.IsStaleNaN(v) && !math.IsNaN(v) {
+		app.pending = append(app.pending, observation{rules: rules, labels: l, ts: t, value: v})
+	}
+	if drop {
+		app.agg.metrics.droppedSamples.Inc()
+		return 0, nil
+	}
+	return app.next.Append(ref, l, t, v)
+}
+
+func (app *appender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if _, drop := app.agg.match(l); drop {
+		return 0, nil
+	}
+	return app.next.AppendExemplar(ref, l, e)
+}
+
+func (app *appender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	// Histograms aren't aggregated, but dropped like the rest of the raw
+	// series.
+	if _, drop := app.agg.match(l); drop {
+		return 0, nil
+	}
+	return app.next.AppendHistogram(ref, l, t, h, fh)
+}
+
+func (app *appender) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
+	if _, drop := app.agg.match(l); drop {
+		return 0, nil
+	}
+	return app.next.UpdateMetadata(ref, l, m)
+}
+
+func (app *appender) Commit() error {
+	if err := app.next.Commit(); err != nil {
+		app.pending = nil
+		return err
+	}
+	if len(app.pending) > 0 {
+		app.agg.observe(app.pending)
+		app.pending = nil
+	}
+	return nil
+}
+
+func (app *appender) Rollback() error {
+	app.pending = nil
+	return app.next.Rollback()
+}
+
+type metrics struct {
+	inputSamples       prometheus.Counter
+	outOfWindowSamples prometheus.Counter
+	droppedSamples     prometheus.Counter
+	outputSamples      prometheus.Counter
+	groups             prometheus.Gauge
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		inputSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregate_input_samples_total",
+			Help: "Total number of samples added to aggregates.",
+		}),
+		outOfWindowSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregate_out_of_window_samples_total",
+			Help: "Total number of samples left out of an aggregate because their timestamp is outside of its open window.",
+		}),
+		droppedSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregate_dropped_samples_total",
+			Help: "Total number of raw samples dropped after being aggregated.",
+		}),
+		outputSamples: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregate_output_samples_total",
+			Help: "Total number of aggregated samples written.",
+		}),
+		groups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "agent_metrics_aggregate_groups",
+			Help: "Number of groups in the open aggregation windows.",
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(m.inputSamples, m.outOfWindowSamples, m.droppedSamples, m.outputSamples, m.groups)
+	}
+	return m
+}
@@ -0,0 +1,277 @@
+package aggregate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type sample struct {
+	ts    int64
+	value float64
+}
+
+// memStorage is a storage.Appendable which keeps the committed samples of
+// each series.
+type memStorage struct {
+	mut    sync.Mutex
+	series map[string][]sample
+}
+
+func (s *memStorage) Appender(context.Context) storage.Appender {
+	return &memAppender{s: s, pending: map[string][]sample{}}
+}
+
+func (s *memStorage) get(series string) []sample {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.series[series]
+}
+
+func (s *memStorage) names() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	var res []string
+	for name := range s.series {
+		res = append(res, name)
+	}
+	return res
+}
+
+type memAppender struct {
+	s       *memStorage
+	pending map[string][]sample
+}
+
+func (a *memAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.pending[l.String()] = append(a.pending[l.String()], sample{t, v})
+	return 1, nil
+}
+
+func (a *memAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 1, nil
+}
+
+func (a *memAppender) AppendHistogram(storage.SeriesRef, labels.Labels, int64, *histogram.Histogram, *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	return 1, nil
+}
+
+func (a *memAppender) UpdateMetadata(storage.SeriesRef, labels.Labels, metadata.Metadata) (storage.SeriesRef, error) {
+	return 1, nil
+}
+
+func (a *memAppender) Commit() error {
+	a.s.mut.Lock()
+	defer a.s.mut.Unlock()
+	if a.s.series == nil {
+		a.s.series = map[string][]sample{}
+	}
+	for name, samples := range a.pending {
+		a.s.series[name] = append(a.s.series[name], samples...)
+	}
+	return nil
+}
+
+func (a *memAppender) Rollback() error { return nil }
+
+func TestAggregator(t *testing.T) {
+	next := &memStorage{}
+	agg := New(log.NewNopLogger(), prometheus.NewRegistry(), next)
+	require.NoError(t, agg.ApplyRules([]Rule{
+		{
+			Match:        `{__name__="peer_latency_seconds"}`,
+			By:           []string{"job"},
+			Intervals:    []time.Duration{time.Minute, 5 * time.Minute},
+			Aggregations: []string{Sum, Avg, Min, Max, Count},
+			Quantiles:    []float64{0.5},
+			DropRaw:      true,
+		},
+		{
+			Match:        `{__name__="validator_balance"}`,
+			Without:      []string{"validator"},
+			Intervals:    []time.Duration{time.Minute},
+			Aggregations: []string{Sum},
+		},
+	}))
+
+	agg.mut.RLock()
+	end, longEnd := agg.rules[0].windows[0].end, agg.rules[0].windows[1].end
+	agg.mut.RUnlock()
+	sampleTs := end.Add(-time.Minute).UnixMilli()
+
+	appendAll := func(samples map[string]float64, series ...labels.Labels) {
+		app := agg.Appender(context.Background())
+		for _, l := range series {
+			_, err := app.Append(0, l, sampleTs, samples[l.Get("peer")+l.Get("validator")])
+			require.NoError(t, err)
+		}
+		require.NoError(t, app.Commit())
+	}
+
+	peers := []labels.Labels{
+		labels.FromStrings("__name__", "peer_latency_seconds", "job", "geth", "peer", "a"),
+		labels.FromStrings("__name__", "peer_latency_seconds", "job", "geth", "peer", "b"),
+		labels.FromStrings("__name__", "peer_latency_seconds", "job", "geth", "peer", "c"),
+	}
+	validators := []labels.Labels{
+		labels.FromStrings("__name__", "validator_balance", "job", "lighthouse", "validator", "1"),
+		labels.FromStrings("__name__", "validator_balance", "job", "lighthouse", "validator", "2"),
+	}
+
+	appendAll(map[string]float64{"a": 1, "b": 2, "c": 6, "1": 32, "2": 31}, append(peers, validators...)...)
+	appendAll(map[string]float64{"a": 3, "b": 4, "c": math.Float64frombits(value.StaleNaN), "1": 32, "2": 33}, append(peers, validators...)...)
+
+	// Raw series are only dropped for rules with drop_raw.
+	require.Empty(t, next.get(peers[0].String()))
+	require.Len(t, next.get(validators[0].String()), 2)
+
+	// Aggregates are written once their window ends.
+	agg.flush(end.Add(-time.Second))
+	require.Len(t, next.names(), 2)
+
+	agg.flush(end)
+	ts := end.UnixMilli()
+
+	expect := map[string]float64{
+		// Each series contributes its last value to sum, avg and count; min,
+		// max and quantiles consider every sample.
+		`{__name__="peer_latency_seconds:sum_1m", job="geth"}`:                      3 + 4 + 6,
+		`{__name__="peer_latency_seconds:avg_1m", job="geth"}`:                      13.0 / 3,
+		`{__name__="peer_latency_seconds:min_1m", job="geth"}`:                      1,
+		`{__name__="peer_latency_seconds:max_1m", job="geth"}`:                      6,
+		`{__name__="peer_latency_seconds:count_1m", job="geth"}`:                    3,
+		`{__name__="peer_latency_seconds:quantile_1m", job="geth", quantile="0.5"}`: 3,
+		`{__name__="validator_balance:sum_1m", job="lighthouse"}`:                   65,
+	}
+	for series, v := range expect {
+		require.Equal(t, []sample{{ts, v}}, next.get(series), series)
+	}
+
+	// Longer windows are written when they end.
+	if longEnd.After(end) {
+		require.Empty(t, next.get(`{__name__="peer_latency_seconds:sum_5m", job="geth"}`))
+	}
+
+	// Windows start empty again.
+	agg.flush(end.Add(time.Minute))
+	require.Len(t, next.get(`{__name__="validator_balance:sum_1m", job="lighthouse"}`), 1)
+}
+
+func TestAggregator_SampleTimestamp(t *testing.T) {
+	next := &memStorage{}
+	reg := prometheus.NewRegistry()
+	agg := New(log.NewNopLogger(), reg, next)
+	require.NoError(t, agg.ApplyRules([]Rule{{
+		Match:        `{__name__="up"}`,
+		Intervals:    []time.Duration{time.Minute},
+		Aggregations: []string{Count},
+	}}))
+
+	agg.mut.RLock()
+	end := agg.rules[0].windows[0].end
+	agg.mut.RUnlock()
+
+	appendAt := func(ts time.Time, job string) {
+		app := agg.Appender(context.Background())
+		_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", job), ts.UnixMilli(), 1)
+		require.NoError(t, err)
+		require.NoError(t, app.Commit())
+	}
+
+	// Samples older than the open window, or in the future, are left out.
+	appendAt(end.Add(-2*time.Minute), "late")
+	appendAt(time.Now().Add(time.Hour), "future")
+	appendAt(end.Add(-time.Second), "a")
+	require.Equal(t, 2.0, testutil.ToFloat64(agg.metrics.outOfWindowSamples))
+	require.Equal(t, 1.0, testutil.ToFloat64(agg.metrics.inputSamples))
+
+	agg.flush(end)
+	require.Equal(t, []sample{{end.UnixMilli(), 1}}, next.get(`{__name__="up:count_1m"}`))
+
+	// A window which ended without being written yet is written before
+	// samples of the next window are added.
+	past := time.Now().Truncate(time.Minute)
+	agg.mut.Lock()
+	agg.rules[0].windows[0].end = past
+	agg.mut.Unlock()
+	appendAt(past.Add(-time.Second), "a")
+	appendAt(past.Add(-time.Second), "b")
+	require.Len(t, next.get(`{__name__="up:count_1m"}`), 1)
+
+	appendAt(past, "a")
+	require.Equal(t, []sample{{end.UnixMilli(), 1}, {past.UnixMilli(), 2}}, next.get(`{__name__="up:count_1m"}`))
+	appendAt(past.Add(-time.Second), "c")
+	require.Equal(t, 3.0, testutil.ToFloat64(agg.metrics.outOfWindowSamples))
+	require.Equal(t, 4.0, testutil.ToFloat64(agg.metrics.inputSamples))
+}
+
+func TestAggregator_Rollback(t *testing.T) {
+	next := &memStorage{}
+	agg := New(log.NewNopLogger(), nil, next)
+	require.NoError(t, agg.ApplyRules([]Rule{{
+		Match:        `{__name__="up"}`,
+		Intervals:    []time.Duration{time.Minute},
+		Aggregations: []string{Count},
+	}}))
+
+	app := agg.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", "a"), 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Rollback())
+
+	agg.flush(time.Now().Add(time.Minute))
+	require.Empty(t, next.names())
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4}
+	require.Equal(t, 1.0, quantile(0, sorted))
+	require.Equal(t, 2.5, quantile(0.5, sorted))
+	require.Equal(t, 4.0, quantile(1, sorted))
+	require.Equal(t, 3.0, quantile(0.5, []float64{3}))
+}
+
+func TestRule_Validate(t *testing.T) {
+	valid := Rule{
+		Match:        `{__name__="up"}`,
+		Intervals:    []time.Duration{time.Minute},
+		Aggregations: []string{Sum},
+	}
+	require.NoError(t, valid.Validate())
+
+	tt := []struct {
+		name   string
+		mutate func(r *Rule)
+		expect string
+	}{
+		{"missing match", func(r *Rule) { r.Match = "" }, "match must be set"},
+		{"invalid match", func(r *Rule) { r.Match = "{" }, `invalid match "{"`},
+		{"by and without", func(r *Rule) { r.By, r.Without = []string{"a"}, []string{"b"} }, "only one of by and without may be set"},
+		{"without name", func(r *Rule) { r.Without = []string{"__name__"} }, "without must not contain __name__"},
+		{"missing intervals", func(r *Rule) { r.Intervals = nil }, "at least one interval must be set"},
+		{"short interval", func(r *Rule) { r.Intervals = []time.Duration{time.Millisecond} }, "interval 1ms must be at least 1s"},
+		{"missing aggregations", func(r *Rule) { r.Aggregations = nil }, "at least one aggregation or quantile must be set"},
+		{"unknown aggregation", func(r *Rule) { r.Aggregations = []string{"stddev"} }, `unsupported aggregation "stddev"`},
+		{"invalid quantile", func(r *Rule) { r.Quantiles = []float64{1.5} }, "quantile 1.5 must be between 0 and 1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := valid
+			tc.mutate(&r)
+			require.ErrorContains(t, r.Validate(), tc.expect)
+		})
+	}
+}
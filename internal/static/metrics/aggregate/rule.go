@@ -0,0 +1,226 @@
+// Package aggregate implements streaming aggregation of samples before they're
+// written to storage.
+//
+// Samples matching a rule are grouped by a reduced label set and rolled up
+// over fixed windows. At the end of each window, one series per group and
+// aggregation is written, and the raw series can optionally be dropped.
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Supported aggregations. Each series contributes its last value in a window
+// to sum, avg and count, while min and max consider every sample.
+const (
+	Sum   = "sum"
+	Avg   = "avg"
+	Min   = "min"
+	Max   = "max"
+	Count = "count"
+)
+
+// quantileName is the aggregation name of quantile series, which carry the
+// quantile as a label.
+const quantileName = "quantile"
+
+var validAggregations = map[string]struct{}{
+	Sum: {}, Avg: {}, Min: {}, Max: {}, Count: {},
+}
+
+// Rule configures the rollups of the series matching a selector.
+type Rule struct {
+	// Match is the series selector of the series to aggregate, e.g.
+	// `{__name__=~"p2p_peer_.*"}`.
+	Match string `yaml:"match"`
+	// By lists the labels to keep in the output. Without lists the labels to
+	// remove instead. At most one may be set; if neither is, all series of a
+	// metric are aggregated together. The metric name is always kept.
+	By      []string `yaml:"by,omitempty"`
+	Without []string `yaml:"without,omitempty"`
+	// Intervals are the windows to aggregate over, e.g. 1m and 5m.
+	Intervals []time.Duration `yaml:"intervals"`
+	// Aggregations to compute for each group.
+	Aggregations []string `yaml:"aggregations,omitempty"`
+	// Quantiles of the samples of each group to compute, between 0 and 1.
+	Quantiles []float64 `yaml:"quantiles,omitempty"`
+	// DropRaw drops the matching series instead of writing them along with
+	// the aggregates.
+	DropRaw bool `yaml:"drop_raw,omitempty"`
+}
+
+// Validate returns an error if r is invalid.
+func (r *Rule) Validate() error {
+	if r.Match == "" {
+		return errors.New("match must be set")
+	}
+	if _, err := parser.ParseMetricSelector(r.Match); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	if len(r.By) > 0 && len(r.Without) > 0 {
+		return errors.New("only one of by and without may be set")
+	}
+	for _, name := range r.Without {
+		if name == labels.MetricName {
+			return fmt.Errorf("without must not contain %s", labels.MetricName)
+		}
+	}
+
+	if len(r.Intervals) == 0 {
+		return errors.New("at least one interval must be set")
+	}
+	for _, interval := range r.Intervals {
+		if interval < time.Second {
+			return fmt.Errorf("interval %s must be at least 1s", interval)
+		}
+	}
+
+	if len(r.Aggregations) == 0 && len(r.Quantiles) == 0 {
+		return errors.New("at least one aggregation or quantile must be set")
+	}
+	for _, agg := range r.Aggregations {
+		if _, ok := validAggregations[agg]; !ok {
+			return fmt.Errorf("unsupported aggregation %q", agg)
+		}
+	}
+	for _, q := range r.Quantiles {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("quantile %v must be between 0 and 1", q)
+		}
+	}
+	return nil
+}
+
+// rule is a compiled Rule along with the state of its open windows.
+type rule struct {
+	Rule
+	matchers []*labels.Matcher
+	windows  []*window
+}
+
+func newRule(r Rule, now time.Time) (*rule, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	matchers, err := parser.ParseMetricSelector(r.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &rule{Rule: r, matchers: matchers}
+	if len(r.By) > 0 {
+		res.By = append([]string{labels.MetricName}, r.By...)
+		sort.Strings(res.By)
+	}
+	for _, interval := range r.Intervals {
+		res.windows = append(res.windows, newWindow(interval, now))
+	}
+	return res, nil
+}
+
+func (r *rule) matches(l labels.Labels) bool {
+	for _, m := range r.matchers {
+		if !m.Matches(l.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupLabels returns the labels of the group of the series l.
+func (r *rule) groupLabels(b *labels.Builder, l labels.Labels) labels.Labels {
+	b.Reset(l)
+	switch {
+	case len(r.By) > 0:
+		b.Keep(r.By...)
+	case len(r.Without) > 0:
+		b.Del(r.Without...)
+	default:
+		b.Keep(labels.MetricName)
+	}
+	return b.Labels()
+}
+
+// window accumulates the samples of a rule over one interval.
+type window struct {
+	interval time.Duration
+	suffix   string
+	end      time.Time
+	groups   map[uint64]*group
+}
+
+func newWindow(interval time.Duration, now time.Time) *window {
+	return &window{
+		interval: interval,
+		suffix:   "_" + model.Duration(interval).String(),
+		end:      now.Truncate(interval).Add(interval),
+		groups:   make(map[uint64]*group),
+	}
+}
+
+// group accumulates the samples of the series sharing the same group labels.
+type group struct {
+	labels   labels.Labels
+	last     map[uint64]float64
+	min, max float64
+	samples  []float64
+}
+
+func (g *group) observe(series uint64, v float64, keepSamples bool) {
+	if len(g.last) == 0 {
+		g.min, g.max = v, v
+	}
+	g.last[series] = v
+	if v < g.min {
+		g.min = v
+	}
+	if v > g.max {
+		g.max = v
+	}
+	if keepSamples {
+		g.samples = append(g.samples, v)
+	}
+}
+
+func (g *group) value(agg string) float64 {
+	switch agg {
+	case Sum, Avg:
+		var sum float64
+		for _, v := range g.last {
+			sum += v
+		}
+		if agg == Avg {
+			return sum / float64(len(g.last))
+		}
+		return sum
+	case Min:
+		return g.min
+	case Max:
+		return g.max
+	case Count:
+		return float64(len(g.last))
+	}
+	return 0
+}
+
+// quantile returns the q-quantile of sorted, interpolating between the
+// closest ranks like the quantile function of PromQL.
+func quantile(q float64, sorted []float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := q * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[lower+1]*weight
+}
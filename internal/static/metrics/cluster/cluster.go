@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -14,6 +15,7 @@ import (
 	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance/configstore"
 	"github.com/blockopsnetwork/telescope/internal/util"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 )
 
@@ -42,8 +44,14 @@ type Cluster struct {
 	// triggering metrics to be collected and sent. configWatcher also does a
 	// complete refresh of its state on an interval.
 	watcher *configWatcher
+
+	// targetSharding is set when targets are sharded instead of configs.
+	targetSharding atomic.Bool
+	targetHandover atomic.Duration
 }
 
+var _ instance.TargetOwner = (*Cluster)(nil)
+
 // New creates a new Cluster.
 func New(
 	l log.Logger,
@@ -78,7 +86,9 @@ func New(
 	c.storeAPI = configstore.NewAPI(l, c.store, c.storeValidate, cfg.APIEnableGetConfiguration)
 	reg.MustRegister(c.storeAPI)
 
-	c.watcher, err = newConfigWatcher(l, cfg, c.store, im, c.node.Owns, validate)
+	c.targetSharding.Store(cfg.Enabled && cfg.TargetSharding)
+	c.targetHandover.Store(cfg.TargetHandover)
+	c.watcher, err = newConfigWatcher(l, cfg, c.store, im, c.ownsConfig, validate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize configwatcher: %w", err)
 	}
@@ -105,6 +115,38 @@ func (c *Cluster) storeValidate(cfg *instance.Config) error {
 	return validateNofiles(cfg)
 }
 
+// ownsConfig returns true if the config with the given key should run on this
+// agent. With target sharding, every agent runs every config.
+func (c *Cluster) ownsConfig(key string) (bool, error) {
+	if c.targetSharding.Load() {
+		return true, nil
+	}
+	return c.node.Owns(key)
+}
+
+// OwnsTarget implements instance.TargetOwner. All targets are owned unless
+// target sharding is enabled.
+func (c *Cluster) OwnsTarget(key string) (bool, error) {
+	if !c.targetSharding.Load() {
+		return true, nil
+	}
+	return c.node.Owns(key)
+}
+
+// TargetOwners implements instance.TargetOwner.
+func (c *Cluster) TargetOwners(key string) ([]string, error) {
+	if !c.targetSharding.Load() {
+		return nil, nil
+	}
+	return c.node.Owners(key)
+}
+
+// TargetHandover returns how long targets which moved to another agent keep
+// being scraped.
+func (c *Cluster) TargetHandover() time.Duration {
+	return c.targetHandover.Load()
+}
+
 // Reshard implements agentproto.ScrapingServiceServer, and syncs the state of
 // configs with the configstore.
 func (c *Cluster) Reshard(ctx context.Context, _ *agentproto.ReshardRequest) (*empty.Empty, error) {
@@ -133,6 +175,8 @@ func (c *Cluster) ApplyConfig(cfg Config) error {
 		return fmt.Errorf("failed to apply config to config store: %w", err)
 	}
 
+	c.targetSharding.Store(cfg.Enabled && cfg.TargetSharding)
+	c.targetHandover.Store(cfg.TargetHandover)
 	if err := c.watcher.ApplyConfig(cfg); err != nil {
 		return fmt.Errorf("failed to apply config to watcher: %w", err)
 	}
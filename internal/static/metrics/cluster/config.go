@@ -45,6 +45,13 @@ type Config struct {
 
 	DangerousAllowReadingFiles bool `yaml:"dangerous_allow_reading_files,omitempty"`
 
+	// TargetSharding runs every config on every agent and shards their
+	// targets across the cluster instead, by hashing the labels of targets.
+	TargetSharding bool `yaml:"target_sharding,omitempty"`
+	// TargetHandover is how long an agent keeps scraping a target which moved
+	// to another agent, so the new owner can pick it up without a gap.
+	TargetHandover time.Duration `yaml:"target_handover,omitempty"`
+
 	// TODO(rfratto): deprecate scraping_service_client in Agent and replace with this.
 	Client                    client.Config `yaml:"-"`
 	APIEnableGetConfiguration bool          `yaml:"-"`
@@ -80,6 +87,8 @@ func (c *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	f.DurationVar(&c.ReshardInterval, prefix+"reshard-interval", time.Minute*1, "how often to manually refresh configuration")
 	f.DurationVar(&c.ReshardTimeout, prefix+"reshard-timeout", time.Second*30, "timeout for refreshing the configuration. Timeout of 0s disables timeout.")
 	f.DurationVar(&c.ClusterReshardEventTimeout, prefix+"cluster-reshard-event-timeout", time.Second*30, "timeout for the cluster reshard. Timeout of 0s disables timeout.")
+	f.BoolVar(&c.TargetSharding, prefix+"target-sharding", false, "shard the targets of configs across the cluster instead of whole configs")
+	f.DurationVar(&c.TargetHandover, prefix+"target-handover", time.Minute, "how long targets which moved to another agent keep being scraped")
 	c.KVStore.RegisterFlagsWithPrefix(prefix+"config-store.", "configurations/", f)
 	c.Lifecycler.RegisterFlagsWithPrefix(prefix, f, util_log.Logger)
 
@@ -362,6 +362,10 @@ func (n *node) Owns(key string) (bool, error) {
 	n.mut.RLock()
 	defer n.mut.RUnlock()
 
+	if n.ring == nil || n.lc == nil {
+		return false, fmt.Errorf("node disabled")
+	}
+
 	rs, err := n.ring.Get(keyHash(key), ring.Write, nil, nil, nil)
 	if err != nil {
 		return false, err
@@ -374,6 +378,22 @@ func (n *node) Owns(key string) (bool, error) {
 	return false, nil
 }
 
+// Owners returns the addresses of the nodes owning a key.
+func (n *node) Owners(key string) ([]string, error) {
+	n.mut.RLock()
+	defer n.mut.RUnlock()
+
+	if n.ring == nil {
+		return nil, fmt.Errorf("node disabled")
+	}
+
+	rs, err := n.ring.Get(keyHash(key), ring.Write, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return rs.GetAddresses(), nil
+}
+
 func keyHash(key string) uint32 {
 	h := fnv.New32()
 	_, _ = h.Write([]byte(key))
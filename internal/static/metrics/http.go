@@ -10,6 +10,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/gorilla/mux"
 	"github.com/blockopsnetwork/telescope/internal/static/metrics/cluster/configapi"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/wal"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/scrape"
@@ -26,6 +27,12 @@ func (a *Agent) WireAPI(r *mux.Router) {
 	r.HandleFunc("/agent/api/v1/metrics/instances", a.ListInstancesHandler).Methods("GET")
 	r.HandleFunc("/agent/api/v1/metrics/targets", a.ListTargetsHandler).Methods("GET")
 	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/write", a.PushMetricsHandler).Methods("POST")
+	r.HandleFunc("/debug/target-shards", a.TargetShardsHandler).Methods("GET")
+
+	// Queries over the local storage of instances, compatible with the
+	// Prometheus HTTP API.
+	r.HandleFunc("/api/v1/query", a.QueryHandler).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/query_range", a.QueryRangeHandler).Methods("GET", "POST")
 }
 
 // ListInstancesHandler writes the set of currently running instances to the http.ResponseWriter.
@@ -48,14 +55,28 @@ func (a *Agent) ListInstancesHandler(w http.ResponseWriter, _ *http.Request) {
 func (a *Agent) ListTargetsHandler(w http.ResponseWriter, r *http.Request) {
 	instances := a.mm.ListInstances()
 	allTagets := make(map[string]TargetSet, len(instances))
+	usage := make(map[string]targetSeriesGetter, len(instances))
 	for instName, inst := range instances {
 		allTagets[instName] = inst.TargetsActive()
+		if g, ok := inst.(targetSeriesGetter); ok {
+			usage[instName] = g
+		}
 	}
-	ListTargetsHandler(allTagets).ServeHTTP(w, r)
+	listTargetsHandler(allTagets, usage).ServeHTTP(w, r)
+}
+
+// targetSeriesGetter is implemented by instances which track the series
+// usage of their targets.
+type targetSeriesGetter interface {
+	TargetSeries(job, instance string) (wal.TargetSeries, bool)
 }
 
 // ListTargetsHandler renders a mapping of instance to target set.
 func ListTargetsHandler(targets map[string]TargetSet) http.Handler {
+	return listTargetsHandler(targets, nil)
+}
+
+func listTargetsHandler(targets map[string]TargetSet, usage map[string]targetSeriesGetter) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
 		resp := ListTargetsResponse{}
 
@@ -67,7 +88,7 @@ func ListTargetsHandler(targets map[string]TargetSet) http.Handler {
 						lastError = scrapeError.Error()
 					}
 
-					resp = append(resp, TargetInfo{
+					info := TargetInfo{
 						InstanceName: instance,
 						TargetGroup:  key,
 
@@ -78,7 +99,13 @@ func ListTargetsHandler(targets map[string]TargetSet) http.Handler {
 						LastScrape:       tgt.LastScrape(),
 						ScrapeDuration:   tgt.LastScrapeDuration().Milliseconds(),
 						ScrapeError:      lastError,
-					})
+					}
+					if g, ok := usage[instance]; ok {
+						if u, ok := g.TargetSeries(info.Labels.Get(model.JobLabel), info.Labels.Get(model.InstanceLabel)); ok {
+							info.SeriesUsage = &SeriesUsage{Active: u.Active, Limit: u.Limit}
+						}
+					}
+					resp = append(resp, info)
 				}
 			}
 		}
@@ -131,6 +158,14 @@ type TargetInfo struct {
 	LastScrape       time.Time     `json:"last_scrape"`
 	ScrapeDuration   int64         `json:"scrape_duration_ms"`
 	ScrapeError      string        `json:"scrape_error"`
+	SeriesUsage      *SeriesUsage  `json:"series_usage,omitempty"`
+}
+
+// SeriesUsage is the number of active series of a target and its series
+// budget.
+type SeriesUsage struct {
+	Active int `json:"active"`
+	Limit  int `json:"limit,omitempty"`
 }
 
 // PushMetricsHandler provides a way to POST data directly into
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/wal"
 	"github.com/blockopsnetwork/telescope/internal/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
@@ -130,6 +132,49 @@ func TestAgent_ListTargetsHandler(t *testing.T) {
 		require.JSONEq(t, expect, rr.Body.String())
 		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
 	})
+
+	t.Run("series usage", func(t *testing.T) {
+		tgt := scrape.NewTarget(labels.FromMap(map[string]string{
+			model.JobLabel:         "job",
+			model.InstanceLabel:    "instance",
+			model.SchemeLabel:      "http",
+			model.AddressLabel:     "localhost:12345",
+			model.MetricsPathLabel: "/metrics",
+		}), labels.EmptyLabels(), nil)
+
+		mockManager.ListInstancesFunc = func() map[string]instance.ManagedInstance {
+			return map[string]instance.ManagedInstance{
+				"test_instance": &mockInstanceSeries{
+					mockInstanceScrape: mockInstanceScrape{
+						tgts: map[string][]*scrape.Target{"group_a": {tgt}},
+					},
+					usage: map[string]wal.TargetSeries{
+						"job/instance": {Active: 120, Limit: 100},
+					},
+				},
+			}
+		}
+
+		rr := httptest.NewRecorder()
+		a.ListTargetsHandler(rr, r)
+
+		var resp struct {
+			Data ListTargetsResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Len(t, resp.Data, 1)
+		require.Equal(t, &SeriesUsage{Active: 120, Limit: 100}, resp.Data[0].SeriesUsage)
+	})
+}
+
+type mockInstanceSeries struct {
+	mockInstanceScrape
+	usage map[string]wal.TargetSeries
+}
+
+func (i *mockInstanceSeries) TargetSeries(job, instance string) (wal.TargetSeries, bool) {
+	u, ok := i.usage[job+"/"+instance]
+	return u, ok
 }
 
 type mockInstanceScrape struct {
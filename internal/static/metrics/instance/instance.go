@@ -19,9 +19,15 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/blockopsnetwork/telescope/internal/agentseed"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/aggregate"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/localstore"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/outbox"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/ruler"
 	"github.com/blockopsnetwork/telescope/internal/static/metrics/wal"
+	"github.com/blockopsnetwork/telescope/internal/static/otlp"
 	"github.com/blockopsnetwork/telescope/internal/useragent"
 	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/grafana/dskit/flagext"
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus"
 	config_util "github.com/prometheus/common/config"
@@ -68,6 +74,10 @@ type Config struct {
 	ScrapeConfigs            []*config.ScrapeConfig      `yaml:"scrape_configs,omitempty"`
 	RemoteWrite              []*config.RemoteWriteConfig `yaml:"remote_write,omitempty"`
 
+	// Routes sending the series matching them to their own remote_write
+	// endpoint. Series matching no route are sent to remote_write.
+	RemoteWriteRoutes []*RouteConfig `yaml:"remote_write_routes,omitempty"`
+
 	// How frequently the WAL should be truncated.
 	WALTruncateFrequency time.Duration `yaml:"wal_truncate_frequency,omitempty"`
 
@@ -75,12 +85,94 @@ type Config struct {
 	MinWALTime time.Duration `yaml:"min_wal_time,omitempty"`
 	MaxWALTime time.Duration `yaml:"max_wal_time,omitempty"`
 
+	// Maximum size of the WAL and minimum free space to leave on the disk
+	// holding it. When either is exceeded, the oldest WAL segments are evicted
+	// even if they haven't been sent yet. Unset limits are disabled.
+	MaxWALSize  flagext.Bytes `yaml:"max_wal_size,omitempty"`
+	MinFreeDisk flagext.Bytes `yaml:"min_free_disk,omitempty"`
+
+	// Series budgets of the scrape jobs and targets. Unlike sample_limit,
+	// which fails the whole scrape, only new series beyond a budget are
+	// rejected.
+	SeriesLimits *SeriesLimitsConfig `yaml:"series_limits,omitempty"`
+
 	RemoteFlushDeadline  time.Duration `yaml:"remote_flush_deadline,omitempty"`
 	WriteStaleOnShutdown bool          `yaml:"write_stale_on_shutdown,omitempty"`
 
+	// Buffers remote_write batches on disk while their endpoint is
+	// unreachable and replays them once it's back. Disabled when unset.
+	RemoteWriteOutbox *outbox.Config `yaml:"remote_write_outbox,omitempty"`
+
+	// Scrape native histograms from targets which expose them and send them
+	// to the remote_write endpoints.
+	ScrapeNativeHistograms bool `yaml:"scrape_native_histograms,omitempty"`
+
+	// Protocol version used to send to the remote_write endpoints. With 2.0,
+	// endpoints which don't support it fall back to 1.0.
+	RemoteWriteProtocol string `yaml:"remote_write_protocol,omitempty"`
+
+	// Rollups computed from the scraped samples before they're written to the
+	// WAL.
+	AggregationRules []aggregate.Rule `yaml:"aggregation_rules,omitempty"`
+
+	// Keeps recent samples in memory to evaluate rules against. Enabled with
+	// the default settings when rules are set.
+	LocalStorage *localstore.Config `yaml:"local_storage,omitempty"`
+
+	// Recording and alerting rules evaluated against the local storage.
+	Rules *ruler.Config `yaml:"rules,omitempty"`
+
+	// OTLP endpoints receiving the scraped samples alongside remote_write.
+	// Only the samples kept by the series limits and aggregation rules are
+	// sent; the series produced by aggregation and recording rules only go
+	// to remote_write.
+	OTLP []otlp.Config `yaml:"otlp,omitempty"`
+
 	global GlobalConfig `yaml:"-"`
 }
 
+// Supported values of remote_write_protocol.
+const (
+	RemoteWriteProtocolV1 = "1.0"
+	RemoteWriteProtocolV2 = "2.0"
+)
+
+// SeriesLimitsConfig configures the series budgets of the scrape jobs and
+// targets of an instance. Unset budgets are unlimited.
+type SeriesLimitsConfig struct {
+	// Maximum number of active series of a single target.
+	PerTarget int `yaml:"per_target,omitempty"`
+	// Maximum number of active series of all targets of a job combined.
+	PerJob int `yaml:"per_job,omitempty"`
+	// Jobs overrides the budgets of specific jobs.
+	Jobs map[string]JobSeriesLimitsConfig `yaml:"jobs,omitempty"`
+}
+
+// JobSeriesLimitsConfig overrides the series budgets of a scrape job.
+type JobSeriesLimitsConfig struct {
+	PerTarget int `yaml:"per_target,omitempty"`
+	PerJob    int `yaml:"per_job,omitempty"`
+}
+
+// cardinalityLimits converts c to the limits of the WAL. A nil c disables
+// the limits.
+func (c *SeriesLimitsConfig) cardinalityLimits() wal.CardinalityLimits {
+	if c == nil {
+		return wal.CardinalityLimits{}
+	}
+
+	limits := wal.CardinalityLimits{
+		Default: wal.SeriesLimit{PerTarget: c.PerTarget, PerJob: c.PerJob},
+	}
+	if len(c.Jobs) > 0 {
+		limits.Jobs = make(map[string]wal.SeriesLimit, len(c.Jobs))
+		for job, l := range c.Jobs {
+			limits.Jobs[job] = wal.SeriesLimit{PerTarget: l.PerTarget, PerJob: l.PerJob}
+		}
+	}
+	return limits
+}
+
 // UnmarshalYAML implements yaml.Unmarshaler.
 func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultConfig
@@ -127,6 +219,14 @@ func (c *Config) ApplyDefaults(global GlobalConfig) error {
 		return errors.New("min_wal_time must be less than max_wal_time")
 	}
 
+	switch c.RemoteWriteProtocol {
+	case "":
+		c.RemoteWriteProtocol = RemoteWriteProtocolV1
+	case RemoteWriteProtocolV1, RemoteWriteProtocolV2:
+	default:
+		return fmt.Errorf("unsupported remote_write_protocol %q, must be %q or %q", c.RemoteWriteProtocol, RemoteWriteProtocolV1, RemoteWriteProtocolV2)
+	}
+
 	jobNames := map[string]struct{}{}
 	for _, sc := range c.ScrapeConfigs {
 		if sc == nil {
@@ -158,12 +258,34 @@ func (c *Config) ApplyDefaults(global GlobalConfig) error {
 		jobNames[sc.JobName] = struct{}{}
 	}
 
+	for i := range c.AggregationRules {
+		if err := c.AggregationRules[i].Validate(); err != nil {
+			return fmt.Errorf("invalid aggregation rule %d: %w", i, err)
+		}
+	}
+
+	if c.Rules != nil {
+		if err := c.Rules.Validate(); err != nil {
+			return fmt.Errorf("invalid rules config: %w", err)
+		}
+	}
+
 	rwNames := map[string]struct{}{}
 	// If the instance remote write is not filled in, then apply the prometheus write config
 	if len(c.RemoteWrite) == 0 {
 		c.RemoteWrite = c.global.RemoteWrite
 	}
-	for _, cfg := range c.RemoteWrite {
+	rws := c.RemoteWrite[:len(c.RemoteWrite):len(c.RemoteWrite)]
+	for i, route := range c.RemoteWriteRoutes {
+		if route == nil {
+			return fmt.Errorf("empty or null remote write route section")
+		}
+		if err := route.validate(); err != nil {
+			return fmt.Errorf("invalid remote write route %d: %w", i, err)
+		}
+		rws = append(rws, route.RemoteWrite)
+	}
+	for _, cfg := range rws {
 		if cfg == nil {
 			return fmt.Errorf("empty or null remote write config section")
 		}
@@ -195,6 +317,21 @@ func (c *Config) ApplyDefaults(global GlobalConfig) error {
 	return nil
 }
 
+// localStorageEnabled returns true if samples should be kept in a local
+// store, which is required to evaluate rules.
+func (c *Config) localStorageEnabled() bool {
+	return c.LocalStorage != nil || c.Rules != nil
+}
+
+// localStorageConfig returns the config of the local store, using defaults
+// when it's only enabled by rules.
+func (c *Config) localStorageConfig() localstore.Config {
+	if c.LocalStorage == nil {
+		return localstore.DefaultConfig
+	}
+	return *c.LocalStorage
+}
+
 // Clone makes a deep copy of the config along with global settings.
 func (c *Config) Clone() (Config, error) {
 	bb, err := MarshalConfig(c, false)
@@ -235,13 +372,24 @@ type Instance struct {
 	discovery          *discoveryService
 	readyScrapeManager *readyScrapeManager
 	remoteStore        *remote.Storage
+	outbox             *outbox.Manager
 	storage            storage.Storage
+	aggregator         *aggregate.Aggregator
+	localStore         *localstore.Store
+	ruler              *ruler.Ruler
+	otlpExporters      []*otlp.MetricsExporter
+	otlpAppendables    []storage.Appendable
 
 	// ready is set to true after the initialization process finishes
 	ready atomic.Bool
 
 	hostFilter *HostFilter
 
+	// Set when targets are sharded across a cluster of agents.
+	targetOwner    TargetOwner
+	targetHandover time.Duration
+	targetSharder  *TargetSharder
+
 	logger log.Logger
 
 	reg          prometheus.Registerer
@@ -341,6 +489,70 @@ func (i *Instance) Run(ctx context.Context) error {
 			},
 		)
 	}
+	{
+		// Size limit loop
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.sizeLimitLoop(ctx, i.wal)
+				level.Info(i.logger).Log("msg", "size limit loop stopped")
+				return nil
+			},
+			func(err error) {
+				level.Info(i.logger).Log("msg", "stopping size limit loop...")
+				contextCancel()
+			},
+		)
+	}
+	{
+		// Aggregation loop
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.aggregator.Run(ctx)
+				level.Info(i.logger).Log("msg", "aggregation loop stopped")
+				return nil
+			},
+			func(err error) {
+				level.Info(i.logger).Log("msg", "stopping aggregation loop...")
+				contextCancel()
+			},
+		)
+	}
+	if i.localStore != nil {
+		// Local store truncation loop
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.localStore.Run(ctx)
+				level.Info(i.logger).Log("msg", "local store truncation loop stopped")
+				return nil
+			},
+			func(err error) {
+				level.Info(i.logger).Log("msg", "stopping local store truncation loop...")
+				contextCancel()
+			},
+		)
+	}
+	if i.ruler != nil {
+		// Rule evaluation
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.ruler.Run(ctx)
+				level.Info(i.logger).Log("msg", "ruler stopped")
+				return nil
+			},
+			func(err error) {
+				level.Info(i.logger).Log("msg", "stopping ruler...")
+				contextCancel()
+			},
+		)
+	}
 	{
 		sm, err := i.readyScrapeManager.Get()
 		if err != nil {
@@ -377,6 +589,12 @@ func (i *Instance) Run(ctx context.Context) error {
 				if err := i.storage.Close(); err != nil {
 					level.Error(i.logger).Log("msg", "error stopping storage", "err", err)
 				}
+
+				// The outbox is stopped last so batches flushed by the remote
+				// storage while closing are still buffered.
+				i.outbox.Stop()
+
+				stopOTLPExporters(i.logger, i.otlpExporters)
 			},
 		)
 	}
@@ -408,6 +626,7 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 	if err != nil {
 		return fmt.Errorf("error creating WAL: %w", err)
 	}
+	i.wal.SetCardinalityLimits(cfg.SeriesLimits.cardinalityLimits())
 
 	i.writeHandler = remote.NewWriteHandler(i.logger, reg, i.wal)
 
@@ -421,26 +640,65 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 	// Set up the remote storage
 	remoteLogger := log.With(i.logger, "component", "remote")
 	i.remoteStore = remote.NewStorage(remoteLogger, reg, i.wal.StartTime, i.wal.Directory(), cfg.RemoteFlushDeadline, i.readyScrapeManager)
+	rws, err := remoteWriteConfigs(cfg)
+	if err != nil {
+		return fmt.Errorf("failed applying remote_write routes: %w", err)
+	}
+	if cfg.ScrapeNativeHistograms {
+		rws = sendNativeHistograms(rws)
+	}
 	uid := agentseed.Get().UID
-	for _, rw := range cfg.RemoteWrite {
+	for _, rw := range rws {
 		if rw.Headers == nil {
 			rw.Headers = map[string]string{}
 		}
 		rw.Headers[agentseed.HeaderName] = uid
 	}
+	i.outbox = outbox.NewManager(log.With(i.logger, "component", "outbox"), reg, filepath.Join(i.wal.Directory(), "outbox"))
+	rws, err = i.outbox.ApplyConfig(cfg.RemoteWriteOutbox, cfg.RemoteWriteProtocol == RemoteWriteProtocolV2, rws)
+	if err != nil {
+		return fmt.Errorf("failed applying config to remote_write outbox: %w", err)
+	}
 	err = i.remoteStore.ApplyConfig(&config.Config{
 		GlobalConfig:       cfg.global.Prometheus,
-		RemoteWriteConfigs: cfg.RemoteWrite,
+		RemoteWriteConfigs: rws,
 	})
 	if err != nil {
 		return fmt.Errorf("failed applying config to remote storage: %w", err)
 	}
 
-	i.storage = storage.NewFanout(i.logger, i.wal, i.remoteStore)
+	if cfg.localStorageEnabled() {
+		i.localStore, err = localstore.New(log.With(i.logger, "component", "local store"), reg, filepath.Join(i.wal.Directory(), "local-store"), cfg.localStorageConfig())
+		if err != nil {
+			return fmt.Errorf("error creating local store: %w", err)
+		}
+		i.storage = storage.NewFanout(i.logger, i.wal, i.remoteStore, i.localStore)
+	} else {
+		i.storage = storage.NewFanout(i.logger, i.wal, i.remoteStore)
+	}
+
+	// Recorded series are written like scraped samples.
+	if cfg.Rules != nil {
+		i.ruler = ruler.New(log.With(i.logger, "component", "ruler"), reg, i.localStore, i.storage)
+		if err := i.ruler.ApplyConfig(*cfg.Rules, "", cfg.global.Prometheus.ExternalLabels); err != nil {
+			return fmt.Errorf("failed applying rules: %w", err)
+		}
+	}
+
+	// Scraped samples go through the aggregator before they're written.
+	i.aggregator = aggregate.New(log.With(i.logger, "component", "aggregator"), reg, i.storage)
+	if err := i.aggregator.ApplyRules(cfg.AggregationRules); err != nil {
+		return fmt.Errorf("failed applying aggregation rules: %w", err)
+	}
 
 	opts := &scrape.Options{
 		ExtraMetrics:      cfg.global.ExtraMetrics,
 		HTTPClientOptions: []config_util.HTTPClientOption{},
+		// Native histograms are only exposed in the protobuf format.
+		EnableProtobufNegotiation: cfg.ScrapeNativeHistograms,
+		// The metadata of the targets types the metrics sent to OTLP
+		// endpoints.
+		PassMetadataInContext: len(cfg.OTLP) > 0,
 	}
 
 	if cfg.global.DisableKeepAlives {
@@ -449,12 +707,23 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 	if cfg.global.IdleConnTimeout > 0 {
 		opts.HTTPClientOptions = append(opts.HTTPClientOptions, config_util.WithIdleConnTimeout(cfg.global.IdleConnTimeout))
 	}
-	scrapeManager := newScrapeManager(opts, log.With(i.logger, "component", "scrape manager"), i.storage)
+	// Scraped samples go through the aggregator and the series limits of the
+	// WAL first, and the kept ones are sent to the OTLP endpoints as scraped,
+	// since translating them needs the scrape target.
+	i.otlpExporters, i.otlpAppendables, err = newOTLPExporters(log.With(i.logger, "component", "otlp"), cfg)
+	if err != nil {
+		return fmt.Errorf("error creating otlp exporters: %w", err)
+	}
+	app := i.withOTLP(i.aggregator)
+
+	scrapeManager := newScrapeManager(opts, log.With(i.logger, "component", "scrape manager"), app)
 	err = scrapeManager.ApplyConfig(&config.Config{
 		GlobalConfig:  cfg.global.Prometheus,
 		ScrapeConfigs: cfg.ScrapeConfigs,
 	})
 	if err != nil {
+		stopOTLPExporters(i.logger, i.otlpExporters)
+		i.otlpExporters, i.otlpAppendables = nil, nil
 		return fmt.Errorf("failed applying config to scrape manager: %w", err)
 	}
 
@@ -491,6 +760,14 @@ func (i *Instance) Update(c Config) (err error) {
 		err = errImmutableField{Field: "remote_flush_deadline"}
 	case i.cfg.WriteStaleOnShutdown != c.WriteStaleOnShutdown:
 		err = errImmutableField{Field: "write_stale_on_shutdown"}
+	case i.cfg.ScrapeNativeHistograms != c.ScrapeNativeHistograms:
+		err = errImmutableField{Field: "scrape_native_histograms"}
+	case i.cfg.localStorageEnabled() != c.localStorageEnabled():
+		err = errImmutableField{Field: "local_storage"}
+	case (i.cfg.Rules == nil) != (c.Rules == nil):
+		err = errImmutableField{Field: "rules"}
+	case !util.CompareYAML(i.cfg.OTLP, c.OTLP):
+		err = errImmutableField{Field: "otlp"}
 	}
 	if err != nil {
 		return ErrInvalidUpdate{Inner: err}
@@ -528,14 +805,40 @@ func (i *Instance) Update(c Config) (err error) {
 		i.hostFilter.PatchSD(c.ScrapeConfigs)
 	}
 
+	rws, err := remoteWriteConfigs(&c)
+	if err != nil {
+		return fmt.Errorf("error applying new remote_write routes: %w", err)
+	}
+	if c.ScrapeNativeHistograms {
+		rws = sendNativeHistograms(rws)
+	}
+	rws, err = i.outbox.ApplyConfig(c.RemoteWriteOutbox, c.RemoteWriteProtocol == RemoteWriteProtocolV2, rws)
+	if err != nil {
+		return fmt.Errorf("error applying new remote_write outbox config: %w", err)
+	}
 	err = i.remoteStore.ApplyConfig(&config.Config{
 		GlobalConfig:       c.global.Prometheus,
-		RemoteWriteConfigs: c.RemoteWrite,
+		RemoteWriteConfigs: rws,
 	})
 	if err != nil {
 		return fmt.Errorf("error applying new remote_write configs: %w", err)
 	}
 
+	err = i.aggregator.ApplyRules(c.AggregationRules)
+	if err != nil {
+		return fmt.Errorf("error applying new aggregation rules: %w", err)
+	}
+
+	if i.localStore != nil {
+		i.localStore.ApplyConfig(c.localStorageConfig())
+	}
+	if i.ruler != nil {
+		err = i.ruler.ApplyConfig(*c.Rules, "", c.global.Prometheus.ExternalLabels)
+		if err != nil {
+			return fmt.Errorf("error applying new rules: %w", err)
+		}
+	}
+
 	sm, err := i.readyScrapeManager.Get()
 	if err != nil {
 		return fmt.Errorf("couldn't get scrape manager to apply new scrape configs: %w", err)
@@ -557,6 +860,7 @@ func (i *Instance) Update(c Config) (err error) {
 		return fmt.Errorf("failed applying configs to discovery manager: %w", err)
 	}
 
+	i.wal.SetCardinalityLimits(c.SeriesLimits.cardinalityLimits())
 	return nil
 }
 
@@ -580,6 +884,54 @@ func (i *Instance) TargetsActive() map[string][]*scrape.Target {
 	return mgr.TargetsActive()
 }
 
+// TargetSeries returns the series usage of the target with the given job and
+// instance labels. ok is false if the instance is not running.
+func (i *Instance) TargetSeries(job, instance string) (usage wal.TargetSeries, ok bool) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.wal == nil {
+		return wal.TargetSeries{}, false
+	}
+	return i.wal.TargetSeries(job, instance), true
+}
+
+// SetTargetOwner shards the targets of the instance across a cluster of
+// agents: only targets owned by this agent are scraped, and targets which
+// moved to another agent are still scraped for the handover period. It must
+// be called before Run.
+func (i *Instance) SetTargetOwner(owner TargetOwner, handover time.Duration) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+	i.targetOwner = owner
+	i.targetHandover = handover
+}
+
+// ShardedTargets returns the discovered targets of the instance along with
+// their owners. It returns nil if targets aren't sharded.
+func (i *Instance) ShardedTargets() []ShardedTarget {
+	i.mut.Lock()
+	sharder := i.targetSharder
+	i.mut.Unlock()
+
+	if sharder == nil {
+		return nil
+	}
+	return sharder.Targets()
+}
+
+// LocalStorage returns the store of recent samples of the instance, or nil if
+// local storage isn't enabled.
+func (i *Instance) LocalStorage() storage.Queryable {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.localStore == nil {
+		return nil
+	}
+	return i.localStore
+}
+
 // StorageDirectory returns the directory where this Instance is writing series
 // and samples to for the WAL.
 func (i *Instance) StorageDirectory() string {
@@ -592,9 +944,10 @@ func (i *Instance) WriteHandler() http.Handler {
 	return i.writeHandler
 }
 
-// Appender returns a storage.Appender from the instance's WAL
+// Appender returns a storage.Appender from the instance's WAL. Samples are
+// also sent to the OTLP endpoints of the instance, if any.
 func (i *Instance) Appender(ctx context.Context) storage.Appender {
-	return i.wal.Appender(ctx)
+	return i.withOTLP(i.wal).Appender(ctx)
 }
 
 type discoveryService struct {
@@ -661,6 +1014,24 @@ func (i *Instance) newDiscoveryManager(ctx context.Context, cfg *Config) (*disco
 		syncChFunc = i.hostFilter.SyncCh
 	}
 
+	// If targets are sharded, only pass on those owned by this agent.
+	if i.targetOwner != nil {
+		sharder := NewTargetSharder(log.With(i.logger, "component", "target sharder"), i.targetOwner, i.targetHandover)
+		i.targetSharder = sharder
+
+		inputCh := syncChFunc()
+		rg.Add(func() error {
+			sharder.Run(inputCh)
+			level.Info(i.logger).Log("msg", "target sharder stopped")
+			return nil
+		}, func(_ error) {
+			level.Info(i.logger).Log("msg", "stopping target sharder...")
+			sharder.Stop()
+		})
+
+		syncChFunc = sharder.SyncCh
+	}
+
 	return &discoveryService{
 		Manager: manager,
 
@@ -717,6 +1088,37 @@ func (i *Instance) truncateLoop(ctx context.Context, wal walStorage, cfg *Config
 	}
 }
 
+// walSizeCheckFrequency is how often the size limits of the WAL are
+// enforced. It is much shorter than the truncation frequency so the WAL can't
+// fill the disk between two checks.
+var walSizeCheckFrequency = 30 * time.Second
+
+// sizeLimitLoop periodically evicts the oldest data from the WAL when it
+// exceeds max_wal_size or leaves less than min_free_disk on the disk.
+func (i *Instance) sizeLimitLoop(ctx context.Context, wal walStorage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(walSizeCheckFrequency):
+			if err := wal.EnforceSizeLimits(i.walSizeLimits()); err != nil {
+				level.Warn(i.logger).Log("msg", "could not enforce WAL size limits", "err", err)
+			}
+		}
+	}
+}
+
+// walSizeLimits returns the size limits of the WAL from the current config.
+func (i *Instance) walSizeLimits() wal.SizeLimits {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	return wal.SizeLimits{
+		MaxSize:     uint64(i.cfg.MaxWALSize),
+		MinFreeDisk: uint64(i.cfg.MinFreeDisk),
+	}
+}
+
 // getRemoteWriteTimestamp looks up the last successful remote write timestamp.
 // This is passed to wal.Storage for its truncation. If no remote write sections
 // are configured, getRemoteWriteTimestamp returns the current time.
@@ -724,7 +1126,7 @@ func (i *Instance) getRemoteWriteTimestamp() int64 {
 	i.mut.Lock()
 	defer i.mut.Unlock()
 
-	if len(i.cfg.RemoteWrite) == 0 {
+	if len(i.cfg.RemoteWrite) == 0 && len(i.cfg.RemoteWriteRoutes) == 0 {
 		return timestamp.FromTime(time.Now())
 	}
 
@@ -747,6 +1149,9 @@ type walStorage interface {
 	WriteStalenessMarkers(remoteTsFunc func() int64) error
 	Appender(context.Context) storage.Appender
 	Truncate(mint int64) error
+	EnforceSizeLimits(limits wal.SizeLimits) error
+	SetCardinalityLimits(limits wal.CardinalityLimits)
+	TargetSeries(job, instance string) wal.TargetSeries
 
 	Close() error
 }
@@ -3,6 +3,8 @@ package instance
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
@@ -12,7 +14,14 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/aggregate"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/localstore"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/outbox"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/ruler"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/wal"
+	"github.com/blockopsnetwork/telescope/internal/static/otlp"
 	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/model"
@@ -24,6 +33,7 @@ import (
 	"github.com/prometheus/prometheus/model/metadata"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 )
 
 func TestConfig_Unmarshal_Defaults(t *testing.T) {
@@ -55,6 +65,130 @@ remote_write:
 	}
 }
 
+func TestConfig_Unmarshal_SizeLimits(t *testing.T) {
+	cfgText := `name: test
+max_wal_size: 512MiB
+min_free_disk: 2GiB`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.Equal(t, flagext.Bytes(512<<20), cfg.MaxWALSize)
+	require.Equal(t, flagext.Bytes(2<<30), cfg.MinFreeDisk)
+
+	// Unset limits are left out when marshaling.
+	cfg.MaxWALSize, cfg.MinFreeDisk = 0, 0
+	bb, err := MarshalConfig(cfg, false)
+	require.NoError(t, err)
+	require.NotContains(t, string(bb), "max_wal_size")
+	require.NotContains(t, string(bb), "min_free_disk")
+}
+
+func TestConfig_Unmarshal_SeriesLimits(t *testing.T) {
+	cfgText := `name: test
+series_limits:
+  per_target: 10000
+  jobs:
+    erigon:
+      per_target: 50000
+      per_job: 100000`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.Equal(t, wal.CardinalityLimits{
+		Default: wal.SeriesLimit{PerTarget: 10000},
+		Jobs: map[string]wal.SeriesLimit{
+			"erigon": {PerTarget: 50000, PerJob: 100000},
+		},
+	}, cfg.SeriesLimits.cardinalityLimits())
+
+	// Limits are disabled by default.
+	cfg, err = UnmarshalConfig(strings.NewReader("name: test"))
+	require.NoError(t, err)
+	require.Equal(t, wal.CardinalityLimits{}, cfg.SeriesLimits.cardinalityLimits())
+}
+
+func TestConfig_Unmarshal_RemoteWriteOutbox(t *testing.T) {
+	cfgText := `name: test
+remote_write_outbox:
+  max_size: 256MiB`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.NotNil(t, cfg.RemoteWriteOutbox)
+	require.Equal(t, flagext.Bytes(256<<20), cfg.RemoteWriteOutbox.MaxSize)
+	require.Equal(t, outbox.DefaultConfig.MaxAge, cfg.RemoteWriteOutbox.MaxAge)
+
+	cfg, err = UnmarshalConfig(strings.NewReader("name: test"))
+	require.NoError(t, err)
+	require.Nil(t, cfg.RemoteWriteOutbox)
+}
+
+func TestConfig_Unmarshal_OTLP(t *testing.T) {
+	cfgText := `name: test
+otlp:
+  - endpoint: otel-collector:4317
+    insecure: true`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.Len(t, cfg.OTLP, 1)
+	require.Equal(t, otlp.ProtocolGRPC, cfg.OTLP[0].Protocol)
+	require.True(t, cfg.OTLP[0].Insecure)
+
+	_, err = UnmarshalConfig(strings.NewReader(`name: test
+otlp:
+  - endpoint: otel-collector:4317
+    protocol: thrift`))
+	require.ErrorContains(t, err, `unsupported otlp protocol "thrift"`)
+}
+
+func TestConfig_Unmarshal_AggregationRules(t *testing.T) {
+	cfgText := `name: test
+aggregation_rules:
+- match: '{__name__=~"p2p_peer_.*"}'
+  by: [job]
+  intervals: [1m, 5m]
+  aggregations: [sum, max]
+  quantiles: [0.99]
+  drop_raw: true`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.Equal(t, []aggregate.Rule{{
+		Match:        `{__name__=~"p2p_peer_.*"}`,
+		By:           []string{"job"},
+		Intervals:    []time.Duration{time.Minute, 5 * time.Minute},
+		Aggregations: []string{aggregate.Sum, aggregate.Max},
+		Quantiles:    []float64{0.99},
+		DropRaw:      true,
+	}}, cfg.AggregationRules)
+}
+
+func TestConfig_Unmarshal_Rules(t *testing.T) {
+	cfgText := `name: test
+rules:
+  rule_files: [/etc/telescope/rules/*.yml]
+  alertmanager_urls: [http://alertmanager:9093]`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.Equal(t, &ruler.Config{
+		RuleFiles:          []string{"/etc/telescope/rules/*.yml"},
+		EvaluationInterval: time.Minute,
+		AlertmanagerURLs:   []string{"http://alertmanager:9093"},
+	}, cfg.Rules)
+	require.Nil(t, cfg.LocalStorage)
+
+	// Rules need the local store, which is enabled with defaults.
+	require.True(t, cfg.localStorageEnabled())
+	require.Equal(t, localstore.DefaultConfig, cfg.localStorageConfig())
+
+	_, err = UnmarshalConfig(strings.NewReader(`name: test
+rules:
+  webhook_urls: [ftp://example.com]`))
+	require.ErrorContains(t, err, "scheme must be http or https")
+}
+
 func TestConfig_ApplyDefaults_Validations(t *testing.T) {
 	global := DefaultGlobalConfig
 	cfg := DefaultConfig
@@ -136,6 +270,16 @@ func TestConfig_ApplyDefaults_Validations(t *testing.T) {
 			},
 			fmt.Errorf("found duplicate remote write configs with name \"foo\""),
 		},
+		{
+			"invalid aggregation rule",
+			func(c *Config) { c.AggregationRules = []aggregate.Rule{{Match: `{__name__="up"}`}} },
+			fmt.Errorf("invalid aggregation rule 0: at least one interval must be set"),
+		},
+		{
+			"unsupported remote write protocol",
+			func(c *Config) { c.RemoteWriteProtocol = "3.0" },
+			fmt.Errorf("unsupported remote_write_protocol \"3.0\", must be \"1.0\" or \"2.0\""),
+		},
 	}
 
 	for _, tc := range tt {
@@ -242,6 +386,39 @@ func TestInstance(t *testing.T) {
 	}, slowBackoff)
 }
 
+func TestInstance_SizeLimits(t *testing.T) {
+	scrapeAddr, closeSrv := getTestServer(t)
+	defer closeSrv()
+
+	prevFrequency := walSizeCheckFrequency
+	walSizeCheckFrequency = 10 * time.Millisecond
+	defer func() { walSizeCheckFrequency = prevFrequency }()
+
+	globalConfig := getTestGlobalConfig(t)
+	cfg := getTestConfig(t, &globalConfig, scrapeAddr)
+	cfg.WALTruncateFrequency = time.Hour
+	cfg.RemoteFlushDeadline = time.Hour
+	cfg.MaxWALSize = 512 << 20
+	cfg.MinFreeDisk = 2 << 30
+
+	mockStorage := mockWalStorage{
+		series:    make(map[storage.SeriesRef]int),
+		directory: t.TempDir(),
+	}
+	newWal := func(_ prometheus.Registerer) (walStorage, error) { return &mockStorage, nil }
+
+	inst, err := newInstance(cfg, nil, log.NewNopLogger(), newWal)
+	require.NoError(t, err)
+	runInstance(t, inst)
+
+	util.EventuallyWithBackoff(t, func(t require.TestingT) {
+		mockStorage.mut.Lock()
+		defer mockStorage.mut.Unlock()
+		require.NotEmpty(t, mockStorage.limits)
+		require.Equal(t, wal.SizeLimits{MaxSize: 512 << 20, MinFreeDisk: 2 << 30}, mockStorage.limits[0])
+	}, slowBackoff)
+}
+
 // TestInstance_Recreate ensures that creating an instance with the same name twice
 // does not cause any duplicate metrics registration that leads to a panic.
 func TestInstance_Recreate(t *testing.T) {
@@ -287,6 +464,124 @@ func TestInstance_Recreate(t *testing.T) {
 	})
 }
 
+func TestInstance_OTLP(t *testing.T) {
+	scrapeAddr, closeSrv := getTestServer(t)
+	defer closeSrv()
+
+	requests := make(chan pmetricotlp.ExportRequest, 10)
+	otlpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := pmetricotlp.NewExportRequest()
+		require.NoError(t, req.UnmarshalProto(body))
+		select {
+		case requests <- req:
+		default:
+		}
+
+		resp, _ := pmetricotlp.NewExportResponse().MarshalProto()
+		rw.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = rw.Write(resp)
+	}))
+	defer otlpSrv.Close()
+
+	globalConfig := getTestGlobalConfig(t)
+	globalConfig.Prometheus.ExternalLabels = labels.FromStrings("network", "mainnet")
+	cfg := getTestConfig(t, &globalConfig, scrapeAddr)
+	cfg.WALTruncateFrequency = time.Hour
+	cfg.RemoteFlushDeadline = time.Hour
+	otlpCfg := otlp.DefaultConfig
+	otlpCfg.Endpoint = otlpSrv.URL
+	otlpCfg.Protocol = otlp.ProtocolHTTP
+	otlpCfg.Compression = otlp.CompressionNone
+	cfg.OTLP = []otlp.Config{otlpCfg}
+
+	mockStorage := mockWalStorage{
+		series:    make(map[storage.SeriesRef]int),
+		directory: t.TempDir(),
+	}
+	newWal := func(_ prometheus.Registerer) (walStorage, error) { return &mockStorage, nil }
+
+	inst, err := newInstance(cfg, nil, log.NewNopLogger(), newWal)
+	require.NoError(t, err)
+	runInstance(t, inst)
+
+	// Samples are still written to the WAL.
+	util.EventuallyWithBackoff(t, func(t require.TestingT) {
+		mockStorage.mut.Lock()
+		defer mockStorage.mut.Unlock()
+		require.True(t, len(mockStorage.series) > 0)
+	}, slowBackoff)
+
+	// The first scrape only sets the start time of the counter, so look for
+	// it in any of the requests.
+	util.EventuallyWithBackoff(t, func(t require.TestingT) {
+		var req pmetricotlp.ExportRequest
+		select {
+		case req = <-requests:
+		default:
+			require.FailNow(t, "no request yet")
+		}
+
+		rm := req.Metrics().ResourceMetrics().At(0)
+		serviceName, _ := rm.Resource().Attributes().Get("service.name")
+		require.Equal(t, "test", serviceName.Str())
+		instanceID, _ := rm.Resource().Attributes().Get("service.instance.id")
+		require.Equal(t, scrapeAddr, instanceID.Str())
+
+		var found bool
+		ms := rm.ScopeMetrics().At(0).Metrics()
+		for i := 0; i < ms.Len(); i++ {
+			if ms.At(i).Name() != "test_metric_total" {
+				continue
+			}
+			found = true
+			dp := ms.At(i).Sum().DataPoints().At(0)
+			require.Equal(t, 1.0, dp.DoubleValue())
+			network, _ := dp.Attributes().Get("network")
+			require.Equal(t, "mainnet", network.Str())
+		}
+		require.True(t, found, "test_metric_total not sent")
+	}, slowBackoff)
+}
+
+func TestOTLPAppender_DroppedSamples(t *testing.T) {
+	kept := labels.FromStrings("__name__", "kept_total")
+	dropped := labels.FromStrings("__name__", "dropped_total")
+
+	otlpStorage := mockWalStorage{series: make(map[storage.SeriesRef]int)}
+	app := &otlpAppender{
+		log:  log.NewNopLogger(),
+		next: &droppingAppender{drop: dropped.Hash()},
+		otlp: []storage.Appender{otlpStorage.Appender(context.Background())},
+	}
+
+	ref, err := app.Append(0, kept, 0, 1)
+	require.NoError(t, err)
+	require.NotZero(t, ref)
+	ref, err = app.Append(0, dropped, 0, 1)
+	require.NoError(t, err)
+	require.Zero(t, ref)
+	require.NoError(t, app.Commit())
+
+	// Only the samples kept by the next appender are sent to OTLP endpoints.
+	require.Equal(t, map[storage.SeriesRef]int{storage.SeriesRef(kept.Hash()): 1}, otlpStorage.series)
+}
+
+// droppingAppender drops the samples of a series the way the WAL drops the
+// samples of series over its limits.
+type droppingAppender struct {
+	mockAppender
+	drop uint64
+}
+
+func (a *droppingAppender) Append(_ storage.SeriesRef, l labels.Labels, _ int64, _ float64) (storage.SeriesRef, error) {
+	if l.Hash() == a.drop {
+		return 0, nil
+	}
+	return storage.SeriesRef(l.Hash()), nil
+}
+
 func getTestServer(t *testing.T) (addr string, closeFunc func()) {
 	t.Helper()
 
@@ -346,6 +641,7 @@ type mockWalStorage struct {
 	directory string
 	mut       sync.Mutex
 	series    map[storage.SeriesRef]int
+	limits    []wal.SizeLimits
 }
 
 func (s *mockWalStorage) Directory() string                          { return s.directory }
@@ -354,6 +650,19 @@ func (s *mockWalStorage) WriteStalenessMarkers(f func() int64) error { return ni
 func (s *mockWalStorage) Close() error                               { return nil }
 func (s *mockWalStorage) Truncate(mint int64) error                  { return nil }
 
+func (s *mockWalStorage) SetCardinalityLimits(limits wal.CardinalityLimits) {}
+
+func (s *mockWalStorage) TargetSeries(job, instance string) wal.TargetSeries {
+	return wal.TargetSeries{}
+}
+
+func (s *mockWalStorage) EnforceSizeLimits(limits wal.SizeLimits) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.limits = append(s.limits, limits)
+	return nil
+}
+
 func (s *mockWalStorage) Appender(context.Context) storage.Appender {
 	return &mockAppender{s: s}
 }
@@ -0,0 +1,163 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blockopsnetwork/telescope/internal/component/otelcol/receiver/prometheus/translator"
+	"github.com/blockopsnetwork/telescope/internal/static/otlp"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// newOTLPExporters creates the exporters of the OTLP endpoints of cfg, and
+// the appendables translating scraped samples into OpenTelemetry metrics for
+// them.
+//
+// The translation follows otelcol.receiver.prometheus: the job and instance
+// labels of a target set the service.name and service.instance.id attributes
+// of its resource, and the other labels and the external labels become
+// attributes of the data points.
+func newOTLPExporters(l log.Logger, cfg *Config) ([]*otlp.MetricsExporter, []storage.Appendable, error) {
+	var (
+		exporters   []*otlp.MetricsExporter
+		appendables []storage.Appendable
+	)
+	for idx, otlpCfg := range cfg.OTLP {
+		name := fmt.Sprintf("%s/%d", cfg.Name, idx)
+		exp, err := otlp.NewMetricsExporter(l, name, otlpCfg)
+		if err == nil {
+			var app storage.Appendable
+			app, err = translator.NewAppendable(exp, otlp.ReceiverSettings(l, name), cfg.global.Prometheus.ExternalLabels)
+			appendables = append(appendables, app)
+			exporters = append(exporters, exp)
+		}
+		if err != nil {
+			stopOTLPExporters(l, exporters)
+			return nil, nil, err
+		}
+	}
+	return exporters, appendables, nil
+}
+
+func stopOTLPExporters(l log.Logger, exporters []*otlp.MetricsExporter) {
+	for _, exp := range exporters {
+		if err := exp.Shutdown(context.Background()); err != nil {
+			level.Error(l).Log("msg", "failed to stop otlp exporter", "err", err)
+		}
+	}
+}
+
+// withOTLP returns an appendable passing samples to next and to the OTLP
+// endpoints of the instance, if any.
+func (i *Instance) withOTLP(next storage.Appendable) storage.Appendable {
+	if len(i.otlpAppendables) == 0 {
+		return next
+	}
+	return &otlpAppendable{log: i.logger, next: next, otlp: i.otlpAppendables}
+}
+
+// otlpAppendable passes scraped samples to the next appendable and to the
+// appendables of OTLP endpoints. Failing to append to an OTLP endpoint
+// doesn't fail the scrape.
+//
+// Only the samples kept by the next appendable are sent to the OTLP
+// endpoints, so that the series limits of the WAL and the raw series dropped
+// by aggregation rules apply to them too. Appenders report a dropped sample by
+// returning a zero reference without an error.
+type otlpAppendable struct {
+	log  log.Logger
+	next storage.Appendable
+	otlp []storage.Appendable
+}
+
+// Appender implements storage.Appendable.
+func (a *otlpAppendable) Appender(ctx context.Context) storage.Appender {
+	app := &otlpAppender{log: a.log, next: a.next.Appender(ctx)}
+	for _, o := range a.otlp {
+		app.otlp = append(app.otlp, o.Appender(ctx))
+	}
+	return app
+}
+
+type otlpAppender struct {
+	log  log.Logger
+	next storage.Appender
+	otlp []storage.Appender
+}
+
+var _ storage.Appender = (*otlpAppender)(nil)
+
+func (app *otlpAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	ref, err := app.next.Append(ref, l, t, v)
+	if err != nil || ref == 0 {
+		return ref, err
+	}
+	for _, o := range app.otlp {
+		_, _ = o.Append(0, l, t, v)
+	}
+	return ref, nil
+}
+
+func (app *otlpAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	ref, err := app.next.AppendExemplar(ref, l, e)
+	if err != nil || ref == 0 {
+		return ref, err
+	}
+	for _, o := range app.otlp {
+		_, _ = o.AppendExemplar(0, l, e)
+	}
+	return ref, nil
+}
+
+func (app *otlpAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	ref, err := app.next.AppendHistogram(ref, l, t, h, fh)
+	if err != nil || ref == 0 {
+		return ref, err
+	}
+	for _, o := range app.otlp {
+		_, _ = o.AppendHistogram(0, l, t, h, fh)
+	}
+	return ref, nil
+}
+
+func (app *otlpAppender) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
+	ref, err := app.next.UpdateMetadata(ref, l, m)
+	if err != nil {
+		return ref, err
+	}
+	for _, o := range app.otlp {
+		_, _ = o.UpdateMetadata(0, l, m)
+	}
+	return ref, nil
+}
+
+func (app *otlpAppender) Commit() error {
+	err := app.next.Commit()
+	if err != nil {
+		app.rollbackOTLP()
+		return err
+	}
+	for _, o := range app.otlp {
+		if err := o.Commit(); err != nil {
+			level.Warn(app.log).Log("msg", "failed to send scraped samples to otlp endpoint", "err", err)
+		}
+	}
+	return nil
+}
+
+func (app *otlpAppender) Rollback() error {
+	app.rollbackOTLP()
+	return app.next.Rollback()
+}
+
+func (app *otlpAppender) rollbackOTLP() {
+	for _, o := range app.otlp {
+		_ = o.Rollback()
+	}
+}
@@ -0,0 +1,193 @@
+package instance
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// tenantHeader is the header holding the tenant of a remote_write request.
+const tenantHeader = "X-Scope-OrgID"
+
+// RouteConfig sends the series matching a selector to their own remote_write
+// endpoint instead of the remote_write endpoints of the instance.
+type RouteConfig struct {
+	// Selector of the series to route, e.g., {project_id="customer-a"}.
+	Match string `yaml:"match"`
+	// Tenant of the routed series, sent as the X-Scope-OrgID header.
+	TenantID    string                    `yaml:"tenant_id,omitempty"`
+	RemoteWrite *config.RemoteWriteConfig `yaml:"remote_write"`
+}
+
+// matchers parses the selector of the route.
+func (r *RouteConfig) matchers() ([]*labels.Matcher, error) {
+	ms, err := parser.ParseMetricSelector(r.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	return ms, nil
+}
+
+// validate checks the route and fills in the tenant header.
+func (r *RouteConfig) validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("match must be set")
+	}
+	if _, err := r.matchers(); err != nil {
+		return err
+	}
+	if r.RemoteWrite == nil {
+		return fmt.Errorf("remote_write must be set")
+	}
+
+	if r.TenantID != "" {
+		if tenant, ok := r.RemoteWrite.Headers[tenantHeader]; ok && tenant != r.TenantID {
+			return fmt.Errorf("tenant_id %q conflicts with %s header %q", r.TenantID, tenantHeader, tenant)
+		}
+		if r.RemoteWrite.Headers == nil {
+			r.RemoteWrite.Headers = map[string]string{}
+		}
+		r.RemoteWrite.Headers[tenantHeader] = r.TenantID
+	}
+	return nil
+}
+
+// remoteWriteConfigs returns the remote_write configs to apply for c. Each
+// route gets its own endpoint, which only receives the series matching it,
+// while the remote_write endpoints of the instance only receive the series
+// matching no route. A series matching several routes is sent to all of them.
+//
+// The returned configs are copies; c is left untouched.
+func remoteWriteConfigs(c *Config) ([]*config.RemoteWriteConfig, error) {
+	if len(c.RemoteWriteRoutes) == 0 {
+		return c.RemoteWrite, nil
+	}
+
+	var (
+		res      = make([]*config.RemoteWriteConfig, 0, len(c.RemoteWrite)+len(c.RemoteWriteRoutes))
+		matching []*relabel.Config
+		dropAll  []*relabel.Config
+	)
+	for i, route := range c.RemoteWriteRoutes {
+		ms, err := route.matchers()
+		if err != nil {
+			return nil, err
+		}
+		mark := model.LabelName(fmt.Sprintf("__tmp_route_%d", i))
+		match, matched := routeRelabelConfigs(mark, ms)
+
+		rw := copyRemoteWrite(route.RemoteWrite)
+		rw.WriteRelabelConfigs = concatRelabelConfigs(
+			match,
+			[]*relabel.Config{newRelabelConfig(relabel.Keep, []model.LabelName{mark}, matched)},
+			[]*relabel.Config{newRelabelConfig(relabel.LabelDrop, nil, string(mark))},
+			route.RemoteWrite.WriteRelabelConfigs,
+		)
+		res = append(res, rw)
+
+		matching = append(matching, match...)
+		dropAll = append(dropAll, newRelabelConfig(relabel.Drop, []model.LabelName{mark}, matched))
+	}
+
+	for _, rw := range c.RemoteWrite {
+		cp := copyRemoteWrite(rw)
+		cp.WriteRelabelConfigs = concatRelabelConfigs(
+			matching,
+			dropAll,
+			[]*relabel.Config{newRelabelConfig(relabel.LabelDrop, nil, `__tmp_route_\d+`)},
+			rw.WriteRelabelConfigs,
+		)
+		res = append(res, cp)
+	}
+	return res, nil
+}
+
+// routeRelabelConfigs returns relabel configs which set mark to the returned
+// value if a series matches all of ms.
+//
+// Relabel rules can't negate a regex, so the conjunction is built up in
+// steps: mark is set to "1" first, then grows by a "1" for each positive
+// matcher of the series which matches while mark is still complete. Negative
+// matchers clear mark if the series matches their inverse.
+func routeRelabelConfigs(mark model.LabelName, ms []*labels.Matcher) (rcs []*relabel.Config, matched string) {
+	set := newRelabelConfig(relabel.Replace, nil, "(.*)")
+	set.TargetLabel, set.Replacement = string(mark), "1"
+	rcs = append(rcs, set)
+
+	matched = "1"
+	for _, m := range ms {
+		if m.Type != labels.MatchEqual && m.Type != labels.MatchRegexp {
+			continue
+		}
+		rc := newRelabelConfig(relabel.Replace, []model.LabelName{mark, model.LabelName(m.Name)}, matched+";(?:"+matcherRegex(m)+")")
+		rc.TargetLabel, rc.Replacement = string(mark), matched+"1"
+		rcs = append(rcs, rc)
+		matched += "1"
+	}
+	for _, m := range ms {
+		if m.Type != labels.MatchNotEqual && m.Type != labels.MatchNotRegexp {
+			continue
+		}
+		rc := newRelabelConfig(relabel.Replace, []model.LabelName{model.LabelName(m.Name)}, matcherRegex(m))
+		rc.TargetLabel, rc.Replacement = string(mark), ""
+		rcs = append(rcs, rc)
+	}
+	return rcs, matched
+}
+
+// matcherRegex returns the regex matching the values matched by m, or by its
+// inverse for negative matchers.
+func matcherRegex(m *labels.Matcher) string {
+	switch m.Type {
+	case labels.MatchEqual, labels.MatchNotEqual:
+		return regexp.QuoteMeta(m.Value)
+	default:
+		return m.Value
+	}
+}
+
+func newRelabelConfig(action relabel.Action, source []model.LabelName, regex string) *relabel.Config {
+	rc := relabel.DefaultRelabelConfig
+	rc.Action = action
+	rc.SourceLabels = source
+	rc.Regex = relabel.MustNewRegexp(regex)
+	return &rc
+}
+
+func concatRelabelConfigs(rcs ...[]*relabel.Config) []*relabel.Config {
+	var res []*relabel.Config
+	for _, rc := range rcs {
+		res = append(res, rc...)
+	}
+	return res
+}
+
+// sendNativeHistograms returns copies of rws which send native histograms.
+func sendNativeHistograms(rws []*config.RemoteWriteConfig) []*config.RemoteWriteConfig {
+	res := make([]*config.RemoteWriteConfig, 0, len(rws))
+	for _, rw := range rws {
+		cp := copyRemoteWrite(rw)
+		cp.SendNativeHistograms = true
+		res = append(res, cp)
+	}
+	return res
+}
+
+// copyRemoteWrite returns a copy of rw whose headers and relabel configs can
+// be changed without affecting rw.
+func copyRemoteWrite(rw *config.RemoteWriteConfig) *config.RemoteWriteConfig {
+	cp := *rw
+	cp.WriteRelabelConfigs = append([]*relabel.Config(nil), rw.WriteRelabelConfigs...)
+	if rw.Headers != nil {
+		cp.Headers = make(map[string]string, len(rw.Headers))
+		for k, v := range rw.Headers {
+			cp.Headers[k] = v
+		}
+	}
+	return &cp
+}
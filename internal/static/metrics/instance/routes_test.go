@@ -0,0 +1,173 @@
+package instance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteWriteConfigs(t *testing.T) {
+	cfgText := `
+name: test
+remote_write:
+- name: default
+  url: http://default/push
+remote_write_routes:
+- match: '{project_id="a"}'
+  tenant_id: tenant-a
+  remote_write:
+    name: a
+    url: http://a/push
+    basic_auth:
+      username: a
+      password: secret
+- match: '{project_id=~"b|c", env!="dev"}'
+  remote_write:
+    name: bc
+    url: http://bc/push
+    headers:
+      X-Scope-OrgID: tenant-bc
+    write_relabel_configs:
+    - action: labeldrop
+      regex: env
+`
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ApplyDefaults(DefaultGlobalConfig))
+	require.Equal(t, "tenant-a", cfg.RemoteWriteRoutes[0].RemoteWrite.Headers[tenantHeader])
+
+	rws, err := remoteWriteConfigs(cfg)
+	require.NoError(t, err)
+	require.Len(t, rws, 3)
+
+	endpoints := map[string]*config.RemoteWriteConfig{}
+	for _, rw := range rws {
+		endpoints[rw.Name] = rw
+	}
+	require.Equal(t, "tenant-bc", endpoints["bc"].Headers[tenantHeader])
+
+	// The configs of the instance are left untouched.
+	require.Empty(t, cfg.RemoteWrite[0].WriteRelabelConfigs)
+	require.Len(t, cfg.RemoteWriteRoutes[1].RemoteWrite.WriteRelabelConfigs, 1)
+
+	tt := []struct {
+		name   string
+		series labels.Labels
+		expect map[string]labels.Labels
+	}{
+		{
+			name:   "route a",
+			series: labels.FromStrings("__name__", "up", "project_id", "a"),
+			expect: map[string]labels.Labels{
+				"a": labels.FromStrings("__name__", "up", "project_id", "a"),
+			},
+		},
+		{
+			name:   "route bc",
+			series: labels.FromStrings("__name__", "up", "project_id", "c", "env", "prod"),
+			expect: map[string]labels.Labels{
+				"bc": labels.FromStrings("__name__", "up", "project_id", "c"),
+			},
+		},
+		{
+			name:   "negative matcher falls through",
+			series: labels.FromStrings("__name__", "up", "project_id", "b", "env", "dev"),
+			expect: map[string]labels.Labels{
+				"default": labels.FromStrings("__name__", "up", "env", "dev", "project_id", "b"),
+			},
+		},
+		{
+			name:   "unmatched",
+			series: labels.FromStrings("__name__", "up", "project_id", "d"),
+			expect: map[string]labels.Labels{
+				"default": labels.FromStrings("__name__", "up", "project_id", "d"),
+			},
+		},
+		{
+			name:   "missing label",
+			series: labels.FromStrings("__name__", "up"),
+			expect: map[string]labels.Labels{
+				"default": labels.FromStrings("__name__", "up"),
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := map[string]labels.Labels{}
+			for name, rw := range endpoints {
+				if lbls, keep := relabel.Process(tc.series, rw.WriteRelabelConfigs...); keep {
+					actual[name] = lbls
+				}
+			}
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+func TestRemoteWriteConfigs_NoRoutes(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Name = "test"
+	cfg.RemoteWrite = []*config.RemoteWriteConfig{{Name: "default"}}
+
+	rws, err := remoteWriteConfigs(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, cfg.RemoteWrite, rws)
+}
+
+func TestRouteConfig_Validate(t *testing.T) {
+	tt := []struct {
+		name   string
+		route  RouteConfig
+		expect string
+	}{
+		{
+			name:   "missing match",
+			route:  RouteConfig{RemoteWrite: &config.RemoteWriteConfig{}},
+			expect: "match must be set",
+		},
+		{
+			name:   "invalid match",
+			route:  RouteConfig{Match: "{project_id=}", RemoteWrite: &config.RemoteWriteConfig{}},
+			expect: `invalid match "{project_id=}"`,
+		},
+		{
+			name:   "missing remote_write",
+			route:  RouteConfig{Match: `{project_id="a"}`},
+			expect: "remote_write must be set",
+		},
+		{
+			name: "conflicting tenant",
+			route: RouteConfig{
+				Match:       `{project_id="a"}`,
+				TenantID:    "a",
+				RemoteWrite: &config.RemoteWriteConfig{Headers: map[string]string{tenantHeader: "b"}},
+			},
+			expect: `tenant_id "a" conflicts with X-Scope-OrgID header "b"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.route.validate()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expect)
+		})
+	}
+}
+
+func TestSendNativeHistograms(t *testing.T) {
+	rws := []*config.RemoteWriteConfig{{Name: "a"}, {Name: "b"}}
+
+	res := sendNativeHistograms(rws)
+	require.Len(t, res, 2)
+	for i, rw := range res {
+		require.True(t, rw.SendNativeHistograms)
+		require.Equal(t, rws[i].Name, rw.Name)
+		require.False(t, rws[i].SendNativeHistograms)
+	}
+}
@@ -0,0 +1,238 @@
+package instance
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// targetShardResyncInterval is how often ownership of targets is checked
+// again, so targets are rebalanced when agents join or leave the cluster.
+var targetShardResyncInterval = 10 * time.Second
+
+// TargetOwner decides which agent of a cluster scrapes a target.
+type TargetOwner interface {
+	// OwnsTarget returns true if the target with the given key should be
+	// scraped by this agent.
+	OwnsTarget(key string) (bool, error)
+	// TargetOwners returns the addresses of the agents owning the target with
+	// the given key.
+	TargetOwners(key string) ([]string, error)
+}
+
+// ShardedTarget is a discovered target and the agents owning it.
+type ShardedTarget struct {
+	Job    string
+	Labels labels.Labels
+	Key    string
+	// Scraped is true if this agent scrapes the target, either because it
+	// owns it or because it's handing it over to its new owner.
+	Scraped bool
+	Owners  []string
+}
+
+// TargetSharder acts as a MITM between the discovery manager and the scrape
+// manager, like HostFilter, filtering out discovered targets which are owned
+// by other agents of the cluster.
+//
+// When a target moves to another agent, the previous owner keeps scraping it
+// for the handover period, so there's no gap in its samples while the new
+// owner picks it up.
+type TargetSharder struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	log      log.Logger
+	owner    TargetOwner
+	handover time.Duration
+
+	outputCh chan DiscoveredGroups
+
+	mut       sync.Mutex
+	groups    DiscoveredGroups
+	lastOwned map[string]time.Time
+	scraped   map[string]struct{}
+}
+
+// NewTargetSharder creates a new TargetSharder.
+func NewTargetSharder(l log.Logger, owner TargetOwner, handover time.Duration) *TargetSharder {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TargetSharder{
+		ctx:    ctx,
+		cancel: cancel,
+
+		log:      l,
+		owner:    owner,
+		handover: handover,
+
+		outputCh:  make(chan DiscoveredGroups),
+		lastOwned: make(map[string]time.Time),
+		scraped:   make(map[string]struct{}),
+	}
+}
+
+// Run filters groups read from syncCh until the TargetSharder is stopped.
+// Ownership is also checked periodically, and the filtered groups are sent
+// again if the set of scraped targets changed.
+func (s *TargetSharder) Run(syncCh GroupChannel) {
+	ticker := time.NewTicker(targetShardResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		var (
+			out     DiscoveredGroups
+			changed bool
+		)
+		select {
+		case <-s.ctx.Done():
+			return
+		case data := <-syncCh:
+			out, _ = s.filter(data, time.Now())
+			changed = true
+		case <-ticker.C:
+			s.mut.Lock()
+			groups := s.groups
+			s.mut.Unlock()
+			if groups == nil {
+				continue
+			}
+			out, changed = s.filter(groups, time.Now())
+		}
+		if !changed {
+			continue
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case s.outputCh <- out:
+		}
+	}
+}
+
+// Stop stops the TargetSharder from processing more target updates.
+func (s *TargetSharder) Stop() {
+	s.cancel()
+}
+
+// SyncCh returns a read only channel used by all the clients to receive
+// target updates.
+func (s *TargetSharder) SyncCh() GroupChannel {
+	return s.outputCh
+}
+
+// filter returns the targets of in which should be scraped by this agent, and
+// whether they changed since the last call.
+func (s *TargetSharder) filter(in DiscoveredGroups, now time.Time) (DiscoveredGroups, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var (
+		out     = make(DiscoveredGroups, len(in))
+		scraped = make(map[string]struct{}, len(s.scraped))
+		errored bool
+	)
+	for job, groups := range in {
+		groupList := make([]*targetgroup.Group, 0, len(groups))
+
+		for _, group := range groups {
+			newGroup := &targetgroup.Group{
+				Targets: make([]model.LabelSet, 0, len(group.Targets)),
+				Labels:  group.Labels,
+				Source:  group.Source,
+			}
+
+			for _, target := range group.Targets {
+				key := TargetKey(job, mergeSets(target, group.Labels))
+
+				owned, err := s.owner.OwnsTarget(key)
+				if err != nil {
+					// Keep the previous decision until ownership is known.
+					errored = true
+					_, owned = s.scraped[key]
+				}
+				if owned {
+					s.lastOwned[key] = now
+				}
+				if last, ok := s.lastOwned[key]; !ok || now.Sub(last) > s.handover {
+					delete(s.lastOwned, key)
+					continue
+				}
+
+				scraped[key] = struct{}{}
+				newGroup.Targets = append(newGroup.Targets, target)
+			}
+
+			groupList = append(groupList, newGroup)
+		}
+
+		out[job] = groupList
+	}
+	if errored {
+		level.Warn(s.log).Log("msg", "failed to check ownership of targets, keeping previous assignment")
+	}
+
+	// Forget targets which are no longer discovered.
+	for key := range s.lastOwned {
+		if _, ok := scraped[key]; !ok {
+			delete(s.lastOwned, key)
+		}
+	}
+
+	changed := len(scraped) != len(s.scraped)
+	for key := range scraped {
+		if _, ok := s.scraped[key]; !ok {
+			changed = true
+			break
+		}
+	}
+	s.groups = in
+	s.scraped = scraped
+	return out, changed
+}
+
+// Targets returns all discovered targets along with their owners.
+func (s *TargetSharder) Targets() []ShardedTarget {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var res []ShardedTarget
+	for job, groups := range s.groups {
+		for _, group := range groups {
+			for _, target := range group.Targets {
+				lset := mergeSets(target, group.Labels)
+				key := TargetKey(job, lset)
+				_, scraped := s.scraped[key]
+
+				owners, err := s.owner.TargetOwners(key)
+				if err != nil {
+					level.Debug(s.log).Log("msg", "failed to get owners of target", "key", key, "err", err)
+				}
+
+				res = append(res, ShardedTarget{
+					Job:     job,
+					Labels:  labels.New(toLabelSlice(lset)...),
+					Key:     key,
+					Scraped: scraped,
+					Owners:  owners,
+				})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+// TargetKey returns the key used to shard a discovered target of a job. It
+// only depends on the discovered labels, so all agents of a cluster running
+// the same config agree on it.
+func TargetKey(job string, lset model.LabelSet) string {
+	return job + lset.String()
+}
@@ -0,0 +1,131 @@
+package instance
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// mapOwner owns the targets with addresses in a set.
+type mapOwner struct {
+	mut   sync.Mutex
+	owned map[model.LabelValue]bool
+	err   error
+}
+
+func (o *mapOwner) OwnsTarget(key string) (bool, error) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if o.err != nil {
+		return false, o.err
+	}
+	for addr, owned := range o.owned {
+		if owned && TargetKey("geth", model.LabelSet{model.AddressLabel: addr}) == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (o *mapOwner) TargetOwners(key string) ([]string, error) {
+	owned, err := o.OwnsTarget(key)
+	if err != nil || !owned {
+		return []string{"other:12345"}, err
+	}
+	return []string{"self:12345"}, nil
+}
+
+func (o *mapOwner) set(addr model.LabelValue, owned bool) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	o.owned[addr] = owned
+}
+
+func targetAddrs(groups DiscoveredGroups) []model.LabelValue {
+	var res []model.LabelValue
+	for _, g := range groups["geth"] {
+		for _, t := range g.Targets {
+			res = append(res, t[model.AddressLabel])
+		}
+	}
+	return res
+}
+
+func TestTargetSharder_Filter(t *testing.T) {
+	owner := &mapOwner{owned: map[model.LabelValue]bool{"node-a:8545": true}}
+	s := NewTargetSharder(log.NewNopLogger(), owner, time.Minute)
+
+	in := DiscoveredGroups{"geth": {makeGroup([]model.LabelSet{
+		{model.AddressLabel: "node-a:8545"},
+		{model.AddressLabel: "node-b:8545"},
+	})}}
+	now := time.Now()
+
+	out, changed := s.filter(in, now)
+	require.True(t, changed)
+	require.Equal(t, []model.LabelValue{"node-a:8545"}, targetAddrs(out))
+
+	// A target moving to this agent is picked up right away, while the one
+	// moving away is still scraped during the handover.
+	owner.set("node-a:8545", false)
+	owner.set("node-b:8545", true)
+	out, changed = s.filter(in, now.Add(10*time.Second))
+	require.True(t, changed)
+	require.Equal(t, []model.LabelValue{"node-a:8545", "node-b:8545"}, targetAddrs(out))
+
+	_, changed = s.filter(in, now.Add(20*time.Second))
+	require.False(t, changed)
+
+	out, changed = s.filter(in, now.Add(2*time.Minute))
+	require.True(t, changed)
+	require.Equal(t, []model.LabelValue{"node-b:8545"}, targetAddrs(out))
+
+	// Targets keep their assignment while ownership can't be checked.
+	owner.err = errors.New("empty ring")
+	out, changed = s.filter(in, now.Add(5*time.Minute))
+	require.False(t, changed)
+	require.Equal(t, []model.LabelValue{"node-b:8545"}, targetAddrs(out))
+	owner.err = nil
+
+	targets := s.Targets()
+	require.Len(t, targets, 2)
+	require.Equal(t, "geth", targets[0].Job)
+	require.Equal(t, "node-a:8545", targets[0].Labels.Get(model.AddressLabel))
+	require.False(t, targets[0].Scraped)
+	require.Equal(t, []string{"other:12345"}, targets[0].Owners)
+	require.True(t, targets[1].Scraped)
+	require.Equal(t, []string{"self:12345"}, targets[1].Owners)
+}
+
+func TestTargetSharder_Run(t *testing.T) {
+	prevInterval := targetShardResyncInterval
+	targetShardResyncInterval = 10 * time.Millisecond
+	defer func() { targetShardResyncInterval = prevInterval }()
+
+	owner := &mapOwner{owned: map[model.LabelValue]bool{}}
+	s := NewTargetSharder(log.NewNopLogger(), owner, 0)
+	defer s.Stop()
+
+	inputCh := make(chan DiscoveredGroups)
+	go s.Run(inputCh)
+
+	inputCh <- DiscoveredGroups{"geth": {makeGroup([]model.LabelSet{
+		{model.AddressLabel: "node-a:8545"},
+	})}}
+	require.Empty(t, targetAddrs(<-s.SyncCh()))
+
+	// Targets are sent again once this agent owns them, without a discovery
+	// update.
+	owner.set("node-a:8545", true)
+	select {
+	case out := <-s.SyncCh():
+		require.Equal(t, []model.LabelValue{"node-a:8545"}, targetAddrs(out))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "targets weren't resynced")
+	}
+}
@@ -0,0 +1,198 @@
+// Package localstore keeps a queryable in-memory copy of the most recent
+// samples of a metrics instance.
+//
+// The WAL of an instance can't be queried, so samples are also written to a
+// TSDB head block which is truncated to a retention period. Rules and local
+// queries are evaluated against it.
+package localstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"go.uber.org/atomic"
+)
+
+// DefaultConfig holds the default settings of the local store.
+var DefaultConfig = Config{
+	Retention: 2 * time.Hour,
+}
+
+// Config configures the local store.
+type Config struct {
+	// Retention is how long samples are kept.
+	Retention time.Duration `yaml:"retention,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Retention <= 0 {
+		return fmt.Errorf("retention must be greater than 0s")
+	}
+	return nil
+}
+
+// Store is a queryable in-memory store of recent samples. Samples the store
+// can't hold, such as samples older than its retention, are dropped without
+// failing the append, so the store never affects writes to the WAL.
+type Store struct {
+	log       log.Logger
+	head      *tsdb.Head
+	retention *atomic.Duration
+	dropped   prometheus.Counter
+}
+
+var _ storage.Storage = (*Store)(nil)
+
+// New creates a new Store. Full chunks are memory-mapped from dir, which is
+// cleared as the store doesn't survive restarts.
+func New(l log.Logger, reg prometheus.Registerer, dir string, cfg Config) (*Store, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("clear local store directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create local store directory: %w", err)
+	}
+
+	opts := tsdb.DefaultHeadOptions()
+	opts.ChunkDirRoot = dir
+	opts.EnableNativeHistograms.Store(true)
+
+	// The metrics of the head are left unregistered; they would conflict
+	// between instances.
+	head, err := tsdb.NewHead(nil, l, nil, nil, opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create local store: %w", err)
+	}
+	if err := head.Init(0); err != nil {
+		_ = head.Close()
+		return nil, fmt.Errorf("initialize local store: %w", err)
+	}
+
+	s := &Store{
+		log:       l,
+		head:      head,
+		retention: atomic.NewDuration(cfg.Retention),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_local_store_dropped_samples_total",
+			Help: "Total number of samples which couldn't be added to the local store.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(s.dropped)
+	}
+	return s, nil
+}
+
+// ApplyConfig updates the retention of the store.
+func (s *Store) ApplyConfig(cfg Config) {
+	s.retention.Store(cfg.Retention)
+}
+
+// Run truncates samples older than the retention until ctx is canceled.
+func (s *Store) Run(ctx context.Context) {
+	for {
+		retention := s.retention.Load()
+		mint := time.Now().Add(-retention).UnixMilli()
+		if s.head.MinTime() < mint {
+			if err := s.head.Truncate(mint); err != nil {
+				level.Warn(s.log).Log("msg", "failed to truncate local store", "err", err)
+			}
+		}
+
+		interval := retention / 4
+		if interval > 5*time.Minute {
+			interval = 5 * time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Close releases the resources of the store.
+func (s *Store) Close() error {
+	return s.head.Close()
+}
+
+// Querier implements storage.Queryable.
+func (s *Store) Querier(mint, maxt int64) (storage.Querier, error) {
+	return tsdb.NewBlockQuerier(tsdb.NewRangeHead(s.head, mint, maxt), mint, maxt)
+}
+
+// ChunkQuerier implements storage.ChunkQueryable.
+func (s *Store) ChunkQuerier(mint, maxt int64) (storage.ChunkQuerier, error) {
+	return tsdb.NewBlockChunkQuerier(tsdb.NewRangeHead(s.head, mint, maxt), mint, maxt)
+}
+
+// StartTime implements storage.Storage.
+func (s *Store) StartTime() (int64, error) {
+	return s.head.MinTime(), nil
+}
+
+// Appender implements storage.Appendable.
+func (s *Store) Appender(ctx context.Context) storage.Appender {
+	return &appender{s: s, app: s.head.Appender(ctx)}
+}
+
+// appender appends to the head, ignoring its errors. Series references are
+// those of the WAL when the store is a secondary storage of a fanout, so they
+// are never passed on.
+type appender struct {
+	s   *Store
+	app storage.Appender
+}
+
+func (a *appender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	if _, err := a.app.Append(0, l, t, v); err != nil {
+		a.s.dropped.Inc()
+	}
+	return 0, nil
+}
+
+func (a *appender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	// Exemplars aren't kept.
+	return 0, nil
+}
+
+func (a *appender) AppendHistogram(_ storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	if _, err := a.app.AppendHistogram(0, l, t, h, fh); err != nil {
+		a.s.dropped.Inc()
+	}
+	return 0, nil
+}
+
+func (a *appender) UpdateMetadata(storage.SeriesRef, labels.Labels, metadata.Metadata) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *appender) Commit() error {
+	if err := a.app.Commit(); err != nil {
+		level.Debug(a.s.log).Log("msg", "failed to commit samples to local store", "err", err)
+	}
+	return nil
+}
+
+func (a *appender) Rollback() error {
+	_ = a.app.Rollback()
+	return nil
+}
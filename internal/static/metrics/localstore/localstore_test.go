@@ -0,0 +1,70 @@
+package localstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestStore(t *testing.T) {
+	s, err := New(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir(), DefaultConfig)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	now := time.Now().UnixMilli()
+	series := labels.FromStrings("__name__", "up", "job", "geth")
+
+	app := s.Appender(context.Background())
+	// References are ignored, since they may belong to another storage.
+	_, err = app.Append(1234, series, now-1000, 1)
+	require.NoError(t, err)
+	_, err = app.Append(0, series, now, 0)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	// Out of order samples are dropped without failing the append.
+	app = s.Appender(context.Background())
+	_, err = app.Append(0, series, now-2000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+	require.Equal(t, 1.0, testutil.ToFloat64(s.dropped))
+
+	q, err := s.Querier(now-time.Hour.Milliseconds(), now)
+	require.NoError(t, err)
+	defer q.Close()
+
+	set := q.Select(context.Background(), false, nil, labels.MustNewMatcher(labels.MatchEqual, "job", "geth"))
+	require.True(t, set.Next())
+	require.Equal(t, series, set.At().Labels())
+
+	var values []float64
+	it := set.At().Iterator(nil)
+	for it.Next() == chunkenc.ValFloat {
+		_, v := it.At()
+		values = append(values, v)
+	}
+	require.Equal(t, []float64{1, 0}, values)
+	require.False(t, set.Next())
+	require.NoError(t, set.Err())
+}
+
+func TestConfig_Unmarshal(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("{}"), &cfg))
+	require.Equal(t, DefaultConfig, cfg)
+
+	require.NoError(t, yaml.Unmarshal([]byte("retention: 30m"), &cfg))
+	require.Equal(t, 30*time.Minute, cfg.Retention)
+
+	require.EqualError(t, yaml.Unmarshal([]byte("retention: 0s"), &cfg), "retention must be greater than 0s")
+}
@@ -0,0 +1,75 @@
+// Package outbox implements a durable buffer for remote_write. Batches which
+// can't be sent are persisted to disk and replayed once the endpoint is
+// reachable again, so long outages don't leave gaps once data ages out of the
+// WAL.
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/grafana/dskit/flagext"
+)
+
+// DefaultConfig holds the default settings of the outbox.
+var DefaultConfig = Config{
+	MaxSize:    1 << 30,
+	MaxAge:     7 * 24 * time.Hour,
+	MinBackoff: 1 * time.Second,
+	MaxBackoff: 5 * time.Minute,
+}
+
+// Config configures the outbox of the remote_write endpoints of a metrics
+// instance.
+type Config struct {
+	// Maximum size of the batches buffered for a single endpoint. The oldest
+	// batches are dropped beyond it.
+	MaxSize flagext.Bytes `yaml:"max_size,omitempty"`
+	// Maximum age of a buffered batch. Older batches are dropped, as most
+	// backends reject samples that old anyway.
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+
+	// Backoff between attempts to replay buffered batches.
+	MinBackoff time.Duration `yaml:"min_backoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+
+	// ReplayURLs maps remote_write URLs to the endpoint their buffered
+	// batches are replayed to. Replayed samples are older than the samples
+	// sent in the meantime, so the endpoint must accept out-of-order samples.
+	// Batches are replayed to the remote_write URL itself by default.
+	ReplayURLs map[string]string `yaml:"replay_urls,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate returns an error if c is invalid.
+func (c *Config) Validate() error {
+	switch {
+	case c.MaxSize == 0:
+		return errors.New("max_size must be greater than 0")
+	case c.MaxAge <= 0:
+		return errors.New("max_age must be greater than 0s")
+	case c.MinBackoff <= 0:
+		return errors.New("min_backoff must be greater than 0s")
+	case c.MaxBackoff < c.MinBackoff:
+		return errors.New("max_backoff must not be less than min_backoff")
+	}
+	for rw, replay := range c.ReplayURLs {
+		u, err := url.Parse(replay)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid replay URL %q for %q", replay, rw)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/config"
+)
+
+const routePrefix = "/outbox/"
+
+// Manager manages the outboxes of the remote_write endpoints of a metrics
+// instance.
+//
+// The remote storage keeps sending to a loopback listener served by the
+// Manager, which forwards each batch to its endpoint or persists it when the
+// endpoint can't be reached. This keeps the queue managers of the remote
+// storage moving during outages instead of retrying a single batch while the
+// WAL ages out.
+//
+// The Manager also converts batches for endpoints using remote_write 2.0,
+// which the remote storage doesn't support itself.
+type Manager struct {
+	log log.Logger
+	dir string
+
+	metrics *metrics
+
+	mut      sync.Mutex
+	srv      *http.Server
+	addr     string
+	outboxes map[string]*outbox
+}
+
+// NewManager creates a new Manager. Batches are persisted under dir.
+func NewManager(l log.Logger, reg prometheus.Registerer, dir string) *Manager {
+	return &Manager{
+		log:      l,
+		dir:      dir,
+		metrics:  newMetrics(reg),
+		outboxes: make(map[string]*outbox),
+	}
+}
+
+// ApplyConfig updates the outboxes to match rws and returns the remote_write
+// configs the remote storage should use, which send to the outboxes instead.
+// Endpoints are identified by their name, which must be set.
+//
+// If cfg is nil, batches aren't persisted. If v2 is set, batches are sent
+// with remote_write 2.0, falling back to 1.0 for endpoints which don't
+// support it. If cfg is nil and v2 isn't set, all outboxes are stopped and
+// rws is returned unchanged.
+//
+// Batches persisted for endpoints which are removed are kept on disk and
+// replayed once the endpoint is added back.
+func (m *Manager) ApplyConfig(cfg *Config, v2 bool, rws []*config.RemoteWriteConfig) ([]*config.RemoteWriteConfig, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if cfg == nil && !v2 {
+		m.stopOutboxes(nil)
+		return rws, nil
+	}
+
+	if err := m.listen(); err != nil {
+		return nil, err
+	}
+
+	var (
+		res  = make([]*config.RemoteWriteConfig, 0, len(rws))
+		keep = make(map[string]struct{}, len(rws))
+	)
+	for _, rw := range rws {
+		if rw.Name == "" {
+			return nil, errors.New("remote_write name must be set to use the outbox")
+		}
+		if rw.SigV4Config != nil || rw.AzureADConfig != nil {
+			level.Warn(m.log).Log("msg", "outbox does not support signed remote_write requests, sending directly", "remote_name", rw.Name)
+			res = append(res, rw)
+			continue
+		}
+
+		ep, err := newEndpoint(cfg, v2, rw)
+		if err != nil {
+			return nil, fmt.Errorf("outbox for %q: %w", rw.Name, err)
+		}
+
+		if o, ok := m.outboxes[rw.Name]; ok && o.persisting == (cfg != nil) {
+			o.update(cfg, ep)
+		} else {
+			if ok {
+				o.stop()
+			}
+			o, err := newOutbox(
+				log.With(m.log, "remote_name", rw.Name),
+				filepath.Join(m.dir, rw.Name),
+				m.metrics.forEndpoint(rw.Name, ep.url),
+				cfg, ep,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("outbox for %q: %w", rw.Name, err)
+			}
+			m.outboxes[rw.Name] = o
+		}
+		keep[rw.Name] = struct{}{}
+
+		res = append(res, m.rewrite(rw))
+	}
+
+	m.stopOutboxes(keep)
+	return res, nil
+}
+
+// stopOutboxes stops all outboxes not in keep.
+func (m *Manager) stopOutboxes(keep map[string]struct{}) {
+	for name, o := range m.outboxes {
+		if _, ok := keep[name]; ok {
+			continue
+		}
+		o.stop()
+		delete(m.outboxes, name)
+	}
+}
+
+func newEndpoint(cfg *Config, v2 bool, rw *config.RemoteWriteConfig) (endpoint, error) {
+	client, err := config_util.NewClientFromConfig(rw.HTTPClientConfig, "remote_write_outbox")
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	var (
+		u         = rw.URL.String()
+		replayURL string
+	)
+	if cfg != nil {
+		replayURL = cfg.ReplayURLs[u]
+	}
+	return endpoint{
+		url:       u,
+		replayURL: replayURL,
+		headers:   rw.Headers,
+		// Live sends must finish before the request from the remote storage
+		// times out, so the batch can still be persisted.
+		timeout: time.Duration(rw.RemoteTimeout) / 2,
+		client:  client,
+		v2:      v2,
+	}, nil
+}
+
+// rewrite returns a copy of rw which sends to the outbox of rw. The
+// credentials and headers are left to the outbox.
+func (m *Manager) rewrite(rw *config.RemoteWriteConfig) *config.RemoteWriteConfig {
+	cp := *rw
+	cp.URL = &config_util.URL{URL: &url.URL{
+		Scheme: "http",
+		Host:   m.addr,
+		Path:   routePrefix + url.PathEscape(rw.Name),
+	}}
+	cp.HTTPClientConfig = config_util.DefaultHTTPClientConfig
+	cp.Headers = nil
+	return &cp
+}
+
+// listen starts the loopback listener if it isn't running yet.
+func (m *Manager) listen() error {
+	if m.srv != nil {
+		return nil
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("outbox listener: %w", err)
+	}
+	m.srv = &http.Server{Handler: http.HandlerFunc(m.serveHTTP)}
+	m.addr = lis.Addr().String()
+
+	go func() {
+		if err := m.srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			level.Error(m.log).Log("msg", "outbox listener stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, routePrefix))
+	if err != nil || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.mut.Lock()
+	o, ok := m.outboxes[name]
+	m.mut.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	o.ServeHTTP(w, r)
+}
+
+// Stop stops the listener and all outboxes. Persisted batches are kept on
+// disk. The remote storage must be stopped first.
+func (m *Manager) Stop() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.srv != nil {
+		_ = m.srv.Close()
+		m.srv = nil
+	}
+	m.stopOutboxes(nil)
+}
+
+type metrics struct {
+	pendingBatches   *prometheus.GaugeVec
+	pendingBytes     *prometheus.GaugeVec
+	oldestPendingAge *prometheus.GaugeVec
+	gapFillProgress  *prometheus.GaugeVec
+	persistedBatches *prometheus.CounterVec
+	replayedBatches  *prometheus.CounterVec
+	droppedBatches   *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	labels := []string{"remote_name", "url"}
+
+	m := &metrics{
+		pendingBatches: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "agent_remote_write_outbox_pending_batches",
+			Help: "Number of batches buffered on disk waiting to be replayed.",
+		}, labels),
+		pendingBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "agent_remote_write_outbox_pending_bytes",
+			Help: "Size of the batches buffered on disk waiting to be replayed.",
+		}, labels),
+		oldestPendingAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "agent_remote_write_outbox_oldest_pending_age_seconds",
+			Help: "Age of the oldest batch buffered on disk.",
+		}, labels),
+		gapFillProgress: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "agent_remote_write_outbox_gap_fill_progress",
+			Help: "Ratio of the current backlog which has been replayed. 1 when nothing is buffered.",
+		}, labels),
+		persistedBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_remote_write_outbox_persisted_batches_total",
+			Help: "Total number of batches buffered on disk because the endpoint was unavailable.",
+		}, labels),
+		replayedBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_remote_write_outbox_replayed_batches_total",
+			Help: "Total number of buffered batches replayed successfully.",
+		}, labels),
+		droppedBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_remote_write_outbox_dropped_batches_total",
+			Help: "Total number of buffered batches dropped without being replayed.",
+		}, append(labels, "reason")),
+	}
+
+	if reg != nil {
+		reg.MustRegister(
+			m.pendingBatches,
+			m.pendingBytes,
+			m.oldestPendingAge,
+			m.gapFillProgress,
+			m.persistedBatches,
+			m.replayedBatches,
+			m.droppedBatches,
+		)
+	}
+	return m
+}
+
+func (m *metrics) forEndpoint(name, url string) *outboxMetrics {
+	return &outboxMetrics{
+		pendingBatches:   m.pendingBatches.WithLabelValues(name, url),
+		pendingBytes:     m.pendingBytes.WithLabelValues(name, url),
+		oldestPendingAge: m.oldestPendingAge.WithLabelValues(name, url),
+		gapFillProgress:  m.gapFillProgress.WithLabelValues(name, url),
+		persistedBatches: m.persistedBatches.WithLabelValues(name, url),
+		replayedBatches:  m.replayedBatches.WithLabelValues(name, url),
+		droppedBatches:   m.droppedBatches.MustCurryWith(prometheus.Labels{"remote_name": name, "url": url}),
+	}
+}
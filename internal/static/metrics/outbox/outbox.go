@@ -0,0 +1,582 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/writev2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"go.uber.org/atomic"
+)
+
+const (
+	batchExt = ".batch"
+	tmpExt   = ".tmp"
+)
+
+// batchHeader holds the request headers a batch must be replayed with.
+type batchHeader struct {
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	Version         string `json:"version,omitempty"`
+}
+
+func (h batchHeader) apply(req *http.Request) {
+	if h.ContentType != "" {
+		req.Header.Set("Content-Type", h.ContentType)
+	}
+	if h.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", h.ContentEncoding)
+	}
+	if h.Version != "" {
+		req.Header.Set(writev2.VersionHeader, h.Version)
+	}
+}
+
+// endpoint is the remote_write endpoint an outbox forwards to.
+type endpoint struct {
+	url       string
+	replayURL string
+	headers   map[string]string
+	timeout   time.Duration
+	client    *http.Client
+	// v2 converts batches to remote_write 2.0 before they're sent.
+	v2 bool
+}
+
+// outbox buffers the batches of a single remote_write endpoint.
+//
+// Batches are sent live while the endpoint is reachable. Batches which fail
+// with a recoverable error are persisted and replayed oldest first in the
+// background, while new batches keep being sent live. Without persistence,
+// the outbox only forwards batches and failures are passed back to the
+// remote storage.
+type outbox struct {
+	log        log.Logger
+	dir        string
+	metrics    *outboxMetrics
+	persisting bool
+
+	// conv converts batches for endpoints using remote_write 2.0, until the
+	// endpoint turns out to only support 1.0.
+	conv   *writev2.Converter
+	v1Only *atomic.Bool
+
+	mut          sync.Mutex
+	cfg          Config
+	ep           endpoint
+	backoff      time.Duration
+	offlineUntil time.Time
+
+	// Batches replayed since the backlog started, to report the gap-fill
+	// progress.
+	replayedBacklog int
+
+	seq    *atomic.Uint64
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newOutbox creates a new outbox. If cfg is nil, batches are only forwarded
+// and nothing is persisted.
+func newOutbox(l log.Logger, dir string, m *outboxMetrics, cfg *Config, ep endpoint) (*outbox, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &outbox{
+		log:        l,
+		dir:        dir,
+		metrics:    m,
+		persisting: cfg != nil,
+		conv:       writev2.NewConverter(),
+		v1Only:     atomic.NewBool(false),
+		cfg:        DefaultConfig,
+		ep:         ep,
+		seq:        atomic.NewUint64(0),
+		wake:       make(chan struct{}, 1),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if cfg != nil {
+		o.cfg = *cfg
+	}
+	o.backoff = o.cfg.MinBackoff
+
+	if !o.persisting {
+		close(o.done)
+		return o, nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		cancel()
+		return nil, fmt.Errorf("create outbox directory: %w", err)
+	}
+	go o.run(ctx)
+	return o, nil
+}
+
+// update changes the config and endpoint of the outbox. cfg must be nil if
+// and only if the outbox was created without persistence.
+func (o *outbox) update(cfg *Config, ep endpoint) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if cfg != nil {
+		o.cfg = *cfg
+	}
+	o.ep = ep
+	o.backoff = o.cfg.MinBackoff
+	o.offlineUntil = time.Time{}
+	// Check again whether the endpoint supports remote_write 2.0, it may
+	// have been upgraded.
+	o.v1Only.Store(false)
+	o.notify()
+}
+
+// stop stops replaying batches. Persisted batches are kept on disk.
+func (o *outbox) stop() {
+	o.cancel()
+	<-o.done
+}
+
+func (o *outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ServeHTTP receives a remote_write request for the endpoint. It always
+// succeeds once the batch is either sent or persisted, so the sender moves
+// on; non-recoverable errors of the endpoint are passed through. Without
+// persistence, all errors are passed through so the sender retries.
+func (o *outbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hdr := batchHeader{
+		ContentType:     r.Header.Get("Content-Type"),
+		ContentEncoding: r.Header.Get("Content-Encoding"),
+		Version:         r.Header.Get(writev2.VersionHeader),
+	}
+
+	if !o.persisting {
+		o.mut.Lock()
+		ep := o.ep
+		o.mut.Unlock()
+
+		status, err := o.send(r.Context(), ep, ep.url, hdr, body)
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case status == 0:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			http.Error(w, err.Error(), status)
+		}
+		return
+	}
+
+	o.mut.Lock()
+	ep, offline := o.ep, time.Now().Before(o.offlineUntil)
+	o.mut.Unlock()
+
+	if !offline {
+		status, err := o.send(r.Context(), ep, ep.url, hdr, body)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		} else if !recoverable(status) {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		level.Warn(o.log).Log("msg", "remote_write endpoint unavailable, buffering batches", "err", err)
+		o.markOffline()
+	}
+
+	if err := o.persist(hdr, body); err != nil {
+		level.Error(o.log).Log("msg", "failed to buffer batch", "err", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// markOffline stops live sends until the next backoff elapses or a replay
+// succeeds.
+func (o *outbox) markOffline() {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	o.offlineUntil = time.Now().Add(o.backoff)
+}
+
+// send sends a batch to url, converted to remote_write 2.0 if ep uses it.
+// status is 0 if no response was received.
+func (o *outbox) send(ctx context.Context, ep endpoint, url string, hdr batchHeader, body []byte) (status int, err error) {
+	if !ep.v2 || o.v1Only.Load() {
+		return o.post(ctx, ep, url, hdr, body)
+	}
+
+	v2Hdr, v2Body, err := o.convert(hdr, body)
+	if err != nil {
+		level.Warn(o.log).Log("msg", "failed to convert batch to remote_write 2.0, sending as 1.0", "err", err)
+		return o.post(ctx, ep, url, hdr, body)
+	} else if v2Body == nil {
+		// Batches which only hold metadata have no 2.0 equivalent. Their
+		// metadata is also sent along with the series of later batches,
+		// but receivers get it right away with 1.0.
+		return o.post(ctx, ep, url, hdr, body)
+	}
+
+	status, err = o.post(ctx, ep, url, v2Hdr, v2Body)
+	switch status {
+	case http.StatusUnsupportedMediaType, http.StatusBadRequest:
+		// Receivers which only support 1.0 reject the content type, or fail
+		// to decode the request.
+	default:
+		return status, err
+	}
+
+	level.Warn(o.log).Log("msg", "remote_write endpoint does not support remote_write 2.0, falling back to 1.0", "status", status)
+	o.v1Only.Store(true)
+	return o.post(ctx, ep, url, hdr, body)
+}
+
+// convert converts a remote_write 1.0 batch to 2.0. The returned body is nil
+// if there's nothing to send.
+func (o *outbox) convert(hdr batchHeader, body []byte) (batchHeader, []byte, error) {
+	if hdr.ContentEncoding != "" && hdr.ContentEncoding != "snappy" {
+		return hdr, nil, fmt.Errorf("unsupported content encoding %q", hdr.ContentEncoding)
+	}
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		return hdr, nil, fmt.Errorf("decompress batch: %w", err)
+	}
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(raw, &req); err != nil {
+		return hdr, nil, fmt.Errorf("decode batch: %w", err)
+	}
+
+	v2, err := o.conv.Convert(&req)
+	if err != nil {
+		return hdr, nil, fmt.Errorf("convert batch: %w", err)
+	} else if v2 == nil {
+		return hdr, nil, nil
+	}
+	return batchHeader{
+		ContentType:     writev2.ContentType,
+		ContentEncoding: "snappy",
+		Version:         writev2.Version,
+	}, snappy.Encode(nil, v2), nil
+}
+
+// post sends a request to url. status is 0 if no response was received.
+func (o *outbox) post(ctx context.Context, ep endpoint, url string, hdr batchHeader, body []byte) (status int, err error) {
+	if ep.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ep.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	hdr.apply(req)
+	for k, v := range ep.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, fmt.Errorf("server returned HTTP status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// recoverable returns true if a send which failed with status may succeed
+// later.
+func recoverable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status/100 == 5
+}
+
+// persist writes a batch to disk. The body is stored as received, which is
+// already compressed.
+func (o *outbox) persist(hdr batchHeader, body []byte) error {
+	path := filepath.Join(o.dir, formatBatchName(time.Now(), o.seq.Inc())+batchExt)
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(hdr); err != nil {
+		return err
+	}
+	buf.Write(body)
+
+	if err := os.WriteFile(path+tmpExt, buf.Bytes(), 0o640); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	if err := os.Rename(path+tmpExt, path); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+
+	o.metrics.persistedBatches.Inc()
+	o.notify()
+	return nil
+}
+
+// formatBatchName returns the name of a batch created at ts. Names sort in
+// the order batches were created.
+func formatBatchName(ts time.Time, seq uint64) string {
+	return fmt.Sprintf("%020d-%06d", ts.UnixNano(), seq%1e6)
+}
+
+// readBatch reads a persisted batch.
+func readBatch(path string) (batchHeader, []byte, error) {
+	var hdr batchHeader
+
+	f, err := os.Open(path)
+	if err != nil {
+		return hdr, nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return hdr, nil, fmt.Errorf("read batch header: %w", err)
+	}
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		return hdr, nil, fmt.Errorf("read batch header: %w", err)
+	}
+	body, err := io.ReadAll(r)
+	return hdr, body, err
+}
+
+type pendingBatch struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+// pending returns the persisted batches, oldest first.
+func (o *outbox) pending() ([]pendingBatch, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []pendingBatch
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != batchExt {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		var nanos int64
+		if _, err := fmt.Sscanf(e.Name(), "%020d-", &nanos); err != nil {
+			nanos = fi.ModTime().UnixNano()
+		}
+		batches = append(batches, pendingBatch{
+			path:    filepath.Join(o.dir, e.Name()),
+			size:    fi.Size(),
+			created: time.Unix(0, nanos),
+		})
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].path < batches[j].path })
+	return batches, nil
+}
+
+// run replays persisted batches until ctx is canceled.
+func (o *outbox) run(ctx context.Context) {
+	defer close(o.done)
+
+	for {
+		wait, err := o.replayOne(ctx)
+		if err != nil {
+			level.Error(o.log).Log("msg", "failed to replay buffered batches", "err", err)
+			wait = o.nextBackoff()
+		}
+		if wait == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// idleInterval is how often metrics of an empty outbox are refreshed.
+const idleInterval = time.Minute
+
+// replayOne drops expired batches and replays the oldest pending one. It
+// returns how long to wait before the next call.
+func (o *outbox) replayOne(ctx context.Context) (time.Duration, error) {
+	batches, err := o.pending()
+	if err != nil {
+		return 0, err
+	}
+	batches = o.enforceLimits(batches)
+	o.updateMetrics(batches)
+
+	if len(batches) == 0 {
+		return idleInterval, nil
+	}
+
+	o.mut.Lock()
+	ep := o.ep
+	o.mut.Unlock()
+
+	oldest := batches[0]
+	hdr, body, err := readBatch(oldest.path)
+	if err != nil {
+		level.Warn(o.log).Log("msg", "dropping unreadable batch", "path", oldest.path, "err", err)
+		o.drop(oldest, "corrupt")
+		return 0, nil
+	}
+
+	replayURL := ep.replayURL
+	if replayURL == "" {
+		replayURL = ep.url
+	}
+	status, err := o.send(ctx, ep, replayURL, hdr, body)
+	switch {
+	case err == nil:
+		if err := os.Remove(oldest.path); err != nil {
+			return 0, err
+		}
+		o.metrics.replayedBatches.Inc()
+		o.mut.Lock()
+		o.replayedBacklog++
+		o.backoff = o.cfg.MinBackoff
+		o.offlineUntil = time.Time{}
+		o.mut.Unlock()
+		return 0, nil
+
+	case !recoverable(status):
+		level.Warn(o.log).Log("msg", "dropping batch rejected by remote_write endpoint", "err", err)
+		o.drop(oldest, "rejected")
+		return 0, nil
+
+	default:
+		if ctx.Err() != nil {
+			return 0, nil
+		}
+		level.Debug(o.log).Log("msg", "failed to replay batch, backing off", "err", err)
+		return o.nextBackoff(), nil
+	}
+}
+
+// nextBackoff returns the current backoff and doubles it for the next
+// failure.
+func (o *outbox) nextBackoff() time.Duration {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	wait := o.backoff
+	o.backoff *= 2
+	if o.backoff > o.cfg.MaxBackoff {
+		o.backoff = o.cfg.MaxBackoff
+	}
+	return wait
+}
+
+// enforceLimits drops batches older than max_age and the oldest batches
+// beyond max_size, and returns the batches left.
+func (o *outbox) enforceLimits(batches []pendingBatch) []pendingBatch {
+	o.mut.Lock()
+	cfg := o.cfg
+	o.mut.Unlock()
+
+	var size uint64
+	for _, b := range batches {
+		size += uint64(b.size)
+	}
+
+	cutoff := time.Now().Add(-cfg.MaxAge)
+	for len(batches) > 0 {
+		oldest := batches[0]
+		switch {
+		case oldest.created.Before(cutoff):
+			o.drop(oldest, "max_age")
+		case size > uint64(cfg.MaxSize):
+			o.drop(oldest, "max_size")
+		default:
+			return batches
+		}
+		size -= uint64(oldest.size)
+		batches = batches[1:]
+	}
+	return batches
+}
+
+func (o *outbox) drop(b pendingBatch, reason string) {
+	if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		level.Error(o.log).Log("msg", "failed to drop batch", "path", b.path, "err", err)
+		return
+	}
+	o.metrics.droppedBatches.WithLabelValues(reason).Inc()
+}
+
+func (o *outbox) updateMetrics(batches []pendingBatch) {
+	var size int64
+	for _, b := range batches {
+		size += b.size
+	}
+	o.metrics.pendingBatches.Set(float64(len(batches)))
+	o.metrics.pendingBytes.Set(float64(size))
+
+	if len(batches) == 0 {
+		o.metrics.oldestPendingAge.Set(0)
+		o.metrics.gapFillProgress.Set(1)
+
+		o.mut.Lock()
+		o.replayedBacklog = 0
+		o.mut.Unlock()
+		return
+	}
+	o.metrics.oldestPendingAge.Set(time.Since(batches[0].created).Seconds())
+
+	o.mut.Lock()
+	replayed := o.replayedBacklog
+	o.mut.Unlock()
+	o.metrics.gapFillProgress.Set(float64(replayed) / float64(replayed+len(batches)))
+}
+
+// outboxMetrics are the metrics of a single outbox.
+type outboxMetrics struct {
+	pendingBatches   prometheus.Gauge
+	pendingBytes     prometheus.Gauge
+	oldestPendingAge prometheus.Gauge
+	gapFillProgress  prometheus.Gauge
+	persistedBatches prometheus.Counter
+	replayedBatches  prometheus.Counter
+	droppedBatches   *prometheus.CounterVec
+}
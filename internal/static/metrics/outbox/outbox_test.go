@@ -0,0 +1,349 @@
+package outbox
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/writev2"
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+// upstream is a remote_write endpoint which can be taken offline.
+type upstream struct {
+	mut      sync.Mutex
+	status   int
+	received []string
+	headers  []http.Header
+}
+
+func (u *upstream) setStatus(status int) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	u.status = status
+}
+
+func (u *upstream) bodies() []string {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	return append([]string(nil), u.received...)
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if u.status/100 != 2 {
+		w.WriteHeader(u.status)
+		return
+	}
+	u.received = append(u.received, string(body))
+	u.headers = append(u.headers, r.Header.Clone())
+	w.WriteHeader(u.status)
+}
+
+func testConfig() *Config {
+	cfg := DefaultConfig
+	cfg.MinBackoff = 10 * time.Millisecond
+	cfg.MaxBackoff = 50 * time.Millisecond
+	return &cfg
+}
+
+func testRemoteWrite(t *testing.T, rawURL string) *config.RemoteWriteConfig {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	rw := config.DefaultRemoteWriteConfig
+	rw.Name = "test"
+	rw.URL = &config_util.URL{URL: u}
+	rw.RemoteTimeout = model.Duration(5 * time.Second)
+	rw.Headers = map[string]string{"X-Test": "value"}
+	return &rw
+}
+
+func push(t *testing.T, rw *config.RemoteWriteConfig, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, rw.URL.String(), bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp
+}
+
+func TestManager(t *testing.T) {
+	up := &upstream{status: http.StatusNoContent}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	m := NewManager(log.NewNopLogger(), reg, t.TempDir())
+	defer m.Stop()
+
+	rws, err := m.ApplyConfig(testConfig(), false, []*config.RemoteWriteConfig{testRemoteWrite(t, srv.URL)})
+	require.NoError(t, err)
+	require.Len(t, rws, 1)
+	require.Equal(t, "test", rws[0].Name)
+	require.NotEqual(t, srv.URL, rws[0].URL.String())
+	require.Empty(t, rws[0].Headers)
+
+	// Batches are forwarded while the endpoint is reachable.
+	require.Equal(t, http.StatusNoContent, push(t, rws[0], "a").StatusCode)
+	require.Equal(t, []string{"a"}, up.bodies())
+	require.Equal(t, "value", up.headers[0].Get("X-Test"))
+	require.Equal(t, "snappy", up.headers[0].Get("Content-Encoding"))
+
+	// Batches are persisted and acknowledged while the endpoint is down.
+	up.setStatus(http.StatusServiceUnavailable)
+	require.Equal(t, http.StatusNoContent, push(t, rws[0], "b").StatusCode)
+	require.Equal(t, http.StatusNoContent, push(t, rws[0], "c").StatusCode)
+	persisted := m.metrics.persistedBatches.WithLabelValues("test", srv.URL)
+	require.Equal(t, 2.0, testutil.ToFloat64(persisted))
+
+	// Persisted batches are replayed in order once the endpoint is back.
+	up.setStatus(http.StatusNoContent)
+	require.Eventually(t, func() bool {
+		return len(up.bodies()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"a", "b", "c"}, up.bodies())
+
+	replayed := m.metrics.replayedBatches.WithLabelValues("test", srv.URL)
+	require.Equal(t, 2.0, testutil.ToFloat64(replayed))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.metrics.pendingBatches.WithLabelValues("test", srv.URL)) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Non-recoverable errors are passed through instead of persisted.
+	up.setStatus(http.StatusBadRequest)
+	require.Equal(t, http.StatusBadRequest, push(t, rws[0], "d").StatusCode)
+	require.Equal(t, 2.0, testutil.ToFloat64(persisted))
+}
+
+func TestManager_ReplayURL(t *testing.T) {
+	live := &upstream{status: http.StatusServiceUnavailable}
+	liveSrv := httptest.NewServer(live)
+	defer liveSrv.Close()
+
+	backfill := &upstream{status: http.StatusNoContent}
+	backfillSrv := httptest.NewServer(backfill)
+	defer backfillSrv.Close()
+
+	m := NewManager(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	defer m.Stop()
+
+	cfg := testConfig()
+	cfg.ReplayURLs = map[string]string{liveSrv.URL: backfillSrv.URL}
+	rws, err := m.ApplyConfig(cfg, false, []*config.RemoteWriteConfig{testRemoteWrite(t, liveSrv.URL)})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNoContent, push(t, rws[0], "a").StatusCode)
+	require.Eventually(t, func() bool {
+		return len(backfill.bodies()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, live.bodies())
+}
+
+func TestOutbox_EnforceLimits(t *testing.T) {
+	dir := t.TempDir()
+	m := newMetrics(nil).forEndpoint("test", "http://example.com")
+
+	cfg := *testConfig()
+	cfg.MaxSize = 10
+	o := &outbox{log: log.NewNopLogger(), dir: dir, metrics: m, cfg: cfg}
+
+	// Write batches directly, so the replayer doesn't race with the test.
+	now := time.Now()
+	for i, age := range []time.Duration{10 * 24 * time.Hour, time.Hour, time.Minute} {
+		name := filepath.Join(dir, formatBatchName(now.Add(-age), uint64(i))+batchExt)
+		require.NoError(t, os.WriteFile(name, []byte("{}\nbody"), 0o640))
+	}
+
+	batches, err := o.pending()
+	require.NoError(t, err)
+	require.Len(t, batches, 3)
+
+	// The expired batch is dropped for its age and the next one for the size.
+	batches = o.enforceLimits(batches)
+	require.Len(t, batches, 1)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.droppedBatches.WithLabelValues("max_age")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.droppedBatches.WithLabelValues("max_size")))
+}
+
+func TestConfig_Unmarshal(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("max_size: 512MiB\n"), &cfg))
+	require.Equal(t, uint64(512<<20), uint64(cfg.MaxSize))
+	require.Equal(t, DefaultConfig.MaxAge, cfg.MaxAge)
+
+	err := yaml.Unmarshal([]byte("min_backoff: 1m\nmax_backoff: 1s\n"), &cfg)
+	require.EqualError(t, err, "max_backoff must not be less than min_backoff")
+
+	err = yaml.Unmarshal([]byte("replay_urls:\n  http://a/push: not-a-url\n"), &cfg)
+	require.Error(t, err)
+}
+
+// receiver is a remote_write endpoint which records the protocol of the
+// requests it receives.
+type receiver struct {
+	mut sync.Mutex
+	// supportsV2 makes the receiver accept remote_write 2.0 and report the
+	// samples written. Otherwise, 2.0 is rejected with rejectStatus, or
+	// accepted without reporting what was written if it's 0.
+	supportsV2   bool
+	rejectStatus int
+	types        []string
+}
+
+func (rc *receiver) contentTypes() []string {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	return append([]string(nil), rc.types...)
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.ReadAll(r.Body)
+
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+
+	ct := r.Header.Get("Content-Type")
+	rc.types = append(rc.types, ct)
+	switch {
+	case ct != writev2.ContentType:
+	case rc.supportsV2:
+		w.Header().Set(writev2.SamplesWrittenHeader, "1")
+	case rc.rejectStatus != 0:
+		w.WriteHeader(rc.rejectStatus)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pushRequest(t *testing.T, rw *config.RemoteWriteConfig, req *prompb.WriteRequest) *http.Response {
+	t.Helper()
+
+	raw, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return push(t, rw, string(snappy.Encode(nil, raw)))
+}
+
+func TestManager_RemoteWriteV2(t *testing.T) {
+	series := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	metadata := &prompb.WriteRequest{Metadata: []prompb.MetricMetadata{{
+		MetricFamilyName: "up",
+		Type:             prompb.MetricMetadata_GAUGE,
+	}}}
+
+	tt := []struct {
+		name     string
+		receiver *receiver
+		status   int
+		expect   []string
+	}{
+		{
+			name:     "supported",
+			receiver: &receiver{supportsV2: true},
+			expect:   []string{"application/x-protobuf", writev2.ContentType, writev2.ContentType},
+		},
+		{
+			name:     "unsupported media type",
+			receiver: &receiver{rejectStatus: http.StatusUnsupportedMediaType},
+			expect:   []string{"application/x-protobuf", writev2.ContentType, "application/x-protobuf", "application/x-protobuf"},
+		},
+		{
+			name:     "bad request",
+			receiver: &receiver{rejectStatus: http.StatusBadRequest},
+			expect:   []string{"application/x-protobuf", writev2.ContentType, "application/x-protobuf", "application/x-protobuf"},
+		},
+		{
+			// Accepted requests are never sent again, even if the receiver
+			// doesn't report what it wrote.
+			name:     "missing written headers",
+			receiver: &receiver{},
+			expect:   []string{"application/x-protobuf", writev2.ContentType, writev2.ContentType},
+		},
+		{
+			// Other errors are passed back to the sender.
+			name:     "server error",
+			receiver: &receiver{rejectStatus: http.StatusInternalServerError},
+			status:   http.StatusInternalServerError,
+			expect:   []string{"application/x-protobuf", writev2.ContentType, writev2.ContentType},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.receiver)
+			defer srv.Close()
+
+			dir := t.TempDir()
+			m := NewManager(log.NewNopLogger(), prometheus.NewRegistry(), dir)
+			defer m.Stop()
+
+			// Without an outbox config, batches are only converted.
+			rws, err := m.ApplyConfig(nil, true, []*config.RemoteWriteConfig{testRemoteWrite(t, srv.URL)})
+			require.NoError(t, err)
+			require.Len(t, rws, 1)
+
+			// Metadata-only requests have no 2.0 equivalent and are sent
+			// with 1.0.
+			status := tc.status
+			if status == 0 {
+				status = http.StatusNoContent
+			}
+			require.Equal(t, http.StatusNoContent, pushRequest(t, rws[0], metadata).StatusCode)
+			require.Equal(t, status, pushRequest(t, rws[0], series).StatusCode)
+			require.Equal(t, status, pushRequest(t, rws[0], series).StatusCode)
+			require.Equal(t, tc.expect, tc.receiver.contentTypes())
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestManager_RemoteWriteV2_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	m := NewManager(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	defer m.Stop()
+
+	rws, err := m.ApplyConfig(nil, true, []*config.RemoteWriteConfig{testRemoteWrite(t, srv.URL)})
+	require.NoError(t, err)
+
+	// Without persistence, the remote storage must retry.
+	series := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	require.Equal(t, http.StatusBadGateway, pushRequest(t, rws[0], series).StatusCode)
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	queryMaxSamples = 50_000_000
+	queryTimeout    = 2 * time.Minute
+
+	// queryMaxPoints is the maximum number of steps of a range query, like in
+	// Prometheus.
+	queryMaxPoints = 11000
+)
+
+// Error types of the Prometheus HTTP API.
+const (
+	errorBadData     = "bad_data"
+	errorExecution   = "execution"
+	errorTimeout     = "timeout"
+	errorCanceled    = "canceled"
+	errorUnavailable = "unavailable"
+)
+
+// errNoLocalStorage is returned when no instance keeps samples to query.
+var errNoLocalStorage = errors.New("no metrics instance has local_storage enabled")
+
+// localStorageGetter is implemented by instances which keep recent samples in
+// a local store.
+type localStorageGetter interface {
+	LocalStorage() storage.Queryable
+}
+
+// queryResponse is the response of the query endpoints, in the format of the
+// Prometheus HTTP API.
+type queryResponse struct {
+	Status    string     `json:"status"`
+	Data      *queryData `json:"data,omitempty"`
+	ErrorType string     `json:"errorType,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Warnings  []string   `json:"warnings,omitempty"`
+}
+
+type queryData struct {
+	ResultType parser.ValueType `json:"resultType"`
+	Result     parser.Value     `json:"result"`
+}
+
+// QueryHandler evaluates an instant query against the local storage of the
+// running instances. It implements /api/v1/query of the Prometheus HTTP API.
+func (a *Agent) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, err)
+		return
+	}
+	ts := time.Now()
+	if t := r.FormValue("time"); t != "" {
+		var err error
+		if ts, err = parseTime(t); err != nil {
+			a.writeQueryError(w, http.StatusBadRequest, errorBadData, fmt.Errorf("invalid parameter \"time\": %w", err))
+			return
+		}
+	}
+
+	q, err := a.queryEngine.NewInstantQuery(r.Context(), a.localQueryable(), nil, r.FormValue("query"), ts)
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, err)
+		return
+	}
+	a.execQuery(w, r, q)
+}
+
+// QueryRangeHandler evaluates a range query against the local storage of the
+// running instances. It implements /api/v1/query_range of the Prometheus HTTP
+// API.
+func (a *Agent) QueryRangeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, err)
+		return
+	}
+
+	start, err := parseTime(r.FormValue("start"))
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, fmt.Errorf("invalid parameter \"start\": %w", err))
+		return
+	}
+	end, err := parseTime(r.FormValue("end"))
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, fmt.Errorf("invalid parameter \"end\": %w", err))
+		return
+	}
+	step, err := parseDuration(r.FormValue("step"))
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, fmt.Errorf("invalid parameter \"step\": %w", err))
+		return
+	}
+
+	switch {
+	case end.Before(start):
+		err = errors.New("end timestamp must not be before start time")
+	case step <= 0:
+		err = errors.New("zero or negative query resolution step widths are not accepted")
+	case end.Sub(start)/step > queryMaxPoints:
+		err = fmt.Errorf("exceeded maximum resolution of %d points per timeseries", queryMaxPoints)
+	}
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, err)
+		return
+	}
+
+	q, err := a.queryEngine.NewRangeQuery(r.Context(), a.localQueryable(), nil, r.FormValue("query"), start, end, step)
+	if err != nil {
+		a.writeQueryError(w, http.StatusBadRequest, errorBadData, err)
+		return
+	}
+	a.execQuery(w, r, q)
+}
+
+func (a *Agent) execQuery(w http.ResponseWriter, r *http.Request, q promql.Query) {
+	defer q.Close()
+
+	res := q.Exec(r.Context())
+	if res.Err != nil {
+		var (
+			errCanceled promql.ErrQueryCanceled
+			errTimeout  promql.ErrQueryTimeout
+		)
+		switch {
+		case errors.Is(res.Err, errNoLocalStorage):
+			a.writeQueryError(w, http.StatusServiceUnavailable, errorUnavailable, res.Err)
+		case errors.As(res.Err, &errCanceled):
+			a.writeQueryError(w, http.StatusServiceUnavailable, errorCanceled, res.Err)
+		case errors.As(res.Err, &errTimeout):
+			a.writeQueryError(w, http.StatusServiceUnavailable, errorTimeout, res.Err)
+		default:
+			a.writeQueryError(w, http.StatusUnprocessableEntity, errorExecution, res.Err)
+		}
+		return
+	}
+
+	warnings := res.Warnings.AsStrings(r.FormValue("query"), 0)
+	a.writeQueryResponse(w, http.StatusOK, queryResponse{
+		Status:   "success",
+		Data:     &queryData{ResultType: res.Value.Type(), Result: res.Value},
+		Warnings: warnings,
+	})
+}
+
+// localQueryable returns a queryable merging the local storage of all running
+// instances.
+func (a *Agent) localQueryable() storage.Queryable {
+	return storage.QueryableFunc(func(mint, maxt int64) (storage.Querier, error) {
+		var queriers []storage.Querier
+		for _, inst := range a.mm.ListInstances() {
+			g, ok := inst.(localStorageGetter)
+			if !ok {
+				continue
+			}
+			queryable := g.LocalStorage()
+			if queryable == nil {
+				continue
+			}
+			q, err := queryable.Querier(mint, maxt)
+			if err != nil {
+				for _, q := range queriers {
+					_ = q.Close()
+				}
+				return nil, err
+			}
+			queriers = append(queriers, q)
+		}
+		if len(queriers) == 0 {
+			return nil, errNoLocalStorage
+		}
+		return storage.NewMergeQuerier(queriers, nil, storage.ChainedSeriesMerge), nil
+	})
+}
+
+func (a *Agent) writeQueryError(w http.ResponseWriter, statusCode int, errorType string, err error) {
+	a.writeQueryResponse(w, statusCode, queryResponse{
+		Status:    "error",
+		ErrorType: errorType,
+		Error:     err.Error(),
+	})
+}
+
+func (a *Agent) writeQueryResponse(w http.ResponseWriter, statusCode int, resp queryResponse) {
+	bb, err := json.Marshal(resp)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to encode query response", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(bb)
+}
+
+// parseTime parses a Unix timestamp in seconds or an RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration parses a duration in seconds or a Prometheus duration.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		ts := d * float64(time.Second)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration, it overflows int64", s)
+		}
+		return time.Duration(ts), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/localstore"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_QueryHandler(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	mockManager := &instance.MockManager{
+		ListInstancesFunc: func() map[string]instance.ManagedInstance { return nil },
+		ListConfigsFunc:   func() map[string]instance.Config { return nil },
+		ApplyConfigFunc:   func(_ instance.Config) error { return nil },
+		DeleteConfigFunc:  func(name string) error { return nil },
+		StopFunc:          func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	query := func(path string, params url.Values) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(params.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		switch path {
+		case "/api/v1/query":
+			a.QueryHandler(rr, r)
+		case "/api/v1/query_range":
+			a.QueryRangeHandler(rr, r)
+		}
+		return rr
+	}
+
+	t.Run("no local storage", func(t *testing.T) {
+		rr := query("/api/v1/query", url.Values{"query": {"up"}})
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.JSONEq(t, `{"status":"error","errorType":"unavailable","error":"no metrics instance has local_storage enabled"}`, rr.Body.String())
+	})
+
+	store, err := localstore.New(log.NewNopLogger(), nil, t.TempDir(), localstore.DefaultConfig)
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Unix(1700000000, 0)
+	app := store.Appender(context.Background())
+	for i := 0; i < 3; i++ {
+		ts := now.Add(time.Duration(i-2) * time.Minute).UnixMilli()
+		_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", "geth"), ts, float64(i%2))
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	mockManager.ListInstancesFunc = func() map[string]instance.ManagedInstance {
+		return map[string]instance.ManagedInstance{
+			"no_storage": &mockInstanceScrape{},
+			"default":    &mockInstanceStorage{store: store},
+		}
+	}
+	unix := func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+
+	t.Run("instant query", func(t *testing.T) {
+		rr := query("/api/v1/query", url.Values{"query": {"up"}, "time": {unix(now)}})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{
+			"status": "success",
+			"data": {
+				"resultType": "vector",
+				"result": [{"metric": {"__name__": "up", "job": "geth"}, "value": [1700000000, "0"]}]
+			}
+		}`, rr.Body.String())
+	})
+
+	t.Run("range query", func(t *testing.T) {
+		rr := query("/api/v1/query_range", url.Values{
+			"query": {"up"},
+			"start": {unix(now.Add(-2 * time.Minute))},
+			"end":   {now.Format(time.RFC3339)},
+			"step":  {"1m"},
+		})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{
+			"status": "success",
+			"data": {
+				"resultType": "matrix",
+				"result": [{
+					"metric": {"__name__": "up", "job": "geth"},
+					"values": [[1699999880, "0"], [1699999940, "1"], [1700000000, "0"]]
+				}]
+			}
+		}`, rr.Body.String())
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		rr := query("/api/v1/query", url.Values{"query": {"up{"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), `"errorType":"bad_data"`)
+
+		rr = query("/api/v1/query_range", url.Values{"query": {"up"}, "start": {"10"}, "end": {"0"}, "step": {"1"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "end timestamp must not be before start time")
+	})
+}
+
+type mockInstanceStorage struct {
+	mockInstanceScrape
+	store *localstore.Store
+}
+
+func (i *mockInstanceStorage) LocalStorage() storage.Queryable {
+	return i.store
+}
@@ -0,0 +1,75 @@
+package ruler
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// DefaultConfig holds the default settings of the ruler.
+var DefaultConfig = Config{
+	EvaluationInterval: time.Minute,
+}
+
+// Config configures the evaluation of recording and alerting rules.
+type Config struct {
+	// RuleFiles are the Prometheus rule files to evaluate. Globs are
+	// expanded each time the config is applied.
+	RuleFiles []string `yaml:"rule_files,omitempty"`
+	// EvaluationInterval is the default interval of rule groups.
+	EvaluationInterval time.Duration `yaml:"evaluation_interval,omitempty"`
+	// AlertmanagerURLs are the Alertmanagers firing alerts are sent to.
+	AlertmanagerURLs []string `yaml:"alertmanager_urls,omitempty"`
+	// WebhookURLs receive firing alerts in the format of the Alertmanager
+	// API.
+	WebhookURLs []string `yaml:"webhook_urls,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate returns an error if c is invalid.
+func (c *Config) Validate() error {
+	if c.EvaluationInterval <= 0 {
+		return fmt.Errorf("evaluation_interval must be greater than 0s")
+	}
+	for _, pattern := range c.RuleFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid rule file pattern %q: %w", pattern, err)
+		}
+	}
+	for _, list := range [][]string{c.AlertmanagerURLs, c.WebhookURLs} {
+		for _, rawURL := range list {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return fmt.Errorf("invalid alert URL %q: %w", rawURL, err)
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return fmt.Errorf("invalid alert URL %q: scheme must be http or https", rawURL)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleFiles returns the rule files matching the patterns of c.
+func (c *Config) ruleFiles() ([]string, error) {
+	var files []string
+	for _, pattern := range c.RuleFiles {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule file pattern %q: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
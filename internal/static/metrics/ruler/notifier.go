@@ -0,0 +1,161 @@
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+)
+
+const (
+	// alertsPath is the path of the Alertmanager API receiving alerts.
+	alertsPath = "/api/v2/alerts"
+
+	queueCapacity = 100
+	sendTimeout   = 10 * time.Second
+)
+
+// sender sends firing alerts to Alertmanagers and webhooks. Alerts are
+// posted as a JSON array in the format of the Alertmanager API.
+//
+// Failed sends aren't retried; the rule manager resends firing alerts
+// periodically.
+type sender struct {
+	log    log.Logger
+	client *http.Client
+
+	mut            sync.Mutex
+	urls           []string
+	externalLabels labels.Labels
+
+	queue   chan []*notifier.Alert
+	sent    *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	dropped prometheus.Counter
+}
+
+func newSender(l log.Logger, reg prometheus.Registerer) *sender {
+	s := &sender{
+		log:    l,
+		client: &http.Client{Timeout: sendTimeout},
+		queue:  make(chan []*notifier.Alert, queueCapacity),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_ruler_alerts_sent_total",
+			Help: "Total number of alerts sent.",
+		}, []string{"url"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_ruler_alerts_errors_total",
+			Help: "Total number of alerts which failed to be sent.",
+		}, []string{"url"}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_ruler_alerts_dropped_total",
+			Help: "Total number of alerts dropped because the queue was full.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(s.sent, s.errors, s.dropped)
+	}
+	return s
+}
+
+// setConfig sets the URLs alerts are posted to and the external labels added
+// to them.
+func (s *sender) setConfig(cfg Config, externalLabels labels.Labels) {
+	urls := make([]string, 0, len(cfg.AlertmanagerURLs)+len(cfg.WebhookURLs))
+	for _, u := range cfg.AlertmanagerURLs {
+		urls = append(urls, strings.TrimSuffix(u, "/")+alertsPath)
+	}
+	urls = append(urls, cfg.WebhookURLs...)
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.urls = urls
+	s.externalLabels = externalLabels
+}
+
+// Send implements rules.Sender. It never blocks; alerts are dropped if the
+// queue is full.
+func (s *sender) Send(alerts ...*notifier.Alert) {
+	select {
+	case s.queue <- alerts:
+	default:
+		s.dropped.Add(float64(len(alerts)))
+	}
+}
+
+// run sends queued alerts until ctx is canceled.
+func (s *sender) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alerts := <-s.queue:
+			s.sendAll(ctx, alerts)
+		}
+	}
+}
+
+func (s *sender) sendAll(ctx context.Context, alerts []*notifier.Alert) {
+	s.mut.Lock()
+	urls, externalLabels := s.urls, s.externalLabels
+	s.mut.Unlock()
+	if len(urls) == 0 {
+		return
+	}
+
+	// Like Prometheus, external labels don't override the labels of alerts.
+	for _, a := range alerts {
+		b := labels.NewBuilder(a.Labels)
+		externalLabels.Range(func(l labels.Label) {
+			if a.Labels.Get(l.Name) == "" {
+				b.Set(l.Name, l.Value)
+			}
+		})
+		a.Labels = b.Labels()
+	}
+
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		level.Error(s.log).Log("msg", "failed to encode alerts", "err", err)
+		return
+	}
+	for _, u := range urls {
+		if err := s.post(ctx, u, body); err != nil {
+			level.Warn(s.log).Log("msg", "failed to send alerts", "url", u, "err", err)
+			s.errors.WithLabelValues(u).Add(float64(len(alerts)))
+			continue
+		}
+		s.sent.WithLabelValues(u).Add(float64(len(alerts)))
+	}
+}
+
+func (s *sender) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package ruler evaluates Prometheus recording and alerting rules inside the
+// agent.
+//
+// Rules are evaluated against a local queryable store of recent samples.
+// Recorded series are appended like scraped samples, so they're written to
+// the WAL and sent with remote_write, and firing alerts are posted to
+// Alertmanagers or webhooks.
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// inlineIdentifier is the identifier of inline rules, which can't collide
+// with a file path.
+const inlineIdentifier = "<inline>"
+
+// Settings of the rule manager, matching the defaults of Prometheus.
+const (
+	outageTolerance = time.Hour
+	forGracePeriod  = 10 * time.Minute
+	resendDelay     = time.Minute
+)
+
+// Ruler evaluates recording and alerting rules.
+type Ruler struct {
+	manager *rules.Manager
+	loader  *loader
+	sender  *sender
+}
+
+var _ rules.Sender = (*sender)(nil)
+
+// New creates a new Ruler which queries queryable and appends recorded series
+// to appendable. It has no rules until ApplyConfig is called.
+func New(l log.Logger, reg prometheus.Registerer, queryable storage.Queryable, appendable storage.Appendable) *Ruler {
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     log.With(l, "component", "query engine"),
+		MaxSamples: 50_000_000,
+		Timeout:    2 * time.Minute,
+	})
+
+	r := &Ruler{
+		loader: &loader{},
+		sender: newSender(l, reg),
+	}
+	r.manager = rules.NewManager(&rules.ManagerOptions{
+		Appendable:      appendable,
+		Queryable:       queryable,
+		QueryFunc:       rules.EngineQueryFunc(engine, queryable),
+		NotifyFunc:      rules.SendAlerts(r.sender, ""),
+		Context:         context.Background(),
+		Logger:          l,
+		Registerer:      reg,
+		OutageTolerance: outageTolerance,
+		ForGracePeriod:  forGracePeriod,
+		ResendDelay:     resendDelay,
+		GroupLoader:     r.loader,
+	})
+	return r
+}
+
+// ApplyConfig loads the rule files of cfg along with inline rules, given in
+// the format of a Prometheus rule file. Rule groups which didn't change keep
+// their state. If loading fails, the previous rules are kept.
+func (r *Ruler) ApplyConfig(cfg Config, inline string, externalLabels labels.Labels) error {
+	files, err := cfg.ruleFiles()
+	if err != nil {
+		return err
+	}
+	if inline != "" {
+		files = append(files, inlineIdentifier)
+	}
+	r.loader.setInline(inline)
+	r.sender.setConfig(cfg, externalLabels)
+
+	if err := r.manager.Update(cfg.EvaluationInterval, files, externalLabels, "", nil); err != nil {
+		return fmt.Errorf("failed to load rules: %w", err)
+	}
+	return nil
+}
+
+// Run evaluates rules until ctx is canceled.
+func (r *Ruler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		r.manager.Run()
+	}()
+	go func() {
+		defer wg.Done()
+		r.sender.run(ctx)
+	}()
+
+	<-ctx.Done()
+	r.manager.Stop()
+	wg.Wait()
+}
+
+// loader loads rule files from disk and inline rules from memory.
+type loader struct {
+	rules.FileLoader
+
+	mut    sync.Mutex
+	inline string
+}
+
+func (l *loader) setInline(content string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.inline = content
+}
+
+func (l *loader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	if identifier != inlineIdentifier {
+		return l.FileLoader.Load(identifier)
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return rulefmt.Parse([]byte(l.inline))
+}
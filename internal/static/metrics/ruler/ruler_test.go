@@ -0,0 +1,153 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/localstore"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const testRules = `
+groups:
+- name: test
+  rules:
+  - record: job:up:sum
+    expr: sum by (job) (up)
+  - alert: TargetDown
+    expr: up == 0
+    labels:
+      severity: critical
+`
+
+// webhook records the alerts posted to it.
+type webhook struct {
+	mut    sync.Mutex
+	alerts []map[string]interface{}
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var alerts []map[string]interface{}
+	_ = json.Unmarshal(body, &alerts)
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.alerts = append(w.alerts, alerts...)
+}
+
+func (w *webhook) received() []map[string]interface{} {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return append([]map[string]interface{}(nil), w.alerts...)
+}
+
+func TestRuler(t *testing.T) {
+	store, err := localstore.New(log.NewNopLogger(), nil, t.TempDir(), localstore.DefaultConfig)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Keep appending scraped samples while the rules are evaluated.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			app := store.Appender(ctx)
+			now := time.Now().UnixMilli()
+			_, _ = app.Append(0, labels.FromStrings("__name__", "up", "job", "geth", "instance", "a"), now, 1)
+			_, _ = app.Append(0, labels.FromStrings("__name__", "up", "job", "geth", "instance", "b"), now, 0)
+			_ = app.Commit()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	am := &webhook{}
+	amSrv := httptest.NewServer(am)
+	defer amSrv.Close()
+	hook := &webhook{}
+	hookSrv := httptest.NewServer(hook)
+	defer hookSrv.Close()
+
+	r := New(log.NewNopLogger(), prometheus.NewRegistry(), store, store)
+	cfg := DefaultConfig
+	cfg.EvaluationInterval = 50 * time.Millisecond
+	cfg.AlertmanagerURLs = []string{amSrv.URL}
+	cfg.WebhookURLs = []string{hookSrv.URL + "/hook"}
+	require.NoError(t, r.ApplyConfig(cfg, testRules, labels.FromStrings("cluster", "edge")))
+
+	go r.Run(ctx)
+
+	// Recorded series are appended without the external labels, which are
+	// added by remote_write.
+	require.Eventually(t, func() bool {
+		q, err := store.Querier(0, time.Now().UnixMilli())
+		require.NoError(t, err)
+		defer q.Close()
+
+		set := q.Select(ctx, false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "job:up:sum"))
+		if !set.Next() {
+			return false
+		}
+		require.Equal(t, labels.FromStrings("__name__", "job:up:sum", "job", "geth"), set.At().Labels())
+		it := set.At().Iterator(nil)
+		require.Equal(t, chunkenc.ValFloat, it.Next())
+		_, v := it.At()
+		return v == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Firing alerts are sent to Alertmanagers and webhooks with the external
+	// labels.
+	for _, receiver := range []*webhook{am, hook} {
+		require.Eventually(t, func() bool {
+			return len(receiver.received()) > 0
+		}, 5*time.Second, 20*time.Millisecond)
+
+		alert := receiver.received()[0]
+		require.Equal(t, map[string]interface{}{
+			"alertname": "TargetDown",
+			"cluster":   "edge",
+			"instance":  "b",
+			"job":       "geth",
+			"severity":  "critical",
+		}, alert["labels"])
+	}
+}
+
+func TestRuler_ApplyConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.yml"), []byte("groups:\n- name: bad\n  rules:\n  - record: x\n    expr: sum(\n"), 0o644))
+
+	r := New(log.NewNopLogger(), prometheus.NewRegistry(), nil, nil)
+	cfg := DefaultConfig
+	cfg.RuleFiles = []string{filepath.Join(dir, "*.yml")}
+	require.Error(t, r.ApplyConfig(cfg, "", labels.EmptyLabels()))
+	require.Error(t, r.ApplyConfig(DefaultConfig, "groups: [", labels.EmptyLabels()))
+	require.NoError(t, r.ApplyConfig(DefaultConfig, testRules, labels.EmptyLabels()))
+}
+
+func TestConfig_Unmarshal(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("rule_files: [/etc/rules/*.yml]"), &cfg))
+	require.Equal(t, time.Minute, cfg.EvaluationInterval)
+
+	require.EqualError(t, yaml.Unmarshal([]byte("webhook_urls: [ftp://example.com]"), &cfg), `invalid alert URL "ftp://example.com": scheme must be http or https`)
+	require.EqualError(t, yaml.Unmarshal([]byte("rule_files: ['[']"), &cfg), `invalid rule file pattern "[": syntax error in pattern`)
+}
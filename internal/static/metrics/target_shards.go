@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+// shardedTargetsGetter is implemented by instances whose targets are sharded
+// across a cluster.
+type shardedTargetsGetter interface {
+	ShardedTargets() []instance.ShardedTarget
+}
+
+var targetShardsTemplate = template.Must(template.New("target-shards").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Target Shards</title>
+</head>
+<body>
+	<h1>Target Shards</h1>
+	{{ if not .Targets }}
+	<p>No targets are sharded. Enable target_sharding in the scraping service to shard targets across agents.</p>
+	{{ else }}
+	<table width="100%" border="1">
+		<thead>
+			<tr>
+				<th>Instance</th>
+				<th>Job</th>
+				<th>Address</th>
+				<th>Owners</th>
+				<th>Scraped Here</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{ range .Targets }}
+			<tr>
+				<td>{{ .Instance }}</td>
+				<td>{{ .Job }}</td>
+				<td title="{{ .Labels }}">{{ .Address }}</td>
+				<td>{{ .Owners }}</td>
+				<td>{{ if .Scraped }}yes{{ else }}no{{ end }}</td>
+			</tr>
+			{{ end }}
+		</tbody>
+	</table>
+	{{ end }}
+</body>
+</html>`))
+
+type targetShardRow struct {
+	Instance string
+	Job      string
+	Address  string
+	Labels   string
+	Owners   string
+	Scraped  bool
+}
+
+// TargetShardsHandler renders a page showing which agent of the cluster owns
+// each discovered target.
+func (a *Agent) TargetShardsHandler(w http.ResponseWriter, _ *http.Request) {
+	var rows []targetShardRow
+	for name, inst := range a.mm.ListInstances() {
+		g, ok := inst.(shardedTargetsGetter)
+		if !ok {
+			continue
+		}
+		for _, tgt := range g.ShardedTargets() {
+			rows = append(rows, targetShardRow{
+				Instance: name,
+				Job:      tgt.Job,
+				Address:  tgt.Labels.Get(model.AddressLabel),
+				Labels:   tgt.Labels.String(),
+				Owners:   strings.Join(tgt.Owners, ", "),
+				Scraped:  tgt.Scraped,
+			})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Instance < rows[j].Instance })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := targetShardsTemplate.Execute(w, struct{ Targets []targetShardRow }{rows})
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to render target shards page", "err", err)
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/instance"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_TargetShardsHandler(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	mockManager := &instance.MockManager{
+		ListInstancesFunc: func() map[string]instance.ManagedInstance { return nil },
+		ListConfigsFunc:   func() map[string]instance.Config { return nil },
+		ApplyConfigFunc:   func(_ instance.Config) error { return nil },
+		DeleteConfigFunc:  func(name string) error { return nil },
+		StopFunc:          func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/debug/target-shards", nil)
+
+	rr := httptest.NewRecorder()
+	a.TargetShardsHandler(rr, r)
+	require.Contains(t, rr.Body.String(), "No targets are sharded")
+
+	mockManager.ListInstancesFunc = func() map[string]instance.ManagedInstance {
+		return map[string]instance.ManagedInstance{
+			"rpc": &mockInstanceShards{targets: []instance.ShardedTarget{{
+				Job:     "geth",
+				Labels:  labels.FromStrings("__address__", "node-a:8545"),
+				Scraped: true,
+				Owners:  []string{"10.0.0.1:12345"},
+			}}},
+		}
+	}
+	rr = httptest.NewRecorder()
+	a.TargetShardsHandler(rr, r)
+	body := rr.Body.String()
+	require.Contains(t, body, ">node-a:8545</td>")
+	require.Contains(t, body, "<td>10.0.0.1:12345</td>")
+	require.Contains(t, body, "<td>yes</td>")
+}
+
+type mockInstanceShards struct {
+	mockInstanceScrape
+	targets []instance.ShardedTarget
+}
+
+func (i *mockInstanceShards) ShardedTargets() []instance.ShardedTarget {
+	return i.targets
+}
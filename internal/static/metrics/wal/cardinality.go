@@ -0,0 +1,311 @@
+package wal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// topOffenders is the number of metric names reported for each target over
+// its series budget.
+const topOffenders = 10
+
+// maxRejectedSeries bounds the number of rejected series remembered so that
+// they're only counted once. Past it, the least recently rejected series are
+// forgotten and counted again when they're rejected next.
+const maxRejectedSeries = 100_000
+
+// SeriesLimit bounds the number of active series of a job. A zero value
+// disables the corresponding limit.
+type SeriesLimit struct {
+	// PerTarget is the maximum number of active series of each target of the
+	// job.
+	PerTarget int
+	// PerJob is the maximum number of active series of all targets of the job
+	// combined.
+	PerJob int
+}
+
+func (l SeriesLimit) enabled() bool {
+	return l.PerTarget > 0 || l.PerJob > 0
+}
+
+// CardinalityLimits bounds the number of active series of each scrape job and
+// target. Series are attributed to a target by their job and instance labels.
+//
+// Unlike the sample_limit of a scrape config, which fails the whole scrape,
+// existing series keep being written once a budget is used up; only new
+// series are rejected until old ones go stale.
+type CardinalityLimits struct {
+	// Default applies to jobs without an override.
+	Default SeriesLimit
+	// Jobs overrides the limit of specific jobs.
+	Jobs map[string]SeriesLimit
+}
+
+func (l CardinalityLimits) forJob(job string) SeriesLimit {
+	if limit, ok := l.Jobs[job]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// TargetSeries is the series usage of a target.
+type TargetSeries struct {
+	// Active is the number of active series of the target.
+	Active int
+	// Limit is the series budget of the target, or 0 if unlimited.
+	Limit int
+}
+
+// cardinalityTracker counts the active series of each job and target and
+// enforces CardinalityLimits on new series.
+type cardinalityTracker struct {
+	mut    sync.Mutex
+	limits CardinalityLimits
+	jobs   map[string]*jobSeries
+
+	rejectedDesc *prometheus.Desc
+	offenderDesc *prometheus.Desc
+	rejected     map[string]float64
+	// rejectedSeries holds the hashes of the series recently rejected since
+	// the last garbage collection, so that a series is counted once however
+	// many samples it has.
+	rejectedSeries *simplelru.LRU[uint64, struct{}]
+}
+
+type jobSeries struct {
+	active  int
+	targets map[string]*targetSeries
+}
+
+type targetSeries struct {
+	active int
+	names  map[string]int
+}
+
+func newCardinalityTracker() *cardinalityTracker {
+	return &cardinalityTracker{
+		jobs:           map[string]*jobSeries{},
+		rejected:       map[string]float64{},
+		rejectedSeries: newRejectedSeries(),
+
+		rejectedDesc: prometheus.NewDesc(
+			"agent_wal_series_rejected_total",
+			"Total number of new series rejected because their job or target was over its series budget.",
+			[]string{"job"}, nil,
+		),
+		offenderDesc: prometheus.NewDesc(
+			"agent_wal_series_budget_top_offenders",
+			"Active series of the metric names with the most series, for targets over their series budget.",
+			[]string{"job", "instance", "metric"}, nil,
+		),
+	}
+}
+
+func (t *cardinalityTracker) setLimits(limits CardinalityLimits) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.limits = limits
+}
+
+// exempt returns true for series which are never rejected: the series the
+// scrape loop reports about each scrape, which must stay accurate when the
+// target is over its budget.
+func exempt(name string) bool {
+	return name == "up" || strings.HasPrefix(name, "scrape_")
+}
+
+// admit accounts for the new series l. It returns false without accounting
+// for it if l exceeds the series budget of its job or target.
+func (t *cardinalityTracker) admit(l labels.Labels) bool {
+	var (
+		job      = l.Get(model.JobLabel)
+		instance = l.Get(model.InstanceLabel)
+		name     = l.Get(model.MetricNameLabel)
+	)
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	js, ts := t.get(job, instance)
+	if limit := t.limits.forJob(job); limit.enabled() && !exempt(name) {
+		if (limit.PerTarget > 0 && ts.active >= limit.PerTarget) || (limit.PerJob > 0 && js.active >= limit.PerJob) {
+			if hash := l.Hash(); !t.isRejected(hash) {
+				t.rejectedSeries.Add(hash, struct{}{})
+				t.rejected[job]++
+			}
+			t.cleanup(job, instance)
+			return false
+		}
+	}
+
+	js.active++
+	ts.active++
+	ts.names[name]++
+	return true
+}
+
+// isRejected returns true if the series with the given hash was already
+// rejected since the last garbage collection. t.mut must be held.
+func (t *cardinalityTracker) isRejected(hash uint64) bool {
+	_, ok := t.rejectedSeries.Get(hash)
+	return ok
+}
+
+// resetRejected forgets the rejected series, which are counted again the
+// next time they're rejected. It's called when series are garbage collected.
+func (t *cardinalityTracker) resetRejected() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.rejectedSeries.Purge()
+}
+
+func newRejectedSeries() *simplelru.LRU[uint64, struct{}] {
+	// NewLRU only fails for a non-positive size.
+	lru, _ := simplelru.NewLRU[uint64, struct{}](maxRejectedSeries, nil)
+	return lru
+}
+
+// add accounts for the series l regardless of the limits, for series
+// replayed from the WAL.
+func (t *cardinalityTracker) add(l labels.Labels) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	js, ts := t.get(l.Get(model.JobLabel), l.Get(model.InstanceLabel))
+	js.active++
+	ts.active++
+	ts.names[l.Get(model.MetricNameLabel)]++
+}
+
+// remove stops accounting for the deleted series l.
+func (t *cardinalityTracker) remove(l labels.Labels) {
+	var (
+		job      = l.Get(model.JobLabel)
+		instance = l.Get(model.InstanceLabel)
+		name     = l.Get(model.MetricNameLabel)
+	)
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	js, ts := t.get(job, instance)
+	js.active--
+	ts.active--
+	if ts.names[name]--; ts.names[name] <= 0 {
+		delete(ts.names, name)
+	}
+	t.cleanup(job, instance)
+}
+
+// get returns the counts of job and its target instance, creating them if
+// needed. t.mut must be held.
+func (t *cardinalityTracker) get(job, instance string) (*jobSeries, *targetSeries) {
+	js, ok := t.jobs[job]
+	if !ok {
+		js = &jobSeries{targets: map[string]*targetSeries{}}
+		t.jobs[job] = js
+	}
+	ts, ok := js.targets[instance]
+	if !ok {
+		ts = &targetSeries{names: map[string]int{}}
+		js.targets[instance] = ts
+	}
+	return js, ts
+}
+
+// cleanup removes the counts of job and instance if they have no series
+// left. t.mut must be held.
+func (t *cardinalityTracker) cleanup(job, instance string) {
+	js := t.jobs[job]
+	if ts := js.targets[instance]; ts.active <= 0 {
+		delete(js.targets, instance)
+	}
+	if js.active <= 0 {
+		delete(t.jobs, job)
+	}
+}
+
+// target returns the series usage of a target.
+func (t *cardinalityTracker) target(job, instance string) TargetSeries {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	res := TargetSeries{Limit: t.limits.forJob(job).PerTarget}
+	if js, ok := t.jobs[job]; ok {
+		if ts, ok := js.targets[instance]; ok {
+			res.Active = ts.active
+		}
+	}
+	return res
+}
+
+// Describe implements prometheus.Collector.
+func (t *cardinalityTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.rejectedDesc
+	ch <- t.offenderDesc
+}
+
+// Collect implements prometheus.Collector.
+func (t *cardinalityTracker) Collect(ch chan<- prometheus.Metric) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	for job, rejected := range t.rejected {
+		ch <- prometheus.MustNewConstMetric(t.rejectedDesc, prometheus.CounterValue, rejected, job)
+	}
+
+	for job, js := range t.jobs {
+		limit := t.limits.forJob(job)
+		if !limit.enabled() {
+			continue
+		}
+		jobOver := limit.PerJob > 0 && js.active >= limit.PerJob
+
+		for instance, ts := range js.targets {
+			if !jobOver && (limit.PerTarget == 0 || ts.active < limit.PerTarget) {
+				continue
+			}
+			for _, name := range topNames(ts.names, topOffenders) {
+				ch <- prometheus.MustNewConstMetric(t.offenderDesc, prometheus.GaugeValue, float64(ts.names[name]), job, instance, name)
+			}
+		}
+	}
+}
+
+// topNames returns up to n names with the highest counts.
+func topNames(counts map[string]int, n int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// SetCardinalityLimits sets the series budgets of the jobs and targets
+// writing to w. Lowering a budget doesn't remove existing series; new series
+// are rejected until enough existing series go stale.
+func (w *Storage) SetCardinalityLimits(limits CardinalityLimits) {
+	w.cardinality.setLimits(limits)
+}
+
+// TargetSeries returns the series usage of the target with the given job and
+// instance labels.
+func (w *Storage) TargetSeries(job, instance string) TargetSeries {
+	return w.cardinality.target(job, instance)
+}
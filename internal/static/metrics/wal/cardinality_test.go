@@ -0,0 +1,134 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_CardinalityLimits(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s, err := NewStorage(log.NewNopLogger(), reg, t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	s.SetCardinalityLimits(CardinalityLimits{
+		Default: SeriesLimit{PerTarget: 3},
+		Jobs: map[string]SeriesLimit{
+			"erigon": {PerTarget: 10, PerJob: 4},
+		},
+	})
+
+	// appendAll appends a sample for each series and returns the number
+	// accepted.
+	appendAll := func(ts int64, series ...labels.Labels) int {
+		app := s.Appender(context.Background())
+		var accepted int
+		for _, l := range series {
+			ref, err := app.Append(0, l, ts, 1)
+			require.NoError(t, err)
+			if ref != 0 {
+				accepted++
+			}
+		}
+		require.NoError(t, app.Commit())
+		return accepted
+	}
+	target := func(job, instance string, names ...string) []labels.Labels {
+		var res []labels.Labels
+		for _, name := range names {
+			res = append(res, labels.FromStrings("__name__", name, "job", job, "instance", instance))
+		}
+		return res
+	}
+
+	// New series beyond the target budget are rejected, but existing series
+	// and the series reported by the scrape loop are kept. A rejected series
+	// is only counted once.
+	require.Equal(t, 3, appendAll(1, target("geth", "a", "foo", "bar", "baz", "qux")...))
+	require.Equal(t, 4, appendAll(2, target("geth", "a", "foo", "bar", "baz", "up", "qux")...))
+	require.Equal(t, 2, appendAll(2, target("geth", "b", "foo", "bar")...))
+	require.Equal(t, TargetSeries{Active: 4, Limit: 3}, s.TargetSeries("geth", "a"))
+	require.Equal(t, TargetSeries{Active: 2, Limit: 3}, s.TargetSeries("geth", "b"))
+
+	// Job budgets apply to all of the targets of the job.
+	require.Equal(t, 3, appendAll(1, target("erigon", "a", "foo", "bar", "baz")...))
+	require.Equal(t, 1, appendAll(1, target("erigon", "b", "foo", "bar")...))
+
+	expect := `
+# HELP agent_wal_series_rejected_total Total number of new series rejected because their job or target was over its series budget.
+# TYPE agent_wal_series_rejected_total counter
+agent_wal_series_rejected_total{job="erigon"} 1
+agent_wal_series_rejected_total{job="geth"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expect), "agent_wal_series_rejected_total"))
+
+	// Targets over their budget report their top metric names.
+	expect = `
+# HELP agent_wal_series_budget_top_offenders Active series of the metric names with the most series, for targets over their series budget.
+# TYPE agent_wal_series_budget_top_offenders gauge
+agent_wal_series_budget_top_offenders{instance="a",job="erigon",metric="bar"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="erigon",metric="baz"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="erigon",metric="foo"} 1
+agent_wal_series_budget_top_offenders{instance="b",job="erigon",metric="foo"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="geth",metric="bar"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="geth",metric="baz"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="geth",metric="foo"} 1
+agent_wal_series_budget_top_offenders{instance="a",job="geth",metric="up"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expect), "agent_wal_series_budget_top_offenders"))
+
+	// Once series go stale, new series are accepted again.
+	require.NoError(t, s.Truncate(2))
+	require.Equal(t, TargetSeries{Active: 0, Limit: 10}, s.TargetSeries("erigon", "a"))
+	require.Equal(t, TargetSeries{Active: 2, Limit: 3}, s.TargetSeries("geth", "b"))
+	require.Equal(t, 2, appendAll(3, target("erigon", "b", "foo", "bar")...))
+
+	// Series rejected before the garbage collection are counted again.
+	require.Equal(t, 0, appendAll(3, target("geth", "a", "qux")...))
+	expect = `
+# HELP agent_wal_series_rejected_total Total number of new series rejected because their job or target was over its series budget.
+# TYPE agent_wal_series_rejected_total counter
+agent_wal_series_rejected_total{job="erigon"} 1
+agent_wal_series_rejected_total{job="geth"} 2
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expect), "agent_wal_series_rejected_total"))
+}
+
+func TestTopNames(t *testing.T) {
+	counts := map[string]int{}
+	for i := 0; i < 15; i++ {
+		counts[fmt.Sprintf("metric_%02d", i)] = i
+	}
+	require.Equal(t, []string{"metric_14", "metric_13", "metric_12"}, topNames(counts, 3))
+	require.Len(t, topNames(counts, topOffenders), topOffenders)
+}
+
+func TestCardinalityTracker_RejectedSeriesBound(t *testing.T) {
+	tracker := newCardinalityTracker()
+	tracker.setLimits(CardinalityLimits{Default: SeriesLimit{PerTarget: 1}})
+	series := func(i int) labels.Labels {
+		return labels.FromStrings("__name__", "peer_score", "job", "geth", "instance", "a", "peer", fmt.Sprint(i))
+	}
+
+	require.True(t, tracker.admit(series(0)))
+	for i := 1; i <= maxRejectedSeries+10; i++ {
+		require.False(t, tracker.admit(series(i)))
+	}
+	require.Equal(t, maxRejectedSeries, tracker.rejectedSeries.Len())
+	require.Equal(t, float64(maxRejectedSeries+10), tracker.rejected["geth"])
+
+	// Recently rejected series are counted once, forgotten ones again.
+	require.False(t, tracker.admit(series(maxRejectedSeries+10)))
+	require.False(t, tracker.admit(series(1)))
+	require.Equal(t, float64(maxRejectedSeries+11), tracker.rejected["geth"])
+}
@@ -0,0 +1,205 @@
+package wal
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// SizeLimits bounds the disk usage of a Storage. A zero value disables the
+// corresponding limit.
+type SizeLimits struct {
+	// MaxSize is the maximum size of the WAL directory in bytes.
+	MaxSize uint64
+	// MinFreeDisk is the minimum number of bytes which must remain available
+	// on the filesystem holding the WAL.
+	MinFreeDisk uint64
+}
+
+// Enabled returns true if any limit is set.
+func (l SizeLimits) Enabled() bool {
+	return l.MaxSize > 0 || l.MinFreeDisk > 0
+}
+
+// excess returns the number of bytes which must be reclaimed for a WAL of
+// size bytes on a filesystem with free bytes available to be within l.
+func (l SizeLimits) excess(size, free uint64) uint64 {
+	var excess uint64
+	if l.MaxSize > 0 && size > l.MaxSize {
+		excess = size - l.MaxSize
+	}
+	if l.MinFreeDisk > 0 && free < l.MinFreeDisk {
+		if short := l.MinFreeDisk - free; short > excess {
+			excess = short
+		}
+	}
+	return excess
+}
+
+// EnforceSizeLimits evicts the oldest WAL segments until the WAL is within
+// limits, regardless of whether their samples have been sent. Series records
+// of active series are kept in a checkpoint so newer samples can still be
+// read; the samples and exemplars of the evicted segments are dropped and
+// counted.
+//
+// If the WAL is still over its limits once every segment but the one being
+// written has been evicted, new samples are rejected until the next call
+// finds the WAL within its limits.
+func (w *Storage) EnforceSizeLimits(limits SizeLimits) error {
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		return ErrWALClosed
+	}
+
+	w.truncateMtx.Lock()
+	defer w.truncateMtx.Unlock()
+
+	dir := w.wal.Dir()
+
+	size, err := dirSize(dir)
+	if err != nil {
+		return fmt.Errorf("get WAL size: %w", err)
+	}
+	w.metrics.storageSize.Set(float64(size))
+
+	if !limits.Enabled() {
+		w.setLimitReached(false)
+		return nil
+	}
+
+	free := uint64(math.MaxUint64)
+	if limits.MinFreeDisk > 0 {
+		if free, err = diskFree(dir); err != nil {
+			return fmt.Errorf("get free disk space: %w", err)
+		}
+	}
+
+	excess := limits.excess(size, free)
+	if excess == 0 {
+		w.setLimitReached(false)
+		return nil
+	}
+
+	first, last, err := wlog.Segments(dir)
+	if err != nil {
+		return fmt.Errorf("get segment range: %w", err)
+	}
+	if last < 0 {
+		// There's nothing to evict; the usage is outside of the WAL.
+		w.setLimitReached(true)
+		return nil
+	}
+
+	// Cut the segment being written so its data can be evicted too.
+	if _, err := w.wal.NextSegment(); err != nil {
+		return fmt.Errorf("next segment: %w", err)
+	}
+
+	// Evict the oldest segments until enough space is reclaimed.
+	var reclaimed uint64
+	to := first - 1
+	for seg := first; seg <= last && reclaimed < excess; seg++ {
+		fi, err := os.Stat(wlog.SegmentName(dir, seg))
+		if err != nil {
+			return fmt.Errorf("stat segment %d: %w", seg, err)
+		}
+		reclaimed += uint64(fi.Size())
+		to = seg
+	}
+
+	keep := func(id chunks.HeadSeriesRef) bool {
+		if w.series.GetByID(id) != nil {
+			return true
+		}
+
+		seg, ok := w.deleted[id]
+		return ok && seg > to
+	}
+	stats, err := wlog.Checkpoint(w.logger, w.wal, first, to, keep, math.MaxInt64)
+	if err != nil {
+		return fmt.Errorf("create checkpoint: %w", err)
+	}
+	if err := w.wal.Truncate(to + 1); err != nil {
+		return fmt.Errorf("evict segments: %w", err)
+	}
+	for ref, segment := range w.deleted {
+		if segment <= to {
+			delete(w.deleted, ref)
+			w.metrics.totalRemovedSeries.Inc()
+		}
+	}
+	w.metrics.numDeletedSeries.Set(float64(len(w.deleted)))
+
+	if err := wlog.DeleteCheckpoints(dir, to); err != nil {
+		level.Error(w.logger).Log("msg", "delete old checkpoints", "err", err)
+	}
+
+	evicted := to - first + 1
+	w.metrics.totalEvictedSegments.Add(float64(evicted))
+	w.metrics.totalEvictedSamples.Add(float64(stats.DroppedSamples + stats.DroppedExemplars))
+
+	level.Warn(w.logger).Log(
+		"msg", "evicted WAL segments to stay within size limits",
+		"first", first, "last", to,
+		"dropped_samples", stats.DroppedSamples,
+		"dropped_exemplars", stats.DroppedExemplars,
+	)
+
+	// Samples are only rejected once everything but the segment created
+	// above has been evicted and that still wasn't enough. Otherwise, the
+	// next call evicts more segments.
+	if size, err = dirSize(dir); err != nil {
+		return fmt.Errorf("get WAL size: %w", err)
+	}
+	w.metrics.storageSize.Set(float64(size))
+	if limits.MinFreeDisk > 0 {
+		if free, err = diskFree(dir); err != nil {
+			return fmt.Errorf("get free disk space: %w", err)
+		}
+	}
+	w.setLimitReached(to == last && limits.excess(size, free) > 0)
+	return nil
+}
+
+func (w *Storage) setLimitReached(reached bool) {
+	if w.limitReached.Swap(reached) != reached {
+		if reached {
+			level.Warn(w.logger).Log("msg", "WAL is over its size limits with nothing left to evict, rejecting new samples")
+		} else {
+			level.Info(w.logger).Log("msg", "WAL is within its size limits, accepting new samples")
+		}
+	}
+	if reached {
+		w.metrics.limitReached.Set(1)
+	} else {
+		w.metrics.limitReached.Set(0)
+	}
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += uint64(fi.Size())
+		return nil
+	})
+	return size, err
+}
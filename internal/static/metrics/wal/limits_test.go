@@ -0,0 +1,98 @@
+package wal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeLimits_excess(t *testing.T) {
+	tt := []struct {
+		name       string
+		limits     SizeLimits
+		size, free uint64
+		expect     uint64
+	}{
+		{name: "disabled", limits: SizeLimits{}, size: 100, free: 0, expect: 0},
+		{name: "under max size", limits: SizeLimits{MaxSize: 100}, size: 90, free: 0, expect: 0},
+		{name: "over max size", limits: SizeLimits{MaxSize: 100}, size: 150, free: 0, expect: 50},
+		{name: "enough free disk", limits: SizeLimits{MinFreeDisk: 100}, size: 500, free: 200, expect: 0},
+		{name: "low free disk", limits: SizeLimits{MinFreeDisk: 100}, size: 500, free: 20, expect: 80},
+		{name: "both exceeded", limits: SizeLimits{MaxSize: 400, MinFreeDisk: 100}, size: 500, free: 20, expect: 100},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, tc.limits.excess(tc.size, tc.free))
+		})
+	}
+}
+
+func TestStorage_EnforceSizeLimits(t *testing.T) {
+	walDir := t.TempDir()
+
+	s, err := NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), walDir)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	payload := buildSeries([]string{"foo", "bar", "baz", "blerg"})
+	app := s.Appender(context.Background())
+	for _, metric := range payload {
+		metric.Write(t, app)
+	}
+	require.NoError(t, app.Commit())
+
+	for i := 0; i < 3; i++ {
+		_, err := s.wal.NextSegmentSync()
+		require.NoError(t, err)
+	}
+
+	// Generous limits don't evict anything.
+	require.NoError(t, s.EnforceSizeLimits(SizeLimits{MaxSize: 1 << 30}))
+	require.Zero(t, testutil.ToFloat64(s.metrics.totalEvictedSegments))
+	require.False(t, s.limitReached.Load())
+
+	// A limit smaller than the series records first evicts the oldest segment,
+	// which holds all the samples.
+	require.NoError(t, s.EnforceSizeLimits(SizeLimits{MaxSize: 1}))
+	require.Equal(t, 1.0, testutil.ToFloat64(s.metrics.totalEvictedSegments))
+	require.Equal(t, float64(len(payload.ExpectedSamples())+len(payload.ExpectedExemplars())), testutil.ToFloat64(s.metrics.totalEvictedSamples))
+	require.False(t, s.limitReached.Load())
+
+	// Once there's nothing left to evict, new samples are rejected.
+	require.NoError(t, s.EnforceSizeLimits(SizeLimits{MaxSize: 1}))
+	require.Equal(t, 5.0, testutil.ToFloat64(s.metrics.totalEvictedSegments))
+	require.True(t, s.limitReached.Load())
+
+	rejected := buildSeries([]string{"qux"})
+	app = s.Appender(context.Background())
+	for _, metric := range rejected {
+		metric.Write(t, app)
+	}
+	require.NoError(t, app.Commit())
+	require.Equal(t, float64(len(rejected.ExpectedSamples())+len(rejected.ExpectedExemplars())), testutil.ToFloat64(s.metrics.totalRejectedSamples))
+
+	// The series records of active series survive the eviction, and series
+	// records are still written while samples are rejected.
+	collector := walDataCollector{}
+	replayer := walReplayer{w: &collector}
+	require.NoError(t, replayer.Replay(s.wal.Dir()))
+
+	names := []string{}
+	for _, series := range collector.series {
+		names = append(names, series.Labels.Get("__name__"))
+	}
+	require.Equal(t, append(payload.SeriesNames(), rejected.SeriesNames()...), names)
+	require.Empty(t, collector.samples)
+	require.Empty(t, collector.exemplars)
+
+	// Samples are accepted again once the WAL is within its limits.
+	require.NoError(t, s.EnforceSizeLimits(SizeLimits{MaxSize: 1 << 30}))
+	require.False(t, s.limitReached.Load())
+}
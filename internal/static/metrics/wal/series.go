@@ -116,8 +116,9 @@ func newStripeSeries(stripeSize int) *stripeSeries {
 }
 
 // gc garbage collects old chunks that are strictly before mint and removes
-// series entirely that have no chunks left.
-func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]struct{} {
+// series entirely that have no chunks left. It returns the labels of the
+// deleted series by ref.
+func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]labels.Labels {
 	// NOTE(rfratto): GC will grab two locks, one for the hash and the other for
 	// series. It's not valid for any other function to grab both locks,
 	// otherwise a deadlock might occur when running GC in parallel with
@@ -125,7 +126,7 @@ func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]struct{} {
 	s.gcMut.Lock()
 	defer s.gcMut.Unlock()
 
-	deleted := map[chunks.HeadSeriesRef]struct{}{}
+	deleted := map[chunks.HeadSeriesRef]labels.Labels{}
 	for hashLock := 0; hashLock < s.size; hashLock++ {
 		s.locks[hashLock].Lock()
 
@@ -146,7 +147,7 @@ func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]struct{} {
 					s.locks[refLock].Lock()
 				}
 
-				deleted[series.ref] = struct{}{}
+				deleted[series.ref] = series.lset
 				delete(s.series[refLock], series.ref)
 				s.hashes[hashLock].Delete(hash, series.ref)
 
@@ -44,6 +44,12 @@ type storageMetrics struct {
 	totalRemovedSeries     prometheus.Counter
 	totalAppendedSamples   prometheus.Counter
 	totalAppendedExemplars prometheus.Counter
+	storageSize            prometheus.Gauge
+	limitReached           prometheus.Gauge
+	totalEvictedSegments   prometheus.Counter
+	totalEvictedSamples    prometheus.Counter
+	totalRejectedSamples   prometheus.Counter
+	cardinality            *cardinalityTracker
 }
 
 func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
@@ -83,6 +89,33 @@ func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
 		Help: "Total number of exemplars appended to the WAL",
 	})
 
+	m.storageSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_size_bytes",
+		Help: "Size of the WAL on disk at the last size limit check",
+	})
+
+	m.limitReached = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_limit_reached",
+		Help: "Whether the WAL is over its size limits with nothing left to evict, and rejects new samples",
+	})
+
+	m.totalEvictedSegments = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_wal_segments_evicted_total",
+		Help: "Total number of WAL segments evicted to stay within the size limits",
+	})
+
+	m.totalEvictedSamples = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_wal_samples_evicted_total",
+		Help: "Total number of samples and exemplars dropped from evicted WAL segments",
+	})
+
+	m.totalRejectedSamples = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_wal_samples_rejected_total",
+		Help: "Total number of samples and exemplars not written to the WAL because it reached its size limits",
+	})
+
+	m.cardinality = newCardinalityTracker()
+
 	if r != nil {
 		r.MustRegister(
 			m.numActiveSeries,
@@ -92,6 +125,12 @@ func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
 			m.totalRemovedSeries,
 			m.totalAppendedSamples,
 			m.totalAppendedExemplars,
+			m.storageSize,
+			m.limitReached,
+			m.totalEvictedSegments,
+			m.totalEvictedSamples,
+			m.totalRejectedSamples,
+			m.cardinality,
 		)
 	}
 
@@ -110,6 +149,12 @@ func (m *storageMetrics) Unregister() {
 		m.totalRemovedSeries,
 		m.totalAppendedSamples,
 		m.totalAppendedExemplars,
+		m.storageSize,
+		m.limitReached,
+		m.totalEvictedSegments,
+		m.totalEvictedSamples,
+		m.totalRejectedSamples,
+		m.cardinality,
 	}
 	for _, c := range cs {
 		m.r.Unregister(c)
@@ -129,6 +174,18 @@ type Storage struct {
 	walMtx    sync.RWMutex
 	walClosed bool
 
+	// truncateMtx serializes checkpointing, which both Truncate and
+	// EnforceSizeLimits do.
+	truncateMtx sync.Mutex
+
+	// limitReached is set when the WAL exceeds its size limits and no segment
+	// is left to evict. New samples are rejected until space is reclaimed.
+	limitReached *atomic.Bool
+
+	// cardinality counts the active series of each scrape job and target to
+	// enforce their series budgets.
+	cardinality *cardinalityTracker
+
 	path   string
 	wal    *wlog.WL
 	logger log.Logger
@@ -158,7 +215,10 @@ func NewStorage(logger log.Logger, registerer prometheus.Registerer, path string
 		series:  newStripeSeries(tsdb.DefaultStripeSize),
 		metrics: newStorageMetrics(registerer),
 		nextRef: atomic.NewUint64(0),
+
+		limitReached: atomic.NewBool(false),
 	}
+	storage.cardinality = storage.metrics.cardinality
 
 	storage.bufPool.New = func() interface{} {
 		b := make([]byte, 0, 1024)
@@ -373,6 +433,7 @@ func (w *Storage) loadWAL(r *wlog.Reader, multiRef map[chunks.HeadSeriesRef]chun
 				if w.series.GetByID(s.Ref) == nil {
 					series := &memSeries{ref: s.Ref, lset: s.Labels, lastTs: 0}
 					w.series.Set(s.Labels.Hash(), series)
+					w.cardinality.add(s.Labels)
 					multiRef[s.Ref] = series.ref
 
 					w.metrics.numActiveSeries.Inc()
@@ -483,6 +544,9 @@ func (w *Storage) Truncate(mint int64) error {
 		return ErrWALClosed
 	}
 
+	w.truncateMtx.Lock()
+	defer w.truncateMtx.Unlock()
+
 	start := time.Now()
 
 	// Garbage collect series that haven't received an update since mint.
@@ -563,9 +627,11 @@ func (w *Storage) gc(mint int64) {
 	// We want to keep series records for any newly deleted series
 	// until we've passed the last recorded segment. This prevents
 	// the WAL having samples for series records that no longer exist.
-	for ref := range deleted {
+	for ref, lset := range deleted {
 		w.deleted[ref] = last
+		w.cardinality.remove(lset)
 	}
+	w.cardinality.resetRejected()
 
 	w.metrics.numDeletedSeries.Set(float64(len(w.deleted)))
 }
@@ -685,6 +751,11 @@ func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v flo
 
 		var created bool
 		series, created = a.getOrCreate(l)
+		if series == nil {
+			// The series is over its series budget. Drop the sample without an
+			// error so the rest of the scrape is kept.
+			return 0, nil
+		}
 		if created {
 			a.pendingSeries = append(a.pendingSeries, record.RefSeries{
 				Ref:    series.ref,
@@ -711,6 +782,8 @@ func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v flo
 	return storage.SeriesRef(series.ref), nil
 }
 
+// getOrCreate returns the series for l, creating it if it doesn't exist. It
+// returns nil if l would exceed the series budget of its job or target.
 func (a *appender) getOrCreate(l labels.Labels) (series *memSeries, created bool) {
 	hash := l.Hash()
 
@@ -718,6 +791,9 @@ func (a *appender) getOrCreate(l labels.Labels) (series *memSeries, created bool
 	if series != nil {
 		return series, false
 	}
+	if !a.w.cardinality.admit(l) {
+		return nil, false
+	}
 
 	ref := chunks.HeadSeriesRef(a.w.nextRef.Inc())
 	series = &memSeries{ref: ref, lset: l, lastTs: math.MinInt64}
@@ -809,6 +885,11 @@ func (a *appender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int
 
 		var created bool
 		series, created = a.getOrCreate(l)
+		if series == nil {
+			// The series is over its series budget. Drop the sample without an
+			// error so the rest of the scrape is kept.
+			return 0, nil
+		}
 		if created {
 			a.pendingSeries = append(a.pendingSeries, record.RefSeries{
 				Ref:    series.ref,
@@ -886,10 +967,49 @@ func (a *appender) log() error {
 		buf = buf[:0]
 	}
 
+	// Series records are always logged so later samples can reference them,
+	// but data is rejected while the WAL is over its size limits. Timestamps
+	// are still updated below so active series aren't garbage collected.
+	if a.w.limitReached.Load() {
+		rejected := len(a.pendingSamples) + len(a.pendingHistograms) + len(a.pendingFloatHistograms) + len(a.pendingExamplars)
+		a.w.metrics.totalRejectedSamples.Add(float64(rejected))
+	} else {
+		var err error
+		if buf, err = a.logData(&encoder, buf); err != nil {
+			return err
+		}
+	}
+
+	var series *memSeries
+	for i, s := range a.pendingSamples {
+		series = a.sampleSeries[i]
+		if !series.updateTimestamp(s.T) {
+			a.w.metrics.totalOutOfOrderSamples.Inc()
+		}
+	}
+	for i, s := range a.pendingHistograms {
+		series = a.histogramSeries[i]
+		if !series.updateTimestamp(s.T) {
+			a.w.metrics.totalOutOfOrderSamples.Inc()
+		}
+	}
+	for i, s := range a.pendingFloatHistograms {
+		series = a.floatHistogramSeries[i]
+		if !series.updateTimestamp(s.T) {
+			a.w.metrics.totalOutOfOrderSamples.Inc()
+		}
+	}
+
+	return nil
+}
+
+// logData logs the pending samples and exemplars to the WAL. It returns buf
+// so the grown buffer can be reused.
+func (a *appender) logData(encoder *record.Encoder, buf []byte) ([]byte, error) {
 	if len(a.pendingSamples) > 0 {
 		buf = encoder.Samples(a.pendingSamples, buf)
 		if err := a.w.wal.Log(buf); err != nil {
-			return err
+			return buf, err
 		}
 		buf = buf[:0]
 	}
@@ -897,7 +1017,7 @@ func (a *appender) log() error {
 	if len(a.pendingHistograms) > 0 {
 		buf = encoder.HistogramSamples(a.pendingHistograms, buf)
 		if err := a.w.wal.Log(buf); err != nil {
-			return err
+			return buf, err
 		}
 		buf = buf[:0]
 	}
@@ -905,7 +1025,7 @@ func (a *appender) log() error {
 	if len(a.pendingFloatHistograms) > 0 {
 		buf = encoder.FloatHistogramSamples(a.pendingFloatHistograms, buf)
 		if err := a.w.wal.Log(buf); err != nil {
-			return err
+			return buf, err
 		}
 		buf = buf[:0]
 	}
@@ -917,32 +1037,12 @@ func (a *appender) log() error {
 	if len(a.pendingExamplars) > 0 {
 		buf = encoder.Exemplars(a.pendingExamplars, buf)
 		if err := a.w.wal.Log(buf); err != nil {
-			return err
+			return buf, err
 		}
 		buf = buf[:0]
 	}
 
-	var series *memSeries
-	for i, s := range a.pendingSamples {
-		series = a.sampleSeries[i]
-		if !series.updateTimestamp(s.T) {
-			a.w.metrics.totalOutOfOrderSamples.Inc()
-		}
-	}
-	for i, s := range a.pendingHistograms {
-		series = a.histogramSeries[i]
-		if !series.updateTimestamp(s.T) {
-			a.w.metrics.totalOutOfOrderSamples.Inc()
-		}
-	}
-	for i, s := range a.pendingFloatHistograms {
-		series = a.floatHistogramSeries[i]
-		if !series.updateTimestamp(s.T) {
-			a.w.metrics.totalOutOfOrderSamples.Inc()
-		}
-	}
-
-	return nil
+	return buf, nil
 }
 
 // clearData clears all pending data.
@@ -0,0 +1,293 @@
+// Package writev2 converts remote_write 1.0 requests to the remote_write 2.0
+// protocol (io.prometheus.write.v2.Request).
+//
+// Remote write 2.0 interns label names and values into a symbol table,
+// attaches metadata to each series, and carries the created timestamp of
+// counters, histograms and summaries. The remote storage of the vendored
+// Prometheus only speaks 1.0, so requests are converted just before they're
+// sent.
+package writev2
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Headers and values of remote_write 2.0 requests and responses.
+const (
+	ContentType   = "application/x-protobuf;proto=io.prometheus.write.v2.Request"
+	Version       = "2.0.0"
+	VersionHeader = "X-Prometheus-Remote-Write-Version"
+
+	SamplesWrittenHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	HistogramsWrittenHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	ExemplarsWrittenHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+)
+
+// Field numbers of io.prometheus.write.v2 messages.
+const (
+	fieldRequestSymbols    = 4
+	fieldRequestTimeseries = 5
+
+	fieldSeriesLabelsRefs       = 1
+	fieldSeriesSamples          = 2
+	fieldSeriesHistograms       = 3
+	fieldSeriesExemplars        = 4
+	fieldSeriesMetadata         = 5
+	fieldSeriesCreatedTimestamp = 6
+
+	fieldExemplarLabelsRefs = 1
+	fieldExemplarValue      = 2
+	fieldExemplarTimestamp  = 3
+
+	fieldMetadataType    = 1
+	fieldMetadataHelpRef = 3
+	fieldMetadataUnitRef = 4
+)
+
+// cacheRotation is how often entries which weren't refreshed are dropped from
+// the caches of a Converter.
+const cacheRotation = 15 * time.Minute
+
+// Converter converts remote_write 1.0 requests of a single endpoint.
+//
+// Remote write 1.0 sends metadata in separate requests and created timestamps
+// as separate _created series, so a Converter remembers them to attach them
+// to the series of later requests. Entries which aren't refreshed expire.
+type Converter struct {
+	mut      sync.Mutex
+	metadata *cache[string, prompb.MetricMetadata]
+	created  *cache[string, int64]
+}
+
+// NewConverter creates a new Converter.
+func NewConverter() *Converter {
+	return &Converter{
+		metadata: newCache[string, prompb.MetricMetadata](cacheRotation),
+		created:  newCache[string, int64](cacheRotation),
+	}
+}
+
+// Convert converts req to an encoded io.prometheus.write.v2.Request. It
+// returns nil if req holds nothing to send, which is the case for requests
+// which only hold metadata.
+func (c *Converter) Convert(req *prompb.WriteRequest) ([]byte, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := time.Now()
+	for _, md := range req.Metadata {
+		c.metadata.set(now, md.MetricFamilyName, md)
+	}
+	if len(req.Timeseries) == 0 {
+		return nil, nil
+	}
+
+	// Remember created timestamps first, so series in the same request as
+	// their _created series get them.
+	for _, ts := range req.Timeseries {
+		name := seriesName(ts.Labels)
+		if !strings.HasSuffix(name, "_created") || len(ts.Samples) == 0 {
+			continue
+		}
+		v := ts.Samples[len(ts.Samples)-1].Value
+		if math.IsNaN(v) {
+			continue
+		}
+		c.created.set(now, createdKey(familyName(name), ts.Labels), int64(v*1000))
+	}
+
+	var (
+		symbols = newSymbolTable()
+		buf     []byte
+		series  []byte
+	)
+	for _, ts := range req.Timeseries {
+		series = series[:0]
+		series = appendLabelsRefs(series, fieldSeriesLabelsRefs, symbols, ts.Labels)
+
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			series = appendMessage(series, fieldSeriesSamples, sample)
+		}
+		for _, h := range ts.Histograms {
+			// Histograms share their layout with remote_write 1.0.
+			hb, err := h.Marshal()
+			if err != nil {
+				return nil, fmt.Errorf("marshal histogram: %w", err)
+			}
+			series = appendMessage(series, fieldSeriesHistograms, hb)
+		}
+		for _, e := range ts.Exemplars {
+			var ex []byte
+			ex = appendLabelsRefs(ex, fieldExemplarLabelsRefs, symbols, e.Labels)
+			ex = protowire.AppendTag(ex, fieldExemplarValue, protowire.Fixed64Type)
+			ex = protowire.AppendFixed64(ex, math.Float64bits(e.Value))
+			ex = protowire.AppendTag(ex, fieldExemplarTimestamp, protowire.VarintType)
+			ex = protowire.AppendVarint(ex, uint64(e.Timestamp))
+			series = appendMessage(series, fieldSeriesExemplars, ex)
+		}
+
+		name := seriesName(ts.Labels)
+		if md, ok := c.lookupMetadata(name); ok {
+			var m []byte
+			if md.Type != prompb.MetricMetadata_UNKNOWN {
+				m = protowire.AppendTag(m, fieldMetadataType, protowire.VarintType)
+				m = protowire.AppendVarint(m, uint64(md.Type))
+			}
+			if md.Help != "" {
+				m = protowire.AppendTag(m, fieldMetadataHelpRef, protowire.VarintType)
+				m = protowire.AppendVarint(m, uint64(symbols.ref(md.Help)))
+			}
+			if md.Unit != "" {
+				m = protowire.AppendTag(m, fieldMetadataUnitRef, protowire.VarintType)
+				m = protowire.AppendVarint(m, uint64(symbols.ref(md.Unit)))
+			}
+			series = appendMessage(series, fieldSeriesMetadata, m)
+		}
+		if ct, ok := c.created.get(createdKey(familyName(name), ts.Labels)); ok && !strings.HasSuffix(name, "_created") {
+			series = protowire.AppendTag(series, fieldSeriesCreatedTimestamp, protowire.VarintType)
+			series = protowire.AppendVarint(series, uint64(ct))
+		}
+
+		buf = appendMessage(buf, fieldRequestTimeseries, series)
+	}
+
+	// The symbols come first in the request, but are only known once all
+	// series are encoded.
+	out := make([]byte, 0, len(buf)+symbols.size)
+	for _, s := range symbols.list {
+		out = protowire.AppendTag(out, fieldRequestSymbols, protowire.BytesType)
+		out = protowire.AppendString(out, s)
+	}
+	return append(out, buf...), nil
+}
+
+// lookupMetadata returns the metadata of the family of the series name.
+// Families are named with or without the suffix of their series depending on
+// the exposition format, so both are tried.
+func (c *Converter) lookupMetadata(name string) (prompb.MetricMetadata, bool) {
+	if md, ok := c.metadata.get(name); ok {
+		return md, true
+	}
+	return c.metadata.get(familyName(name))
+}
+
+// familySuffixes are the suffixes of the series of a metric family.
+var familySuffixes = []string{"_total", "_bucket", "_count", "_sum", "_created", "_info"}
+
+// familyName returns the name of the metric family of the series name.
+func familyName(name string) string {
+	for _, suffix := range familySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// createdKey identifies the created timestamp of a series of family. Labels
+// identifying a series of the family, le and quantile, are ignored.
+func createdKey(family string, lbls []prompb.Label) string {
+	var sb strings.Builder
+	sb.WriteString(family)
+	for _, l := range lbls {
+		switch l.Name {
+		case labels.MetricName, labels.BucketLabel, "quantile":
+			continue
+		}
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Name)
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+func seriesName(lbls []prompb.Label) string {
+	for _, l := range lbls {
+		if l.Name == labels.MetricName {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func appendLabelsRefs(b []byte, field protowire.Number, symbols *symbolTable, lbls []prompb.Label) []byte {
+	if len(lbls) == 0 {
+		return b
+	}
+	var refs []byte
+	for _, l := range lbls {
+		refs = protowire.AppendVarint(refs, uint64(symbols.ref(l.Name)))
+		refs = protowire.AppendVarint(refs, uint64(symbols.ref(l.Value)))
+	}
+	return appendMessage(b, field, refs)
+}
+
+func appendMessage(b []byte, field protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// symbolTable interns the strings of a request. The empty string is always
+// the first symbol.
+type symbolTable struct {
+	refs map[string]uint32
+	list []string
+	size int
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{refs: map[string]uint32{"": 0}, list: []string{""}, size: 2}
+}
+
+func (t *symbolTable) ref(s string) uint32 {
+	if ref, ok := t.refs[s]; ok {
+		return ref
+	}
+	ref := uint32(len(t.list))
+	t.refs[s] = ref
+	t.list = append(t.list, s)
+	t.size += 1 + protowire.SizeBytes(len(s))
+	return ref
+}
+
+// cache is a map whose entries expire if they aren't set again within one to
+// two rotation periods.
+type cache[K comparable, V any] struct {
+	rotation  time.Duration
+	rotated   time.Time
+	cur, prev map[K]V
+}
+
+func newCache[K comparable, V any](rotation time.Duration) *cache[K, V] {
+	return &cache[K, V]{rotation: rotation, cur: map[K]V{}, prev: map[K]V{}}
+}
+
+func (c *cache[K, V]) set(now time.Time, k K, v V) {
+	if now.Sub(c.rotated) >= c.rotation {
+		c.prev, c.cur = c.cur, make(map[K]V, len(c.cur))
+		c.rotated = now
+	}
+	c.cur[k] = v
+}
+
+func (c *cache[K, V]) get(k K) (V, bool) {
+	if v, ok := c.cur[k]; ok {
+		return v, true
+	}
+	v, ok := c.prev[k]
+	return v, ok
+}
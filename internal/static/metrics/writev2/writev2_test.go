@@ -0,0 +1,229 @@
+package writev2
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedSeries is a decoded io.prometheus.write.v2.TimeSeries.
+type decodedSeries struct {
+	labels     map[string]string
+	samples    []prompb.Sample
+	histograms []prompb.Histogram
+	exemplars  []map[string]string
+	metadata   *prompb.MetricMetadata
+	created    int64
+}
+
+// fields returns the fields of an encoded message.
+func fields(t *testing.T, b []byte) (nums []protowire.Number, values [][]byte, varints []uint64) {
+	t.Helper()
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+
+		var (
+			value  []byte
+			varint uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			varint, n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+
+		nums = append(nums, num)
+		values = append(values, value)
+		varints = append(varints, varint)
+	}
+	return nums, values, varints
+}
+
+func decodeRefs(t *testing.T, b []byte, symbols []string) map[string]string {
+	t.Helper()
+
+	res := map[string]string{}
+	for len(b) > 0 {
+		name, n := protowire.ConsumeVarint(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		value, n := protowire.ConsumeVarint(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		res[symbols[name]] = symbols[value]
+	}
+	return res
+}
+
+func decode(t *testing.T, b []byte) ([]string, []decodedSeries) {
+	t.Helper()
+
+	var (
+		symbols []string
+		raw     [][]byte
+	)
+	nums, values, _ := fields(t, b)
+	for i, num := range nums {
+		switch num {
+		case fieldRequestSymbols:
+			symbols = append(symbols, string(values[i]))
+		case fieldRequestTimeseries:
+			raw = append(raw, values[i])
+		}
+	}
+
+	var res []decodedSeries
+	for _, b := range raw {
+		var s decodedSeries
+		nums, values, varints := fields(t, b)
+		for i, num := range nums {
+			switch num {
+			case fieldSeriesLabelsRefs:
+				s.labels = decodeRefs(t, values[i], symbols)
+			case fieldSeriesSamples:
+				_, _, sv := fields(t, values[i])
+				s.samples = append(s.samples, prompb.Sample{Value: math.Float64frombits(sv[0]), Timestamp: int64(sv[1])})
+			case fieldSeriesHistograms:
+				var h prompb.Histogram
+				require.NoError(t, h.Unmarshal(values[i]))
+				s.histograms = append(s.histograms, h)
+			case fieldSeriesExemplars:
+				en, ev, _ := fields(t, values[i])
+				require.Equal(t, protowire.Number(fieldExemplarLabelsRefs), en[0])
+				s.exemplars = append(s.exemplars, decodeRefs(t, ev[0], symbols))
+			case fieldSeriesMetadata:
+				md := &prompb.MetricMetadata{}
+				mn, _, mv := fields(t, values[i])
+				for j, num := range mn {
+					switch num {
+					case fieldMetadataType:
+						md.Type = prompb.MetricMetadata_MetricType(mv[j])
+					case fieldMetadataHelpRef:
+						md.Help = symbols[mv[j]]
+					case fieldMetadataUnitRef:
+						md.Unit = symbols[mv[j]]
+					}
+				}
+				s.metadata = md
+			case fieldSeriesCreatedTimestamp:
+				s.created = int64(varints[i])
+			}
+		}
+		res = append(res, s)
+	}
+	return symbols, res
+}
+
+func TestConverter(t *testing.T) {
+	c := NewConverter()
+
+	// Metadata is sent separately and attached to later series.
+	require.Nil(t, convert(t, c, &prompb.WriteRequest{Metadata: []prompb.MetricMetadata{
+		{MetricFamilyName: "requests", Type: prompb.MetricMetadata_COUNTER, Help: "Total requests.", Unit: "requests"},
+		{MetricFamilyName: "latency_seconds", Type: prompb.MetricMetadata_HISTOGRAM, Help: "Request latency."},
+	}}))
+
+	h := prompb.Histogram{
+		Count:          &prompb.Histogram_CountInt{CountInt: 3},
+		Sum:            1.5,
+		Schema:         3,
+		ZeroThreshold:  1e-128,
+		PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}},
+		PositiveDeltas: []int64{1, 1},
+		Timestamp:      1000,
+	}
+
+	req := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:    []prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "geth"}},
+			Samples:   []prompb.Sample{{Value: 10, Timestamp: 1000}},
+			Exemplars: []prompb.Exemplar{{Labels: []prompb.Label{{Name: "trace_id", Value: "abc"}}, Value: 1, Timestamp: 900}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "requests_created"}, {Name: "job", Value: "geth"}},
+			Samples: []prompb.Sample{{Value: 500, Timestamp: 1000}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "latency_seconds"}, {Name: "job", Value: "geth"}},
+			Histograms: []prompb.Histogram{h},
+		},
+	}}
+
+	symbols, series := decode(t, convert(t, c, req))
+	require.Equal(t, "", symbols[0])
+
+	// Strings are interned once.
+	seen := map[string]bool{}
+	for _, s := range symbols {
+		require.False(t, seen[s], "duplicate symbol %q", s)
+		seen[s] = true
+	}
+
+	require.Len(t, series, 3)
+
+	require.Equal(t, map[string]string{"__name__": "requests_total", "job": "geth"}, series[0].labels)
+	require.Equal(t, []prompb.Sample{{Value: 10, Timestamp: 1000}}, series[0].samples)
+	require.Equal(t, []map[string]string{{"trace_id": "abc"}}, series[0].exemplars)
+	require.Equal(t, &prompb.MetricMetadata{Type: prompb.MetricMetadata_COUNTER, Help: "Total requests.", Unit: "requests"}, series[0].metadata)
+	require.Equal(t, int64(500_000), series[0].created)
+
+	// The _created series itself doesn't carry a created timestamp.
+	require.Equal(t, int64(0), series[1].created)
+
+	require.Equal(t, []prompb.Histogram{h}, series[2].histograms)
+	require.Equal(t, prompb.MetricMetadata_HISTOGRAM, series[2].metadata.Type)
+	require.Equal(t, int64(0), series[2].created)
+
+	// Created timestamps are remembered for later requests.
+	_, series = decode(t, convert(t, c, &prompb.WriteRequest{Timeseries: req.Timeseries[:1]}))
+	require.Equal(t, int64(500_000), series[0].created)
+}
+
+func convert(t *testing.T, c *Converter, req *prompb.WriteRequest) []byte {
+	t.Helper()
+	b, err := c.Convert(req)
+	require.NoError(t, err)
+	return b
+}
+
+func TestFamilyName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"requests_total":         "requests",
+		"latency_seconds_bucket": "latency_seconds",
+		"latency_seconds_count":  "latency_seconds",
+		"build_info":             "build",
+		"up":                     "up",
+	} {
+		require.Equal(t, expect, familyName(name), name)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache[string, int](cacheRotation)
+	start := c.rotated.Add(cacheRotation)
+
+	c.set(start, "a", 1)
+	c.set(start.Add(cacheRotation), "b", 2)
+	_, ok := c.get("a")
+	require.True(t, ok)
+
+	// Entries which weren't set again expire after two rotations.
+	c.set(start.Add(2*cacheRotation), "b", 3)
+	_, ok = c.get("a")
+	require.False(t, ok)
+	v, _ := c.get("b")
+	require.Equal(t, 3, v)
+}
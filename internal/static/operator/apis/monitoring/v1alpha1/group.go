@@ -32,5 +32,9 @@ func init() {
 		&PodLogsList{},
 		&Integration{},
 		&IntegrationList{},
+		&EthereumNode{},
+		&EthereumNodeList{},
+		&SubstrateNode{},
+		&SubstrateNodeList{},
 	)
 }
@@ -0,0 +1,194 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types set on the status of EthereumNode and SubstrateNode
+// resources.
+const (
+	// ChainNodeReachable is true when every client API of the node responded
+	// to the last probe.
+	ChainNodeReachable = "Reachable"
+	// ChainNodeSynced is true when every client of the node reported that it
+	// is not syncing.
+	ChainNodeSynced = "Synced"
+	// ChainNodeChainMatched is false when a client of the node is on a
+	// different chain than the one declared in the spec.
+	ChainNodeChainMatched = "ChainMatched"
+)
+
+// EthereumNodeSelector returns a selector to find EthereumNodes. They are
+// discovered with the same selectors as Integrations.
+func (a *GrafanaAgent) EthereumNodeSelector() ObjectSelector {
+	sel := a.IntegrationsSelector()
+	sel.ObjectType = &EthereumNode{}
+	return sel
+}
+
+// SubstrateNodeSelector returns a selector to find SubstrateNodes. They are
+// discovered with the same selectors as Integrations.
+func (a *GrafanaAgent) SubstrateNodeSelector() ObjectSelector {
+	sel := a.IntegrationsSelector()
+	sel.ObjectType = &SubstrateNode{}
+	return sel
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path="ethereumnodes"
+// +kubebuilder:resource:singular="ethereumnode"
+// +kubebuilder:resource:categories="agent-operator"
+// +kubebuilder:printcolumn:name="Chain",type="string",JSONPath=".spec.chain"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// EthereumNode monitors the execution and consensus clients of an Ethereum
+// node. It is reconciled into an ethereum integration run by the GrafanaAgent
+// resources which discover it through their integrations selectors.
+type EthereumNode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Specifies the node to monitor.
+	Spec EthereumNodeSpec `json:"spec,omitempty"`
+	// Most recently observed state of the node.
+	Status ChainNodeStatus `json:"status,omitempty"`
+}
+
+// EthereumNodeSpec specifies the clients of an Ethereum node to monitor.
+type EthereumNodeSpec struct {
+	// Chain the node is expected to run, e.g., "mainnet" or "sepolia". A
+	// decimal chain ID is also accepted.
+	Chain string `json:"chain,omitempty"`
+
+	// +kubebuilder:validation:Enum=fail;warn
+
+	// Whether a chain mismatch stops the integration (fail) or is only
+	// reported (warn). Defaults to fail.
+	ChainMismatch string `json:"chainMismatch,omitempty"`
+
+	// Execution client of the node.
+	Execution *EthereumExecutionSpec `json:"execution,omitempty"`
+	// Consensus client of the node.
+	Consensus *EthereumConsensusSpec `json:"consensus,omitempty"`
+
+	// MetricsInstance to send the collected metrics to, referenced as
+	// <namespace>/<name>.
+	MetricsInstance string `json:"metricsInstance,omitempty"`
+}
+
+// EthereumExecutionSpec specifies the execution client of an Ethereum node.
+type EthereumExecutionSpec struct {
+	// URL of the client's JSON-RPC API.
+	URL string `json:"url"`
+	// JSON-RPC modules to collect metrics from. Defaults to the modules of
+	// the ethereum integration.
+	Modules []string `json:"modules,omitempty"`
+}
+
+// EthereumConsensusSpec specifies the consensus client of an Ethereum node.
+type EthereumConsensusSpec struct {
+	// URL of the client's beacon node API.
+	URL string `json:"url"`
+	// Event stream topics to subscribe to. The event stream is disabled when
+	// empty.
+	EventStreamTopics []string `json:"eventStreamTopics,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EthereumNodeList is a list of EthereumNode.
+type EthereumNodeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	// Items is the list of EthereumNode.
+	Items []*EthereumNode `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path="substratenodes"
+// +kubebuilder:resource:singular="substratenode"
+// +kubebuilder:resource:categories="agent-operator"
+// +kubebuilder:printcolumn:name="Chain",type="string",JSONPath=".spec.chain"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// SubstrateNode monitors a Substrate-based node, such as a Polkadot relay
+// chain or parachain node. It is reconciled into a substrate integration run
+// by the GrafanaAgent resources which discover it through their integrations
+// selectors.
+type SubstrateNode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Specifies the node to monitor.
+	Spec SubstrateNodeSpec `json:"spec,omitempty"`
+	// Most recently observed state of the node.
+	Status ChainNodeStatus `json:"status,omitempty"`
+}
+
+// SubstrateNodeSpec specifies a Substrate-based node to monitor.
+type SubstrateNodeSpec struct {
+	// Chain the node is expected to run, as returned by system_chain, e.g.,
+	// "Polkadot".
+	Chain string `json:"chain,omitempty"`
+	// URL of the node's Prometheus endpoint, e.g.,
+	// http://polkadot-0.polkadot:9615/metrics.
+	MetricsURL string `json:"metricsURL"`
+	// URL of the node's JSON-RPC API. Required to report the sync state of
+	// the node.
+	RPCURL string `json:"rpcURL,omitempty"`
+
+	// MetricsInstance to send the collected metrics to, referenced as
+	// <namespace>/<name>.
+	MetricsInstance string `json:"metricsInstance,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SubstrateNodeList is a list of SubstrateNode.
+type SubstrateNodeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	// Items is the list of SubstrateNode.
+	Items []*SubstrateNode `json:"items"`
+}
+
+// ChainNodeStatus is the most recently observed state of a chain node.
+type ChainNodeStatus struct {
+	// The generation of the spec the status was observed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+
+	// Conditions of the node: Reachable, Synced and ChainMatched.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// State of the node's clients at the last probe.
+	Clients []ChainClientStatus `json:"clients,omitempty"`
+}
+
+// ChainClientStatus is the state of a single client of a chain node.
+type ChainClientStatus struct {
+	// Role of the client: execution, consensus or substrate.
+	Role string `json:"role"`
+	// Version reported by the client.
+	Version string `json:"version,omitempty"`
+	// Chain reported by the client.
+	Chain string `json:"chain,omitempty"`
+	// Whether the client is syncing.
+	Syncing bool `json:"syncing"`
+	// Number of blocks or slots the client is behind the head of the chain.
+	SyncDistance int64 `json:"syncDistance,omitempty"`
+	// Head block number or, for consensus clients, head slot.
+	HeadBlock int64 `json:"headBlock,omitempty"`
+	// Number of connected peers.
+	PeerCount int64 `json:"peerCount,omitempty"`
+	// Errors returned by the client's API at the last probe.
+	Errors []string `json:"errors,omitempty"`
+	// Time of the last probe.
+	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
+}
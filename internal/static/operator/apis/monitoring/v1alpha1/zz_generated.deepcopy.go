@@ -28,6 +28,56 @@ func (in *CRIStageSpec) DeepCopy() *CRIStageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChainClientStatus) DeepCopyInto(out *ChainClientStatus) {
+	*out = *in
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChainClientStatus.
+func (in *ChainClientStatus) DeepCopy() *ChainClientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ChainClientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChainNodeStatus) DeepCopyInto(out *ChainNodeStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Clients != nil {
+		in, out := &in.Clients, &out.Clients
+		*out = make([]ChainClientStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChainNodeStatus.
+func (in *ChainNodeStatus) DeepCopy() *ChainNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ChainNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Deployment) DeepCopyInto(out *Deployment) {
 	*out = *in
@@ -106,6 +156,134 @@ func (in *DropStageSpec) DeepCopy() *DropStageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EthereumConsensusSpec) DeepCopyInto(out *EthereumConsensusSpec) {
+	*out = *in
+	if in.EventStreamTopics != nil {
+		in, out := &in.EventStreamTopics, &out.EventStreamTopics
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EthereumConsensusSpec.
+func (in *EthereumConsensusSpec) DeepCopy() *EthereumConsensusSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EthereumConsensusSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EthereumExecutionSpec) DeepCopyInto(out *EthereumExecutionSpec) {
+	*out = *in
+	if in.Modules != nil {
+		in, out := &in.Modules, &out.Modules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EthereumExecutionSpec.
+func (in *EthereumExecutionSpec) DeepCopy() *EthereumExecutionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EthereumExecutionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EthereumNode) DeepCopyInto(out *EthereumNode) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EthereumNode.
+func (in *EthereumNode) DeepCopy() *EthereumNode {
+	if in == nil {
+		return nil
+	}
+	out := new(EthereumNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EthereumNode) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EthereumNodeList) DeepCopyInto(out *EthereumNodeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*EthereumNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(EthereumNode)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EthereumNodeList.
+func (in *EthereumNodeList) DeepCopy() *EthereumNodeList {
+	if in == nil {
+		return nil
+	}
+	out := new(EthereumNodeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EthereumNodeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EthereumNodeSpec) DeepCopyInto(out *EthereumNodeSpec) {
+	*out = *in
+	if in.Execution != nil {
+		in, out := &in.Execution, &out.Execution
+		*out = new(EthereumExecutionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consensus != nil {
+		in, out := &in.Consensus, &out.Consensus
+		*out = new(EthereumConsensusSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EthereumNodeSpec.
+func (in *EthereumNodeSpec) DeepCopy() *EthereumNodeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EthereumNodeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GrafanaAgent) DeepCopyInto(out *GrafanaAgent) {
 	*out = *in
@@ -1440,6 +1618,84 @@ func (in *SigV4Config) DeepCopy() *SigV4Config {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubstrateNode) DeepCopyInto(out *SubstrateNode) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubstrateNode.
+func (in *SubstrateNode) DeepCopy() *SubstrateNode {
+	if in == nil {
+		return nil
+	}
+	out := new(SubstrateNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SubstrateNode) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubstrateNodeList) DeepCopyInto(out *SubstrateNodeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*SubstrateNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(SubstrateNode)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubstrateNodeList.
+func (in *SubstrateNodeList) DeepCopy() *SubstrateNodeList {
+	if in == nil {
+		return nil
+	}
+	out := new(SubstrateNodeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SubstrateNodeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubstrateNodeSpec) DeepCopyInto(out *SubstrateNodeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubstrateNodeSpec.
+func (in *SubstrateNodeSpec) DeepCopy() *SubstrateNodeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SubstrateNodeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateStageSpec) DeepCopyInto(out *TemplateStageSpec) {
 	*out = *in
@@ -48,11 +48,15 @@ func buildHierarchy(ctx context.Context, l log.Logger, cli client.Client, root *
 		metricInstances gragent.MetricsInstanceList
 		logsInstances   gragent.LogsInstanceList
 		integrations    gragent.IntegrationList
+		ethereumNodes   gragent.EthereumNodeList
+		substrateNodes  gragent.SubstrateNodeList
 	)
 	var roots = []hierarchyResource{
 		{List: &metricInstances, Selector: root.MetricsInstanceSelector()},
 		{List: &logsInstances, Selector: root.LogsInstanceSelector()},
 		{List: &integrations, Selector: root.IntegrationsSelector()},
+		{List: &ethereumNodes, Selector: root.EthereumNodeSelector()},
+		{List: &substrateNodes, Selector: root.SubstrateNodeSelector()},
 	}
 	if err := search(roots); err != nil {
 		return deployment, nil, err
@@ -107,6 +111,40 @@ func buildHierarchy(ctx context.Context, l log.Logger, cli client.Client, root *
 		})
 	}
 
+	// Chain node resources are run as the integrations they convert to. Nodes
+	// which fail to convert are skipped so they don't block the rest of the
+	// deployment; their status reports the problem.
+	for _, node := range ethereumNodes.Items {
+		integration, err := ethereumNodeIntegration(node)
+		if err != nil {
+			level.Warn(l).Log(
+				"msg", "skipping ethereum node",
+				"agent", client.ObjectKeyFromObject(root),
+				"ethereumnode", client.ObjectKeyFromObject(node),
+				"err", err,
+			)
+			continue
+		}
+		deployment.Integrations = append(deployment.Integrations, gragent.IntegrationsDeployment{
+			Instance: integration,
+		})
+	}
+	for _, node := range substrateNodes.Items {
+		integration, err := substrateNodeIntegration(node)
+		if err != nil {
+			level.Warn(l).Log(
+				"msg", "skipping substrate node",
+				"agent", client.ObjectKeyFromObject(root),
+				"substratenode", client.ObjectKeyFromObject(node),
+				"err", err,
+			)
+			continue
+		}
+		deployment.Integrations = append(deployment.Integrations, gragent.IntegrationsDeployment{
+			Instance: integration,
+		})
+	}
+
 	// Finally, find all referenced secrets
 	secrets, secretWatchers, err := buildSecrets(ctx, cli, deployment)
 	if err != nil {
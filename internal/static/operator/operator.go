@@ -4,8 +4,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -43,6 +45,10 @@ type Config struct {
 	AgentSelector       string
 	KubelsetServiceName string
 
+	// ChainNodeProbeInterval is how often the clients of EthereumNode and
+	// SubstrateNode resources are probed to refresh their status.
+	ChainNodeProbeInterval time.Duration
+
 	agentLabelSelector labels.Selector
 
 	// RestConfig used to connect to cluster. One will be generated based on the
@@ -85,6 +91,8 @@ func (c *Config) registerFlags(f *flag.FlagSet) error {
 
 	f.StringVar(&c.KubelsetServiceName, "kubelet-service", "", "Service and Endpoints objects to write kubelets into. Allows for monitoring Kubelet and cAdvisor metrics using a ServiceMonitor. Must be in format \"namespace/name\". If empty, nothing will be created.")
 
+	f.DurationVar(&c.ChainNodeProbeInterval, "chain-node-probe-interval", defaultChainNodeProbeInterval, "How often to probe the clients of EthereumNode and SubstrateNode resources to refresh their status.")
+
 	c.Controller.WebhookServer = webhook.NewServer(webhookServerOptions)
 
 	if namespace != "" {
@@ -208,6 +216,8 @@ func New(l log.Logger, c *Config) (*Operator, error) {
 		Watches(&gragent.PodLogs{}, notifierHandler).
 		Watches(&gragent.MetricsInstance{}, notifierHandler).
 		Watches(&gragent.Integration{}, notifierHandler).
+		Watches(&gragent.EthereumNode{}, notifierHandler).
+		Watches(&gragent.SubstrateNode{}, notifierHandler).
 		Watches(&promop_v1.PodMonitor{}, notifierHandler).
 		Watches(&promop_v1.Probe{}, notifierHandler).
 		Watches(&promop_v1.ServiceMonitor{}, notifierHandler).
@@ -225,6 +235,34 @@ func New(l log.Logger, c *Config) (*Operator, error) {
 		config:   c,
 	})
 
+	probeInterval := c.ChainNodeProbeInterval
+	if probeInterval <= 0 {
+		probeInterval = defaultChainNodeProbeInterval
+	}
+	probeClient := &http.Client{Timeout: chainNodeProbeTimeout}
+
+	err = controller.NewControllerManagedBy(manager).
+		For(&gragent.EthereumNode{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(&ethereumNodeReconciler{
+			Client:     manager.GetClient(),
+			httpClient: probeClient,
+			interval:   probeInterval,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EthereumNode controller: %w", err)
+	}
+
+	err = controller.NewControllerManagedBy(manager).
+		For(&gragent.SubstrateNode{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(&substrateNodeReconciler{
+			Client:     manager.GetClient(),
+			httpClient: probeClient,
+			interval:   probeInterval,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SubstrateNode controller: %w", err)
+	}
+
 	return &Operator{
 		log:     l,
 		manager: manager,
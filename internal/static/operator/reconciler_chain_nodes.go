@@ -0,0 +1,207 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	gragent "github.com/blockopsnetwork/telescope/internal/static/operator/apis/monitoring/v1alpha1"
+	"github.com/blockopsnetwork/telescope/internal/static/operator/logutil"
+	"github.com/go-kit/log/level"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	controller "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultChainNodeProbeInterval is how often the clients of chain nodes
+	// are probed to refresh their status.
+	defaultChainNodeProbeInterval = 30 * time.Second
+	// chainNodeProbeTimeout bounds a single probe of a chain node.
+	chainNodeProbeTimeout = 10 * time.Second
+)
+
+// ethereumNodeReconciler probes the clients of EthereumNodes and reports
+// their state in the status of the resource.
+type ethereumNodeReconciler struct {
+	client.Client
+	httpClient *http.Client
+	interval   time.Duration
+}
+
+func (r *ethereumNodeReconciler) Reconcile(ctx context.Context, req controller.Request) (controller.Result, error) {
+	l := logutil.FromContext(ctx)
+	level.Debug(l).Log("msg", "probing ethereum node")
+
+	var node gragent.EthereumNode
+	if err := r.Get(ctx, req.NamespacedName, &node); k8s_errors.IsNotFound(err) {
+		return controller.Result{}, nil
+	} else if err != nil {
+		return controller.Result{}, fmt.Errorf("unable to get ethereum node: %w", err)
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, chainNodeProbeTimeout)
+	defer cancel()
+
+	var snapshots []chainclient.Snapshot
+	if e := node.Spec.Execution; e != nil {
+		snapshots = append(snapshots, chainclient.ExecutionSnapshot(probeCtx, r.httpClient, e.URL))
+	}
+	if c := node.Spec.Consensus; c != nil {
+		snapshots = append(snapshots, chainclient.ConsensusSnapshot(probeCtx, r.httpClient, c.URL))
+	}
+
+	matchChain := func(s chainclient.Snapshot) bool {
+		expect, ok := chainclient.EthereumChainID(node.Spec.Chain)
+		if !ok {
+			return true
+		}
+		return s.ChainID == strconv.FormatUint(expect, 10)
+	}
+
+	setChainNodeStatus(&node.Status, node.Generation, node.Spec.Chain, snapshots, matchChain)
+	if err := r.Status().Update(ctx, &node); err != nil {
+		return controller.Result{}, fmt.Errorf("unable to update ethereum node status: %w", err)
+	}
+	return controller.Result{RequeueAfter: r.interval}, nil
+}
+
+// substrateNodeReconciler probes SubstrateNodes and reports their state in
+// the status of the resource.
+type substrateNodeReconciler struct {
+	client.Client
+	httpClient *http.Client
+	interval   time.Duration
+}
+
+func (r *substrateNodeReconciler) Reconcile(ctx context.Context, req controller.Request) (controller.Result, error) {
+	l := logutil.FromContext(ctx)
+	level.Debug(l).Log("msg", "probing substrate node")
+
+	var node gragent.SubstrateNode
+	if err := r.Get(ctx, req.NamespacedName, &node); k8s_errors.IsNotFound(err) {
+		return controller.Result{}, nil
+	} else if err != nil {
+		return controller.Result{}, fmt.Errorf("unable to get substrate node: %w", err)
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, chainNodeProbeTimeout)
+	defer cancel()
+
+	// The state of a Substrate node is only available from its RPC API.
+	var snapshots []chainclient.Snapshot
+	if node.Spec.RPCURL != "" {
+		snapshots = append(snapshots, chainclient.SubstrateSnapshot(probeCtx, r.httpClient, node.Spec.RPCURL))
+	}
+
+	matchChain := func(s chainclient.Snapshot) bool {
+		return strings.EqualFold(s.ChainID, node.Spec.Chain)
+	}
+
+	setChainNodeStatus(&node.Status, node.Generation, node.Spec.Chain, snapshots, matchChain)
+	if err := r.Status().Update(ctx, &node); err != nil {
+		return controller.Result{}, fmt.Errorf("unable to update substrate node status: %w", err)
+	}
+	return controller.Result{RequeueAfter: r.interval}, nil
+}
+
+// setChainNodeStatus updates status from the snapshots of a node's clients.
+// matchChain reports whether a client is on the expected chain; it is only
+// called when chain is set and the client reported its chain.
+func setChainNodeStatus(status *gragent.ChainNodeStatus, generation int64, chain string, snapshots []chainclient.Snapshot, matchChain func(chainclient.Snapshot) bool) {
+	now := meta_v1.Now()
+
+	status.ObservedGeneration = generation
+	status.Clients = make([]gragent.ChainClientStatus, 0, len(snapshots))
+
+	var unreachable, syncing, mismatched []string
+	for _, s := range snapshots {
+		status.Clients = append(status.Clients, gragent.ChainClientStatus{
+			Role:          s.Role,
+			Version:       s.ClientVersion,
+			Chain:         s.ChainID,
+			Syncing:       s.Syncing,
+			SyncDistance:  int64(s.SyncDistance),
+			HeadBlock:     int64(s.HeadBlock),
+			PeerCount:     int64(s.PeerCount),
+			Errors:        s.Errors,
+			LastProbeTime: now,
+		})
+
+		if len(s.Errors) > 0 {
+			unreachable = append(unreachable, s.Role)
+		}
+		if s.Syncing {
+			syncing = append(syncing, s.Role)
+		}
+		if chain != "" && s.ChainID != "" && !matchChain(s) {
+			mismatched = append(mismatched, fmt.Sprintf("%s is on chain %s", s.Role, s.ChainID))
+		}
+	}
+
+	if len(snapshots) == 0 {
+		for _, t := range []string{gragent.ChainNodeReachable, gragent.ChainNodeSynced, gragent.ChainNodeChainMatched} {
+			meta.SetStatusCondition(&status.Conditions, meta_v1.Condition{
+				Type:               t,
+				Status:             meta_v1.ConditionUnknown,
+				ObservedGeneration: generation,
+				Reason:             "NoClientAPI",
+				Message:            "no client API to probe is configured",
+			})
+		}
+		return
+	}
+
+	reachable := meta_v1.Condition{
+		Type:               gragent.ChainNodeReachable,
+		Status:             meta_v1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "ClientsResponded",
+		Message:            "all clients responded",
+	}
+	if len(unreachable) > 0 {
+		reachable.Status = meta_v1.ConditionFalse
+		reachable.Reason = "ClientErrors"
+		reachable.Message = fmt.Sprintf("clients returned errors: %s", strings.Join(unreachable, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, reachable)
+
+	synced := meta_v1.Condition{
+		Type:               gragent.ChainNodeSynced,
+		Status:             meta_v1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "ClientsSynced",
+		Message:            "all clients are synced",
+	}
+	if len(syncing) > 0 {
+		synced.Status = meta_v1.ConditionFalse
+		synced.Reason = "ClientsSyncing"
+		synced.Message = fmt.Sprintf("clients are syncing: %s", strings.Join(syncing, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, synced)
+
+	matched := meta_v1.Condition{
+		Type:               gragent.ChainNodeChainMatched,
+		Status:             meta_v1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "ChainMatched",
+		Message:            fmt.Sprintf("all clients are on chain %s", chain),
+	}
+	switch {
+	case chain == "":
+		matched.Status = meta_v1.ConditionUnknown
+		matched.Reason = "NoChain"
+		matched.Message = "no chain is declared in the spec"
+	case len(mismatched) > 0:
+		matched.Status = meta_v1.ConditionFalse
+		matched.Reason = "ChainMismatch"
+		matched.Message = fmt.Sprintf("expected chain %s: %s", chain, strings.Join(mismatched, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, matched)
+}
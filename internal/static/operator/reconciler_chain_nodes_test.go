@@ -0,0 +1,246 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	gragent "github.com/blockopsnetwork/telescope/internal/static/operator/apis/monitoring/v1alpha1"
+	"github.com/blockopsnetwork/telescope/internal/static/operator/logutil"
+	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	controller "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	clog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func Test_setChainNodeStatus(t *testing.T) {
+	matchChain := func(s chainclient.Snapshot) bool { return s.ChainID == "11155111" }
+
+	tt := []struct {
+		name      string
+		chain     string
+		snapshots []chainclient.Snapshot
+		expect    map[string]meta_v1.ConditionStatus
+	}{
+		{
+			name:  "healthy",
+			chain: "sepolia",
+			snapshots: []chainclient.Snapshot{
+				{Role: chainclient.RoleExecution, ChainID: "11155111"},
+				{Role: chainclient.RoleConsensus, ChainID: "11155111"},
+			},
+			expect: map[string]meta_v1.ConditionStatus{
+				gragent.ChainNodeReachable:    meta_v1.ConditionTrue,
+				gragent.ChainNodeSynced:       meta_v1.ConditionTrue,
+				gragent.ChainNodeChainMatched: meta_v1.ConditionTrue,
+			},
+		},
+		{
+			name:  "syncing on wrong chain",
+			chain: "sepolia",
+			snapshots: []chainclient.Snapshot{
+				{Role: chainclient.RoleExecution, ChainID: "1", Syncing: true},
+				{Role: chainclient.RoleConsensus, Errors: []string{"connection refused"}},
+			},
+			expect: map[string]meta_v1.ConditionStatus{
+				gragent.ChainNodeReachable:    meta_v1.ConditionFalse,
+				gragent.ChainNodeSynced:       meta_v1.ConditionFalse,
+				gragent.ChainNodeChainMatched: meta_v1.ConditionFalse,
+			},
+		},
+		{
+			name:      "no chain declared",
+			snapshots: []chainclient.Snapshot{{Role: chainclient.RoleExecution, ChainID: "1"}},
+			expect: map[string]meta_v1.ConditionStatus{
+				gragent.ChainNodeReachable:    meta_v1.ConditionTrue,
+				gragent.ChainNodeSynced:       meta_v1.ConditionTrue,
+				gragent.ChainNodeChainMatched: meta_v1.ConditionUnknown,
+			},
+		},
+		{
+			name:  "nothing to probe",
+			chain: "sepolia",
+			expect: map[string]meta_v1.ConditionStatus{
+				gragent.ChainNodeReachable:    meta_v1.ConditionUnknown,
+				gragent.ChainNodeSynced:       meta_v1.ConditionUnknown,
+				gragent.ChainNodeChainMatched: meta_v1.ConditionUnknown,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var status gragent.ChainNodeStatus
+			setChainNodeStatus(&status, 3, tc.chain, tc.snapshots, matchChain)
+
+			require.Equal(t, int64(3), status.ObservedGeneration)
+			require.Len(t, status.Clients, len(tc.snapshots))
+			for ty, expect := range tc.expect {
+				cond := meta.FindStatusCondition(status.Conditions, ty)
+				require.NotNil(t, cond, ty)
+				require.Equal(t, expect, cond.Status, ty)
+			}
+		})
+	}
+}
+
+func Test_ethereumNodeReconciler(t *testing.T) {
+	// The execution client is on sepolia, while the consensus client is
+	// syncing mainnet.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			data := map[string]interface{}{
+				"/eth/v1/node/version":            map[string]string{"version": "Lighthouse/v5.1.0"},
+				"/eth/v1/config/deposit_contract": map[string]string{"chain_id": "1"},
+				"/eth/v1/node/syncing":            map[string]interface{}{"head_slot": "200", "sync_distance": "10", "is_syncing": true},
+				"/eth/v1/node/peer_count":         map[string]string{"connected": "30"},
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data[r.URL.Path]})
+			return
+		}
+
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		results := map[string]interface{}{
+			"web3_clientVersion": "Geth/v1.13.14",
+			"eth_chainId":        "0xaa36a7",
+			"eth_syncing":        false,
+			"net_peerCount":      "0x19",
+			"eth_blockNumber":    "0x64",
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  results[req.Method],
+		})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, gragent.AddToScheme(scheme))
+
+	node := &gragent.EthereumNode{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "sepolia-0", Namespace: "eth", Generation: 2},
+		Spec: gragent.EthereumNodeSpec{
+			Chain:     "sepolia",
+			Execution: &gragent.EthereumExecutionSpec{URL: srv.URL},
+			Consensus: &gragent.EthereumConsensusSpec{URL: srv.URL},
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(node).
+		WithStatusSubresource(node).
+		Build()
+
+	ctx := clog.IntoContext(context.Background(), logutil.Wrap(util.TestLogger(t)))
+
+	r := &ethereumNodeReconciler{Client: cli, httpClient: srv.Client(), interval: time.Minute}
+	res, err := r.Reconcile(ctx, controller.Request{NamespacedName: client.ObjectKeyFromObject(node)})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, res.RequeueAfter)
+
+	var actual gragent.EthereumNode
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(node), &actual))
+	require.Equal(t, int64(2), actual.Status.ObservedGeneration)
+	require.Len(t, actual.Status.Clients, 2)
+
+	execution, consensus := actual.Status.Clients[0], actual.Status.Clients[1]
+	require.Equal(t, chainclient.RoleExecution, execution.Role)
+	require.Equal(t, "Geth/v1.13.14", execution.Version)
+	require.Equal(t, "11155111", execution.Chain)
+	require.Equal(t, int64(25), execution.PeerCount)
+	require.Equal(t, int64(100), execution.HeadBlock)
+	require.Empty(t, execution.Errors)
+
+	require.Equal(t, chainclient.RoleConsensus, consensus.Role)
+	require.Equal(t, "1", consensus.Chain)
+	require.True(t, consensus.Syncing)
+	require.Equal(t, int64(10), consensus.SyncDistance)
+	require.Equal(t, int64(30), consensus.PeerCount)
+	require.Empty(t, consensus.Errors)
+
+	require.True(t, meta.IsStatusConditionTrue(actual.Status.Conditions, gragent.ChainNodeReachable))
+	require.True(t, meta.IsStatusConditionFalse(actual.Status.Conditions, gragent.ChainNodeSynced))
+	mismatch := meta.FindStatusCondition(actual.Status.Conditions, gragent.ChainNodeChainMatched)
+	require.NotNil(t, mismatch)
+	require.Equal(t, meta_v1.ConditionFalse, mismatch.Status)
+	require.Equal(t, "expected chain sepolia: consensus is on chain 1", mismatch.Message)
+
+	// Deleted nodes are not requeued.
+	require.NoError(t, cli.Delete(ctx, node))
+	res, err = r.Reconcile(ctx, controller.Request{NamespacedName: client.ObjectKeyFromObject(node)})
+	require.NoError(t, err)
+	require.Equal(t, controller.Result{}, res)
+}
+
+func Test_substrateNodeReconciler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		results := map[string]interface{}{
+			"system_version":   "1.5.0",
+			"system_chain":     "Kusama",
+			"system_health":    map[string]interface{}{"peers": 12, "isSyncing": false},
+			"system_syncState": map[string]interface{}{"currentBlock": 100, "highestBlock": 100},
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  results[req.Method],
+		})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, gragent.AddToScheme(scheme))
+
+	node := &gragent.SubstrateNode{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "polkadot-0", Namespace: "dot", Generation: 1},
+		Spec: gragent.SubstrateNodeSpec{
+			Chain:      "Polkadot",
+			MetricsURL: srv.URL + "/metrics",
+			RPCURL:     srv.URL,
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(node).
+		WithStatusSubresource(node).
+		Build()
+
+	ctx := clog.IntoContext(context.Background(), logutil.Wrap(util.TestLogger(t)))
+
+	r := &substrateNodeReconciler{Client: cli, httpClient: srv.Client(), interval: time.Minute}
+	res, err := r.Reconcile(ctx, controller.Request{NamespacedName: client.ObjectKeyFromObject(node)})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, res.RequeueAfter)
+
+	var actual gragent.SubstrateNode
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(node), &actual))
+	require.Equal(t, int64(1), actual.Status.ObservedGeneration)
+	require.Len(t, actual.Status.Clients, 1)
+	require.Equal(t, "Kusama", actual.Status.Clients[0].Chain)
+	require.Equal(t, int64(12), actual.Status.Clients[0].PeerCount)
+
+	require.True(t, meta.IsStatusConditionTrue(actual.Status.Conditions, gragent.ChainNodeReachable))
+	require.True(t, meta.IsStatusConditionTrue(actual.Status.Conditions, gragent.ChainNodeSynced))
+	require.True(t, meta.IsStatusConditionFalse(actual.Status.Conditions, gragent.ChainNodeChainMatched))
+}
@@ -0,0 +1,116 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	gragent "github.com/blockopsnetwork/telescope/internal/static/operator/apis/monitoring/v1alpha1"
+	apiext_v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ethereumNodeIntegration converts an EthereumNode into the ethereum
+// integration which monitors it. The integration is run by the integrations
+// Deployment, as a node is monitored through its APIs rather than from the
+// host it runs on.
+func ethereumNodeIntegration(n *gragent.EthereumNode) (*gragent.Integration, error) {
+	if n.Spec.Execution == nil && n.Spec.Consensus == nil {
+		return nil, fmt.Errorf("at least one of execution or consensus must be set")
+	}
+
+	cfg := map[string]interface{}{
+		"instance": chainNodeInstance(&n.ObjectMeta),
+		"enabled":  true,
+	}
+	if n.Spec.Chain != "" {
+		cfg["chain"] = n.Spec.Chain
+	}
+	if n.Spec.ChainMismatch != "" {
+		cfg["chain_mismatch"] = n.Spec.ChainMismatch
+	}
+	if e := n.Spec.Execution; e != nil {
+		if e.URL == "" {
+			return nil, fmt.Errorf("execution url must not be empty")
+		}
+		execution := map[string]interface{}{"enabled": true, "url": e.URL}
+		if len(e.Modules) > 0 {
+			execution["modules"] = e.Modules
+		}
+		cfg["execution"] = execution
+	}
+	if c := n.Spec.Consensus; c != nil {
+		if c.URL == "" {
+			return nil, fmt.Errorf("consensus url must not be empty")
+		}
+		consensus := map[string]interface{}{"enabled": true, "url": c.URL}
+		if len(c.EventStreamTopics) > 0 {
+			consensus["event_stream"] = map[string]interface{}{
+				"enabled": true,
+				"topics":  c.EventStreamTopics,
+			}
+		}
+		cfg["consensus"] = consensus
+	}
+	setChainNodeAutoscrape(cfg, n.Spec.MetricsInstance)
+
+	return chainNodeIntegration(&n.ObjectMeta, "ethereumnode", "ethereum", cfg)
+}
+
+// substrateNodeIntegration converts a SubstrateNode into the substrate
+// integration which monitors it.
+func substrateNodeIntegration(n *gragent.SubstrateNode) (*gragent.Integration, error) {
+	if n.Spec.MetricsURL == "" {
+		return nil, fmt.Errorf("metricsURL must not be empty")
+	}
+
+	cfg := map[string]interface{}{
+		"instance":    chainNodeInstance(&n.ObjectMeta),
+		"metrics_url": n.Spec.MetricsURL,
+	}
+	if n.Spec.RPCURL != "" {
+		cfg["rpc_url"] = n.Spec.RPCURL
+	}
+	if n.Spec.Chain != "" {
+		cfg["chain"] = n.Spec.Chain
+	}
+	setChainNodeAutoscrape(cfg, n.Spec.MetricsInstance)
+
+	return chainNodeIntegration(&n.ObjectMeta, "substratenode", "substrate", cfg)
+}
+
+func chainNodeInstance(m *meta_v1.ObjectMeta) string {
+	return fmt.Sprintf("%s/%s", m.Namespace, m.Name)
+}
+
+func setChainNodeAutoscrape(cfg map[string]interface{}, metricsInstance string) {
+	if metricsInstance == "" {
+		return
+	}
+	cfg["autoscrape"] = map[string]interface{}{
+		"enable":           true,
+		"metrics_instance": metricsInstance,
+	}
+}
+
+// chainNodeIntegration builds the Integration for a chain node. The name is
+// prefixed with the kind of the node so it does not collide with an
+// Integration of the same name in the namespace.
+func chainNodeIntegration(m *meta_v1.ObjectMeta, kind, integration string, cfg map[string]interface{}) (*gragent.Integration, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s config: %w", integration, err)
+	}
+
+	return &gragent.Integration{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", kind, m.Name),
+			Namespace: m.Namespace,
+			Labels:    m.Labels,
+		},
+		Spec: gragent.IntegrationSpec{
+			Name:   integration,
+			Type:   gragent.IntegrationType{AllNodes: false},
+			Config: apiext_v1.JSON{Raw: raw},
+		},
+	}, nil
+}
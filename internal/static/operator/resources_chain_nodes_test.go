@@ -0,0 +1,98 @@
+package operator
+
+import (
+	"testing"
+
+	gragent "github.com/blockopsnetwork/telescope/internal/static/operator/apis/monitoring/v1alpha1"
+	"github.com/blockopsnetwork/telescope/internal/static/operator/config"
+	"github.com/blockopsnetwork/telescope/internal/util"
+	"github.com/blockopsnetwork/telescope/internal/util/subset"
+	"github.com/stretchr/testify/require"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_chainNodeIntegrations(t *testing.T) {
+	eth := &gragent.EthereumNode{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "geth-0", Namespace: "eth"},
+		Spec: gragent.EthereumNodeSpec{
+			Chain:         "sepolia",
+			ChainMismatch: "warn",
+			Execution:     &gragent.EthereumExecutionSpec{URL: "http://geth-0:8545"},
+			Consensus: &gragent.EthereumConsensusSpec{
+				URL:               "http://lighthouse-0:5052",
+				EventStreamTopics: []string{"head"},
+			},
+			MetricsInstance: "monitoring/primary",
+		},
+	}
+	dot := &gragent.SubstrateNode{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "polkadot-0", Namespace: "dot"},
+		Spec: gragent.SubstrateNodeSpec{
+			Chain:      "Polkadot",
+			MetricsURL: "http://polkadot-0:9615/metrics",
+			RPCURL:     "http://polkadot-0:9933",
+		},
+	}
+
+	ethIntegration, err := ethereumNodeIntegration(eth)
+	require.NoError(t, err)
+	require.Equal(t, "ethereumnode-geth-0", ethIntegration.Name)
+	require.False(t, ethIntegration.Spec.Type.AllNodes)
+
+	dotIntegration, err := substrateNodeIntegration(dot)
+	require.NoError(t, err)
+	require.Equal(t, "substratenode-polkadot-0", dotIntegration.Name)
+
+	d := gragent.Deployment{
+		Agent: &gragent.GrafanaAgent{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "test-agent", Namespace: "monitoring"},
+		},
+		Integrations: []gragent.IntegrationsDeployment{
+			{Instance: ethIntegration},
+			{Instance: dotIntegration},
+		},
+	}
+
+	expect := util.Untab(`
+	integrations:
+		ethereum_configs:
+		- instance: eth/geth-0
+			enabled: true
+			chain: sepolia
+			chain_mismatch: warn
+			execution:
+				enabled: true
+				url: http://geth-0:8545
+			consensus:
+				enabled: true
+				url: http://lighthouse-0:5052
+				event_stream:
+					enabled: true
+					topics: [head]
+			autoscrape:
+				enable: true
+				metrics_instance: monitoring/primary
+		substrate_configs:
+		- instance: dot/polkadot-0
+			chain: Polkadot
+			metrics_url: http://polkadot-0:9615/metrics
+			rpc_url: http://polkadot-0:9933
+	`)
+
+	result, err := config.BuildConfig(&d, config.IntegrationsType)
+	require.NoError(t, err)
+	require.NoError(t, subset.YAMLAssert([]byte(expect), []byte(result)), "incomplete yaml\n%s", result)
+}
+
+func Test_chainNodeIntegrations_Invalid(t *testing.T) {
+	_, err := ethereumNodeIntegration(&gragent.EthereumNode{})
+	require.EqualError(t, err, "at least one of execution or consensus must be set")
+
+	_, err = ethereumNodeIntegration(&gragent.EthereumNode{
+		Spec: gragent.EthereumNodeSpec{Execution: &gragent.EthereumExecutionSpec{}},
+	})
+	require.EqualError(t, err, "execution url must not be empty")
+
+	_, err = substrateNodeIntegration(&gragent.SubstrateNode{})
+	require.EqualError(t, err, "metricsURL must not be empty")
+}
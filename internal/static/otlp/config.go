@@ -0,0 +1,80 @@
+// Package otlp implements exporting the logs and metrics of static mode
+// instances to OTLP endpoints.
+package otlp
+
+import (
+	"fmt"
+	"time"
+
+	prom_config "github.com/prometheus/common/config"
+)
+
+// Supported protocols and compressions.
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+// DefaultConfig holds the default settings of an OTLP endpoint.
+var DefaultConfig = Config{
+	Protocol:    ProtocolGRPC,
+	Compression: CompressionGzip,
+	Timeout:     10 * time.Second,
+	BatchWait:   time.Second,
+	BatchSize:   1000,
+}
+
+// Config configures an OTLP endpoint receiving the data of an instance.
+type Config struct {
+	// Endpoint is host:port for gRPC, or the base URL for HTTP, where the
+	// /v1/logs and /v1/metrics paths are appended.
+	Endpoint    string                 `yaml:"endpoint"`
+	Protocol    string                 `yaml:"protocol,omitempty"`
+	Compression string                 `yaml:"compression,omitempty"`
+	Insecure    bool                   `yaml:"insecure,omitempty"`
+	TLSConfig   *prom_config.TLSConfig `yaml:"tls_config,omitempty"`
+	Headers     map[string]string      `yaml:"headers,omitempty"`
+	Timeout     time.Duration          `yaml:"timeout,omitempty"`
+
+	// ResourceAttributes are added to the resource of all the data sent.
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"`
+
+	// BatchWait and BatchSize bound how long and how many log entries are
+	// buffered before being sent. They aren't used for metrics, which are
+	// sent once per scrape.
+	BatchWait time.Duration `yaml:"batch_wait,omitempty"`
+	BatchSize int           `yaml:"batch_size,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate returns an error if c is invalid.
+func (c *Config) Validate() error {
+	switch {
+	case c.Endpoint == "":
+		return fmt.Errorf("otlp endpoint must be set")
+	case c.Protocol != ProtocolGRPC && c.Protocol != ProtocolHTTP:
+		return fmt.Errorf("unsupported otlp protocol %q, expected %q or %q", c.Protocol, ProtocolGRPC, ProtocolHTTP)
+	case c.Compression != CompressionGzip && c.Compression != CompressionNone:
+		return fmt.Errorf("unsupported otlp compression %q, expected %q or %q", c.Compression, CompressionGzip, CompressionNone)
+	case c.Timeout <= 0:
+		return fmt.Errorf("otlp timeout must be greater than 0")
+	case c.BatchWait <= 0:
+		return fmt.Errorf("otlp batch_wait must be greater than 0")
+	case c.BatchSize <= 0:
+		return fmt.Errorf("otlp batch_size must be greater than 0")
+	}
+	return nil
+}
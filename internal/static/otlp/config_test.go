@@ -0,0 +1,33 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig_Unmarshal(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`endpoint: otel-collector:4317`), &cfg))
+	expect := DefaultConfig
+	expect.Endpoint = "otel-collector:4317"
+	require.Equal(t, expect, cfg)
+
+	tt := []struct {
+		name string
+		cfg  string
+		err  string
+	}{
+		{"missing endpoint", `protocol: grpc`, "otlp endpoint must be set"},
+		{"invalid protocol", "endpoint: localhost:4317\nprotocol: thrift", `unsupported otlp protocol "thrift"`},
+		{"invalid compression", "endpoint: localhost:4317\ncompression: zstd", `unsupported otlp compression "zstd"`},
+		{"invalid batch size", "endpoint: localhost:4317\nbatch_size: 0", "otlp batch_size must be greater than 0"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg Config
+			require.ErrorContains(t, yaml.UnmarshalStrict([]byte(tc.cfg), &cfg), tc.err)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blockopsnetwork/telescope/internal/build"
+	"github.com/blockopsnetwork/telescope/internal/util/zapadapter"
+	"github.com/go-kit/log"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/consumer"
+	otelexporter "go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	otelreceiver "go.opentelemetry.io/collector/receiver"
+	metricNoop "go.opentelemetry.io/otel/metric/noop"
+	traceNoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// LogsExporter sends logs to an OTLP endpoint.
+type LogsExporter struct {
+	exp   otelexporter.Logs
+	attrs map[string]string
+}
+
+var _ consumer.Logs = (*LogsExporter)(nil)
+
+// NewLogsExporter creates and starts an exporter sending logs to the endpoint
+// of cfg. name identifies the exporter in its logs.
+func NewLogsExporter(l log.Logger, name string, cfg Config) (*LogsExporter, error) {
+	factory, expCfg := exporterConfig(cfg)
+	set := otelexporter.CreateSettings{
+		ID:                otelcomponent.NewIDWithName(factory.Type(), name),
+		TelemetrySettings: telemetrySettings(l),
+		BuildInfo:         buildInfo(),
+	}
+	exp, err := factory.CreateLogsExporter(context.Background(), set, expCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating otlp logs exporter: %w", err)
+	}
+	if err := exp.Start(context.Background(), &host{}); err != nil {
+		return nil, fmt.Errorf("starting otlp logs exporter: %w", err)
+	}
+	return &LogsExporter{exp: exp, attrs: cfg.ResourceAttributes}, nil
+}
+
+// Capabilities implements consumer.Logs.
+func (e *LogsExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+// ConsumeLogs implements consumer.Logs. The resource attributes of the
+// config are added to ld before it is sent.
+func (e *LogsExporter) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		putAttributes(rls.At(i).Resource().Attributes(), e.attrs)
+	}
+	return e.exp.ConsumeLogs(ctx, ld)
+}
+
+// Shutdown stops the exporter, waiting for queued logs to be sent until ctx
+// is canceled.
+func (e *LogsExporter) Shutdown(ctx context.Context) error {
+	return e.exp.Shutdown(ctx)
+}
+
+// MetricsExporter sends metrics to an OTLP endpoint.
+type MetricsExporter struct {
+	exp   otelexporter.Metrics
+	attrs map[string]string
+}
+
+var _ consumer.Metrics = (*MetricsExporter)(nil)
+
+// NewMetricsExporter creates and starts an exporter sending metrics to the
+// endpoint of cfg. name identifies the exporter in its logs.
+func NewMetricsExporter(l log.Logger, name string, cfg Config) (*MetricsExporter, error) {
+	factory, expCfg := exporterConfig(cfg)
+	set := otelexporter.CreateSettings{
+		ID:                otelcomponent.NewIDWithName(factory.Type(), name),
+		TelemetrySettings: telemetrySettings(l),
+		BuildInfo:         buildInfo(),
+	}
+	exp, err := factory.CreateMetricsExporter(context.Background(), set, expCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating otlp metrics exporter: %w", err)
+	}
+	if err := exp.Start(context.Background(), &host{}); err != nil {
+		return nil, fmt.Errorf("starting otlp metrics exporter: %w", err)
+	}
+	return &MetricsExporter{exp: exp, attrs: cfg.ResourceAttributes}, nil
+}
+
+// Capabilities implements consumer.Metrics.
+func (e *MetricsExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+// ConsumeMetrics implements consumer.Metrics. The resource attributes of the
+// config are added to md before it is sent.
+func (e *MetricsExporter) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		putAttributes(rms.At(i).Resource().Attributes(), e.attrs)
+	}
+	return e.exp.ConsumeMetrics(ctx, md)
+}
+
+// Shutdown stops the exporter, waiting for queued metrics to be sent until
+// ctx is canceled.
+func (e *MetricsExporter) Shutdown(ctx context.Context) error {
+	return e.exp.Shutdown(ctx)
+}
+
+// ReceiverSettings returns the settings of a receiver translating data for
+// an exporter. name identifies the receiver in its logs.
+func ReceiverSettings(l log.Logger, name string) otelreceiver.CreateSettings {
+	return otelreceiver.CreateSettings{
+		ID:                otelcomponent.NewIDWithName(otelcomponent.Type("prometheus"), name),
+		TelemetrySettings: telemetrySettings(l),
+		BuildInfo:         buildInfo(),
+	}
+}
+
+// exporterConfig returns the factory and config of the exporter for cfg.
+func exporterConfig(cfg Config) (otelexporter.Factory, otelcomponent.Config) {
+	headers := make(map[string]configopaque.String, len(cfg.Headers))
+	for k, v := range cfg.Headers {
+		headers[k] = configopaque.String(v)
+	}
+
+	tls := configtls.ClientConfig{Insecure: cfg.Insecure}
+	if cfg.TLSConfig != nil {
+		tls.CAFile = cfg.TLSConfig.CAFile
+		tls.CertFile = cfg.TLSConfig.CertFile
+		tls.KeyFile = cfg.TLSConfig.KeyFile
+		tls.InsecureSkipVerify = cfg.TLSConfig.InsecureSkipVerify
+		tls.ServerName = cfg.TLSConfig.ServerName
+	}
+
+	if cfg.Protocol == ProtocolHTTP {
+		factory := otlphttpexporter.NewFactory()
+		expCfg := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
+		expCfg.Endpoint = httpEndpoint(cfg.Endpoint, cfg.Insecure)
+		expCfg.Compression = configcompression.Type(cfg.Compression)
+		expCfg.TLSSetting = tls
+		expCfg.Headers = headers
+		expCfg.Timeout = cfg.Timeout
+		return factory, expCfg
+	}
+
+	factory := otlpexporter.NewFactory()
+	expCfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
+	expCfg.Endpoint = cfg.Endpoint
+	expCfg.Compression = configcompression.Type(cfg.Compression)
+	expCfg.TLSSetting = tls
+	expCfg.Headers = headers
+	expCfg.Timeout = cfg.Timeout
+	return factory, expCfg
+}
+
+// httpEndpoint adds the scheme to an endpoint without one, so that insecure
+// endpoints can be set the same way for both protocols.
+func httpEndpoint(endpoint string, insecure bool) string {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint
+	}
+	if insecure {
+		return "http://" + endpoint
+	}
+	return "https://" + endpoint
+}
+
+func putAttributes(dst pcommon.Map, attrs map[string]string) {
+	for k, v := range attrs {
+		dst.PutStr(k, v)
+	}
+}
+
+func telemetrySettings(l log.Logger) otelcomponent.TelemetrySettings {
+	return otelcomponent.TelemetrySettings{
+		Logger:         zapadapter.New(l),
+		TracerProvider: traceNoop.NewTracerProvider(),
+		MeterProvider:  metricNoop.NewMeterProvider(),
+		ReportStatus:   func(*otelcomponent.StatusEvent) {},
+	}
+}
+
+func buildInfo() otelcomponent.BuildInfo {
+	return otelcomponent.BuildInfo{
+		Command:     os.Args[0],
+		Description: "Grafana Agent",
+		Version:     build.Version,
+	}
+}
+
+// host implements otelcomponent.Host for exporters which don't use
+// extensions.
+type host struct{}
+
+var _ otelcomponent.Host = (*host)(nil)
+
+func (h *host) GetFactory(otelcomponent.Kind, otelcomponent.Type) otelcomponent.Factory {
+	return nil
+}
+
+func (h *host) GetExtensions() map[otelcomponent.ID]otelcomponent.Component {
+	return nil
+}
+
+func (h *host) GetExporters() map[otelcomponent.DataType]map[otelcomponent.ID]otelcomponent.Component {
+	return nil
+}
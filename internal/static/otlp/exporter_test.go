@@ -0,0 +1,44 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	prom_config "github.com/prometheus/common/config"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+)
+
+func TestExporterConfig(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Endpoint = "otel-collector:4317"
+	cfg.Insecure = true
+	cfg.Headers = map[string]string{"X-Scope-OrgID": "eth"}
+	cfg.Timeout = 5 * time.Second
+
+	_, expCfg := exporterConfig(cfg)
+	grpcCfg := expCfg.(*otlpexporter.Config)
+	require.Equal(t, "otel-collector:4317", grpcCfg.Endpoint)
+	require.Equal(t, configcompression.TypeGzip, grpcCfg.Compression)
+	require.True(t, grpcCfg.TLSSetting.Insecure)
+	require.Equal(t, "eth", string(grpcCfg.Headers["X-Scope-OrgID"]))
+	require.Equal(t, 5*time.Second, grpcCfg.Timeout)
+
+	// HTTP endpoints get a scheme matching the TLS settings.
+	cfg.Protocol = ProtocolHTTP
+	_, expCfg = exporterConfig(cfg)
+	require.Equal(t, "http://otel-collector:4317", expCfg.(*otlphttpexporter.Config).Endpoint)
+
+	cfg.Insecure = false
+	cfg.TLSConfig = &prom_config.TLSConfig{CAFile: "/etc/ssl/ca.pem"}
+	_, expCfg = exporterConfig(cfg)
+	httpCfg := expCfg.(*otlphttpexporter.Config)
+	require.Equal(t, "https://otel-collector:4317", httpCfg.Endpoint)
+	require.Equal(t, "/etc/ssl/ca.pem", httpCfg.TLSSetting.CAFile)
+
+	cfg.Endpoint = "http://otel-collector:4318"
+	_, expCfg = exporterConfig(cfg)
+	require.Equal(t, "http://otel-collector:4318", expCfg.(*otlphttpexporter.Config).Endpoint)
+}
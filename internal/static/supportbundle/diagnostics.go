@@ -0,0 +1,258 @@
+package supportbundle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/blockopsnetwork/telescope/internal/static/agentctl/waltools"
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"github.com/blockopsnetwork/telescope/internal/static/metrics/wal"
+	"gopkg.in/yaml.v3"
+)
+
+// maxWALTargets is the number of targets with the highest series count
+// included in the WAL statistics of a support bundle.
+const maxWALTargets = 10
+
+// Diagnostics holds Telescope-specific information about the chain clients,
+// WAL and remote endpoints an Agent is configured with.
+type Diagnostics struct {
+	config       []byte
+	nodes        []byte
+	walStats     []byte
+	connectivity []byte
+}
+
+// diagnosticsConfig is the subset of a Telescope config file needed to
+// collect diagnostics. It is intentionally loose so that both generated and
+// hand-written config files can be inspected without loading them fully.
+type diagnosticsConfig struct {
+	Metrics struct {
+		WALDirectory string `yaml:"wal_directory"`
+		Global       struct {
+			RemoteWrite []remoteEndpoint `yaml:"remote_write"`
+		} `yaml:"global"`
+		Configs []struct {
+			Name        string           `yaml:"name"`
+			RemoteWrite []remoteEndpoint `yaml:"remote_write"`
+		} `yaml:"configs"`
+	} `yaml:"metrics"`
+	Logs struct {
+		Configs []struct {
+			Name    string           `yaml:"name"`
+			Clients []remoteEndpoint `yaml:"clients"`
+		} `yaml:"configs"`
+	} `yaml:"logs"`
+	Integrations struct {
+		EthereumConfigs []struct {
+			Instance  string       `yaml:"instance"`
+			Execution nodeEndpoint `yaml:"execution"`
+			Consensus nodeEndpoint `yaml:"consensus"`
+		} `yaml:"ethereum_configs"`
+	} `yaml:"integrations"`
+}
+
+type remoteEndpoint struct {
+	URL       string `yaml:"url"`
+	BasicAuth *struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"basic_auth"`
+}
+
+type nodeEndpoint struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+}
+
+// NodeSnapshot is the snapshot of a single chain client endpoint.
+type NodeSnapshot struct {
+	Integration string `yaml:"integration"`
+	Instance    string `yaml:"instance,omitempty"`
+
+	chainclient.Snapshot `yaml:",inline"`
+}
+
+// ConnectivityResult is the result of checking whether a remote endpoint can
+// be reached.
+type ConnectivityResult struct {
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name,omitempty"`
+	URL        string `yaml:"url"`
+	StatusCode int    `yaml:"status_code,omitempty"`
+	Latency    string `yaml:"latency,omitempty"`
+	Error      string `yaml:"error,omitempty"`
+}
+
+// WALInstanceStats summarizes the WAL of a single metrics instance.
+type WALInstanceStats struct {
+	Instance         string                    `yaml:"instance"`
+	Directory        string                    `yaml:"directory"`
+	From             time.Time                 `yaml:"from,omitempty"`
+	To               time.Time                 `yaml:"to,omitempty"`
+	CheckpointNumber int                       `yaml:"checkpoint_number"`
+	FirstSegment     int                       `yaml:"first_segment"`
+	LastSegment      int                       `yaml:"last_segment"`
+	Series           int                       `yaml:"series"`
+	Samples          int                       `yaml:"samples"`
+	InvalidRefs      int                       `yaml:"invalid_refs"`
+	HashCollisions   int                       `yaml:"hash_collisions"`
+	TopTargets       []waltools.WALTargetStats `yaml:"top_targets,omitempty"`
+	Error            string                    `yaml:"error,omitempty"`
+}
+
+// CollectDiagnostics inspects the Telescope config file at configFile and
+// gathers a snapshot of each configured chain client, WAL statistics for
+// each metrics instance, and the reachability of every remote_write and
+// Loki endpoint. Failures of individual checks are recorded in the output
+// instead of failing the whole collection.
+func CollectDiagnostics(ctx context.Context, configFile string, client *http.Client) (*Diagnostics, error) {
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg diagnosticsConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	redacted, err := RedactConfig(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redact config file: %w", err)
+	}
+
+	var d Diagnostics
+	d.config = redacted
+	if d.nodes, err = yaml.Marshal(collectNodeSnapshots(ctx, client, &cfg)); err != nil {
+		return nil, fmt.Errorf("failed to marshal node snapshots: %w", err)
+	}
+	if d.walStats, err = yaml.Marshal(collectWALStats(&cfg)); err != nil {
+		return nil, fmt.Errorf("failed to marshal WAL stats: %w", err)
+	}
+	if d.connectivity, err = yaml.Marshal(checkConnectivity(ctx, client, &cfg)); err != nil {
+		return nil, fmt.Errorf("failed to marshal connectivity results: %w", err)
+	}
+	return &d, nil
+}
+
+func collectNodeSnapshots(ctx context.Context, client *http.Client, cfg *diagnosticsConfig) []NodeSnapshot {
+	var res []NodeSnapshot
+	for _, ec := range cfg.Integrations.EthereumConfigs {
+		if ec.Execution.Enabled && ec.Execution.URL != "" {
+			res = append(res, NodeSnapshot{
+				Integration: "ethereum",
+				Instance:    ec.Instance,
+				Snapshot:    chainclient.ExecutionSnapshot(ctx, client, ec.Execution.URL),
+			})
+		}
+		if ec.Consensus.Enabled && ec.Consensus.URL != "" {
+			res = append(res, NodeSnapshot{
+				Integration: "ethereum",
+				Instance:    ec.Instance,
+				Snapshot:    chainclient.ConsensusSnapshot(ctx, client, ec.Consensus.URL),
+			})
+		}
+	}
+	return res
+}
+
+func collectWALStats(cfg *diagnosticsConfig) []WALInstanceStats {
+	if cfg.Metrics.WALDirectory == "" {
+		return nil
+	}
+
+	res := make([]WALInstanceStats, 0, len(cfg.Metrics.Configs))
+	for _, ic := range cfg.Metrics.Configs {
+		dir := wal.SubDirectory(filepath.Join(cfg.Metrics.WALDirectory, ic.Name))
+		s := WALInstanceStats{Instance: ic.Name, Directory: dir}
+
+		if _, err := os.Stat(dir); err != nil {
+			s.Error = err.Error()
+			res = append(res, s)
+			continue
+		}
+		stats, err := waltools.CalculateStats(dir)
+		if err != nil {
+			s.Error = err.Error()
+			res = append(res, s)
+			continue
+		}
+
+		sort.Sort(waltools.BySeriesCount(stats.Targets))
+		if len(stats.Targets) > maxWALTargets {
+			stats.Targets = stats.Targets[:maxWALTargets]
+		}
+
+		s.From = stats.From
+		s.To = stats.To
+		s.CheckpointNumber = stats.CheckpointNumber
+		s.FirstSegment = stats.FirstSegment
+		s.LastSegment = stats.LastSegment
+		s.Series = stats.Series()
+		s.Samples = stats.Samples()
+		s.InvalidRefs = stats.InvalidRefs
+		s.HashCollisions = stats.HashCollisions
+		s.TopTargets = stats.Targets
+		res = append(res, s)
+	}
+	return res
+}
+
+func checkConnectivity(ctx context.Context, client *http.Client, cfg *diagnosticsConfig) []ConnectivityResult {
+	var res []ConnectivityResult
+	for _, rw := range cfg.Metrics.Global.RemoteWrite {
+		res = append(res, checkEndpoint(ctx, client, "remote_write", "global", rw))
+	}
+	for _, ic := range cfg.Metrics.Configs {
+		for _, rw := range ic.RemoteWrite {
+			res = append(res, checkEndpoint(ctx, client, "remote_write", ic.Name, rw))
+		}
+	}
+	for _, lc := range cfg.Logs.Configs {
+		for _, c := range lc.Clients {
+			res = append(res, checkEndpoint(ctx, client, "loki", lc.Name, c))
+		}
+	}
+	return res
+}
+
+// checkEndpoint sends a GET request to the endpoint. Any HTTP response,
+// including 4xx responses from write-only endpoints, means the endpoint is
+// reachable; the status code is kept so that authentication problems are
+// visible.
+func checkEndpoint(ctx context.Context, client *http.Client, kind, name string, ep remoteEndpoint) ConnectivityResult {
+	res := ConnectivityResult{
+		Kind: kind,
+		Name: name,
+		URL:  chainclient.RedactURL(ep.URL),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.URL, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if ep.BasicAuth != nil {
+		req.SetBasicAuth(ep.BasicAuth.Username, ep.BasicAuth.Password)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	res.Latency = time.Since(start).String()
+	return res
+}
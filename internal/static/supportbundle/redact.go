@@ -0,0 +1,84 @@
+package supportbundle
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/blockopsnetwork/telescope/internal/static/chainclient"
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "<redacted>"
+
+// secretKeys are config keys whose values are always redacted. Keys ending
+// in _file hold paths rather than secrets and are kept.
+var secretKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"authorization",
+	"credentials",
+	"private_key",
+	"access_key",
+}
+
+// RedactConfig returns a copy of the YAML document raw with secret values
+// removed. Values of secret-looking keys are replaced, and credentials
+// embedded in URLs are masked.
+func RedactConfig(raw []byte) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	redactNode(&root)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func redactNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			redactNode(c)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			if val.Kind == yaml.ScalarNode && val.Value != "" && isSecretKey(key.Value) {
+				val.Value = redactedValue
+				val.Tag = "!!str"
+				val.Style = 0
+				continue
+			}
+			redactNode(val)
+		}
+	case yaml.ScalarNode:
+		if strings.Contains(n.Value, "://") {
+			n.Value = chainclient.RedactURL(n.Value)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "_file") {
+		return false
+	}
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
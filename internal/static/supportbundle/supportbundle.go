@@ -34,6 +34,7 @@ type Bundle struct {
 	blockBuf              *bytes.Buffer
 	mutexBuf              *bytes.Buffer
 	cpuBuf                *bytes.Buffer
+	diagnostics           *Diagnostics
 }
 
 // Metadata contains general runtime information about the current Agent.
@@ -48,8 +49,9 @@ type Metadata struct {
 // Used to enforce single-flight requests to Export
 var mut sync.Mutex
 
-// Export gathers the information required for the support bundle.
-func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddress string, dialContext server.DialContextFunc) (*Bundle, error) {
+// Export gathers the information required for the support bundle. diag may
+// be nil if Telescope diagnostics could not be collected.
+func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddress string, dialContext server.DialContextFunc, diag *Diagnostics) (*Bundle, error) {
 	mut.Lock()
 	defer mut.Unlock()
 	// The block profiler is disabled by default. Temporarily enable recording
@@ -62,22 +64,10 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		runtime.SetMutexProfileFraction(old)
 	}()
 
-	// Gather runtime metadata.
-	ut, err := uptime.Get()
+	meta, err := marshalMetadata(enabledFeatures)
 	if err != nil {
 		return nil, err
 	}
-	m := Metadata{
-		BuildVersion: build.Version,
-		OS:           runtime.GOOS,
-		Architecture: runtime.GOARCH,
-		Uptime:       ut.Seconds(),
-		Payload:      map[string]interface{}{"enabled-features": enabledFeatures},
-	}
-	meta, err := yaml.Marshal(m)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal support bundle metadata: %s", err)
-	}
 
 	var httpClient http.Client
 	httpClient.Transport = &http.Transport{DialContext: dialContext}
@@ -178,17 +168,54 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		blockBuf:              &blockBuf,
 		mutexBuf:              &mutexBuf,
 		cpuBuf:                &cpuBuf,
+		diagnostics:           diag,
 	}
 
 	return bundle, nil
 }
 
+// ExportDiagnostics creates a support bundle which only holds runtime
+// metadata and Telescope diagnostics. It is used when the Agent itself is not
+// running and its internal state cannot be collected.
+func ExportDiagnostics(diag *Diagnostics) (*Bundle, error) {
+	meta, err := marshalMetadata(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{meta: meta, diagnostics: diag}, nil
+}
+
+func marshalMetadata(enabledFeatures []string) ([]byte, error) {
+	ut, err := uptime.Get()
+	if err != nil {
+		return nil, err
+	}
+	m := Metadata{
+		BuildVersion: build.Version,
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+		Uptime:       ut.Seconds(),
+		Payload:      map[string]interface{}{"enabled-features": enabledFeatures},
+	}
+	meta, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal support bundle metadata: %s", err)
+	}
+	return meta, nil
+}
+
 // Serve the collected data and logs as a zip file over the given
 // http.ResponseWriter.
 func Serve(rw http.ResponseWriter, b *Bundle, logsBuf *bytes.Buffer) error {
-	zw := zip.NewWriter(rw)
 	rw.Header().Set("Content-Type", "application/zip")
 	rw.Header().Set("Content-Disposition", "attachment; filename=\"agent-support-bundle.zip\"")
+	return Write(rw, b, logsBuf)
+}
+
+// Write writes the collected data and logs as a zip file to w. logsBuf may be
+// nil.
+func Write(w io.Writer, b *Bundle, logsBuf *bytes.Buffer) error {
+	zw := zip.NewWriter(w)
 
 	zipStructure := map[string][]byte{
 		"agent-metadata.yaml":          b.meta,
@@ -198,12 +225,18 @@ func Serve(rw http.ResponseWriter, b *Bundle, logsBuf *bytes.Buffer) error {
 		"agent-metrics-targets.json":   b.agentMetricsTargets,
 		"agent-logs-instances.json":    b.agentLogsInstances,
 		"agent-logs-targets.json":      b.agentLogsTargets,
-		"agent-logs.txt":               logsBuf.Bytes(),
-		"pprof/cpu.pprof":              b.cpuBuf.Bytes(),
-		"pprof/heap.pprof":             b.heapBuf.Bytes(),
-		"pprof/goroutine.pprof":        b.goroutineBuf.Bytes(),
-		"pprof/mutex.pprof":            b.mutexBuf.Bytes(),
-		"pprof/block.pprof":            b.blockBuf.Bytes(),
+		"agent-logs.txt":               bufferBytes(logsBuf),
+		"pprof/cpu.pprof":              bufferBytes(b.cpuBuf),
+		"pprof/heap.pprof":             bufferBytes(b.heapBuf),
+		"pprof/goroutine.pprof":        bufferBytes(b.goroutineBuf),
+		"pprof/mutex.pprof":            bufferBytes(b.mutexBuf),
+		"pprof/block.pprof":            bufferBytes(b.blockBuf),
+	}
+	if d := b.diagnostics; d != nil {
+		zipStructure["telescope/telescope_config.yaml"] = d.config
+		zipStructure["telescope/nodes.yaml"] = d.nodes
+		zipStructure["telescope/wal-stats.yaml"] = d.walStats
+		zipStructure["telescope/connectivity.yaml"] = d.connectivity
 	}
 
 	for fn, b := range zipStructure {
@@ -222,6 +255,13 @@ func Serve(rw http.ResponseWriter, b *Bundle, logsBuf *bytes.Buffer) error {
 	return nil
 }
 
+func bufferBytes(b *bytes.Buffer) []byte {
+	if b == nil {
+		return nil
+	}
+	return b.Bytes()
+}
+
 func writeByteSlice(zw *zip.Writer, b []byte, fn ...string) error {
 	f, err := zw.Create(filepath.Join(fn...))
 	if err != nil {